@@ -1,6 +1,8 @@
 package main
 
 import (
+	"bufio"
+	"context"
 	"crypto/rand"
 	"encoding/hex"
 	"encoding/json"
@@ -9,10 +11,13 @@ import (
 	"log"
 	"os"
 	"os/exec"
+	"os/signal"
 	"path/filepath"
 	"strings"
+	"syscall"
 	"time"
 
+	"github.com/fatih/color"
 	"github.com/gotk3/gotk3/gdk"
 	"github.com/gotk3/gotk3/glib"
 	"github.com/gotk3/gotk3/gtk"
@@ -23,6 +28,9 @@ const (
 	appTitle  = "TextCleaner"
 	appWidth  = 1200
 	appHeight = 700
+
+	// authTokenEnv is the environment variable providing the default --auth-token
+	authTokenEnv = "TEXTCLEANER_AUTH_TOKEN"
 )
 
 type TextCleaner struct {
@@ -62,29 +70,111 @@ func main() {
 	repl := flag.Bool("repl", false, "Run REPL mode (requires --socket)")
 	logJSON := flag.Bool("log-json", false, "Log raw JSON commands in headless mode")
 	logCommands := flag.Bool("log-commands", false, "Log formatted commands in headless mode")
+	tcpAddr := flag.String("tcp", "", "Use a TCP address instead of a Unix socket for --headless or --repl (e.g., 127.0.0.1:7777). Unencrypted: only use on trusted networks")
+	authToken := flag.String("auth-token", os.Getenv(authTokenEnv), "Shared token clients must send before other commands (default from $"+authTokenEnv+")")
+	httpAddr := flag.String("http", "", "Serve the command API over HTTP at this address (e.g., 127.0.0.1:8080)")
+	keepalive := flag.Duration("keepalive", 0, "Send keepalive events to idle subscribed connections at this interval in headless mode (e.g., 30s)")
+	execTimeout := flag.Duration("exec-timeout", 0, "Abort a command when running the pipeline takes longer than this (e.g., 10s, default no limit)")
+	maxOutput := flag.Int("max-output", 0, "Abort a command when a node's output is larger than this many bytes (default no limit)")
+	script := flag.String("script", "", "Run the REPL commands in this file against the server given by --socket or --tcp, then exit")
+	continueOnError := flag.Bool("continue-on-error", false, "Keep running a --script after a command fails")
+	noHistory := flag.Bool("no-history", false, "Don't load or save REPL history (kept in $XDG_DATA_HOME/textcleaner/history)")
+	noColor := flag.Bool("no-color", false, "Don't use colors in REPL and script output (also set by $NO_COLOR)")
+	watch := flag.String("watch", "", "Run this file through the pipeline and print the output again each time the file changes")
+	pipelineFile := flag.String("pipeline", "", "Pipeline JSON file (as written by export) to use with --watch or --pipe, instead of the server's pipeline")
+	pipe := flag.Bool("pipe", false, "Run stdin through the --pipeline file and write the output to stdout, streaming line by line when the pipeline allows it")
 	flag.Parse()
 
+	if *noColor {
+		color.NoColor = true
+	}
+
 	// Create the headless core
 	core := NewTextCleanerCore()
+	core.SetExecutionTimeout(*execTimeout)
+	core.SetMaxOutputSize(*maxOutput)
+
+	if *tcpAddr != "" && *socketPath != "" {
+		log.Fatalf("Error: --tcp and --socket cannot be used together\n")
+	}
+
+	// Serve only the HTTP gateway; with --headless it runs alongside the socket server below
+	if *httpAddr != "" && !*headless {
+		if *tcpAddr != "" || *socketPath != "" {
+			log.Fatalf("Error: --http with --socket or --tcp requires --headless to serve both\n")
+		}
+		runHTTPGateway(core, nil, *httpAddr, *authToken)
+		return
+	}
 
 	// If headless mode with socket, start server and exit
 	if *headless {
+		var server *SocketServer
+		address := *socketPath
+		if *tcpAddr != "" {
+			address = *tcpAddr
+			server = NewTCPSocketServer(address, core)
+		} else {
+			if *socketPath == "" {
+				log.Fatalf("Error: --headless requires --socket (or --tcp) to specify socket path\n")
+			}
+			server = NewSocketServer(address, core)
+		}
+		server.SetAuthToken(*authToken)
+		server.SetKeepaliveInterval(*keepalive)
+		if *httpAddr != "" {
+			go runHTTPGateway(core, server, *httpAddr, *authToken)
+		}
+		runHeadlessServer(server, address, *logJSON, *logCommands)
+		return
+	}
+
+	// If a script is given, run it like the REPL would and exit
+	if *script != "" {
+		if *tcpAddr != "" {
+			runScriptMode(NewTCPREPLSession, *tcpAddr, *authToken, *script, *continueOnError)
+			return
+		}
 		if *socketPath == "" {
-			log.Fatalf("Error: --headless requires --socket to specify socket path\n")
+			log.Fatalf("Error: --script requires --socket (or --tcp) to specify socket path\n")
 		}
-		runHeadlessServer(*socketPath, core, *logJSON, *logCommands)
+		runScriptMode(NewREPLSession, *socketPath, *authToken, *script, *continueOnError)
+		return
+	}
+
+	// If used as a filter, process stdin once and exit
+	if *pipe {
+		runPipeMode(core, *pipelineFile)
+		return
+	}
+
+	// If a file is watched, keep reprocessing it until interrupted
+	if *watch != "" {
+		connect, address := NewREPLSession, *socketPath
+		if *tcpAddr != "" {
+			connect, address = NewTCPREPLSession, *tcpAddr
+		}
+		runWatchMode(core, *watch, *pipelineFile, connect, address, *authToken)
 		return
 	}
 
 	// If REPL mode, start REPL and exit
 	if *repl {
+		if *tcpAddr != "" {
+			runREPLMode(NewTCPREPLSession, *tcpAddr, *authToken, !*noHistory)
+			return
+		}
 		if *socketPath == "" {
-			log.Fatalf("Error: --repl requires --socket to specify socket path\n")
+			log.Fatalf("Error: --repl requires --socket (or --tcp) to specify socket path\n")
 		}
-		runREPLMode(*socketPath)
+		runREPLMode(NewREPLSession, *socketPath, *authToken, !*noHistory)
 		return
 	}
 
+	if *tcpAddr != "" {
+		log.Fatalf("Error: --tcp is only supported with --headless, --repl, --script or --watch\n")
+	}
+
 	// Otherwise, run GUI mode
 	// Use default socket path if not specified
 	if *socketPath == "" {
@@ -101,7 +191,7 @@ func main() {
 	if err != nil {
 		// No existing server, start headless server as child process
 		fmt.Printf("Starting headless socket server at %s...\n", *socketPath)
-		headlessProc, err = startHeadlessChildProcess(*socketPath)
+		headlessProc, err = startHeadlessChildProcess(*socketPath, *authToken)
 		if err != nil {
 			log.Fatalf("Error: Failed to start headless socket server: %v\n", err)
 		}
@@ -114,6 +204,15 @@ func main() {
 		}
 	}
 
+	if *authToken != "" {
+		if err := socketClient.Authenticate(*authToken); err != nil {
+			if headlessProc != nil {
+				headlessProc.Kill()
+			}
+			log.Fatalf("Error: %v\n", err)
+		}
+	}
+
 	// Successfully connected to socket server
 	commands := NewSocketClientCommands(socketClient)
 	if err := loadStateFromSocket(core, socketClient); err != nil {
@@ -163,9 +262,7 @@ func main() {
 }
 
 // runHeadlessServer starts a socket server without GUI
-func runHeadlessServer(socketPath string, core *TextCleanerCore, logJSON bool, logCommands bool) {
-	server := NewSocketServer(socketPath, core)
-
+func runHeadlessServer(server *SocketServer, socketPath string, logJSON bool, logCommands bool) {
 	// Enable logging if requested
 	server.SetLogJSON(logJSON)
 	server.SetLogCommands(logCommands)
@@ -175,6 +272,12 @@ func runHeadlessServer(socketPath string, core *TextCleanerCore, logJSON bool, l
 	}
 
 	fmt.Printf("TextCleaner headless server listening on %s\n", socketPath)
+	if server.network == "tcp" {
+		fmt.Println("Warning: the TCP listener is unencrypted and accepts any client that can reach it")
+	}
+	if server.authToken != "" {
+		fmt.Println("Token authentication: enabled")
+	}
 	if logJSON {
 		fmt.Println("JSON command logging: enabled")
 	}
@@ -188,18 +291,135 @@ func runHeadlessServer(socketPath string, core *TextCleanerCore, logJSON bool, l
 	fmt.Println("Server stopped")
 }
 
+// runHTTPGateway serves the command API over HTTP until the server fails
+// With a socket server, changes made over HTTP are pushed to its subscribers
+func runHTTPGateway(core *TextCleanerCore, server *SocketServer, addr string, authToken string) {
+	gateway := NewHTTPGateway(core)
+	gateway.SetAuthToken(authToken)
+	if server != nil {
+		gateway.SetSocketServer(server)
+	}
+
+	fmt.Printf("TextCleaner HTTP gateway listening on http://%s (POST /command, GET /pipeline, GET /output)\n", addr)
+	if authToken == "" {
+		fmt.Println("Warning: the HTTP gateway is unauthenticated; use --auth-token outside trusted networks")
+	}
+
+	if err := gateway.ListenAndServe(addr); err != nil {
+		log.Fatalf("HTTP gateway error: %v\n", err)
+	}
+}
+
 // runREPLMode starts a REPL session connected to a socket server
-func runREPLMode(socketPath string) {
-	session, err := NewREPLSession(socketPath)
+func runREPLMode(connect func(address string) (*REPLSession, error), socketPath string, authToken string, keepHistory bool) {
+	session, err := connect(socketPath)
 	if err != nil {
 		log.Fatalf("Error: Failed to connect to socket server: %v\n", err)
 	}
 
+	if keepHistory {
+		session.SetHistoryFile(replHistoryPath())
+	}
+
+	if authToken != "" {
+		if err := session.client.Authenticate(authToken); err != nil {
+			log.Fatalf("Error: %v\n", err)
+		}
+	}
+
 	if err := session.Run(); err != nil {
 		log.Fatalf("Error: REPL error: %v\n", err)
 	}
 }
 
+// runScriptMode connects to a socket server and runs a file of REPL commands
+// Exits with status 1 if the script fails
+func runScriptMode(connect func(address string) (*REPLSession, error), socketPath, authToken, scriptPath string, continueOnError bool) {
+	session, err := connect(socketPath)
+	if err != nil {
+		log.Fatalf("Error: Failed to connect to socket server: %v\n", err)
+	}
+
+	if authToken != "" {
+		if err := session.client.Authenticate(authToken); err != nil {
+			log.Fatalf("Error: %v\n", err)
+		}
+	}
+
+	if err := session.RunScript(scriptPath, continueOnError); err != nil {
+		log.Fatalf("Error: %v\n", err)
+	}
+}
+
+// runWatchMode prints the output for watchPath each time it changes, using the pipeline from
+// pipelinePath or, without one, a copy of the pipeline on the server at address
+func runWatchMode(core *TextCleanerCore, watchPath, pipelinePath string, connect func(address string) (*REPLSession, error), address, authToken string) {
+	switch {
+	case pipelinePath != "":
+		data, err := os.ReadFile(pipelinePath)
+		if err != nil {
+			log.Fatalf("Error: %v\n", err)
+		}
+		if err := core.ImportPipeline(string(data)); err != nil {
+			log.Fatalf("Error: Failed to load pipeline: %v\n", err)
+		}
+	case address != "":
+		session, err := connect(address)
+		if err != nil {
+			log.Fatalf("Error: Failed to connect to socket server: %v\n", err)
+		}
+		if authToken != "" {
+			if err := session.client.Authenticate(authToken); err != nil {
+				log.Fatalf("Error: %v\n", err)
+			}
+		}
+		err = loadStateFromSocket(core, session.client)
+		session.client.Close()
+		if err != nil {
+			log.Fatalf("Error: Failed to load pipeline from server: %v\n", err)
+		}
+	default:
+		log.Fatalf("Error: --watch requires --pipeline, or --socket (or --tcp) to copy the pipeline from a server\n")
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	watcher := NewFileWatcher(core, watchPath)
+	fmt.Fprintf(os.Stderr, "Watching %s, press Ctrl+C to stop\n", watchPath)
+	watcher.Run(ctx, watcher.Changes(ctx), func(output string, err error) {
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			return
+		}
+		fmt.Fprintf(os.Stderr, "--- %s processed at %s ---\n", watchPath, time.Now().Format("15:04:05"))
+		fmt.Println(output)
+	})
+}
+
+// runPipeMode runs stdin through a pipeline file and writes the output to stdout
+func runPipeMode(core *TextCleanerCore, pipelinePath string) {
+	if pipelinePath == "" {
+		log.Fatalf("Error: --pipe requires --pipeline\n")
+	}
+	data, err := os.ReadFile(pipelinePath)
+	if err != nil {
+		log.Fatalf("Error: %v\n", err)
+	}
+	if err := core.ImportPipeline(string(data)); err != nil {
+		log.Fatalf("Error: Failed to load pipeline: %v\n", err)
+	}
+
+	out := bufio.NewWriter(os.Stdout)
+	err = core.ProcessStream(os.Stdin, out)
+	if flushErr := out.Flush(); err == nil {
+		err = flushErr
+	}
+	if err != nil {
+		log.Fatalf("Error: %v\n", err)
+	}
+}
+
 // loadStateFromSocket loads the current state from a socket server via an existing client
 func loadStateFromSocket(core *TextCleanerCore, client *SocketClient) error {
 
@@ -340,6 +560,8 @@ func (tc *TextCleaner) createNodeControls() *gtk.Box {
 	nodeTypeCombo.AppendText("If (Conditional)")
 	nodeTypeCombo.AppendText("ForEachLine")
 	nodeTypeCombo.AppendText("Group")
+	nodeTypeCombo.AppendText("Capture")
+	nodeTypeCombo.AppendText("Subroutine")
 	nodeTypeCombo.SetActive(0)
 	typeRow.PackStart(nodeTypeCombo, true, true, 0)
 	controlsBox.PackStart(typeRow, false, false, 0)
@@ -1082,14 +1304,19 @@ func (tc *TextCleaner) updateNodeTypeUI() {
 		tc.conditionEntry.ShowAll()
 	case "ForEachLine":
 		tc.operationCombo.Hide()
-		tc.argument1.Hide()
-		tc.argument2.Hide()
+		tc.argument1.ShowAll()
+		tc.argument2.ShowAll()
 		tc.conditionEntry.Hide()
 	case "Group":
 		tc.operationCombo.Hide()
 		tc.argument1.Hide()
 		tc.argument2.Hide()
 		tc.conditionEntry.Hide()
+	case "Capture", "Subroutine":
+		tc.operationCombo.Hide()
+		tc.argument1.ShowAll()
+		tc.argument2.Hide()
+		tc.conditionEntry.Hide()
 	}
 }
 
@@ -1196,6 +1423,10 @@ func (tc *TextCleaner) loadNodeToUI(node *PipelineNode) {
 		tc.nodeTypeCombo.SetActive(2)
 	case "group":
 		tc.nodeTypeCombo.SetActive(3)
+	case "capture":
+		tc.nodeTypeCombo.SetActive(4)
+	case "subroutine":
+		tc.nodeTypeCombo.SetActive(5)
 	}
 
 	tc.nodeNameEntry.SetText(node.Name)
@@ -1226,6 +1457,10 @@ func (tc *TextCleaner) createNewNode() {
 		nodeName = "ForEach"
 	} else if nodeType == "Group" {
 		nodeName = "Group"
+	} else if nodeType == "Capture" {
+		nodeName = "Capture"
+	} else if nodeType == "Subroutine" {
+		nodeName = "Subroutine"
 	}
 
 	// Convert UI node type to core node type
@@ -1277,6 +1512,16 @@ func (tc *TextCleaner) updateSelectedNode() {
 		arg2, _ = tc.argument2.GetText()
 	} else if nodeType == "If (Conditional)" {
 		condition, _ = tc.conditionEntry.GetText()
+	} else if nodeType == "ForEachLine" {
+		// arg1 holds the record separator (empty means lines), arg2 may be "parallel"
+		arg1, _ = tc.argument1.GetText()
+		arg2, _ = tc.argument2.GetText()
+	} else if nodeType == "Capture" {
+		// arg1 holds the variable name that ${var:name} refers to
+		arg1, _ = tc.argument1.GetText()
+	} else if nodeType == "Subroutine" {
+		// arg1 holds the name of the preset to run
+		arg1, _ = tc.argument1.GetText()
 	}
 
 	selectedID := tc.commands.GetSelectedNodeID()
@@ -1284,6 +1529,7 @@ func (tc *TextCleaner) updateSelectedNode() {
 	// Update node via commands interface (works with both local core and socket wrapper)
 	err := tc.commands.UpdateNode(
 		selectedID,
+		tc.changedNodeType(selectedID, nodeType),
 		nodeName,
 		operation,
 		arg1,
@@ -1332,6 +1578,7 @@ func (tc *TextCleaner) updateNodeFromUIFields() {
 	// Update node via commands interface (works with both local core and socket wrapper)
 	err := tc.commands.UpdateNode(
 		selectedID,
+		tc.changedNodeType(selectedID, nodeType),
 		nodeName,
 		operation,
 		arg1,
@@ -1691,13 +1938,34 @@ func (tc *TextCleaner) getNodeDisplayText(node *PipelineNode) string {
 		text = fmt.Sprintf("[LOOP] %s", node.Name)
 	case "group":
 		text = fmt.Sprintf("[GROUP] %s", node.Name)
+	case "capture":
+		text = fmt.Sprintf("[CAPTURE] %s", node.Name)
+	case "subroutine":
+		text = fmt.Sprintf("[SUB] %s", node.Name)
 	default:
 		text = node.Name
 	}
 
+	if node.LineBased {
+		text += " [per line]"
+	}
+	if node.Disabled {
+		text += " [disabled]"
+	}
+
 	return text
 }
 
+// changedNodeType returns the node type picked in the combo, or "" when it is the node's
+// current type, so editing a field never converts a node by accident
+func (tc *TextCleaner) changedNodeType(nodeID, nodeTypeText string) string {
+	node := tc.commands.GetNode(nodeID)
+	if node != nil && tc.getNodeTypeFromUI(nodeTypeText) == node.Type {
+		return ""
+	}
+	return nodeTypeText
+}
+
 func (tc *TextCleaner) getNodeTypeFromUI(nodeTypeText string) string {
 	switch nodeTypeText {
 	case "Operation":
@@ -1708,6 +1976,10 @@ func (tc *TextCleaner) getNodeTypeFromUI(nodeTypeText string) string {
 		return "foreach"
 	case "Group":
 		return "group"
+	case "Capture":
+		return "capture"
+	case "Subroutine":
+		return "subroutine"
 	}
 	return "operation"
 }
@@ -1798,7 +2070,7 @@ func generateRandomSocketPath() string {
 }
 
 // startHeadlessChildProcess spawns the current executable as a headless socket server
-func startHeadlessChildProcess(socketPath string) (*os.Process, error) {
+func startHeadlessChildProcess(socketPath string, authToken string) (*os.Process, error) {
 	// Get the path to the current executable
 	exePath, err := os.Executable()
 	if err != nil {
@@ -1807,6 +2079,8 @@ func startHeadlessChildProcess(socketPath string) (*os.Process, error) {
 
 	// Start the headless server in a child process
 	cmd := exec.Command(exePath, "--headless", "--socket", socketPath)
+	// Pass the token through the environment so it doesn't show up in the process list
+	cmd.Env = append(os.Environ(), authTokenEnv+"="+authToken)
 	cmd.Stdout = nil
 	cmd.Stderr = nil
 
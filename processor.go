@@ -2,21 +2,39 @@ package main
 
 import (
 	"bufio"
+	"bytes"
+	"context"
 	"encoding/base64"
 	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"html"
+	"io"
 	"math"
+	"math/rand"
 	"net/url"
 	"regexp"
+	"runtime"
+	"slices"
 	"sort"
 	"strconv"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 	"unicode"
+	"unicode/utf16"
+	"unicode/utf8"
 
 	"github.com/PuerkitoBio/goquery"
+	"github.com/lithammer/fuzzysearch/fuzzy"
+	"github.com/yuin/goldmark"
+	"github.com/yuin/goldmark/extension"
+	"github.com/yuin/goldmark/renderer"
+	gmhtml "github.com/yuin/goldmark/renderer/html"
+	"golang.org/x/text/unicode/runenames"
+	"golang.org/x/text/width"
 )
 
 // Operation represents a text transformation operation
@@ -29,7 +47,7 @@ type Operation struct {
 // PipelineNode represents a node in the tree-based operation pipeline
 type PipelineNode struct {
 	ID           string          `json:"id"`             // Unique identifier
-	Type         string          `json:"type"`           // "operation", "if", "foreach", "group"
+	Type         string          `json:"type"`           // "operation", "if", "foreach", "group", "capture", "subroutine"
 	Name         string          `json:"name"`           // Display name
 	Operation    string          `json:"operation"`      // Operation name (for type="operation")
 	Arg1         string          `json:"arg1"`           // First argument
@@ -37,6 +55,8 @@ type PipelineNode struct {
 	Condition    string          `json:"condition"`      // For if nodes: regex/pattern to test
 	Children     []PipelineNode  `json:"children"`       // Child nodes
 	ElseChildren []PipelineNode  `json:"else_children"`  // For if nodes: else branch
+	Disabled     bool            `json:"disabled,omitempty"` // Skipped nodes pass their input through unchanged
+	LineBased    bool            `json:"line_based,omitempty"` // For operation nodes: apply the operation to each line separately
 }
 
 // GetOperations returns all available text operations
@@ -54,10 +74,12 @@ func GetOperations() []Operation {
 		{"Trim", "Remove leading and trailing whitespace", trim},
 		{"Trim Left", "Remove leading whitespace only", trimLeft},
 		{"Trim Right", "Remove trailing whitespace only", trimRight},
+		{"Trim Lines", "Trim whitespace on every line (arg1=both, left or right)", trimLines},
 		{"Normalize Whitespace", "Collapse multiple spaces to single space", normalizeWhitespace},
 
 		// Basic string operations
 		{"Replace Text", "Replace all occurrences of text (arg1→arg2)", replaceText},
+		{"Replace Nth", "Replace one occurrence of text (arg1=search, arg2=N:replacement, N can be last)", replaceNth},
 		{"Add Prefix", "Add text to the beginning (arg1)", addPrefix},
 		{"Add Suffix", "Add text to the end (arg1)", addSuffix},
 		{"Remove Prefix", "Remove text from beginning (arg1)", removePrefix},
@@ -75,43 +97,69 @@ func GetOperations() []Operation {
 		// HTML operations
 		{"HTML Decode", "Decode HTML entities to text", htmlDecode},
 		{"HTML Encode", "Encode text to HTML entities", htmlEncode},
+		{"HTML Entity Encode", "Encode non-ASCII as HTML entities (arg1=named or numeric)", htmlEntityEncode},
+		{"HTML Entity Decode", "Decode named and numeric HTML entities", htmlEntityDecode},
 		{"Strip Tags", "Remove all HTML/XML tags", stripTags},
-		{"Find HTML Links", "Extract links from HTML (arg1=format)", findHtmlLinks},
-		{"Select HTML", "Select elements using CSS selector (arg1=selector)", selectHtml},
+		{"Find HTML Links", "Extract links from HTML (arg1=format with {text}, {href}, {title}, arg2=base URL)", findHtmlLinks},
+		{"Extract Images", "Extract image sources from HTML (arg1=format with {src}, {alt}, arg2=base URL)", extractImages},
+		{"Select HTML", "Select elements using CSS selector (arg1=selector, arg2=text|inner|outer|attr:name|table:delimiter)", selectHtml},
+		{"Extract Attribute", "Extract an attribute from matching elements (arg1=selector, arg2=attribute)", extractAttribute},
 
 		// JSON operations
-		{"Select JSON", "Extract JSON data using path notation (arg1=path)", selectJson},
+		{"Select JSON", "Extract JSON data using path notation (arg1=path, arg2=sorted to sort keys)", selectJson},
+		{"Format JSON", "Pretty-print JSON keeping key order (arg1=indent spaces or tab, arg2=sorted to sort keys)", formatJson},
+		{"Minify JSON", "Remove whitespace from JSON keeping key order (arg2=sorted to sort keys)", minifyJson},
 
 		// Regex operations
-		{"Keep Match Lines", "Keep only lines matching regex (arg1=pattern)", keepMatchLines},
+		{"Keep Match Lines", "Keep only lines matching regex (arg1=pattern, arg2=flags: i, s, v to invert)", keepMatchLines},
 		{"Remove Match Lines", "Remove lines matching regex (arg1=pattern)", removeMatchLines},
-		{"Match Text", "Find all regex matches (arg1=pattern)", matchText},
-		{"Replace Full", "Regex find and replace (arg1=pattern, arg2=replacement)", replaceFull},
+		{"Match Text", "Find all regex matches (arg1=pattern, arg2=flags plus count or line)", matchText},
+		{"Replace Full", "Regex find and replace (arg1=pattern, arg2=replacement, or just /c to count the replacements)", replaceFull},
+		{"Regex Replace", "Regex replace with trailing flags (arg1=pattern, arg2=replacement/flags, flags: i, s, m, c=count only)", regexReplace},
 
 		// Math operations
 		{"Calculate", "Evaluate mathematical expressions in text", calculate},
 
 		// Phase 1: Line Operations
 		{"Sort Lines", "Sort lines alphabetically (arg1=options: n,r,i)", sortLines},
+		{"Sort Paragraphs", "Sort blank-line separated blocks by first line (arg1=options: b for whole block, r, i)", sortParagraphs},
 		{"Number Lines", "Add line numbers (arg1=start, arg2=format)", numberLines},
 		{"Randomize Lines", "Shuffle lines randomly", randomizeLines},
 		{"Invert Lines", "Reverse the order of lines", invertLines},
 		{"Deduplicate Lines", "Remove duplicate lines, keep first", deduplicateLines},
 		{"Filter Blank Lines", "Remove empty or whitespace-only lines", filterBlankLines},
+		{"Trim Blank Lines", "Remove blank lines at the start and end only (arg1=start or end for one side)", trimBlankLines},
 		{"Filter Lines by Length", "Keep lines within length range (arg1=min, arg2=max)", filterLinesByLength},
+		{"Head Lines", "Keep the first N lines (arg1=N, arg2='-' for all but the last N)", headLines},
+		{"Tail Lines", "Keep the last N lines (arg1=N, arg2='-' for all but the first N)", tailLines},
+		{"Line Range", "Keep a range of lines (arg1=range like 5-10, arg2=delete to remove it)", lineRange},
+		{"Sample Lines", "Pick N random lines in original order (arg1=N, arg2=seed)", sampleLines},
+		{"Shuffle Words", "Shuffle words randomly (arg1=seed, arg2=line to shuffle within each line)", shuffleWords},
+		{"Sample Words", "Pick N random words in original order (arg1=N or N,seed, arg2=line for each line)", sampleWords},
+		{"Chunk Lines", "Group every N lines into blocks (arg1=N, arg2=delimiter, default blank line)", chunkLines},
+		{"Interleave Lines", "Zip two blocks split at a blank line (arg1=half for midpoint, arg2=pair delimiter)", interleaveLines},
+		{"Diff Blocks", "Line diff of the blocks before and after a separator line (arg1=separator, default ---)", diffBlocks},
+		{"Comment Lines", "Prefix non-blank lines with a marker (arg1=marker, default '# ', arg2=skip)", commentLines},
+		{"Uncomment Lines", "Remove a leading comment marker (arg1=marker, default '# ')", uncommentLines},
 
 		// Phase 2: Text Formatting
-		{"Wrap Text", "Wrap text at column width (arg1=width, default 80)", wrapText},
-		{"Rewrap Text", "Unwrap and rewrap at width (arg1=width)", rewrapText},
+		{"Wrap Text", "Wrap text at column width (arg1=width, default 80, arg2=runes to ignore wide characters)", wrapText},
+		{"Rewrap Text", "Unwrap and rewrap at width (arg1=width, arg2=runes to ignore wide characters)", rewrapText},
 		{"Make Paragraphs", "Join lines into paragraphs with blank separators", makeParagraphs},
+		{"Split Sentences", "Put each sentence on its own line", splitSentences},
 		{"Quote Text", "Add prefix to each line (arg1=prefix, default '> ')", quoteText},
-		{"Indent Text", "Add indentation to each line (arg1=indent)", indentText},
-		{"Unindent Text", "Remove common leading whitespace", unindentText},
-		{"Center Text", "Center each line within width (arg1=width)", centerText},
+		{"Template Lines", "Format each line with a template (arg1=template with {line} and {n})", templateLines},
+		{"Fill Template", "Replace {{key}} placeholders (arg1=JSON object or key=value lines, arg2=empty to remove unknown ones)", fillTemplate},
+		{"Indent Text", "Add indentation to each line (arg1=indent, default 4 spaces; arg2=skip to leave blank lines)", indentText},
+		{"Unindent Text", "Remove common leading whitespace (arg1=tab width, default 4)", unindentText},
+		{"Center Text", "Center each line within width (arg1=width, arg2=runes to ignore wide characters)", centerText},
 
 		// Phase 3: Case & Characters
 		{"Capitalize Sentences", "Capitalize first letter of each sentence", capitalizeSentences},
+		{"Sentence Case", "Lowercase text, then capitalize each sentence", sentenceCase},
 		{"Randomcase", "Randomly capitalize or lowercase each letter", randomcase},
+		{"Toggle Case", "Swap upper and lower case for each letter", toggleCase},
+		{"Alternate Case", "Alternate upper and lower case (arg1=word to restart per word)", alternateCase},
 		{"Strip Diacritics", "Remove accents and diacritical marks", stripDiacritics},
 		{"Reverse Text", "Reverse entire text character by character", reverseText},
 		{"Reverse Words", "Reverse characters in each word", reverseWords},
@@ -127,9 +175,13 @@ func GetOperations() []Operation {
 		{"URL Decode", "Decode percent-encoded URLs", urlDecode},
 		{"Hex Encode", "Convert text to hexadecimal", hexEncode},
 		{"Hex Decode", "Convert hexadecimal to text", hexDecode},
+		{"To Binary", "Convert text to space-separated binary octets", toBinary},
+		{"From Binary", "Convert space-separated binary octets to text", fromBinary},
 		{"ROT13", "Apply ROT13 cipher to text", rot13},
 		{"Escape Quotes", "Escape quote characters for strings", escapeQuotes},
 		{"Unescape Quotes", "Unescape escaped quote characters", unescapeQuotes},
+		{"Escape For", "Escape text for a context (arg1=json, csv, shell or regex)", escapeFor},
+		{"Unescape For", "Unescape text from a context (arg1=json, csv, shell or regex)", unescapeFor},
 		{"Insert Date/Time", "Insert current date/time (arg1=format)", insertDateTime},
 
 		// Phase 5: Markdown/HTML
@@ -137,6 +189,7 @@ func GetOperations() []Operation {
 		{"Extract URLs", "Find and extract all URLs from text", extractUrls},
 		{"Extract Emails", "Find and extract all email addresses", extractEmails},
 		{"Extract Numbers", "Find and extract all numbers from text", extractNumbers},
+		{"Extract Numbers with Units", "Extract numbers with their unit or currency as '5 kg' lines", extractNumbersWithUnits},
 
 		// Phase 6: Advanced Regex
 		{"Extract with Groups", "Extract regex matches with groups (arg1=pattern, arg2=template)", extractWithGroups},
@@ -146,15 +199,19 @@ func GetOperations() []Operation {
 
 		// Phase 7: Math & Numbers
 		{"Format Numbers", "Format numbers with decimals (arg1=decimals, arg2=separator)", formatNumbersOperation},
+		{"Format Currency", "Format numbers as amounts of money (arg1=USD, EUR, GBP, JPY or CHF)", formatCurrency},
 		{"Round Numbers", "Round all numbers to decimals (arg1=decimals)", roundNumbers},
+		{"Scientific Notation", "Write numbers as 1.234e+05 (arg1=significant digits, default 4, arg2=engineering for exponents in multiples of 3)", scientificNotation},
 		{"Sum Numbers", "Extract and sum all numbers in text", sumNumbers},
+		{"Aggregate Numbers", "Aggregate all numbers in text (arg1=sum, avg, min, max, median or count)", aggregateNumbers},
 
 		// Phase 8: List & Extraction
 		{"Join List", "Join lines with delimiter (arg1=delimiter)", joinList},
 		{"Remove Control Characters", "Remove non-printable control characters", removeControlCharacters},
+		{"Strip Punctuation", "Remove punctuation characters (arg1=characters to keep)", stripPunctuation},
 		{"Count Occurrences", "Count occurrences of string (arg1=search)", countOccurrences},
-		{"Keep Lines Containing", "Keep lines with text (arg1=search, arg2=flags)", keepLinesContaining},
-		{"Remove Lines Containing", "Remove lines with text (arg1=search, arg2=flags)", removeLinesContaining},
+		{"Keep Lines Containing", "Keep lines with text (arg1=search, | for several, \\| for a literal |, arg2=flags: i, a for all)", keepLinesContaining},
+		{"Remove Lines Containing", "Remove lines with text (arg1=search, | for several, \\| for a literal |, arg2=flags: i, a for all)", removeLinesContaining},
 		{"Truncate Text", "Truncate to max length (arg1=length, arg2=ellipsis)", truncateText},
 
 		// Phase 9: Conditional Operations
@@ -164,51 +221,147 @@ func GetOperations() []Operation {
 
 		// Phase 10: List Processing
 		{"Unique Values", "Remove duplicates (arg1=delimiter)", uniqueValues},
-		{"Most Common", "Find most frequent item (arg1=delimiter)", mostCommon},
-		{"Least Common", "Find least frequent item (arg1=delimiter)", leastCommon},
+		{"Dedupe Words", "Remove repeated words within each line (arg1=i for case-insensitive)", dedupeWords},
+		{"Most Common", "Find most frequent item (arg1=delimiter, arg2=top N and/or count)", mostCommon},
+		{"Least Common", "Find least frequent item (arg1=delimiter, arg2=bottom N and/or count)", leastCommon},
 		{"Reverse Lines", "Reverse the order of lines", reverseLinesOrder},
-		{"Group By Pattern", "Group lines by regex match (arg1=pattern)", groupByPattern},
+		{"Group By Pattern", "Group lines by regex match (arg1=pattern, arg2=bucket to gather them)", groupByPattern},
 
 		// Phase 11: Advanced Text Operations
 		{"Word Count", "Count words, characters, and lines", wordCount},
 		{"Character Count", "Count occurrences of character (arg1=char)", characterCount},
 		{"Line Count", "Count total number of lines", lineCount},
 		{"Text Statistics", "Show detailed text statistics", textStatistics},
+		{"Readability", "Flesch reading-ease score with counts (arg1=grade to add the grade level)", readability},
 		{"Min Word Length", "Find minimum word length", minWordLength},
 		{"Max Word Length", "Find maximum word length", maxWordLength},
 		{"Average Word Length", "Calculate average word length", averageWordLength},
+		{"Word Frequency", "Count each word, most frequent first (arg1=i for case-insensitive, arg2=top N)", wordFrequency},
 
 		// Phase 12: Advanced Pattern Operations
 		{"Whole Word Match", "Find whole word matches only (arg1=word)", wholeWordMatch},
 		{"Case Sensitive Find", "Count case-sensitive matches (arg1=search)", caseSensitiveFind},
 		{"Multi-line Pattern", "Apply multiline regex (arg1=pattern)", multilinePattern},
-		{"Look-ahead Pattern", "Match text followed by pattern (arg1, arg2)", lookaheadPattern},
-		{"Look-behind Pattern", "Match text preceded by pattern (arg1, arg2)", lookbehindPattern},
+		{"Look-ahead Pattern", "Match arg1 where the rest of the line starts with regex arg2 (emulated, no overlapping retries)", lookaheadPattern},
+		{"Look-behind Pattern", "Match arg1 where the line before it ends with regex arg2 (emulated, no overlapping retries)", lookbehindPattern},
 		{"Conditional Replace", "Replace based on conditions (arg1=pattern, arg2=replacement)", conditionalReplace},
 
 		// Phase 13: Transformation Macros
 		{"Chain Operations", "Chain multiple operations (arg1=op1|op2|op3)", chainOperations},
 		{"Repeat Operation", "Repeat operation N times (arg1=op, arg2=count)", repeatOperation},
+		{"Apply Pipeline", "Run an inline pipeline (arg1=JSON array of nodes, as exported)", applyPipeline},
 		{"Swap Pairs", "Swap pairs of items (arg1=delimiter)", swapPairs},
 		{"Reverse Order Items", "Reverse order of items (arg1=delimiter)", reverseOrderItems},
 
 		// Phase 14: HTML/Markdown Advanced
-		{"HTML to Markdown", "Convert HTML to Markdown (simplified)", htmlToMarkdown},
-		{"Markdown to HTML", "Convert Markdown to HTML (simplified)", markdownToHTML},
+		{"HTML to Markdown", "Convert HTML to Markdown", htmlToMarkdown},
+		{"Markdown to HTML", "Convert Markdown to HTML (arg1=options: safe, gfm, hardwraps)", markdownToHTML},
+		{"Strip Markdown", "Remove Markdown formatting, keeping plain text", stripMarkdown},
 		{"Extract Text from HTML", "Extract all text content from HTML", extractTextFromHTML},
+		{"Normalize HTML Text", "Extract text from HTML with whitespace collapsed like a browser (arg1=lines to break lines between blocks)", normalizeHTMLText},
 		{"Create Markdown Table", "Create table from delimited data (arg1=col, arg2=row)", createMarkdownTable},
 		{"Parse YAML Front Matter", "Extract YAML front matter from document", parseYAMLFrontMatter},
-		{"Markdown Link Format", "Convert markdown links to format (arg1=format)", markdownLinkFormat},
+		{"Markdown Link Format", "Convert markdown links to format (arg1=format with {text}, {url}, {title})", markdownLinkFormat},
 
 		// Phase 15: Unicode & Special Characters
-		{"Unicode Names", "Show Unicode names for non-ASCII characters", unicodeNames},
+		{"Unicode Names", "Show Unicode names for non-ASCII characters (arg1=compact to leave out code points)", unicodeNames},
 		{"Convert Unicode Escapes", "Convert \\uXXXX escapes to characters", convertUnicodeEscapes},
-		{"Escape Unicode", "Convert characters to \\uXXXX format", escapeUnicode},
+		{"Escape Unicode", "Convert characters to \\uXXXX format (arg1=U for \\UXXXXXXXX instead of surrogate pairs)", escapeUnicode},
+		{"To ASCII JSON String", "Encode as a JSON string literal with all non-ASCII as \\uXXXX escapes", toASCIIJSONString},
+		{"From JSON String", "Decode a JSON string literal to text", fromJSONString},
 		{"Show Invisible Characters", "Display invisible characters visibly", showInvisibleCharacters},
+		{"Encode Whitespace", "Show spaces, tabs and line breaks as symbols that Decode Whitespace can undo", encodeWhitespace},
+		{"Decode Whitespace", "Restore text written by Encode Whitespace", decodeWhitespace},
+		{"Hex Dump", "Show an xxd-style hex dump (arg1=bytes per row, default 16)", hexDump},
 		{"Normalize Unicode", "Apply Unicode normalization (simplified)", normalizeUnicode},
+		{"Remove BOM", "Strip a leading byte order mark (arg1=all for every U+FEFF)", removeBOM},
+		{"Detect Encoding", "Report UTF-8 validity, BOM, line endings and non-ASCII/control character counts", detectEncoding},
 	}
 }
 
+// SearchOperations returns up to limit operations ranked by how well they match query
+// Matches on the whole name rank first, then name prefixes, names with a word starting with
+// each query word, name substrings, description substrings and finally fuzzy name matches
+func SearchOperations(query string, limit int) []Operation {
+	query = strings.ToLower(strings.TrimSpace(query))
+	if query == "" {
+		return nil
+	}
+
+	type rankedOperation struct {
+		op    Operation
+		score int
+	}
+
+	var ranked []rankedOperation
+	for _, op := range GetOperations() {
+		if score := operationMatchScore(query, op); score > 0 {
+			ranked = append(ranked, rankedOperation{op, score})
+		}
+	}
+
+	// Names that contain the query keep the operation list order, which has the common
+	// operations first; for weaker matches shorter names are closer to the query
+	sort.SliceStable(ranked, func(i, j int) bool {
+		if ranked[i].score != ranked[j].score {
+			return ranked[i].score > ranked[j].score
+		}
+		if ranked[i].score >= 40 {
+			return false
+		}
+		return len(ranked[i].op.Name) < len(ranked[j].op.Name)
+	})
+
+	if limit > 0 && len(ranked) > limit {
+		ranked = ranked[:limit]
+	}
+
+	results := make([]Operation, len(ranked))
+	for i, r := range ranked {
+		results[i] = r.op
+	}
+	return results
+}
+
+// operationMatchScore scores how well a lowercase query matches an operation, 0 for no match
+func operationMatchScore(query string, op Operation) int {
+	name := strings.ToLower(op.Name)
+
+	switch {
+	case name == query:
+		return 100
+	case strings.HasPrefix(name, query):
+		return 80
+	case wordPrefixesMatch(strings.Fields(query), strings.Fields(name)):
+		return 60
+	case strings.Contains(name, query):
+		return 40
+	case strings.Contains(strings.ToLower(op.Description), query):
+		return 20
+	case fuzzy.MatchFold(query, name):
+		return 10
+	default:
+		return 0
+	}
+}
+
+// wordPrefixesMatch reports whether every query word starts some word of the name
+func wordPrefixesMatch(queryWords, nameWords []string) bool {
+	for _, queryWord := range queryWords {
+		found := false
+		for _, nameWord := range nameWords {
+			if strings.HasPrefix(nameWord, queryWord) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	return len(queryWords) > 0
+}
+
 // ProcessText processes the input text with the given operation and arguments
 func ProcessText(input string, operationName string, arg1, arg2 string) string {
 	return ProcessTextWithMode(input, operationName, arg1, arg2, false)
@@ -249,90 +402,433 @@ func applyLineBased(opFunc func(input, arg1, arg2 string) string, input string,
 
 // ExecuteNode executes a pipeline node (tree-based execution)
 func ExecuteNode(node *PipelineNode, input string) string {
+	result, _ := ExecuteNodeContext(context.Background(), node, input)
+	return result
+}
+
+// ExecuteNodeContext executes a pipeline node, giving up with the context's error once it is done
+// The context is checked before every node and every foreach record, so a long run
+// is abandoned between steps; a single operation always runs to completion
+func ExecuteNodeContext(ctx context.Context, node *PipelineNode, input string) (string, error) {
+	return executeNode(ctx, newPipelineRun(nil), node, input)
+}
+
+// ExecutePipelineContext runs the root nodes of a pipeline in order
+// Values captured by one node are visible to every node after it, and subroutine
+// nodes run the pipelines in presets by name
+func ExecutePipelineContext(ctx context.Context, nodes []PipelineNode, presets map[string][]PipelineNode, input string) (string, error) {
+	return executePipelineRun(ctx, newPipelineRun(presets), nodes, input)
+}
+
+// executePipelineRun runs the root nodes of a pipeline with the given run state
+func executePipelineRun(ctx context.Context, run *pipelineRun, nodes []PipelineNode, input string) (string, error) {
+	return executeSequenceNode(ctx, run, &PipelineNode{Children: nodes}, input)
+}
+
+// ErrSubroutineRecursion is returned when a subroutine node runs a preset that is already running
+var ErrSubroutineRecursion = errors.New("subroutine recursion")
+
+// ErrOutputTooLarge is returned when a node's output is larger than the run's output size limit
+var ErrOutputTooLarge = errors.New("output too large")
+
+// pipelineRun is the state of one pipeline run that nodes share
+type pipelineRun struct {
+	vars    *pipelineVars             // Values stored by capture nodes
+	presets map[string][]PipelineNode // Pipelines subroutine nodes can run, read-only during the run
+	calls   []string                  // Presets currently running, outermost first
+	rng     *rand.Rand                // Seeded source for random operations, nil for nondeterministic runs
+	maxSize int                       // Largest output in bytes a node may produce, zero for no limit
+}
+
+func newPipelineRun(presets map[string][]PipelineNode) *pipelineRun {
+	return &pipelineRun{vars: newPipelineVars(), presets: presets}
+}
+
+// seeded makes the run's random operations draw from a source seeded with seed
+func (run *pipelineRun) seeded(seed int64) *pipelineRun {
+	run.rng = rand.New(rand.NewSource(seed))
+	return run
+}
+
+// applyOperation runs an operation, taking randomness from the run's seeded source when it has one
+// If lineBased is true, the operation is applied to each line individually
+// Only operations that run other operations, such as Repeat Operation, can fail; they stop
+// between steps once ctx is done
+func (run *pipelineRun) applyOperation(ctx context.Context, input, operationName, arg1, arg2 string, lineBased bool) (string, error) {
+	if op := run.nestedOperation(operationName); op != nil {
+		if !lineBased || input == "" {
+			return op(ctx, input, arg1, arg2)
+		}
+		lines := strings.Split(input, "\n")
+		for i, line := range lines {
+			var err error
+			if lines[i], err = op(ctx, line, arg1, arg2); err != nil {
+				return input, err
+			}
+		}
+		return strings.Join(lines, "\n"), nil
+	}
+
+	if run.rng != nil {
+		if op, ok := randomOperations[operationName]; ok {
+			opFunc := func(input, arg1, arg2 string) string { return op(run.rng, input, arg1, arg2) }
+			if lineBased {
+				return applyLineBased(opFunc, input, arg1, arg2), nil
+			}
+			return opFunc(input, arg1, arg2), nil
+		}
+	}
+	return ProcessTextWithMode(input, operationName, arg1, arg2, lineBased), nil
+}
+
+// nestedOperation returns the run's version of an operation that runs other operations, or nil
+// These run their steps within the run, so its limits apply to every step and not just the result
+func (run *pipelineRun) nestedOperation(operationName string) func(ctx context.Context, input, arg1, arg2 string) (string, error) {
+	switch operationName {
+	case "Chain Operations":
+		return run.chainOperations
+	case "Repeat Operation":
+		return run.repeatOperation
+	case "Apply Pipeline":
+		return run.applyPipeline
+	}
+	return nil
+}
+
+// checkOutputSize returns an ErrOutputTooLarge error when output is over the run's size limit
+// Operations such as Repeat Operation or Show Invisible Characters can multiply the size of
+// their input, so this stops a run before later nodes make it worse
+func (run *pipelineRun) checkOutputSize(name, output string) error {
+	if run.maxSize <= 0 || len(output) <= run.maxSize {
+		return nil
+	}
+	return fmt.Errorf("%w: %q produced %d bytes, the limit is %d", ErrOutputTooLarge, name, len(output), run.maxSize)
+}
+
+// recordRuns gives each foreach record a copy of the run with its own seeded source
+// The seeds come from the run's source in record order, so a seeded foreach gives the
+// same result whether its records run one by one or in parallel
+func (run *pipelineRun) recordRuns(count int) []*pipelineRun {
+	runs := make([]*pipelineRun, count)
+	for i := range runs {
+		if run.rng == nil {
+			runs[i] = run
+			continue
+		}
+		record := *run
+		runs[i] = record.seeded(run.rng.Int63())
+	}
+	return runs
+}
+
+// randomOperations are the operations that use randomness, taking the source to draw from
+var randomOperations = map[string]func(rng *rand.Rand, input, arg1, arg2 string) string{
+	"Randomize Lines": randomizeLinesWith,
+	"Randomcase":      randomcaseWith,
+	"Sample Lines":    sampleLinesWith,
+	"Shuffle Words":   shuffleWordsWith,
+	"Sample Words":    sampleWordsWith,
+}
+
+// newUnseededRand returns a source for random operations run outside a seeded pipeline
+func newUnseededRand() *rand.Rand {
+	return rand.New(rand.NewSource(time.Now().UnixNano()))
+}
+
+// pipelineVars holds the values capture nodes store during one pipeline run
+// It is shared by every node of the run, including parallel foreach workers
+type pipelineVars struct {
+	mu     sync.Mutex
+	values map[string]string
+}
+
+func newPipelineVars() *pipelineVars {
+	return &pipelineVars{values: make(map[string]string)}
+}
+
+// set stores a captured value under name
+func (v *pipelineVars) set(name, value string) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	v.values[name] = value
+}
+
+// expand replaces ${var:name} references with captured values
+// References to names that haven't been captured are left as they are
+func (v *pipelineVars) expand(s string) string {
+	if !strings.Contains(s, "${var:") {
+		return s
+	}
+
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	return mustCompileRegex(`\$\{var:([^}]+)\}`).ReplaceAllStringFunc(s, func(ref string) string {
+		if value, ok := v.values[ref[len("${var:"):len(ref)-1]]; ok {
+			return value
+		}
+		return ref
+	})
+}
+
+// executeNode executes a pipeline node with the variables of the current run
+func executeNode(ctx context.Context, run *pipelineRun, node *PipelineNode, input string) (string, error) {
 	if node == nil {
-		return input
+		return input, nil
+	}
+	if err := ctx.Err(); err != nil {
+		return input, err
+	}
+	if node.Disabled {
+		return input, nil
 	}
 
 	switch node.Type {
 	case "operation":
-		return executeOperationNode(node, input)
+		return executeOperationNode(ctx, run, node, input)
 	case "if":
-		return executeIfNode(node, input)
+		return executeIfNode(ctx, run, node, input)
 	case "foreach":
-		return executeForEachNode(node, input)
+		return executeForEachNode(ctx, run, node, input)
 	case "group":
-		return executeGroupNode(node, input)
+		return executeGroupNode(ctx, run, node, input)
+	case "capture":
+		return executeCaptureNode(ctx, run, node, input)
+	case "subroutine":
+		return executeSubroutineNode(ctx, run, node, input)
 	default:
 		// Default to sequence behavior
-		return executeSequenceNode(node, input)
+		return executeSequenceNode(ctx, run, node, input)
 	}
 }
 
 // executeOperationNode executes a single operation and then its children
-func executeOperationNode(node *PipelineNode, input string) string {
+func executeOperationNode(ctx context.Context, run *pipelineRun, node *PipelineNode, input string) (string, error) {
 	// Execute the operation
-	result := ProcessText(input, node.Operation, node.Arg1, node.Arg2)
+	result, err := run.applyOperation(ctx, input, node.Operation, run.vars.expand(node.Arg1), run.vars.expand(node.Arg2), node.LineBased)
+	if err != nil {
+		return input, err
+	}
+	if err := run.checkOutputSize(node.Name, result); err != nil {
+		return input, err
+	}
 
 	// Execute children on the result
-	return executeSequenceNode(&PipelineNode{Children: node.Children}, result)
+	return executeSequenceNode(ctx, run, &PipelineNode{Children: node.Children}, result)
 }
 
 // executeIfNode executes children based on condition match
-func executeIfNode(node *PipelineNode, input string) string {
+func executeIfNode(ctx context.Context, run *pipelineRun, node *PipelineNode, input string) (string, error) {
 	if node.Condition == "" {
-		return input
+		return input, nil
 	}
 
-	// Try to match the condition (treat as regex)
-	re, err := regexp.Compile(node.Condition)
-	var matches bool
-
-	if err != nil {
-		// If invalid regex, treat as literal string match
-		matches = strings.Contains(input, node.Condition)
+	// Execute appropriate branch
+	if ifConditionMatches(node, input) {
+		return executeSequenceNode(ctx, run, &PipelineNode{Children: node.Children}, input)
 	} else {
-		matches = re.MatchString(input)
+		return executeSequenceNode(ctx, run, &PipelineNode{Children: node.ElseChildren}, input)
 	}
+}
 
-	// Execute appropriate branch
-	if matches {
-		return executeSequenceNode(&PipelineNode{Children: node.Children}, input)
-	} else {
-		return executeSequenceNode(&PipelineNode{Children: node.ElseChildren}, input)
+// ifConditionMatches reports whether an if node's condition matches the input
+// The condition is treated as a regex, or as a literal string when it isn't a valid regex
+func ifConditionMatches(node *PipelineNode, input string) bool {
+	re, err := compileRegex(node.Condition)
+	if err != nil {
+		return strings.Contains(input, node.Condition)
 	}
+	return re.MatchString(input)
 }
 
-// executeForEachNode applies children to each line
-func executeForEachNode(node *PipelineNode, input string) string {
+// executeForEachNode applies children to each record, by default each line
+// arg2: "parallel" spreads the records over a worker pool, keeping their order
+func executeForEachNode(ctx context.Context, run *pipelineRun, node *PipelineNode, input string) (string, error) {
 	if input == "" {
-		return input
+		return input, nil
 	}
 
-	lines := strings.Split(input, "\n")
-	result := make([]string, len(lines))
+	records, separators := splitRecords(node.Arg1, input)
+	result := make([]string, len(records))
+	children := &PipelineNode{Children: node.Children}
+	runs := run.recordRuns(len(records))
 
-	for i, line := range lines {
-		// Execute all children on this line
-		result[i] = executeSequenceNode(&PipelineNode{Children: node.Children}, line)
+	if node.Arg2 == "parallel" {
+		if err := forEachParallel(ctx, runs, children, records, result); err != nil {
+			return input, err
+		}
+		return joinRecords(run, node, result, separators)
 	}
 
-	return strings.Join(result, "\n")
+	for i, record := range records {
+		if err := ctx.Err(); err != nil {
+			return input, err
+		}
+
+		// Execute all children on this record
+		var err error
+		if result[i], err = executeSequenceNode(ctx, runs[i], children, record); err != nil {
+			return input, err
+		}
+	}
+
+	return joinRecords(run, node, result, separators)
+}
+
+// joinRecords joins the records of a foreach node, which may together exceed the size limit
+func joinRecords(run *pipelineRun, node *PipelineNode, records, separators []string) (string, error) {
+	output := joinSeparated(records, separators)
+	if err := run.checkOutputSize(node.Name, output); err != nil {
+		return "", err
+	}
+	return output, nil
+}
+
+// forEachParallel runs children on each record using GOMAXPROCS workers
+// Every worker writes only to its own slots in result, so order is preserved
+func forEachParallel(ctx context.Context, runs []*pipelineRun, children *PipelineNode, records, result []string) error {
+	workers := runtime.GOMAXPROCS(0)
+	if workers > len(records) {
+		workers = len(records)
+	}
+
+	indices := make(chan int)
+	errs := make([]error, workers)
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range indices {
+				if errs[w] == nil {
+					result[i], errs[w] = executeSequenceNode(ctx, runs[i], children, records[i])
+				}
+			}
+		}()
+	}
+
+	// Stop handing out records once the context is done
+	var err error
+	for i := range records {
+		if err = ctx.Err(); err != nil {
+			break
+		}
+		indices <- i
+	}
+	close(indices)
+	wg.Wait()
+
+	if err != nil {
+		return err
+	}
+	for _, err := range errs {
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// paragraphSeparator matches the blank lines between paragraphs, including lines of only whitespace
+// and Windows line endings
+var paragraphSeparator = regexp.MustCompile(`\r?\n\s*\n`)
+
+// splitRecords splits the input of a foreach node into records and the separators between them
+// arg1: empty for lines, "paragraph" for paragraphs separated by any number of blank lines, or a
+// custom delimiter (see forEachSeparator)
+// Paragraph separators differ, so each one is kept to join the records back the way they were
+func splitRecords(arg1, input string) (records, separators []string) {
+	if arg1 == "paragraph" {
+		start := 0
+		for _, bounds := range paragraphSeparator.FindAllStringIndex(input, -1) {
+			records = append(records, input[start:bounds[0]])
+			separators = append(separators, input[bounds[0]:bounds[1]])
+			start = bounds[1]
+		}
+		return append(records, input[start:]), separators
+	}
+
+	separator := forEachSeparator(arg1)
+	records = strings.Split(input, separator)
+	separators = make([]string, len(records)-1)
+	for i := range separators {
+		separators[i] = separator
+	}
+	return records, separators
+}
+
+// joinSeparated puts records back together with the separators splitRecords found between them
+func joinSeparated(records, separators []string) string {
+	var b strings.Builder
+	for i, record := range records {
+		if i > 0 {
+			b.WriteString(separators[i-1])
+		}
+		b.WriteString(record)
+	}
+	return b.String()
+}
+
+// forEachSeparator returns the fixed record separator for a foreach node that doesn't split
+// on paragraphs: a newline when arg1 is empty, or arg1 as a custom delimiter where \n and \t
+// stand for newline and tab
+func forEachSeparator(arg1 string) string {
+	if arg1 == "" {
+		return "\n"
+	}
+	return strings.NewReplacer(`\n`, "\n", `\t`, "\t").Replace(arg1)
 }
 
 // executeGroupNode passes through to children (no operation logic)
-func executeGroupNode(node *PipelineNode, input string) string {
-	return executeSequenceNode(&PipelineNode{Children: node.Children}, input)
+func executeGroupNode(ctx context.Context, run *pipelineRun, node *PipelineNode, input string) (string, error) {
+	return executeSequenceNode(ctx, run, &PipelineNode{Children: node.Children}, input)
+}
+
+// executeCaptureNode stores a value under the name in arg1 and passes its input through unchanged
+// Without children the input itself is stored, otherwise the children's output for the input
+func executeCaptureNode(ctx context.Context, run *pipelineRun, node *PipelineNode, input string) (string, error) {
+	value, err := executeSequenceNode(ctx, run, &PipelineNode{Children: node.Children}, input)
+	if err != nil {
+		return input, err
+	}
+
+	if node.Arg1 != "" {
+		run.vars.set(node.Arg1, value)
+	}
+	return input, nil
+}
+
+// executeSubroutineNode runs the preset named in arg1 on its input, sharing the run's variables
+// A missing preset passes the input through; a preset that is already running is an error
+func executeSubroutineNode(ctx context.Context, run *pipelineRun, node *PipelineNode, input string) (string, error) {
+	preset, ok := run.presets[node.Arg1]
+	if !ok {
+		return input, nil
+	}
+
+	for _, name := range run.calls {
+		if name == node.Arg1 {
+			return input, fmt.Errorf("%w: preset %q calls itself via %s", ErrSubroutineRecursion, node.Arg1, strings.Join(run.calls, " -> "))
+		}
+	}
+
+	// Each call gets its own chain, so parallel foreach workers don't share it
+	sub := *run
+	sub.calls = append(append([]string{}, run.calls...), node.Arg1)
+	return executeSequenceNode(ctx, &sub, &PipelineNode{Children: preset}, input)
 }
 
 // executeSequenceNode executes children in sequence, piping output through each
-func executeSequenceNode(node *PipelineNode, input string) string {
+func executeSequenceNode(ctx context.Context, run *pipelineRun, node *PipelineNode, input string) (string, error) {
 	result := input
 
 	for i := range node.Children {
-		result = ExecuteNode(&node.Children[i], result)
+		var err error
+		if result, err = executeNode(ctx, run, &node.Children[i], result); err != nil {
+			return input, err
+		}
 	}
 
-	return result
+	return result, nil
 }
 
 // Operation implementations
@@ -366,6 +862,29 @@ func trimRight(input, arg1, arg2 string) string {
 	return strings.TrimRightFunc(input, unicode.IsSpace)
 }
 
+// trimLines trims whitespace from each line, keeping the lines themselves
+// arg1: "both" (default), "left" or "right"
+func trimLines(input, arg1, arg2 string) string {
+	var trimLine func(string) string
+	switch arg1 {
+	case "", "both":
+		trimLine = strings.TrimSpace
+	case "left":
+		trimLine = func(line string) string { return strings.TrimLeftFunc(line, unicode.IsSpace) }
+	case "right":
+		trimLine = func(line string) string { return strings.TrimRightFunc(line, unicode.IsSpace) }
+	default:
+		return input
+	}
+
+	lines := strings.Split(input, "\n")
+	for i, line := range lines {
+		lines[i] = trimLine(line)
+	}
+
+	return strings.Join(lines, "\n")
+}
+
 func replaceText(input, arg1, arg2 string) string {
 	if arg1 == "" {
 		return input
@@ -375,6 +894,41 @@ func replaceText(input, arg1, arg2 string) string {
 	return strings.ReplaceAll(input, arg1, arg2)
 }
 
+// replaceNth replaces a single occurrence of text, leaving the others alone
+// arg1: search text
+// arg2: occurrence and replacement as "N:replacement", where N counts from 1 or is "last"
+func replaceNth(input, arg1, arg2 string) string {
+	occurrence, replacement, ok := strings.Cut(arg2, ":")
+	if arg1 == "" || !ok {
+		return input
+	}
+	search := processEscapeSequences(arg1)
+	replacement = processEscapeSequences(replacement)
+
+	pos := -1
+	if occurrence == "last" {
+		pos = strings.LastIndex(input, search)
+	} else {
+		n, err := strconv.Atoi(occurrence)
+		if err != nil || n < 1 {
+			return input
+		}
+		for offset := 0; n > 0; n-- {
+			i := strings.Index(input[offset:], search)
+			if i == -1 {
+				return input
+			}
+			pos = offset + i
+			offset = pos + len(search)
+		}
+	}
+	if pos == -1 {
+		return input
+	}
+
+	return input[:pos] + replacement + input[pos+len(search):]
+}
+
 func htmlDecode(input, arg1, arg2 string) string {
 	return html.UnescapeString(input)
 }
@@ -383,6 +937,55 @@ func htmlEncode(input, arg1, arg2 string) string {
 	return html.EscapeString(input)
 }
 
+// htmlNamedEntities maps common characters to their named HTML entities
+var htmlNamedEntities = map[rune]string{
+	'&': "&amp;", '<': "&lt;", '>': "&gt;", '"': "&quot;", '\'': "&#39;",
+	' ': "&nbsp;", '©': "&copy;", '®': "&reg;", '™': "&trade;",
+	'—': "&mdash;", '–': "&ndash;", '…': "&hellip;", '•': "&bull;", '·': "&middot;",
+	'‘': "&lsquo;", '’': "&rsquo;", '“': "&ldquo;", '”': "&rdquo;", '«': "&laquo;", '»': "&raquo;",
+	'€': "&euro;", '£': "&pound;", '¥': "&yen;", '¢': "&cent;",
+	'§': "&sect;", '¶': "&para;", '°': "&deg;", '±': "&plusmn;", '×': "&times;", '÷': "&divide;",
+	'é': "&eacute;", 'è': "&egrave;", 'ê': "&ecirc;", 'ë': "&euml;",
+	'á': "&aacute;", 'à': "&agrave;", 'â': "&acirc;", 'ä': "&auml;", 'å': "&aring;",
+	'ó': "&oacute;", 'ò': "&ograve;", 'ô': "&ocirc;", 'ö': "&ouml;",
+	'ú': "&uacute;", 'ù': "&ugrave;", 'û': "&ucirc;", 'ü': "&uuml;",
+	'í': "&iacute;", 'ì': "&igrave;", 'î': "&icirc;", 'ï': "&iuml;",
+	'ñ': "&ntilde;", 'ç': "&ccedil;", 'ß': "&szlig;",
+}
+
+// htmlEntityEncode encodes special and non-ASCII characters as HTML entities
+// arg1: "named" (default) uses named entities where known, "numeric" uses &#xNN; for all non-ASCII
+func htmlEntityEncode(input, arg1, arg2 string) string {
+	numeric := strings.EqualFold(strings.TrimSpace(arg1), "numeric")
+
+	var result strings.Builder
+	for _, r := range input {
+		if r < 0x80 {
+			if entity, ok := htmlNamedEntities[r]; ok {
+				result.WriteString(entity)
+			} else {
+				result.WriteRune(r)
+			}
+			continue
+		}
+
+		if !numeric {
+			if entity, ok := htmlNamedEntities[r]; ok {
+				result.WriteString(entity)
+				continue
+			}
+		}
+		fmt.Fprintf(&result, "&#x%X;", r)
+	}
+
+	return result.String()
+}
+
+// htmlEntityDecode resolves named (&copy;) and numeric (&#169; or &#xA9;) entities
+func htmlEntityDecode(input, arg1, arg2 string) string {
+	return html.UnescapeString(input)
+}
+
 func addPrefix(input, arg1, arg2 string) string {
 	if arg1 == "" {
 		return input
@@ -505,7 +1108,7 @@ func stripTags(input, arg1, arg2 string) string {
 	doc, err := goquery.NewDocumentFromReader(strings.NewReader(input))
 	if err != nil {
 		// Fallback to simple regex-based tag stripping
-		re := regexp.MustCompile(`<[^>]*>`)
+		re := mustCompileRegex(`<[^>]*>`)
 		return html.UnescapeString(re.ReplaceAllString(input, ""))
 	}
 
@@ -517,6 +1120,9 @@ func stripTags(input, arg1, arg2 string) string {
 }
 
 // keepMatchLines keeps only lines matching the regex pattern
+// arg2: regex flags; "v" keeps the lines that don't match instead, like grep -v.
+// The i, m and s flags change the pattern and "v" inverts the result, so "iv"
+// removes lines matching case-insensitively
 func keepMatchLines(input, arg1, arg2 string) string {
 	if arg1 == "" {
 		return input
@@ -524,17 +1130,18 @@ func keepMatchLines(input, arg1, arg2 string) string {
 
 	// Parse regex options from arg2
 	flags := parseRegexFlags(arg2)
-	re, err := regexp.Compile(addRegexFlags(arg1, flags))
+	re, err := compileRegex(addRegexFlags(arg1, flags))
 	if err != nil {
 		return input
 	}
+	invert := flags['v']
 
 	var result strings.Builder
 	scanner := bufio.NewScanner(strings.NewReader(input))
 
 	for scanner.Scan() {
 		line := scanner.Text()
-		if re.MatchString(line) {
+		if re.MatchString(line) != invert {
 			result.WriteString(line)
 			result.WriteString("\n")
 		}
@@ -551,7 +1158,7 @@ func removeMatchLines(input, arg1, arg2 string) string {
 
 	// Parse regex options from arg2
 	flags := parseRegexFlags(arg2)
-	re, err := regexp.Compile(addRegexFlags(arg1, flags))
+	re, err := compileRegex(addRegexFlags(arg1, flags))
 	if err != nil {
 		return input
 	}
@@ -571,19 +1178,43 @@ func removeMatchLines(input, arg1, arg2 string) string {
 }
 
 // matchText finds all matches of a regex pattern
+// arg2: regex flags, optionally with "count" to return the number of matches or
+// "line" to return each whole line containing a match, e.g. "i count" or "i,line"
 func matchText(input, arg1, arg2 string) string {
 	if arg1 == "" {
 		return input
 	}
 
-	// Parse regex options from arg2
-	flags := parseRegexFlags(arg2)
-	re, err := regexp.Compile(addRegexFlags(arg1, flags))
+	// Parse the mode and regex options from arg2
+	mode, flagText := "", ""
+	for _, field := range strings.FieldsFunc(arg2, func(r rune) bool { return r == ' ' || r == ',' }) {
+		if field == "count" || field == "line" {
+			mode = field
+		} else {
+			flagText += field
+		}
+	}
+
+	flags := parseRegexFlags(flagText)
+	re, err := compileRegex(addRegexFlags(arg1, flags))
 	if err != nil {
 		return input
 	}
 
+	if mode == "line" {
+		var lines []string
+		for _, line := range strings.Split(input, "\n") {
+			if re.MatchString(line) {
+				lines = append(lines, line)
+			}
+		}
+		return strings.Join(lines, "\n")
+	}
+
 	matches := re.FindAllString(input, -1)
+	if mode == "count" {
+		return strconv.Itoa(len(matches))
+	}
 	if len(matches) == 0 {
 		return ""
 	}
@@ -592,44 +1223,124 @@ func matchText(input, arg1, arg2 string) string {
 }
 
 // replaceFull performs regex replacement
+// A replacement of exactly "/c" returns the number of replacements instead; any other
+// replacement is used as written, so Regex Replace is the one to use for counting with flags
 func replaceFull(input, arg1, arg2 string) string {
 	if arg1 == "" {
 		return input
 	}
 
-	re, err := regexp.Compile(arg1)
+	re, err := compileRegex(arg1)
 	if err != nil {
 		return input
 	}
 
+	if arg2 == "/c" {
+		return strconv.Itoa(len(re.FindAllStringIndex(input, -1)))
+	}
+
 	// Process escape sequences in replacement string
 	replacement := processEscapeSequences(arg2)
 
 	return re.ReplaceAllString(input, replacement)
 }
 
+// regexReplace performs regex replacement with sed-style flags after the replacement
+// arg1: regex pattern
+// arg2: replacement, optionally followed by /flags, e.g. "X/i"
+// Flags: i (case-insensitive), s (. matches newline), m (^ and $ match at lines; on unless s is given alone),
+// c (return the number of replacements instead of the text, to check a pattern before relying on it)
+// End the replacement with "/" to keep a literal trailing slash part, e.g. "a/b/", or escape
+// the slash, e.g. "km\/s"
+func regexReplace(input, arg1, arg2 string) string {
+	if arg1 == "" {
+		return input
+	}
+
+	replacement, flags := splitReplacementFlags(arg2)
+	flagSet := parseRegexFlags(flags)
+	re, err := compileRegex(addRegexFlags(arg1, flagSet))
+	if err != nil {
+		return input
+	}
+
+	if flagSet['c'] {
+		return strconv.Itoa(len(re.FindAllStringIndex(input, -1)))
+	}
+
+	return re.ReplaceAllString(input, processEscapeSequences(replacement))
+}
+
+// regexReplaceFlags lists the flag letters accepted after the replacement in regexReplace
+const regexReplaceFlags = "ismc"
+
+// splitReplacementFlags splits "replacement/flags" at the last slash that isn't escaped
+// The whole text is the replacement when the part after the slash isn't made of flag letters
+// A slash escaped as \/ is always part of the replacement, so "km\/s" replaces with "km/s"
+// rather than "km" with the s flag
+func splitReplacementFlags(arg string) (replacement, flags string) {
+	idx := -1
+	for i := 0; i < len(arg); i++ {
+		switch arg[i] {
+		case '\\':
+			i++ // An escaped character is never the separator
+		case '/':
+			idx = i
+		}
+	}
+
+	replacement = arg
+	if idx >= 0 && strings.Trim(arg[idx+1:], regexReplaceFlags) == "" {
+		replacement, flags = arg[:idx], arg[idx+1:]
+	}
+	return unescapeSlashes(replacement), flags
+}
+
+// unescapeSlashes turns \/ into /, leaving other escape sequences for processEscapeSequences
+func unescapeSlashes(s string) string {
+	var result strings.Builder
+	for i := 0; i < len(s); i++ {
+		if s[i] == '\\' && i+1 < len(s) {
+			if s[i+1] != '/' {
+				result.WriteByte(s[i])
+			}
+			i++
+		}
+		result.WriteByte(s[i])
+	}
+	return result.String()
+}
+
 // findHtmlLinks extracts HTML links
+// arg1: format using {text}, {href} and {title} (default text and href on separate lines)
+// arg2: base URL to resolve relative hrefs against (e.g., "https://example.com/dir/")
 func findHtmlLinks(input, arg1, arg2 string) string {
 	doc, err := goquery.NewDocumentFromReader(strings.NewReader(input))
 	if err != nil {
 		return input
 	}
 
+	base := parseBaseURL(arg2)
+
 	// Process escape sequences in format string
 	arg1 = processEscapeSequences(arg1)
 
 	var result strings.Builder
 	doc.Find("a[href]").Each(func(i int, s *goquery.Selection) {
 		href, _ := s.Attr("href")
+		title, _ := s.Attr("title")
 		text := strings.TrimSpace(s.Text())
 
+		href = resolveURL(base, href)
+
 		// Normalize whitespace
-		text = regexp.MustCompile(`\s+`).ReplaceAllString(text, " ")
+		text = mustCompileRegex(`\s+`).ReplaceAllString(text, " ")
 
 		// If format string provided, use it
 		if arg1 != "" {
 			formatted := strings.ReplaceAll(arg1, "{text}", text)
 			formatted = strings.ReplaceAll(formatted, "{href}", href)
+			formatted = strings.ReplaceAll(formatted, "{title}", title)
 			result.WriteString(formatted)
 			result.WriteString("\n")
 		} else {
@@ -644,18 +1355,98 @@ func findHtmlLinks(input, arg1, arg2 string) string {
 	return strings.TrimSuffix(result.String(), "\n")
 }
 
-// selectHtml selects HTML elements using CSS selectors
-func selectHtml(input, arg1, arg2 string) string {
-	if arg1 == "" {
-		return input
-	}
-
+// extractImages extracts image sources from HTML
+// arg1: format using {src} and {alt} (default "{src}")
+// arg2: base URL to resolve relative sources against (e.g., "https://example.com/dir/")
+func extractImages(input, arg1, arg2 string) string {
 	doc, err := goquery.NewDocumentFromReader(strings.NewReader(input))
 	if err != nil {
 		return input
 	}
 
-	var result strings.Builder
+	format := "{src}"
+	if arg1 != "" {
+		format = processEscapeSequences(arg1)
+	}
+	base := parseBaseURL(arg2)
+
+	var result strings.Builder
+	doc.Find("img[src]").Each(func(i int, s *goquery.Selection) {
+		src, _ := s.Attr("src")
+		alt, _ := s.Attr("alt")
+
+		replacer := strings.NewReplacer("{src}", resolveURL(base, src), "{alt}", alt)
+		result.WriteString(replacer.Replace(format))
+		result.WriteString("\n")
+	})
+
+	return strings.TrimSuffix(result.String(), "\n")
+}
+
+// extractAttribute extracts one attribute from every element matching a CSS selector
+// Elements without the attribute are skipped
+// arg1: CSS selector
+// arg2: attribute name
+func extractAttribute(input, arg1, arg2 string) string {
+	if arg1 == "" || arg2 == "" {
+		return input
+	}
+
+	doc, err := goquery.NewDocumentFromReader(strings.NewReader(input))
+	if err != nil {
+		return input
+	}
+
+	var values []string
+	doc.Find(arg1).Each(func(i int, s *goquery.Selection) {
+		if value, exists := s.Attr(arg2); exists {
+			values = append(values, value)
+		}
+	})
+
+	return strings.Join(values, "\n")
+}
+
+// parseBaseURL parses an optional base URL argument, returning nil when it's empty or invalid
+func parseBaseURL(arg string) *url.URL {
+	if arg == "" {
+		return nil
+	}
+	base, err := url.Parse(strings.TrimSpace(arg))
+	if err != nil {
+		return nil
+	}
+	return base
+}
+
+// resolveURL resolves a possibly relative reference against base
+// References are kept as written when there is no base or they don't parse
+func resolveURL(base *url.URL, ref string) string {
+	if base == nil {
+		return ref
+	}
+	parsed, err := url.Parse(strings.TrimSpace(ref))
+	if err != nil {
+		return ref
+	}
+	return base.ResolveReference(parsed).String()
+}
+
+// selectHtml selects HTML elements using CSS selectors
+// arg1: CSS selector
+// arg2: output commands separated by "|": text (default), inner, outer, attr:name,
+// table or table:delimiter (one line per row of cells, tab-separated by default)
+func selectHtml(input, arg1, arg2 string) string {
+	if arg1 == "" {
+		return input
+	}
+
+	doc, err := goquery.NewDocumentFromReader(strings.NewReader(input))
+	if err != nil {
+		return input
+	}
+
+	var result strings.Builder
 	selection := doc.Find(arg1)
 
 	if selection.Length() == 0 {
@@ -689,6 +1480,12 @@ func selectHtml(input, arg1, arg2 string) string {
 					result.WriteString(attr)
 					result.WriteString("\n")
 				}
+			case cmd == "table" || strings.HasPrefix(cmd, "table:"):
+				delimiter := "\t"
+				if strings.HasPrefix(cmd, "table:") {
+					delimiter = processEscapeSequences(strings.TrimPrefix(cmd, "table:"))
+				}
+				writeHtmlTableRows(&result, s, delimiter)
 			}
 		}
 	})
@@ -696,10 +1493,38 @@ func selectHtml(input, arg1, arg2 string) string {
 	return strings.TrimSuffix(result.String(), "\n")
 }
 
+// writeHtmlTableRows writes each row of the selected table (or the tables inside the selection)
+// as a line of cell texts joined by delimiter; rows of nested tables are left to their own table
+func writeHtmlTableRows(result *strings.Builder, s *goquery.Selection, delimiter string) {
+	tables := s
+	if goquery.NodeName(s) != "table" {
+		tables = s.Find("table")
+	}
+
+	tables.Each(func(_ int, table *goquery.Selection) {
+		table.Find("tr").Each(func(_ int, row *goquery.Selection) {
+			if !row.Closest("table").IsSelection(table) {
+				return
+			}
+
+			var cells []string
+			row.ChildrenFiltered("th, td").Each(func(_ int, cell *goquery.Selection) {
+				text := strings.TrimSpace(cell.Text())
+				cells = append(cells, mustCompileRegex(`\s+`).ReplaceAllString(text, " "))
+			})
+
+			result.WriteString(strings.Join(cells, delimiter))
+			result.WriteString("\n")
+		})
+	})
+}
+
 // selectJson extracts JSON data using a simple path notation
+// Object keys keep their original order in the output
+// arg1: dot-separated path (e.g., "items.0.name"); empty formats the whole document
+// arg2: "sorted" to sort object keys alphabetically instead
 func selectJson(input, arg1, arg2 string) string {
-	var data interface{}
-	err := json.Unmarshal([]byte(input), &data)
+	data, err := decodeJSON(input, arg2 == "sorted")
 	if err != nil {
 		return input
 	}
@@ -719,6 +1544,8 @@ func selectJson(input, arg1, arg2 string) string {
 
 	for _, part := range parts {
 		switch v := current.(type) {
+		case *orderedJSONObject:
+			current = v.values[part]
 		case map[string]interface{}:
 			current = v[part]
 		case []interface{}:
@@ -744,6 +1571,180 @@ func selectJson(input, arg1, arg2 string) string {
 	return string(output)
 }
 
+// formatJson pretty-prints JSON, keeping object keys in their original order
+// arg1: indent as a number of spaces or "tab" (default 2)
+// arg2: "sorted" to sort object keys alphabetically instead
+func formatJson(input, arg1, arg2 string) string {
+	data, err := decodeJSON(input, arg2 == "sorted")
+	if err != nil {
+		return input
+	}
+
+	indent := "  "
+	if arg1 == "tab" {
+		indent = "\t"
+	} else if n, err := strconv.Atoi(arg1); err == nil && n >= 0 {
+		indent = strings.Repeat(" ", n)
+	}
+
+	output, err := json.MarshalIndent(data, "", indent)
+	if err != nil {
+		return input
+	}
+	return string(output)
+}
+
+// minifyJson removes all insignificant whitespace from JSON, keeping object keys in their original order
+// arg2: "sorted" to sort object keys alphabetically instead
+func minifyJson(input, arg1, arg2 string) string {
+	data, err := decodeJSON(input, arg2 == "sorted")
+	if err != nil {
+		return input
+	}
+
+	output, err := json.Marshal(data)
+	if err != nil {
+		return input
+	}
+	return string(output)
+}
+
+// orderedJSONObject is a decoded JSON object that remembers the order of its keys,
+// so re-encoding it doesn't reorder the document
+type orderedJSONObject struct {
+	keys   []string
+	values map[string]interface{}
+}
+
+// MarshalJSON encodes the object with its keys in their original order
+func (o *orderedJSONObject) MarshalJSON() ([]byte, error) {
+	var buf bytes.Buffer
+	if err := writeOrderedJSON(&buf, o); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// writeOrderedJSON writes a value from decodeOrderedJSONValue to buf
+// Nested objects and arrays are written into the same buffer, since json.Marshal would
+// encode and check every nested object again for each level around it
+func writeOrderedJSON(buf *bytes.Buffer, value interface{}) error {
+	switch v := value.(type) {
+	case *orderedJSONObject:
+		buf.WriteByte('{')
+		for i, key := range v.keys {
+			if i > 0 {
+				buf.WriteByte(',')
+			}
+			if err := writeOrderedJSON(buf, key); err != nil {
+				return err
+			}
+			buf.WriteByte(':')
+			if err := writeOrderedJSON(buf, v.values[key]); err != nil {
+				return err
+			}
+		}
+		buf.WriteByte('}')
+	case []interface{}:
+		buf.WriteByte('[')
+		for i, item := range v {
+			if i > 0 {
+				buf.WriteByte(',')
+			}
+			if err := writeOrderedJSON(buf, item); err != nil {
+				return err
+			}
+		}
+		buf.WriteByte(']')
+	default:
+		data, err := json.Marshal(v)
+		if err != nil {
+			return err
+		}
+		buf.Write(data)
+	}
+	return nil
+}
+
+// decodeJSON decodes a JSON document, preserving object key order unless sorted is set
+// Numbers are kept as written (json.Number) so re-encoding doesn't change their format
+func decodeJSON(input string, sorted bool) (interface{}, error) {
+	if sorted {
+		var data interface{}
+		err := json.Unmarshal([]byte(input), &data)
+		return data, err
+	}
+
+	dec := json.NewDecoder(strings.NewReader(input))
+	dec.UseNumber()
+
+	data, err := decodeOrderedJSONValue(dec)
+	if err != nil {
+		return nil, err
+	}
+
+	// Like json.Unmarshal, reject anything after the document
+	if _, err := dec.Token(); err != io.EOF {
+		return nil, fmt.Errorf("unexpected data after JSON value")
+	}
+	return data, nil
+}
+
+// decodeOrderedJSONValue reads one JSON value from the token stream
+func decodeOrderedJSONValue(dec *json.Decoder) (interface{}, error) {
+	tok, err := dec.Token()
+	if err != nil {
+		return nil, err
+	}
+
+	delim, ok := tok.(json.Delim)
+	if !ok {
+		return tok, nil // string, json.Number, bool or nil
+	}
+
+	switch delim {
+	case '{':
+		obj := &orderedJSONObject{values: make(map[string]interface{})}
+		for dec.More() {
+			keyTok, err := dec.Token()
+			if err != nil {
+				return nil, err
+			}
+			key, _ := keyTok.(string)
+
+			value, err := decodeOrderedJSONValue(dec)
+			if err != nil {
+				return nil, err
+			}
+
+			// Duplicate keys keep their first position and their last value, like json.Unmarshal
+			if _, exists := obj.values[key]; !exists {
+				obj.keys = append(obj.keys, key)
+			}
+			obj.values[key] = value
+		}
+		if _, err := dec.Token(); err != nil { // Closing brace
+			return nil, err
+		}
+		return obj, nil
+	case '[':
+		arr := []interface{}{}
+		for dec.More() {
+			value, err := decodeOrderedJSONValue(dec)
+			if err != nil {
+				return nil, err
+			}
+			arr = append(arr, value)
+		}
+		if _, err := dec.Token(); err != nil { // Closing bracket
+			return nil, err
+		}
+		return arr, nil
+	default:
+		return nil, fmt.Errorf("unexpected delimiter %v", delim)
+	}
+}
+
 // calculate evaluates mathematical expressions found in text
 func calculate(input, arg1, arg2 string) string {
 	if input == "" {
@@ -759,7 +1760,7 @@ func calculate(input, arg1, arg2 string) string {
 	// Regular expression to match mathematical expressions
 	// Matches: optional spaces, optional minus, number, then (operator number) repeated
 	// This pattern captures complete mathematical expressions embedded in text
-	re := regexp.MustCompile(`(-?\d+(?:\.\d+)?(?:\s*[+\-*/]\s*-?\d+(?:\.\d+)?)*)`)
+	re := mustCompileRegex(`(-?\d+(?:\.\d+)?(?:\s*[+\-*/]\s*-?\d+(?:\.\d+)?)*)`)
 
 	result = re.ReplaceAllStringFunc(result, func(match string) string {
 		// Evaluate each matched expression
@@ -788,8 +1789,12 @@ func sortLines(input, arg1, arg2 string) string {
 	reverse := strings.Contains(arg1, "r")
 	caseInsensitive := strings.Contains(arg1, "i")
 
-	sort.Slice(lines, func(i, j int) bool {
+	// Stable so lines with equal keys keep their input order
+	sort.SliceStable(lines, func(i, j int) bool {
 		a, b := lines[i], lines[j]
+		if reverse {
+			a, b = b, a
+		}
 
 		if caseInsensitive {
 			a = strings.ToLower(a)
@@ -797,26 +1802,74 @@ func sortLines(input, arg1, arg2 string) string {
 		}
 
 		if numeric {
-			// Extract leading numbers if present
+			// Extract leading numbers if present; equal numbers fall back to comparing the whole line
 			numA := extractLeadingNumber(a)
 			numB := extractLeadingNumber(b)
-			if numA != nil && numB != nil {
-				less := *numA < *numB
-				if reverse {
-					return !less
-				}
-				return less
+			if numA != nil && numB != nil && *numA != *numB {
+				return *numA < *numB
 			}
 		}
 
-		less := a < b
+		return a < b
+	})
+
+	return strings.Join(lines, "\n")
+}
+
+// sortParagraphs sorts blocks of lines separated by blank lines, keeping each block's lines together
+// arg1: sort options (b=compare whole blocks instead of their first lines, r=reverse, i=case-insensitive)
+func sortParagraphs(input, arg1, arg2 string) string {
+	if input == "" {
+		return input
+	}
+
+	// Gather runs of non-blank lines; any number of blank lines ends a paragraph
+	var paragraphs [][]string
+	var current []string
+	for _, line := range strings.Split(input, "\n") {
+		if strings.TrimSpace(line) == "" {
+			if len(current) > 0 {
+				paragraphs = append(paragraphs, current)
+				current = nil
+			}
+			continue
+		}
+		current = append(current, line)
+	}
+	if len(current) > 0 {
+		paragraphs = append(paragraphs, current)
+	}
+
+	wholeBlock := strings.Contains(arg1, "b")
+	reverse := strings.Contains(arg1, "r")
+	caseInsensitive := strings.Contains(arg1, "i")
+
+	key := func(paragraph []string) string {
+		k := paragraph[0]
+		if wholeBlock {
+			k = strings.Join(paragraph, "\n")
+		}
+		if caseInsensitive {
+			k = strings.ToLower(k)
+		}
+		return k
+	}
+
+	// Stable so paragraphs with equal keys keep their input order
+	sort.SliceStable(paragraphs, func(i, j int) bool {
+		a, b := key(paragraphs[i]), key(paragraphs[j])
 		if reverse {
-			return !less
+			a, b = b, a
 		}
-		return less
+		return a < b
 	})
 
-	return strings.Join(lines, "\n")
+	result := make([]string, len(paragraphs))
+	for i, paragraph := range paragraphs {
+		result[i] = strings.Join(paragraph, "\n")
+	}
+
+	return strings.Join(result, "\n\n")
 }
 
 // numberLines adds line numbers to each line
@@ -851,17 +1904,19 @@ func numberLines(input, arg1, arg2 string) string {
 
 // randomizeLines shuffles the lines randomly
 func randomizeLines(input, arg1, arg2 string) string {
+	return randomizeLinesWith(newUnseededRand(), input, arg1, arg2)
+}
+
+// randomizeLinesWith shuffles lines using rng
+func randomizeLinesWith(rng *rand.Rand, input, arg1, arg2 string) string {
 	if input == "" {
 		return input
 	}
 
 	lines := strings.Split(input, "\n")
-
-	// Fisher-Yates shuffle using time-based seed
-	for i := len(lines) - 1; i > 0; i-- {
-		j := int(time.Now().UnixNano()) % (i + 1)
+	rng.Shuffle(len(lines), func(i, j int) {
 		lines[i], lines[j] = lines[j], lines[i]
-	}
+	})
 
 	return strings.Join(lines, "\n")
 }
@@ -882,91 +1937,547 @@ func invertLines(input, arg1, arg2 string) string {
 	return strings.Join(lines, "\n")
 }
 
-// deduplicateLines removes duplicate lines, keeping the first occurrence
-func deduplicateLines(input, arg1, arg2 string) string {
-	if input == "" {
-		return input
+// deduplicateLines removes duplicate lines, keeping the first occurrence
+func deduplicateLines(input, arg1, arg2 string) string {
+	if input == "" {
+		return input
+	}
+
+	lines := strings.Split(input, "\n")
+	seen := make(map[string]bool)
+	result := []string{}
+
+	for _, line := range lines {
+		if !seen[line] {
+			seen[line] = true
+			result = append(result, line)
+		}
+	}
+
+	return strings.Join(result, "\n")
+}
+
+// filterBlankLines removes empty or whitespace-only lines
+func filterBlankLines(input, arg1, arg2 string) string {
+	if input == "" {
+		return input
+	}
+
+	lines := strings.Split(input, "\n")
+	result := []string{}
+
+	for _, line := range lines {
+		if strings.TrimSpace(line) != "" {
+			result = append(result, line)
+		}
+	}
+
+	return strings.Join(result, "\n")
+}
+
+// trimBlankLines removes blank and whitespace-only lines from the start and end of the input,
+// keeping blank lines in between; a final newline is kept
+// arg1: "start" or "end" to trim only one side (default both)
+func trimBlankLines(input, arg1, arg2 string) string {
+	trimStart, trimEnd := true, true
+	switch arg1 {
+	case "", "both":
+	case "start":
+		trimEnd = false
+	case "end":
+		trimStart = false
+	default:
+		return input
+	}
+
+	finalNewline := ""
+	if strings.HasSuffix(input, "\n") {
+		finalNewline = "\n"
+	}
+	lines := strings.Split(strings.TrimSuffix(input, "\n"), "\n")
+
+	start, end := 0, len(lines)
+	if trimStart {
+		for start < end && strings.TrimSpace(lines[start]) == "" {
+			start++
+		}
+	}
+	if trimEnd {
+		for end > start && strings.TrimSpace(lines[end-1]) == "" {
+			end--
+		}
+	}
+	if start == end {
+		return ""
+	}
+
+	return strings.Join(lines[start:end], "\n") + finalNewline
+}
+
+// filterLinesByLength filters lines by length
+// arg1: minimum length (0 if not specified)
+// arg2: maximum length (no limit if not specified)
+func filterLinesByLength(input, arg1, arg2 string) string {
+	if input == "" {
+		return input
+	}
+
+	minLen := 0
+	maxLen := -1
+
+	if arg1 != "" {
+		if n, err := strconv.Atoi(arg1); err == nil && n >= 0 {
+			minLen = n
+		}
+	}
+
+	if arg2 != "" {
+		if n, err := strconv.Atoi(arg2); err == nil && n >= 0 {
+			maxLen = n
+		}
+	}
+
+	lines := strings.Split(input, "\n")
+	result := []string{}
+
+	for _, line := range lines {
+		len := len([]rune(line))
+		if len >= minLen && (maxLen < 0 || len <= maxLen) {
+			result = append(result, line)
+		}
+	}
+
+	return strings.Join(result, "\n")
+}
+
+// headLines keeps the first N lines
+// arg1: number of lines (default 10)
+// arg2: "-" to instead keep all but the last N lines (like head -n -N)
+func headLines(input, arg1, arg2 string) string {
+	if input == "" {
+		return input
+	}
+
+	count := 10
+	if arg1 != "" {
+		n, err := strconv.Atoi(arg1)
+		if err != nil || n < 0 {
+			return input
+		}
+		count = n
+	}
+
+	lines := strings.Split(input, "\n")
+	if count > len(lines) {
+		count = len(lines)
+	}
+
+	if strings.TrimSpace(arg2) == "-" {
+		return strings.Join(lines[:len(lines)-count], "\n")
+	}
+	return strings.Join(lines[:count], "\n")
+}
+
+// tailLines keeps the last N lines
+// arg1: number of lines (default 10)
+// arg2: "-" to instead keep all but the first N lines
+func tailLines(input, arg1, arg2 string) string {
+	if input == "" {
+		return input
+	}
+
+	count := 10
+	if arg1 != "" {
+		n, err := strconv.Atoi(arg1)
+		if err != nil || n < 0 {
+			return input
+		}
+		count = n
+	}
+
+	lines := strings.Split(input, "\n")
+	if count > len(lines) {
+		count = len(lines)
+	}
+
+	if strings.TrimSpace(arg2) == "-" {
+		return strings.Join(lines[count:], "\n")
+	}
+	return strings.Join(lines[len(lines)-count:], "\n")
+}
+
+// lineRange keeps (or deletes) a 1-based inclusive range of lines
+// arg1: range like "5-10", "5-", "-10" or "5"
+// arg2: "delete" to remove the range instead of keeping it
+func lineRange(input, arg1, arg2 string) string {
+	if input == "" {
+		return input
+	}
+
+	lines := strings.Split(input, "\n")
+	start, end, ok := parseLineRange(arg1, len(lines))
+	if !ok {
+		return input
+	}
+
+	deleteRange := strings.EqualFold(strings.TrimSpace(arg2), "delete")
+
+	var result []string
+	for i, line := range lines {
+		inRange := i+1 >= start && i+1 <= end
+		if inRange != deleteRange {
+			result = append(result, line)
+		}
+	}
+
+	return strings.Join(result, "\n")
+}
+
+// parseLineRange parses a 1-based inclusive range spec, clamping it to [1, total]
+func parseLineRange(spec string, total int) (int, int, bool) {
+	spec = strings.TrimSpace(spec)
+	if spec == "" {
+		return 0, 0, false
+	}
+
+	startStr, endStr := spec, spec
+	if idx := strings.Index(spec, "-"); idx >= 0 {
+		startStr = strings.TrimSpace(spec[:idx])
+		endStr = strings.TrimSpace(spec[idx+1:])
+	}
+
+	start, end := 1, total
+	if startStr != "" {
+		n, err := strconv.Atoi(startStr)
+		if err != nil {
+			return 0, 0, false
+		}
+		start = n
+	}
+	if endStr != "" {
+		n, err := strconv.Atoi(endStr)
+		if err != nil {
+			return 0, 0, false
+		}
+		end = n
+	}
+
+	if start < 1 {
+		start = 1
+	}
+	if end > total {
+		end = total
+	}
+
+	return start, end, true
+}
+
+// sampleLines selects N random lines using reservoir sampling, keeping their original order
+// arg1: number of lines to keep (default 10)
+// arg2: optional integer seed for reproducible output
+func sampleLines(input, arg1, arg2 string) string {
+	return sampleLinesWith(newUnseededRand(), input, arg1, arg2)
+}
+
+// sampleLinesWith is sampleLines drawing from rng; a seed in arg2 takes precedence over rng
+func sampleLinesWith(rng *rand.Rand, input, arg1, arg2 string) string {
+	if input == "" {
+		return input
+	}
+
+	count := 10
+	if arg1 != "" {
+		n, err := strconv.Atoi(arg1)
+		if err != nil || n < 0 {
+			return input
+		}
+		count = n
+	}
+
+	if arg2 != "" {
+		if seed, err := strconv.ParseInt(strings.TrimSpace(arg2), 10, 64); err == nil {
+			rng = rand.New(rand.NewSource(seed))
+		}
+	}
+
+	lines := strings.Split(input, "\n")
+	return strings.Join(sampleInOrder(rng, lines, count), "\n")
+}
+
+// sampleInOrder picks count random items using reservoir sampling and returns them in their original order
+func sampleInOrder(rng *rand.Rand, items []string, count int) []string {
+	// Reservoir of indices, so the original order can be restored afterwards
+	reservoir := make([]int, 0, count)
+	for i := range items {
+		if len(reservoir) < count {
+			reservoir = append(reservoir, i)
+			continue
+		}
+		if j := rng.Intn(i + 1); j < count {
+			reservoir[j] = i
+		}
+	}
+
+	sort.Ints(reservoir)
+
+	result := make([]string, len(reservoir))
+	for i, idx := range reservoir {
+		result[i] = items[idx]
+	}
+	return result
+}
+
+// shuffleWords shuffles the whitespace-separated words of the input, joining them with single spaces
+// arg1: optional integer seed for reproducible output
+// arg2: "line" to shuffle the words within each line instead of across the whole input
+func shuffleWords(input, arg1, arg2 string) string {
+	return shuffleWordsWith(newUnseededRand(), input, arg1, arg2)
+}
+
+// shuffleWordsWith is shuffleWords drawing from rng; a seed in arg1 takes precedence over rng
+func shuffleWordsWith(rng *rand.Rand, input, arg1, arg2 string) string {
+	if arg1 != "" {
+		seed, err := strconv.ParseInt(strings.TrimSpace(arg1), 10, 64)
+		if err != nil {
+			return input
+		}
+		rng = rand.New(rand.NewSource(seed))
+	}
+
+	return mapWords(input, arg2 == "line", func(words []string) []string {
+		rng.Shuffle(len(words), func(i, j int) {
+			words[i], words[j] = words[j], words[i]
+		})
+		return words
+	})
+}
+
+// sampleWords picks N random whitespace-separated words, keeping their original order
+// arg1: number of words to keep (default 10), optionally followed by a seed as "N,seed"
+// arg2: "line" to sample N words from each line instead of from the whole input
+func sampleWords(input, arg1, arg2 string) string {
+	return sampleWordsWith(newUnseededRand(), input, arg1, arg2)
+}
+
+// sampleWordsWith is sampleWords drawing from rng; a seed in arg1 takes precedence over rng
+func sampleWordsWith(rng *rand.Rand, input, arg1, arg2 string) string {
+	countText, seedText, hasSeed := strings.Cut(arg1, ",")
+
+	count := 10
+	if strings.TrimSpace(countText) != "" {
+		n, err := strconv.Atoi(strings.TrimSpace(countText))
+		if err != nil || n < 0 {
+			return input
+		}
+		count = n
+	}
+
+	if hasSeed {
+		seed, err := strconv.ParseInt(strings.TrimSpace(seedText), 10, 64)
+		if err != nil {
+			return input
+		}
+		rng = rand.New(rand.NewSource(seed))
+	}
+
+	return mapWords(input, arg2 == "line", func(words []string) []string {
+		return sampleInOrder(rng, words, count)
+	})
+}
+
+// mapWords splits the input, or each line when perLine is set, into words and joins
+// the words fn returns with single spaces
+func mapWords(input string, perLine bool, fn func(words []string) []string) string {
+	if !perLine {
+		return strings.Join(fn(strings.Fields(input)), " ")
+	}
+
+	lines := strings.Split(input, "\n")
+	for i, line := range lines {
+		lines[i] = strings.Join(fn(strings.Fields(line)), " ")
+	}
+	return strings.Join(lines, "\n")
+}
+
+// chunkLines groups every N lines into blocks separated by a blank line
+// arg1: number of lines per chunk (default 10)
+// arg2: optional delimiter line placed between chunks instead of a blank line
+func chunkLines(input, arg1, arg2 string) string {
+	if input == "" {
+		return input
+	}
+
+	size := 10
+	if arg1 != "" {
+		n, err := strconv.Atoi(arg1)
+		if err != nil || n <= 0 {
+			return input
+		}
+		size = n
+	}
+
+	separator := "\n\n"
+	if arg2 != "" {
+		separator = "\n" + processEscapeSequences(arg2) + "\n"
+	}
+
+	lines := strings.Split(input, "\n")
+	var chunks []string
+	for start := 0; start < len(lines); start += size {
+		end := start + size
+		if end > len(lines) {
+			end = len(lines)
+		}
+		chunks = append(chunks, strings.Join(lines[start:end], "\n"))
+	}
+
+	return strings.Join(chunks, separator)
+}
+
+// interleaveLines splits the input into two blocks and interleaves their lines
+// arg1: "half" to split at the midpoint instead of at the first blank line
+// arg2: delimiter joining each pair onto one line (default: pairs stay on separate lines)
+func interleaveLines(input, arg1, arg2 string) string {
+	if input == "" {
+		return input
+	}
+
+	lines := strings.Split(input, "\n")
+
+	var first, second []string
+	if strings.EqualFold(strings.TrimSpace(arg1), "half") {
+		mid := (len(lines) + 1) / 2
+		first, second = lines[:mid], lines[mid:]
+	} else {
+		split := -1
+		for i, line := range lines {
+			if strings.TrimSpace(line) == "" {
+				split = i
+				break
+			}
+		}
+		if split < 0 {
+			return input
+		}
+		first, second = lines[:split], lines[split+1:]
+	}
+
+	delimiter := "\n"
+	if arg2 != "" {
+		delimiter = processEscapeSequences(arg2)
+	}
+
+	var result []string
+	for i := 0; i < len(first) || i < len(second); i++ {
+		switch {
+		case i < len(first) && i < len(second):
+			result = append(result, first[i]+delimiter+second[i])
+		case i < len(first):
+			result = append(result, first[i])
+		default:
+			result = append(result, second[i])
+		}
+	}
+
+	return strings.Join(result, "\n")
+}
+
+// diffBlocks splits the input at a separator line and diffs the block before it with the block after it
+// Each line of the result is prefixed with " " (in both), "-" (only before) or "+" (only after)
+// arg1: separator line (default "---")
+func diffBlocks(input, arg1, arg2 string) string {
+	separator := "---"
+	if strings.TrimSpace(arg1) != "" {
+		separator = strings.TrimSpace(arg1)
 	}
 
-	lines := strings.Split(input, "\n")
-	seen := make(map[string]bool)
-	result := []string{}
+	lines := strings.Split(strings.TrimSuffix(input, "\n"), "\n")
+	split := slices.IndexFunc(lines, func(line string) bool { return strings.TrimSpace(line) == separator })
+	if split < 0 {
+		return input
+	}
 
-	for _, line := range lines {
-		if !seen[line] {
-			seen[line] = true
-			result = append(result, line)
-		}
+	diff := DiffLines(lines[:split], lines[split+1:])
+	result := make([]string, len(diff))
+	for i, line := range diff {
+		result[i] = line.Marker() + line.Text
 	}
 
 	return strings.Join(result, "\n")
 }
 
-// filterBlankLines removes empty or whitespace-only lines
-func filterBlankLines(input, arg1, arg2 string) string {
+// commentLines prepends a comment marker to each non-blank line
+// arg1: comment marker (default "# ")
+// arg2: "skip" to leave already-commented lines untouched
+func commentLines(input, arg1, arg2 string) string {
 	if input == "" {
 		return input
 	}
 
-	lines := strings.Split(input, "\n")
-	result := []string{}
+	marker := "# "
+	if arg1 != "" {
+		marker = processEscapeSequences(arg1)
+	}
+	bareMarker := strings.TrimRight(marker, " ")
+	skipCommented := strings.EqualFold(strings.TrimSpace(arg2), "skip")
 
-	for _, line := range lines {
-		if strings.TrimSpace(line) != "" {
-			result = append(result, line)
+	lines := strings.Split(input, "\n")
+	for i, line := range lines {
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+		if skipCommented && bareMarker != "" && strings.HasPrefix(strings.TrimLeft(line, " \t"), bareMarker) {
+			continue
 		}
+		lines[i] = marker + line
 	}
 
-	return strings.Join(result, "\n")
+	return strings.Join(lines, "\n")
 }
 
-// filterLinesByLength filters lines by length
-// arg1: minimum length (0 if not specified)
-// arg2: maximum length (no limit if not specified)
-func filterLinesByLength(input, arg1, arg2 string) string {
+// uncommentLines strips a leading comment marker (and one following space) from each line
+// arg1: comment marker (default "# ")
+func uncommentLines(input, arg1, arg2 string) string {
 	if input == "" {
 		return input
 	}
 
-	minLen := 0
-	maxLen := -1
-
+	marker := "#"
 	if arg1 != "" {
-		if n, err := strconv.Atoi(arg1); err == nil && n >= 0 {
-			minLen = n
-		}
+		marker = strings.TrimRight(processEscapeSequences(arg1), " ")
 	}
-
-	if arg2 != "" {
-		if n, err := strconv.Atoi(arg2); err == nil && n >= 0 {
-			maxLen = n
-		}
+	if marker == "" {
+		return input
 	}
 
 	lines := strings.Split(input, "\n")
-	result := []string{}
-
-	for _, line := range lines {
-		len := len([]rune(line))
-		if len >= minLen && (maxLen < 0 || len <= maxLen) {
-			result = append(result, line)
+	for i, line := range lines {
+		rest := strings.TrimLeft(line, " \t")
+		if !strings.HasPrefix(rest, marker) {
+			continue
 		}
+		indent := line[:len(line)-len(rest)]
+		rest = strings.TrimPrefix(rest[len(marker):], " ")
+		lines[i] = indent + rest
 	}
 
-	return strings.Join(result, "\n")
+	return strings.Join(lines, "\n")
 }
 
 // Phase 2: Text Formatting
 
 // wrapText wraps text at a specified column width
+// Widths are measured in terminal cells, so full-width CJK characters count as two
 // arg1: column width (default 80)
+// arg2: "runes" to count one cell per character (faster, but misaligns wide characters)
 func wrapText(input, arg1, arg2 string) string {
-	width := 80
+	lineWidth := 80
 	if arg1 != "" {
 		if w, err := strconv.Atoi(arg1); err == nil && w > 0 {
-			width = w
+			lineWidth = w
 		}
 	}
+	countRunes := arg2 == "runes"
 
 	words := strings.Fields(input)
 	if len(words) == 0 {
@@ -977,12 +2488,12 @@ func wrapText(input, arg1, arg2 string) string {
 	lineLen := 0
 
 	for _, word := range words {
-		wordLen := len([]rune(word))
+		wordLen := textWidth(word, countRunes)
 
 		if lineLen == 0 {
 			result.WriteString(word)
 			lineLen = wordLen
-		} else if lineLen+1+wordLen <= width {
+		} else if lineLen+1+wordLen <= lineWidth {
 			result.WriteString(" ")
 			result.WriteString(word)
 			lineLen += 1 + wordLen
@@ -996,6 +2507,34 @@ func wrapText(input, arg1, arg2 string) string {
 	return result.String()
 }
 
+// textWidth returns the number of terminal cells s occupies
+// East Asian wide and full-width characters take two cells and combining marks none
+// countRunes skips the lookup and counts one cell per rune
+func textWidth(s string, countRunes bool) int {
+	if countRunes {
+		return utf8.RuneCountInString(s)
+	}
+
+	cells := 0
+	for _, r := range s {
+		switch {
+		case unicode.In(r, unicode.Mn, unicode.Me, unicode.Cf):
+			// Zero width
+		case r < 0x1100:
+			// Fast path: nothing below the Hangul Jamo block is wide
+			cells++
+		default:
+			switch width.LookupRune(r).Kind() {
+			case width.EastAsianWide, width.EastAsianFullwidth:
+				cells += 2
+			default:
+				cells++
+			}
+		}
+	}
+	return cells
+}
+
 // rewrapText unwraps text and then rewraps at specified width
 // arg1: column width (default 80)
 func rewrapText(input, arg1, arg2 string) string {
@@ -1035,6 +2574,50 @@ func makeParagraphs(input, arg1, arg2 string) string {
 	return strings.Join(paragraphs, "\n\n")
 }
 
+// splitSentences puts each sentence on its own line
+// Sentences end at . ! or ? followed by whitespace; common abbreviations
+// such as "Dr." and "e.g." do not end a sentence
+// Spacing within a line is kept as written; a sentence wrapped over several lines is
+// joined with a single space where it was wrapped
+func splitSentences(input, arg1, arg2 string) string {
+	if strings.TrimSpace(input) == "" {
+		return input
+	}
+
+	var sentences []string
+	var current strings.Builder
+	prevEnd := -1
+
+	for _, bounds := range mustCompileRegex(`\S+`).FindAllStringIndex(input, -1) {
+		word := input[bounds[0]:bounds[1]]
+		if current.Len() > 0 {
+			if space := input[prevEnd:bounds[0]]; strings.ContainsAny(space, "\r\n") {
+				current.WriteByte(' ')
+			} else {
+				current.WriteString(space)
+			}
+		}
+		current.WriteString(word)
+		prevEnd = bounds[1]
+
+		trimmed := strings.TrimRight(word, "\"')]”’")
+		if trimmed == "" {
+			continue
+		}
+		last := trimmed[len(trimmed)-1]
+		if last == '!' || last == '?' || (last == '.' && !isAbbreviation(trimmed)) {
+			sentences = append(sentences, current.String())
+			current.Reset()
+		}
+	}
+
+	if current.Len() > 0 {
+		sentences = append(sentences, current.String())
+	}
+
+	return strings.Join(sentences, "\n")
+}
+
 // quoteText adds a prefix to each line (like "> " for blockquote)
 // arg1: prefix string (default "> ")
 func quoteText(input, arg1, arg2 string) string {
@@ -1057,18 +2640,122 @@ func quoteText(input, arg1, arg2 string) string {
 	return strings.Join(result, "\n")
 }
 
+// templateLines formats each line with a template
+// arg1: template where {line} is the line and {n} its 1-based line number, e.g. "<li>{line}</li>"
+func templateLines(input, arg1, arg2 string) string {
+	if input == "" || arg1 == "" {
+		return input
+	}
+
+	template := processEscapeSequences(arg1)
+	lines := strings.Split(input, "\n")
+	result := make([]string, len(lines))
+
+	for i, line := range lines {
+		// A single replacer so "{n}" inside a line isn't replaced again
+		result[i] = strings.NewReplacer("{line}", line, "{n}", strconv.Itoa(i+1)).Replace(template)
+	}
+
+	return strings.Join(result, "\n")
+}
+
+// fillTemplate replaces {{key}} placeholders in the input, for mail-merge style text
+// arg1: the values, as a JSON object or as key=value lines
+// arg2: "empty" to remove placeholders without a value (they are kept by default)
+func fillTemplate(input, arg1, arg2 string) string {
+	values, err := parseTemplateValues(arg1)
+	if err != nil {
+		return input
+	}
+
+	return mustCompileRegex(`\{\{\s*([^{}]*?)\s*\}\}`).ReplaceAllStringFunc(input, func(placeholder string) string {
+		key := strings.TrimSpace(placeholder[2 : len(placeholder)-2])
+		if value, ok := values[key]; ok {
+			return value
+		}
+		if arg2 == "empty" {
+			return ""
+		}
+		return placeholder
+	})
+}
+
+// parseTemplateValues reads Fill Template values from a JSON object or from key=value lines
+// JSON values that aren't strings are used in their JSON form
+func parseTemplateValues(text string) (map[string]string, error) {
+	values := make(map[string]string)
+
+	if strings.HasPrefix(strings.TrimSpace(text), "{") {
+		var object map[string]json.RawMessage
+		if err := json.Unmarshal([]byte(text), &object); err != nil {
+			return nil, err
+		}
+		for key, raw := range object {
+			var str string
+			if err := json.Unmarshal(raw, &str); err == nil {
+				values[key] = str
+			} else {
+				values[key] = string(raw)
+			}
+		}
+		return values, nil
+	}
+
+	for _, line := range strings.Split(processEscapeSequences(text), "\n") {
+		key, value, ok := strings.Cut(line, "=")
+		if key = strings.TrimSpace(key); ok && key != "" {
+			values[key] = value
+		}
+	}
+	return values, nil
+}
+
 // indentText adds indentation to each line
 // arg1: indentation string (default "    " - 4 spaces)
+// arg2: "skip" to leave blank and whitespace-only lines unindented
 func indentText(input, arg1, arg2 string) string {
-	return quoteText(input, arg1, arg2)
+	if input == "" {
+		return input
+	}
+
+	indent := "    "
+	if arg1 != "" {
+		indent = arg1
+	}
+	skipBlank := arg2 == "skip"
+
+	lines := strings.Split(input, "\n")
+	result := make([]string, len(lines))
+
+	for i, line := range lines {
+		if skipBlank && strings.TrimSpace(line) == "" {
+			result[i] = line
+			continue
+		}
+		result[i] = indent + line
+	}
+
+	return strings.Join(result, "\n")
 }
 
 // unindentText removes common leading whitespace
+// Indentation is measured in columns, with a tab advancing to the next tab stop, so
+// tab-indented and space-indented lines line up the way an editor shows them
+// arg1: tab width (default 4)
 func unindentText(input, arg1, arg2 string) string {
 	if input == "" {
 		return input
 	}
 
+	tabWidth := 4
+	if arg1 != "" {
+		n, err := strconv.Atoi(strings.TrimSpace(arg1))
+		if err != nil || n <= 0 {
+			return input
+		}
+		tabWidth = n
+	}
+
 	lines := strings.Split(input, "\n")
 
 	// Find minimum indentation
@@ -1080,8 +2767,10 @@ func unindentText(input, arg1, arg2 string) string {
 
 		indent := 0
 		for _, ch := range line {
-			if ch == ' ' || ch == '\t' {
+			if ch == ' ' {
 				indent++
+			} else if ch == '\t' {
+				indent += tabWidth - indent%tabWidth
 			} else {
 				break
 			}
@@ -1099,37 +2788,63 @@ func unindentText(input, arg1, arg2 string) string {
 	// Remove the minimum indentation
 	result := make([]string, len(lines))
 	for i, line := range lines {
-		if len(line) >= minIndent {
-			result[i] = line[minIndent:]
+		result[i] = removeIndentColumns(line, minIndent, tabWidth)
+	}
+
+	return strings.Join(result, "\n")
+}
+
+// removeIndentColumns strips the first cols columns of leading whitespace from line
+// Tabs left in the indentation keep their width only when the cut is on a tab stop;
+// otherwise the rest of the indentation is rewritten as spaces so the text stays in its column
+func removeIndentColumns(line string, cols, tabWidth int) string {
+	// Measure the leading whitespace, remembering the byte where cols is reached exactly
+	indent, end, cut := 0, 0, -1
+	for end < len(line) && (line[end] == ' ' || line[end] == '\t') {
+		if indent == cols {
+			cut = end
+		}
+		if line[end] == ' ' {
+			indent++
 		} else {
-			result[i] = line
+			indent += tabWidth - indent%tabWidth
 		}
+		end++
 	}
 
-	return strings.Join(result, "\n")
+	if indent <= cols {
+		return line[end:]
+	}
+	if cut >= 0 && (cols%tabWidth == 0 || !strings.Contains(line[cut:end], "\t")) {
+		return line[cut:]
+	}
+	return strings.Repeat(" ", indent-cols) + line[end:]
 }
 
 // centerText centers each line within a specified width
+// Widths are measured in terminal cells, so full-width CJK characters count as two
 // arg1: width (default 80)
+// arg2: "runes" to count one cell per character (faster, but misaligns wide characters)
 func centerText(input, arg1, arg2 string) string {
-	width := 80
+	lineWidth := 80
 	if arg1 != "" {
 		if w, err := strconv.Atoi(arg1); err == nil && w > 0 {
-			width = w
+			lineWidth = w
 		}
 	}
+	countRunes := arg2 == "runes"
 
 	lines := strings.Split(input, "\n")
 	result := make([]string, len(lines))
 
 	for i, line := range lines {
 		trimmed := strings.TrimSpace(line)
-		lineLen := len([]rune(trimmed))
+		lineLen := textWidth(trimmed, countRunes)
 
-		if lineLen >= width {
+		if lineLen >= lineWidth {
 			result[i] = trimmed
 		} else {
-			padding := (width - lineLen) / 2
+			padding := (lineWidth - lineLen) / 2
 			result[i] = strings.Repeat(" ", padding) + trimmed
 		}
 	}
@@ -1163,11 +2878,63 @@ func capitalizeSentences(input, arg1, arg2 string) string {
 	return string(result)
 }
 
+// sentenceCase lowercases the text and capitalizes the first letter of each sentence
+func sentenceCase(input, arg1, arg2 string) string {
+	if input == "" {
+		return input
+	}
+
+	runes := []rune(strings.ToLower(input))
+	capitalizeNext := true
+	wordStart := 0
+
+	for i, r := range runes {
+		if capitalizeNext && unicode.IsLetter(r) {
+			runes[i] = unicode.ToUpper(r)
+			capitalizeNext = false
+		}
+
+		if !unicode.IsSpace(r) {
+			continue
+		}
+
+		if i > wordStart {
+			word := string(runes[wordStart:i])
+			last := runes[i-1]
+			if last == '!' || last == '?' || (last == '.' && !isAbbreviation(word)) {
+				capitalizeNext = true
+			}
+		}
+		wordStart = i + 1
+	}
+
+	return string(runes)
+}
+
+// isAbbreviation reports whether a word ending in a period is a common abbreviation
+// rather than the end of a sentence
+func isAbbreviation(word string) bool {
+	word = strings.TrimLeft(strings.ToLower(word), "([\"'")
+
+	switch word {
+	case "mr.", "mrs.", "ms.", "dr.", "prof.", "st.", "vs.", "approx.", "no.":
+		return true
+	}
+
+	// Dotted initialisms like "e.g." and "i.e."
+	return mustCompileRegex(`^(\pL\.){2,}$`).MatchString(word)
+}
+
 // randomcase randomly capitalizes or lowercases each letter
 func randomcase(input, arg1, arg2 string) string {
+	return randomcaseWith(newUnseededRand(), input, arg1, arg2)
+}
+
+// randomcaseWith randomly capitalizes or lowercases each letter using rng
+func randomcaseWith(rng *rand.Rand, input, arg1, arg2 string) string {
 	return strings.Map(func(r rune) rune {
 		if unicode.IsLetter(r) {
-			if int(time.Now().UnixNano())%2 == 0 {
+			if rng.Intn(2) == 0 {
 				return unicode.ToUpper(r)
 			}
 			return unicode.ToLower(r)
@@ -1176,6 +2943,44 @@ func randomcase(input, arg1, arg2 string) string {
 	}, input)
 }
 
+// toggleCase swaps upper and lower case for each letter
+func toggleCase(input, arg1, arg2 string) string {
+	return strings.Map(func(r rune) rune {
+		if unicode.IsUpper(r) {
+			return unicode.ToLower(r)
+		}
+		if unicode.IsLower(r) {
+			return unicode.ToUpper(r)
+		}
+		return r
+	}, input)
+}
+
+// alternateCase alternates upper and lower case across letters, starting with upper
+// arg1: "word" to restart the pattern at the beginning of each word
+func alternateCase(input, arg1, arg2 string) string {
+	perWord := strings.EqualFold(strings.TrimSpace(arg1), "word")
+	upper := true
+
+	return strings.Map(func(r rune) rune {
+		if !unicode.IsLetter(r) {
+			if perWord && unicode.IsSpace(r) {
+				upper = true
+			}
+			return r
+		}
+
+		var mapped rune
+		if upper {
+			mapped = unicode.ToUpper(r)
+		} else {
+			mapped = unicode.ToLower(r)
+		}
+		upper = !upper
+		return mapped
+	}, input)
+}
+
 // stripDiacritics removes diacritical marks from characters
 // This is a simple version that removes common diacritics
 func stripDiacritics(input, arg1, arg2 string) string {
@@ -1259,10 +3064,10 @@ func slugify(input, arg1, arg2 string) string {
 	slug = strings.ReplaceAll(slug, "_", "-")
 
 	// Remove non-alphanumeric characters except hyphens
-	slug = regexp.MustCompile(`[^a-z0-9-]`).ReplaceAllString(slug, "")
+	slug = mustCompileRegex(`[^a-z0-9-]`).ReplaceAllString(slug, "")
 
 	// Remove consecutive hyphens
-	slug = regexp.MustCompile(`-+`).ReplaceAllString(slug, "-")
+	slug = mustCompileRegex(`-+`).ReplaceAllString(slug, "-")
 
 	// Trim hyphens from start and end
 	slug = strings.Trim(slug, "-")
@@ -1271,37 +3076,54 @@ func slugify(input, arg1, arg2 string) string {
 }
 
 // smartQuotes converts straight quotes to curly/smart quotes
+// Each quote is judged by its neighbours: it opens after whitespace or opening punctuation when
+// text follows, otherwise it closes, so apostrophes in "don't" and "dogs'" become right quotes
 func smartQuotes(input, arg1, arg2 string) string {
-	result := input
+	runes := []rune(input)
+	processedRunes := make([]rune, 0, len(runes))
+
+	for i, r := range runes {
+		if r != '"' && r != '\'' {
+			processedRunes = append(processedRunes, r)
+			continue
+		}
+
+		// Look at the already converted previous rune, so a closing quote is never mistaken for an opening one
+		var prev, next rune
+		if len(processedRunes) > 0 {
+			prev = processedRunes[len(processedRunes)-1]
+		}
+		if i+1 < len(runes) {
+			next = runes[i+1]
+		}
 
-	// Replace double quotes with smart quotes (alternating left and right)
-	// This is a simple implementation that replaces pairs of straight quotes
-	quoteRunes := []rune(result)
-	inQuote := false
-	processedRunes := make([]rune, 0, len(quoteRunes))
+		opening := isQuoteOpeningContext(prev) && next != 0 && !unicode.IsSpace(next)
 
-	for _, r := range quoteRunes {
 		if r == '"' {
-			if inQuote {
-				processedRunes = append(processedRunes, '\u201d') // right double quotation mark
-			} else {
+			if opening {
 				processedRunes = append(processedRunes, '\u201c') // left double quotation mark
-			}
-			inQuote = !inQuote
-		} else if r == '\'' {
-			if inQuote {
-				processedRunes = append(processedRunes, '\u2019') // right single quotation mark
 			} else {
-				processedRunes = append(processedRunes, '\u2018') // left single quotation mark
+				processedRunes = append(processedRunes, '\u201d') // right double quotation mark
 			}
 		} else {
-			processedRunes = append(processedRunes, r)
+			// A leading apostrophe before a digit marks an elision ('90s), not a quote
+			if opening && !unicode.IsDigit(next) {
+				processedRunes = append(processedRunes, '\u2018') // left single quotation mark
+			} else {
+				processedRunes = append(processedRunes, '\u2019') // right single quotation mark / apostrophe
+			}
 		}
 	}
 
 	return string(processedRunes)
 }
 
+// isQuoteOpeningContext reports whether a quote following prev may open a quotation
+// prev is 0 at the start of the text
+func isQuoteOpeningContext(prev rune) bool {
+	return prev == 0 || unicode.IsSpace(prev) || strings.ContainsRune("([{<\u201c\u2018-\u2013\u2014", prev)
+}
+
 // straightQuotes converts curly/smart quotes to straight quotes
 func straightQuotes(input, arg1, arg2 string) string {
 	result := input
@@ -1361,6 +3183,37 @@ func hexDecode(input, arg1, arg2 string) string {
 	return string(decoded)
 }
 
+// toBinary converts each byte to its 8-bit binary representation
+func toBinary(input, arg1, arg2 string) string {
+	data := []byte(input)
+	octets := make([]string, len(data))
+	for i, b := range data {
+		octets[i] = fmt.Sprintf("%08b", b)
+	}
+	return strings.Join(octets, " ")
+}
+
+// fromBinary parses whitespace-separated binary octets back to text
+func fromBinary(input, arg1, arg2 string) string {
+	fields := strings.Fields(input)
+	if len(fields) == 0 {
+		return input
+	}
+
+	data := make([]byte, len(fields))
+	for i, field := range fields {
+		if len(field) > 8 {
+			return input
+		}
+		b, err := strconv.ParseUint(field, 2, 8)
+		if err != nil {
+			return input
+		}
+		data[i] = byte(b)
+	}
+	return string(data)
+}
+
 // rot13 applies ROT13 cipher
 func rot13(input, arg1, arg2 string) string {
 	return strings.Map(func(r rune) rune {
@@ -1389,6 +3242,57 @@ func unescapeQuotes(input, arg1, arg2 string) string {
 	return result
 }
 
+// escapeFor escapes text for a specific string context
+// arg1: context - "json", "csv", "shell" or "regex"
+func escapeFor(input, arg1, arg2 string) string {
+	switch strings.ToLower(strings.TrimSpace(arg1)) {
+	case "json":
+		var buf strings.Builder
+		encoder := json.NewEncoder(&buf)
+		encoder.SetEscapeHTML(false)
+		if err := encoder.Encode(input); err != nil {
+			return input
+		}
+		encoded := strings.TrimSuffix(buf.String(), "\n")
+		return encoded[1 : len(encoded)-1]
+	case "csv":
+		return `"` + strings.ReplaceAll(input, `"`, `""`) + `"`
+	case "shell":
+		return "'" + strings.ReplaceAll(input, "'", `'\''`) + "'"
+	case "regex":
+		return regexp.QuoteMeta(input)
+	default:
+		return input
+	}
+}
+
+// unescapeFor reverses escapeFor for a specific string context
+// arg1: context - "json", "csv", "shell" or "regex"
+func unescapeFor(input, arg1, arg2 string) string {
+	switch strings.ToLower(strings.TrimSpace(arg1)) {
+	case "json":
+		var decoded string
+		if err := json.Unmarshal([]byte(`"`+input+`"`), &decoded); err != nil {
+			return input
+		}
+		return decoded
+	case "csv":
+		if len(input) < 2 || !strings.HasPrefix(input, `"`) || !strings.HasSuffix(input, `"`) {
+			return input
+		}
+		return strings.ReplaceAll(input[1:len(input)-1], `""`, `"`)
+	case "shell":
+		if len(input) < 2 || !strings.HasPrefix(input, "'") || !strings.HasSuffix(input, "'") {
+			return input
+		}
+		return strings.ReplaceAll(input[1:len(input)-1], `'\''`, "'")
+	case "regex":
+		return mustCompileRegex(`\\([\\.+*?()|\[\]{}^$])`).ReplaceAllString(input, "$1")
+	default:
+		return input
+	}
+}
+
 // insertDateTime inserts current date/time
 // arg1: format string (e.g., "2006-01-02" for date, default: RFC3339)
 func insertDateTime(input, arg1, arg2 string) string {
@@ -1413,7 +3317,7 @@ func insertDateTime(input, arg1, arg2 string) string {
 
 // urlsToHyperlinks converts plain URLs to HTML hyperlinks
 func urlsToHyperlinks(input, arg1, arg2 string) string {
-	urlRegex := regexp.MustCompile(`https?://[^\s]+`)
+	urlRegex := mustCompileRegex(`https?://[^\s]+`)
 
 	format := `<a href="$0">$0</a>`
 	if arg1 != "" {
@@ -1432,7 +3336,7 @@ func urlsToHyperlinks(input, arg1, arg2 string) string {
 
 // extractUrls finds all URLs in text
 func extractUrls(input, arg1, arg2 string) string {
-	urlRegex := regexp.MustCompile(`https?://[^\s]+`)
+	urlRegex := mustCompileRegex(`https?://[^\s]+`)
 	matches := urlRegex.FindAllString(input, -1)
 
 	if len(matches) == 0 {
@@ -1444,19 +3348,64 @@ func extractUrls(input, arg1, arg2 string) string {
 
 // extractEmails finds all email addresses
 func extractEmails(input, arg1, arg2 string) string {
-	emailRegex := regexp.MustCompile(`[a-zA-Z0-9._%+-]+@[a-zA-Z0-9.-]+\.[a-zA-Z]{2,}`)
+	emailRegex := mustCompileRegex(`[a-zA-Z0-9._%+-]+@[a-zA-Z0-9.-]+\.[a-zA-Z]{2,}`)
 	matches := emailRegex.FindAllString(input, -1)
 
-	if len(matches) == 0 {
-		return ""
+	if len(matches) == 0 {
+		return ""
+	}
+
+	return strings.Join(matches, "\n")
+}
+
+// numberPattern matches the numbers the number operations work on: an optional minus
+// sign, digits and an optional decimal part
+const numberPattern = `-?\d+(?:\.\d+)?`
+
+// groupedNumberPattern is numberPattern that also matches digits grouped in thousands with
+// commas, as in "1,234.5"
+const groupedNumberPattern = `-?(?:\d{1,3}(?:,\d{3})+|\d+)(?:\.\d+)?`
+
+// standaloneNumber checks a number matched at input[start:] whose text, with any unit, ends
+// at end; it isn't a number on its own when a letter or digit touches it, as in "X200v2"
+// A minus sign right after a letter or digit is a hyphen, as in "555-1234", so the returned
+// start skips it
+func standaloneNumber(input string, start, end int) (int, bool) {
+	before, _ := utf8.DecodeLastRuneInString(input[:start])
+	if input[start] == '-' && (unicode.IsLetter(before) || unicode.IsDigit(before)) {
+		start++
+		before = '-'
+	}
+	after, _ := utf8.DecodeRuneInString(input[end:])
+	for _, r := range []rune{before, after} {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			return start, false
+		}
 	}
+	return start, true
+}
 
-	return strings.Join(matches, "\n")
+// hyphenJoined reports whether the number at input[start:end] is joined to another number by a
+// hyphen, as in dates ("2024-01-15") and phone numbers ("555-1234")
+func hyphenJoined(input string, start, end int) bool {
+	if strings.HasSuffix(input[:start], "-") {
+		before, _ := utf8.DecodeLastRuneInString(input[:start-1])
+		if unicode.IsDigit(before) {
+			return true
+		}
+	}
+	if strings.HasPrefix(input[end:], "-") {
+		after, _ := utf8.DecodeRuneInString(input[end+1:])
+		if unicode.IsDigit(after) {
+			return true
+		}
+	}
+	return false
 }
 
 // extractNumbers finds all numbers in text
 func extractNumbers(input, arg1, arg2 string) string {
-	numberRegex := regexp.MustCompile(`-?\d+(?:\.\d+)?`)
+	numberRegex := mustCompileRegex(numberPattern)
 	matches := numberRegex.FindAllString(input, -1)
 
 	if len(matches) == 0 {
@@ -1466,6 +3415,63 @@ func extractNumbers(input, arg1, arg2 string) string {
 	return strings.Join(matches, "\n")
 }
 
+// numberUnits are the units recognized after a space, in lowercase; a unit written right
+// against its number (e.g. "5kg") is taken whatever it is
+var numberUnits = map[string]bool{
+	"mg": true, "g": true, "kg": true, "t": true, "oz": true, "lb": true, "lbs": true,
+	"mm": true, "cm": true, "m": true, "km": true, "ft": true, "yd": true, "mi": true,
+	"ml": true, "l": true, "ms": true, "s": true, "min": true, "h": true, "hr": true, "hrs": true,
+	"km/h": true, "m/s": true, "mph": true, "b": true, "kb": true, "mb": true, "gb": true,
+	"tb": true, "kib": true, "mib": true, "gib": true, "tib": true, "%": true, "°c": true,
+	"°f": true, "hz": true, "khz": true, "mhz": true, "ghz": true, "w": true, "kw": true,
+	"v": true, "mah": true, "px": true, "pt": true, "em": true,
+	"usd": true, "eur": true, "gbp": true, "jpy": true, "chf": true,
+}
+
+// extractNumbersWithUnits extracts numbers with the unit after them or the currency
+// symbol before them, one "number unit" pair per line, e.g. "5kg" and "$3" give "5 kg"
+// and "3 $"; numbers without a unit are extracted on their own
+// Numbers may be grouped in thousands ("$1,234.56"); digits inside words, as in "X200v2",
+// are skipped
+func extractNumbersWithUnits(input, arg1, arg2 string) string {
+	re := mustCompileRegex(`([$€£¥]) ?(` + groupedNumberPattern + `)|(` + groupedNumberPattern + `)( ?)([\p{L}%°][\p{L}%°/²³]*)?`)
+
+	var results []string
+	for _, m := range re.FindAllStringSubmatchIndex(input, -1) {
+		if m[2] >= 0 {
+			if start, ok := standaloneNumber(input, m[4], m[5]); ok {
+				results = append(results, input[start:m[5]]+" "+input[m[2]:m[3]])
+			}
+			continue
+		}
+
+		unit := ""
+		if m[10] >= 0 {
+			unit = input[m[10]:m[11]]
+		}
+		attached := m[8] == m[9]
+		end := m[7]
+		if unit != "" && (attached || numberUnits[strings.ToLower(unit)]) {
+			end = m[11]
+		} else {
+			// A word after a space that isn't a unit, as in "3 apples", stays behind
+			unit = ""
+		}
+
+		start, ok := standaloneNumber(input, m[6], end)
+		if !ok {
+			continue
+		}
+		if unit != "" {
+			results = append(results, input[start:m[7]]+" "+unit)
+		} else {
+			results = append(results, input[start:m[7]])
+		}
+	}
+
+	return strings.Join(results, "\n")
+}
+
 // Phase 6: Advanced Regex
 
 // extractWithGroups extracts regex matches with capture groups
@@ -1476,7 +3482,7 @@ func extractWithGroups(input, arg1, arg2 string) string {
 		return input
 	}
 
-	re, err := regexp.Compile(arg1)
+	re, err := compileRegex(arg1)
 	if err != nil {
 		return input
 	}
@@ -1511,7 +3517,7 @@ func replaceWithGroups(input, arg1, arg2 string) string {
 		return input
 	}
 
-	re, err := regexp.Compile(arg1)
+	re, err := compileRegex(arg1)
 	if err != nil {
 		return input
 	}
@@ -1532,7 +3538,7 @@ func splitByRegex(input, arg1, arg2 string) string {
 		return input
 	}
 
-	re, err := regexp.Compile(arg1)
+	re, err := compileRegex(arg1)
 	if err != nil {
 		return input
 	}
@@ -1554,7 +3560,7 @@ func matchCount(input, arg1, arg2 string) string {
 		return "0"
 	}
 
-	re, err := regexp.Compile(arg1)
+	re, err := compileRegex(arg1)
 	if err != nil {
 		return "0"
 	}
@@ -1565,6 +3571,23 @@ func matchCount(input, arg1, arg2 string) string {
 
 // Phase 7: Math & Numbers
 
+// groupThousands puts separator between every group of three digits, counted from the right
+func groupThousands(digits, separator string) string {
+	runes := []rune(digits)
+	if len(runes) <= 3 {
+		return digits
+	}
+
+	var withSeparators []rune
+	for i, r := range runes {
+		if i > 0 && (len(runes)-i)%3 == 0 {
+			withSeparators = append(withSeparators, []rune(separator)...)
+		}
+		withSeparators = append(withSeparators, r)
+	}
+	return string(withSeparators)
+}
+
 // formatNumbersOperation formats all numbers in text
 // arg1: decimal places
 // arg2: thousands separator (comma by default)
@@ -1581,7 +3604,7 @@ func formatNumbersOperation(input, arg1, arg2 string) string {
 		separator = arg2
 	}
 
-	numberRegex := regexp.MustCompile(`-?\d+(?:\.\d+)?`)
+	numberRegex := mustCompileRegex(numberPattern)
 
 	result := numberRegex.ReplaceAllStringFunc(input, func(match string) string {
 		num, err := strconv.ParseFloat(match, 64)
@@ -1603,18 +3626,7 @@ func formatNumbersOperation(input, arg1, arg2 string) string {
 			intPart = intPart[1:]
 		}
 
-		// Add separators
-		runes := []rune(intPart)
-		if len(runes) > 3 {
-			var withSeparators []rune
-			for i, r := range runes {
-				if i > 0 && (len(runes)-i)%3 == 0 {
-					withSeparators = append(withSeparators, []rune(separator)...)
-				}
-				withSeparators = append(withSeparators, r)
-			}
-			intPart = string(withSeparators)
-		}
+		intPart = groupThousands(intPart, separator)
 
 		if negative {
 			intPart = "-" + intPart
@@ -1629,6 +3641,79 @@ func formatNumbersOperation(input, arg1, arg2 string) string {
 	return result
 }
 
+// currencyFormat describes how amounts are written in a currency's usual locale
+type currencyFormat struct {
+	prefix   string // Written before the amount, e.g. "$"
+	suffix   string // Written after the amount, e.g. " €"
+	decimals int
+	group    string // Thousands separator
+	point    string // Decimal separator
+}
+
+// currencyFormats maps currency codes to their format
+var currencyFormats = map[string]currencyFormat{
+	"USD": {prefix: "$", decimals: 2, group: ",", point: "."},
+	"EUR": {suffix: " €", decimals: 2, group: ".", point: ","},
+	"GBP": {prefix: "£", decimals: 2, group: ",", point: "."},
+	"JPY": {prefix: "¥", decimals: 0, group: ",", point: "."},
+	"CHF": {prefix: "CHF ", decimals: 2, group: "'", point: "."},
+}
+
+// formatCurrency formats each number in the text as an amount of money
+// arg1: currency code (default USD), which sets the symbol and where it goes, the number
+// of decimals and the separators, e.g. 1234.5 becomes "$1,234.50" or "1.234,50 €"
+// Numbers already grouped with commas ("1,234.50") are read as one amount
+// An unknown currency leaves the text unchanged
+func formatCurrency(input, arg1, arg2 string) string {
+	code := strings.ToUpper(strings.TrimSpace(arg1))
+	if code == "" {
+		code = "USD"
+	}
+	format, ok := currencyFormats[code]
+	if !ok {
+		return input
+	}
+
+	// Numbers inside words, or joined by hyphens as in dates, aren't amounts
+	numberRegex := mustCompileRegex(groupedNumberPattern)
+	var result strings.Builder
+	last := 0
+	for _, m := range numberRegex.FindAllStringIndex(input, -1) {
+		start, ok := standaloneNumber(input, m[0], m[1])
+		if !ok || hyphenJoined(input, start, m[1]) {
+			continue
+		}
+		num, err := strconv.ParseFloat(strings.ReplaceAll(input[start:m[1]], ",", ""), 64)
+		if err != nil {
+			continue
+		}
+		result.WriteString(input[last:start])
+		result.WriteString(format.amount(num))
+		last = m[1]
+	}
+	result.WriteString(input[last:])
+	return result.String()
+}
+
+// amount formats num as an amount of money in the currency
+func (format currencyFormat) amount(num float64) string {
+	// Halves round away from zero, as usual for money, rather than to even
+	scale := math.Pow10(format.decimals)
+	formatted := fmt.Sprintf("%.*f", format.decimals, math.Round(math.Abs(num)*scale)/scale)
+	intPart, fraction, _ := strings.Cut(formatted, ".")
+	amount := groupThousands(intPart, format.group)
+	if fraction != "" {
+		amount += format.point + fraction
+	}
+
+	// Amounts that round to zero don't get a minus sign
+	sign := ""
+	if num < 0 && strings.Trim(formatted, "0.") != "" {
+		sign = "-"
+	}
+	return sign + format.prefix + amount + format.suffix
+}
+
 // roundNumbers rounds all numbers in text to specified decimal places
 // arg1: decimal places
 func roundNumbers(input, arg1, arg2 string) string {
@@ -1639,7 +3724,7 @@ func roundNumbers(input, arg1, arg2 string) string {
 		}
 	}
 
-	numberRegex := regexp.MustCompile(`-?\d+(?:\.\d+)?`)
+	numberRegex := mustCompileRegex(numberPattern)
 
 	result := numberRegex.ReplaceAllStringFunc(input, func(match string) string {
 		num, err := strconv.ParseFloat(match, 64)
@@ -1654,9 +3739,55 @@ func roundNumbers(input, arg1, arg2 string) string {
 	return result
 }
 
+// scientificNotation writes each number in the text in scientific notation, e.g. 12345 becomes 1.235e+04
+// arg1: significant digits (default 4)
+// arg2: "engineering" keeps the exponent a multiple of 3, moving up to two more digits in
+// front of the point, e.g. 12345 becomes 12.35e+03
+// Numbers already in e notation are read whole, and everything else is left as it is
+func scientificNotation(input, arg1, arg2 string) string {
+	digits := 4
+	if n, err := strconv.Atoi(arg1); err == nil && n > 0 {
+		digits = n
+	}
+	engineering := arg2 == "engineering"
+
+	numberRegex := mustCompileRegex(`-?\d+(?:\.\d+)?(?:[eE][-+]?\d+)?`)
+	return numberRegex.ReplaceAllStringFunc(input, func(match string) string {
+		num, err := strconv.ParseFloat(match, 64)
+		if err != nil || math.IsInf(num, 0) {
+			return match
+		}
+
+		formatted := strconv.FormatFloat(num, 'e', digits-1, 64)
+		if !engineering {
+			return formatted
+		}
+
+		// Rounding has already happened, so only the point and the exponent move
+		mantissa, exponentText, _ := strings.Cut(formatted, "e")
+		exponent, _ := strconv.Atoi(exponentText)
+		shift := ((exponent % 3) + 3) % 3
+
+		sign := ""
+		if strings.HasPrefix(mantissa, "-") {
+			sign, mantissa = "-", mantissa[1:]
+		}
+		significant := strings.Replace(mantissa, ".", "", 1)
+		if len(significant) <= shift {
+			significant += strings.Repeat("0", shift+1-len(significant))
+		}
+
+		result := sign + significant[:shift+1]
+		if fraction := significant[shift+1:]; fraction != "" {
+			result += "." + fraction
+		}
+		return fmt.Sprintf("%se%+03d", result, exponent-shift)
+	})
+}
+
 // sumNumbers extracts all numbers and returns their sum
 func sumNumbers(input, arg1, arg2 string) string {
-	numberRegex := regexp.MustCompile(`-?\d+(?:\.\d+)?`)
+	numberRegex := mustCompileRegex(numberPattern)
 	matches := numberRegex.FindAllString(input, -1)
 
 	sum := 0.0
@@ -1669,6 +3800,59 @@ func sumNumbers(input, arg1, arg2 string) string {
 	return formatNumber(sum)
 }
 
+// aggregateNumbers computes one value over all numbers found in the text
+// arg1: "sum" (default), "avg", "min", "max", "median" or "count"
+// The median of an even number of values is the mean of the middle two
+// Without numbers, sum and count give 0 and the others give an empty result;
+// an unknown aggregate leaves the text unchanged
+func aggregateNumbers(input, arg1, arg2 string) string {
+	aggregate := strings.ToLower(strings.TrimSpace(arg1))
+	if aggregate == "" {
+		aggregate = "sum"
+	}
+
+	var numbers []float64
+	for _, match := range mustCompileRegex(numberPattern).FindAllString(input, -1) {
+		if num, err := strconv.ParseFloat(match, 64); err == nil {
+			numbers = append(numbers, num)
+		}
+	}
+
+	sum := 0.0
+	for _, num := range numbers {
+		sum += num
+	}
+
+	switch aggregate {
+	case "sum":
+		return formatNumber(sum)
+	case "count":
+		return strconv.Itoa(len(numbers))
+	case "avg", "min", "max", "median":
+		if len(numbers) == 0 {
+			return ""
+		}
+	default:
+		return input
+	}
+
+	switch aggregate {
+	case "avg":
+		return formatNumber(sum / float64(len(numbers)))
+	case "min":
+		return formatNumber(slices.Min(numbers))
+	case "max":
+		return formatNumber(slices.Max(numbers))
+	default:
+		slices.Sort(numbers)
+		middle := len(numbers) / 2
+		if len(numbers)%2 == 0 {
+			return formatNumber((numbers[middle-1] + numbers[middle]) / 2)
+		}
+		return formatNumber(numbers[middle])
+	}
+}
+
 // Phase 8: List & Extraction
 
 // joinList joins lines with a delimiter
@@ -1697,6 +3881,17 @@ func removeControlCharacters(input, arg1, arg2 string) string {
 	}, input)
 }
 
+// stripPunctuation removes Unicode punctuation, keeping letters, digits and whitespace
+// arg1: punctuation characters to keep (e.g. "-'")
+func stripPunctuation(input, arg1, arg2 string) string {
+	return strings.Map(func(r rune) rune {
+		if unicode.IsPunct(r) && !strings.ContainsRune(arg1, r) {
+			return -1
+		}
+		return r
+	}, input)
+}
+
 // countOccurrences counts how many times a string appears
 // arg1: search string
 func countOccurrences(input, arg1, arg2 string) string {
@@ -1709,58 +3904,84 @@ func countOccurrences(input, arg1, arg2 string) string {
 }
 
 // keepLinesContaining keeps only lines containing the search string
-// arg1: search string
-// arg2: case-insensitive flag ("i")
+// arg1: search string, or several separated by "|" or newlines; "\|" is a literal "|"
+// arg2: flags - "i" for case-insensitive, "a" to require all search strings instead of any
 func keepLinesContaining(input, arg1, arg2 string) string {
+	return filterLinesContaining(input, arg1, arg2, true)
+}
+
+// removeLinesContaining removes lines containing the search string
+// arg1: search string, or several separated by "|" or newlines; "\|" is a literal "|"
+// arg2: flags - "i" for case-insensitive, "a" to require all search strings instead of any
+func removeLinesContaining(input, arg1, arg2 string) string {
+	return filterLinesContaining(input, arg1, arg2, false)
+}
+
+// splitSearchStrings splits search strings separated by "|" or newlines, skipping empty ones
+// A "|" escaped as "\|" is part of the search string
+func splitSearchStrings(arg string) []string {
+	var needles []string
+	var needle strings.Builder
+	flush := func() {
+		if needle.Len() > 0 {
+			needles = append(needles, needle.String())
+			needle.Reset()
+		}
+	}
+
+	for i := 0; i < len(arg); i++ {
+		switch {
+		case arg[i] == '\\' && i+1 < len(arg) && arg[i+1] == '|':
+			needle.WriteByte('|')
+			i++
+		case arg[i] == '|' || arg[i] == '\n':
+			flush()
+		default:
+			needle.WriteByte(arg[i])
+		}
+	}
+	flush()
+	return needles
+}
+
+// filterLinesContaining keeps (or, if keep is false, removes) the lines that match the search strings in arg1
+func filterLinesContaining(input, arg1, arg2 string, keep bool) string {
 	if input == "" || arg1 == "" {
 		return input
 	}
 
-	lines := strings.Split(input, "\n")
-	var result []string
-
 	caseInsensitive := strings.Contains(arg2, "i")
+	matchAll := strings.Contains(arg2, "a")
 
-	for _, line := range lines {
-		lineToCheck := line
-		searchStr := arg1
-
+	var needles []string
+	for _, needle := range splitSearchStrings(arg1) {
 		if caseInsensitive {
-			lineToCheck = strings.ToLower(line)
-			searchStr = strings.ToLower(arg1)
-		}
-
-		if strings.Contains(lineToCheck, searchStr) {
-			result = append(result, line)
+			needle = strings.ToLower(needle)
 		}
+		needles = append(needles, needle)
 	}
-
-	return strings.Join(result, "\n")
-}
-
-// removeLinesContaining removes lines containing the search string
-// arg1: search string
-// arg2: case-insensitive flag ("i")
-func removeLinesContaining(input, arg1, arg2 string) string {
-	if input == "" || arg1 == "" {
+	if len(needles) == 0 {
 		return input
 	}
 
 	lines := strings.Split(input, "\n")
 	var result []string
 
-	caseInsensitive := strings.Contains(arg2, "i")
-
 	for _, line := range lines {
 		lineToCheck := line
-		searchStr := arg1
-
 		if caseInsensitive {
 			lineToCheck = strings.ToLower(line)
-			searchStr = strings.ToLower(arg1)
 		}
 
-		if !strings.Contains(lineToCheck, searchStr) {
+		matched := matchAll
+		for _, needle := range needles {
+			if strings.Contains(lineToCheck, needle) != matchAll {
+				matched = !matchAll
+				break
+			}
+		}
+
+		if matched == keep {
 			result = append(result, line)
 		}
 	}
@@ -1811,7 +4032,7 @@ func hasPattern(input, arg1, arg2 string) string {
 		return "false"
 	}
 
-	re, err := regexp.Compile(arg1)
+	re, err := compileRegex(arg1)
 	if err != nil {
 		return "false"
 	}
@@ -1854,55 +4075,125 @@ func uniqueValues(input, arg1, arg2 string) string {
 	return strings.Join(result, delimiter)
 }
 
-// mostCommon returns the most frequently occurring item
-// arg1: delimiter
-func mostCommon(input, arg1, arg2 string) string {
-	delimiter := "\n"
-	if arg1 != "" {
-		delimiter = arg1
+// dedupeWords removes repeated words within each line, keeping the first occurrence
+// Punctuation attached to a removed word stays, so "end end." becomes "end."
+// arg1: "i" for case-insensitive comparison
+func dedupeWords(input, arg1, arg2 string) string {
+	if input == "" {
+		return input
 	}
 
-	items := strings.Split(input, delimiter)
-	counts := make(map[string]int)
-	maxCount := 0
-	var mostCommonItem string
+	caseInsensitive := strings.Contains(arg1, "i")
+	wordRe := mustCompileRegex(`\S+`)
+	isPunctuation := func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	}
 
-	for _, item := range items {
-		counts[item]++
-		if counts[item] > maxCount {
-			maxCount = counts[item]
-			mostCommonItem = item
+	lines := strings.Split(input, "\n")
+	for i, line := range lines {
+		seen := make(map[string]bool)
+		var result strings.Builder
+		last := 0
+		skipSpace := false
+
+		for _, loc := range wordRe.FindAllStringIndex(line, -1) {
+			word := line[loc[0]:loc[1]]
+			lead := word[:len(word)-len(strings.TrimLeftFunc(word, isPunctuation))]
+			key := strings.TrimFunc(word, isPunctuation)
+			trail := word[len(lead)+len(key):]
+			if caseInsensitive {
+				key = strings.ToLower(key)
+			}
+
+			if key != "" && seen[key] {
+				// Drop the word, keeping its punctuation; without leading punctuation the
+				// whitespace before it goes too, otherwise the whitespace after it
+				if lead != "" {
+					result.WriteString(line[last:loc[0]] + lead)
+					skipSpace = trail == ""
+				}
+				result.WriteString(trail)
+				last = loc[1]
+				continue
+			}
+			seen[key] = true
+
+			if skipSpace {
+				last, skipSpace = loc[0], false
+			}
+			result.WriteString(line[last:loc[1]])
+			last = loc[1]
 		}
+		result.WriteString(line[last:])
+
+		lines[i] = result.String()
 	}
 
-	return mostCommonItem
+	return strings.Join(lines, "\n")
+}
+
+// mostCommon returns the most frequently occurring item
+// arg1: delimiter
+// arg2: a number N for the top N items, and/or "count" to list them as "count\titem"
+func mostCommon(input, arg1, arg2 string) string {
+	return commonItems(input, arg1, arg2, true)
 }
 
 // leastCommon returns the least frequently occurring item
 // arg1: delimiter
+// arg2: a number N for the bottom N items, and/or "count" to list them as "count\titem"
 func leastCommon(input, arg1, arg2 string) string {
+	return commonItems(input, arg1, arg2, false)
+}
+
+// commonItems ranks items by frequency, most frequent first if most is true, and
+// breaks ties alphabetically so the same input always gives the same items
+func commonItems(input, arg1, arg2 string, most bool) string {
 	delimiter := "\n"
 	if arg1 != "" {
 		delimiter = arg1
 	}
 
-	items := strings.Split(input, delimiter)
+	limit, withCount := 1, false
+	for _, field := range strings.FieldsFunc(arg2, func(r rune) bool { return r == ' ' || r == ',' }) {
+		if field == "count" {
+			withCount = true
+		} else if n, err := strconv.Atoi(field); err == nil && n > 0 {
+			limit = n
+		}
+	}
+
 	counts := make(map[string]int)
-	minCount := len(items)
-	var leastCommonItem string
+	var order []string
 
-	for _, item := range items {
+	for _, item := range strings.Split(input, delimiter) {
+		if counts[item] == 0 {
+			order = append(order, item)
+		}
 		counts[item]++
 	}
 
-	for item, count := range counts {
-		if count < minCount {
-			minCount = count
-			leastCommonItem = item
+	sort.Slice(order, func(i, j int) bool {
+		if counts[order[i]] != counts[order[j]] {
+			return (counts[order[i]] > counts[order[j]]) == most
+		}
+		return order[i] < order[j]
+	})
+
+	if limit < len(order) {
+		order = order[:limit]
+	}
+
+	result := make([]string, len(order))
+	for i, item := range order {
+		if withCount {
+			result[i] = fmt.Sprintf("%d\t%s", counts[item], item)
+		} else {
+			result[i] = item
 		}
 	}
 
-	return leastCommonItem
+	return strings.Join(result, "\n")
 }
 
 // reverseLinesOrder reverses the order of lines
@@ -1912,17 +4203,40 @@ func reverseLinesOrder(input, arg1, arg2 string) string {
 
 // groupByPattern groups lines by pattern match
 // arg1: regex pattern to match
+// arg2: "bucket" to gather matching lines under "Matches:" and the rest under "Others:",
+// instead of labelling each line
 func groupByPattern(input, arg1, arg2 string) string {
 	if arg1 == "" {
 		return input
 	}
 
-	re, err := regexp.Compile(arg1)
+	re, err := compileRegex(arg1)
 	if err != nil {
 		return input
 	}
 
 	lines := strings.Split(input, "\n")
+
+	if arg2 == "bucket" {
+		var matches, others []string
+		for _, line := range lines {
+			if re.MatchString(line) {
+				matches = append(matches, line)
+			} else {
+				others = append(others, line)
+			}
+		}
+
+		var sections []string
+		for _, section := range []struct {
+			header string
+			lines  []string
+		}{{"Matches:", matches}, {"Others:", others}} {
+			sections = append(sections, strings.Join(append([]string{section.header}, section.lines...), "\n"))
+		}
+		return strings.Join(sections, "\n\n")
+	}
+
 	var result strings.Builder
 
 	for _, line := range lines {
@@ -2009,6 +4323,79 @@ func textStatistics(input, arg1, arg2 string) string {
 		totalLines, totalWords, totalChars, minLen, maxLen, avgLen)
 }
 
+// readability computes the Flesch Reading Ease score with its component counts
+// arg1: "grade" to also compute the Flesch-Kincaid grade level, shown before the score
+func readability(input, arg1, arg2 string) string {
+	if strings.TrimSpace(input) == "" {
+		return ""
+	}
+
+	words := 0
+	syllables := 0
+	for _, field := range strings.Fields(input) {
+		word := strings.TrimFunc(field, func(r rune) bool {
+			return !unicode.IsLetter(r)
+		})
+		if word == "" {
+			continue
+		}
+		words++
+		syllables += countSyllables(word)
+	}
+
+	if words == 0 {
+		return ""
+	}
+
+	sentences := len(mustCompileRegex(`[.!?]+`).FindAllString(input, -1))
+	if sentences == 0 {
+		sentences = 1
+	}
+
+	wordsPerSentence := float64(words) / float64(sentences)
+	syllablesPerWord := float64(syllables) / float64(words)
+
+	score := 206.835 - 1.015*wordsPerSentence - 84.6*syllablesPerWord
+	summary := fmt.Sprintf("Reading Ease: %.2f\nWords: %d\nSentences: %d\nSyllables: %d", score, words, sentences, syllables)
+
+	if strings.EqualFold(strings.TrimSpace(arg1), "grade") {
+		grade := 0.39*wordsPerSentence + 11.8*syllablesPerWord - 15.59
+		return fmt.Sprintf("Grade Level: %.2f\n%s", grade, summary)
+	}
+	return summary
+}
+
+// countSyllables estimates the number of syllables in an English word
+// by counting vowel groups and discounting a silent trailing "e"
+func countSyllables(word string) int {
+	word = strings.ToLower(word)
+	isVowel := func(r rune) bool {
+		return strings.ContainsRune("aeiouy", r)
+	}
+
+	runes := []rune(word)
+	count := 0
+	prevVowel := false
+	for _, r := range runes {
+		vowel := isVowel(r)
+		if vowel && !prevVowel {
+			count++
+		}
+		prevVowel = vowel
+	}
+
+	// Silent "e" as in "make", but not "le" as in "table"
+	n := len(runes)
+	if n > 2 && runes[n-1] == 'e' && !isVowel(runes[n-2]) && !(runes[n-2] == 'l' && !isVowel(runes[n-3])) {
+		count--
+	}
+
+	if count < 1 {
+		count = 1
+	}
+	return count
+}
+
 // minWordLength returns the minimum word length
 func minWordLength(input, arg1, arg2 string) string {
 	words := strings.Fields(input)
@@ -2059,6 +4446,59 @@ func averageWordLength(input, arg1, arg2 string) string {
 	return fmt.Sprintf("%.2f", avg)
 }
 
+// wordFrequency counts how often each word occurs and lists them as "count\tword"
+// arg1: "i" to count case-insensitively (words are lowercased)
+// arg2: only show the top N words (all words if empty)
+func wordFrequency(input, arg1, arg2 string) string {
+	caseInsensitive := strings.Contains(arg1, "i")
+
+	limit := -1
+	if arg2 != "" {
+		if n, err := strconv.Atoi(arg2); err == nil && n >= 0 {
+			limit = n
+		}
+	}
+
+	counts := make(map[string]int)
+	var order []string
+
+	for _, field := range strings.Fields(input) {
+		// Strip surrounding punctuation so "word," and "word" count together
+		word := strings.TrimFunc(field, func(r rune) bool {
+			return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+		})
+		if word == "" {
+			continue
+		}
+		if caseInsensitive {
+			word = strings.ToLower(word)
+		}
+		if counts[word] == 0 {
+			order = append(order, word)
+		}
+		counts[word]++
+	}
+
+	// Most frequent first, ties broken alphabetically for stable output
+	sort.SliceStable(order, func(i, j int) bool {
+		if counts[order[i]] != counts[order[j]] {
+			return counts[order[i]] > counts[order[j]]
+		}
+		return order[i] < order[j]
+	})
+
+	if limit >= 0 && limit < len(order) {
+		order = order[:limit]
+	}
+
+	result := make([]string, len(order))
+	for i, word := range order {
+		result[i] = fmt.Sprintf("%d\t%s", counts[word], word)
+	}
+
+	return strings.Join(result, "\n")
+}
+
 // Phase 12: Advanced Pattern Operations
 
 // wholeWordMatch finds whole word matches only
@@ -2070,7 +4510,7 @@ func wholeWordMatch(input, arg1, arg2 string) string {
 
 	// Use word boundary regex
 	pattern := fmt.Sprintf(`\b%s\b`, regexp.QuoteMeta(arg1))
-	re := regexp.MustCompile(pattern)
+	re := mustCompileRegex(pattern)
 	matches := re.FindAllString(input, -1)
 
 	if len(matches) == 0 {
@@ -2099,7 +4539,7 @@ func multilinePattern(input, arg1, arg2 string) string {
 	}
 
 	pattern := "(?m)" + arg1
-	re, err := regexp.Compile(pattern)
+	re, err := compileRegex(pattern)
 	if err != nil {
 		return input
 	}
@@ -2112,50 +4552,55 @@ func multilinePattern(input, arg1, arg2 string) string {
 	return strings.Join(matches, "\n")
 }
 
-// lookaheadPattern matches text followed by pattern
-// arg1: pattern to match, arg2: lookahead pattern
-func lookaheadPattern(input, arg1, arg2 string) string {
-	if arg1 == "" || arg2 == "" {
-		return input
-	}
-
-	pattern := fmt.Sprintf(`%s(?=%s)`, arg1, arg2)
-	re, err := regexp.Compile(pattern)
-	if err != nil {
-		return input
-	}
-
-	matches := re.FindAllString(input, -1)
-	if len(matches) == 0 {
-		return ""
-	}
-
-	return strings.Join(matches, "\n")
+// lookaheadPattern matches text followed by pattern
+// Go regexp has no lookaround, so see matchWithContext for how this is emulated
+// arg1: pattern to match, arg2: lookahead pattern (regex that must match right after the match)
+func lookaheadPattern(input, arg1, arg2 string) string {
+	if arg1 == "" || arg2 == "" {
+		return input
+	}
+	return matchWithContext(input, arg1, `^(?:`+arg2+`)`, false)
 }
 
 // lookbehindPattern matches text preceded by pattern
-// Note: Go regexp doesn't support lookbehind, so we implement a simpler version
-// arg1: pattern to match, arg2: lookbehind pattern (as literal string)
+// Go regexp has no lookaround, so see matchWithContext for how this is emulated
+// arg1: pattern to match, arg2: lookbehind pattern (regex that must match right before the match)
 func lookbehindPattern(input, arg1, arg2 string) string {
 	if arg1 == "" || arg2 == "" {
 		return input
 	}
+	return matchWithContext(input, arg1, `(?:`+arg2+`)$`, true)
+}
 
-	// Find all matches of pattern that are preceded by arg2
-	re, err := regexp.Compile(arg1)
+// matchWithContext emulates lookaround by finding all matches of pattern first and keeping
+// those whose surrounding text on the same line matches context (anchored next to the match)
+// Limitation: a rejected match is not retried from a later position inside it, so pattern
+// \d+ with lookbehind 5 finds nothing in "1567" where real lookbehind would find "67"
+func matchWithContext(input, pattern, context string, before bool) string {
+	re, err := compileRegex(pattern)
+	if err != nil {
+		return input
+	}
+	contextRe, err := compileRegex(context)
 	if err != nil {
 		return input
 	}
 
-	lines := strings.Split(input, "\n")
 	var result []string
+	for _, loc := range re.FindAllStringIndex(input, -1) {
+		var surrounding string
+		if before {
+			lineStart := strings.LastIndex(input[:loc[0]], "\n") + 1
+			surrounding = input[lineStart:loc[0]]
+		} else {
+			surrounding = input[loc[1]:]
+			if lineEnd := strings.Index(surrounding, "\n"); lineEnd >= 0 {
+				surrounding = surrounding[:lineEnd]
+			}
+		}
 
-	for _, line := range lines {
-		if strings.Contains(line, arg2) {
-			idx := strings.Index(line, arg2)
-			remaining := line[idx+len(arg2):]
-			matches := re.FindAllString(remaining, -1)
-			result = append(result, matches...)
+		if contextRe.MatchString(surrounding) {
+			result = append(result, input[loc[0]:loc[1]])
 		}
 	}
 
@@ -2169,7 +4614,7 @@ func conditionalReplace(input, arg1, arg2 string) string {
 		return input
 	}
 
-	re, err := regexp.Compile(arg1)
+	re, err := compileRegex(arg1)
 	if err != nil {
 		return input
 	}
@@ -2187,8 +4632,14 @@ func conditionalReplace(input, arg1, arg2 string) string {
 // chainOperations chains multiple operations (simplified version)
 // arg1: operation1|operation2|operation3 format
 func chainOperations(input, arg1, arg2 string) string {
+	result, _ := newPipelineRun(nil).chainOperations(context.Background(), input, arg1, arg2)
+	return result
+}
+
+// chainOperations runs each operation in turn, checking the size limit and ctx after each one
+func (run *pipelineRun) chainOperations(ctx context.Context, input, arg1, arg2 string) (string, error) {
 	if arg1 == "" {
-		return input
+		return input, nil
 	}
 
 	// Simple implementation: split by |, treat each as operation name
@@ -2197,34 +4648,104 @@ func chainOperations(input, arg1, arg2 string) string {
 
 	for _, op := range ops {
 		opName := strings.TrimSpace(op)
-		if opName != "" {
-			result = ProcessText(result, opName, "", "")
+		if opName == "" {
+			continue
+		}
+		var err error
+		if result, err = run.applyOperation(ctx, result, opName, "", "", false); err != nil {
+			return input, err
+		}
+		if err := run.checkOutputSize(opName, result); err != nil {
+			return input, err
+		}
+		if err := ctx.Err(); err != nil {
+			return input, err
 		}
 	}
 
-	return result
+	return result, nil
 }
 
 // repeatOperation repeats an operation multiple times
 // arg1: operation name, arg2: count
 func repeatOperation(input, arg1, arg2 string) string {
+	result, _ := newPipelineRun(nil).repeatOperation(context.Background(), input, arg1, arg2)
+	return result
+}
+
+// repeatOperation runs the operation count times, checking the size limit and ctx after each time
+func (run *pipelineRun) repeatOperation(ctx context.Context, input, arg1, arg2 string) (string, error) {
 	if arg1 == "" || arg2 == "" {
-		return input
+		return input, nil
 	}
 
 	count, err := strconv.Atoi(arg2)
 	if err != nil || count <= 0 {
-		return input
+		return input, nil
 	}
 
 	result := input
 	for i := 0; i < count; i++ {
-		result = ProcessText(result, arg1, "", "")
+		if result, err = run.applyOperation(ctx, result, arg1, "", "", false); err != nil {
+			return input, err
+		}
+		if err := run.checkOutputSize(arg1, result); err != nil {
+			return input, err
+		}
+		if err := ctx.Err(); err != nil {
+			return input, err
+		}
 	}
 
+	return result, nil
+}
+
+// applyPipeline runs an inline pipeline on the input
+// arg1: JSON array of pipeline nodes in the export format; a node without a type is an operation
+// Invalid JSON or an unknown node type leaves the input unchanged
+// The inline pipeline runs on its own: it can't see captured variables or presets of the outer pipeline
+func applyPipeline(input, arg1, arg2 string) string {
+	result, _ := newPipelineRun(nil).applyPipeline(context.Background(), input, arg1, arg2)
 	return result
 }
 
+// applyPipeline runs the inline pipeline with the context, size limit and random source of the run,
+// so its nodes are checked like the outer pipeline's and a seeded run stays reproducible
+func (run *pipelineRun) applyPipeline(ctx context.Context, input, arg1, arg2 string) (string, error) {
+	var nodes []PipelineNode
+	if err := json.Unmarshal([]byte(arg1), &nodes); err != nil {
+		return input, nil
+	}
+	if !normalizeInlineNodes(nodes) {
+		return input, nil
+	}
+
+	inline := newPipelineRun(nil)
+	inline.maxSize = run.maxSize
+	inline.rng = run.rng
+	result, err := executePipelineRun(ctx, inline, nodes, input)
+	if errors.Is(err, ErrOutputTooLarge) || ctx.Err() != nil {
+		return input, err
+	}
+	if err != nil {
+		return input, nil
+	}
+	return result, nil
+}
+
+// normalizeInlineNodes gives untyped nodes the operation type and reports whether every node type is known
+func normalizeInlineNodes(nodes []PipelineNode) bool {
+	for i := range nodes {
+		if nodes[i].Type == "" {
+			nodes[i].Type = "operation"
+		}
+		if !isValidNodeType(nodes[i].Type) || !normalizeInlineNodes(nodes[i].Children) || !normalizeInlineNodes(nodes[i].ElseChildren) {
+			return false
+		}
+	}
+	return true
+}
+
 // swapPairs swaps pairs of items separated by delimiter
 // arg1: delimiter
 func swapPairs(input, arg1, arg2 string) string {
@@ -2266,35 +4787,196 @@ func reverseOrderItems(input, arg1, arg2 string) string {
 
 // Phase 14: HTML/Markdown Advanced
 
-// htmlToMarkdown converts HTML to Markdown (simplified)
+// htmlToMarkdown converts HTML to Markdown by walking the parsed DOM,
+// so nested inline tags and tags with attributes are handled correctly
 func htmlToMarkdown(input, arg1, arg2 string) string {
-	result := input
+	if strings.TrimSpace(input) == "" {
+		return input
+	}
 
-	// Simple conversions
-	result = regexp.MustCompile(`<h[1-6][^>]*>([^<]+)</h[1-6]>`).ReplaceAllString(result, "# $1")
-	result = regexp.MustCompile(`<p[^>]*>([^<]+)</p>`).ReplaceAllString(result, "$1\n\n")
-	result = regexp.MustCompile(`<strong[^>]*>([^<]+)</strong>`).ReplaceAllString(result, "**$1**")
-	result = regexp.MustCompile(`<b[^>]*>([^<]+)</b>`).ReplaceAllString(result, "**$1**")
-	result = regexp.MustCompile(`<em[^>]*>([^<]+)</em>`).ReplaceAllString(result, "*$1*")
-	result = regexp.MustCompile(`<i[^>]*>([^<]+)</i>`).ReplaceAllString(result, "*$1*")
-	result = regexp.MustCompile(`<a[^>]*href="([^"]*)"[^>]*>([^<]+)</a>`).ReplaceAllString(result, "[$2]($1)")
-	result = regexp.MustCompile(`<li[^>]*>([^<]+)</li>`).ReplaceAllString(result, "- $1")
-	result = regexp.MustCompile(`<br[^>]*/?>`).ReplaceAllString(result, "  \n")
+	doc, err := goquery.NewDocumentFromReader(strings.NewReader(input))
+	if err != nil {
+		return input
+	}
 
-	return result
+	var out strings.Builder
+	writeMarkdownNodes(&out, doc.Selection.Contents())
+
+	result := mustCompileRegex(`[ \t]+\n\n`).ReplaceAllString(out.String(), "\n\n")
+	result = mustCompileRegex(`\n{3,}`).ReplaceAllString(result, "\n\n")
+
+	return strings.TrimSpace(result)
+}
+
+// writeMarkdownNodes emits Markdown for each node in the selection
+func writeMarkdownNodes(out *strings.Builder, nodes *goquery.Selection) {
+	nodes.Each(func(i int, s *goquery.Selection) {
+		writeMarkdownNode(out, s)
+	})
+}
+
+// writeMarkdownNode emits Markdown for a single node and its children
+func writeMarkdownNode(out *strings.Builder, s *goquery.Selection) {
+	name := goquery.NodeName(s)
+
+	switch name {
+	case "#text":
+		text := mustCompileRegex(`\s+`).ReplaceAllString(s.Nodes[0].Data, " ")
+		// Avoid doubled spaces and spaces at the start of a line
+		if markdownEndsWithSpace(out) {
+			text = strings.TrimLeft(text, " ")
+		}
+		out.WriteString(text)
+	case "#comment", "head", "script", "style":
+		// Not rendered
+	case "h1", "h2", "h3", "h4", "h5", "h6":
+		level := int(name[1] - '0')
+		out.WriteString("\n\n" + strings.Repeat("#", level) + " " + renderMarkdownInline(s) + "\n\n")
+	case "p", "div":
+		out.WriteString("\n\n")
+		writeMarkdownNodes(out, s.Contents())
+		out.WriteString("\n\n")
+	case "strong", "b":
+		if text := renderMarkdownInline(s); text != "" {
+			out.WriteString("**" + text + "**")
+		}
+	case "em", "i":
+		if text := renderMarkdownInline(s); text != "" {
+			out.WriteString("*" + text + "*")
+		}
+	case "a":
+		text := renderMarkdownInline(s)
+		if href, ok := s.Attr("href"); ok {
+			out.WriteString("[" + text + "](" + href + ")")
+		} else {
+			out.WriteString(text)
+		}
+	case "img":
+		src, _ := s.Attr("src")
+		alt, _ := s.Attr("alt")
+		out.WriteString("![" + alt + "](" + src + ")")
+	case "code":
+		out.WriteString("`" + s.Text() + "`")
+	case "pre":
+		out.WriteString("\n\n```\n" + strings.Trim(s.Text(), "\n") + "\n```\n\n")
+	case "br":
+		out.WriteString("  \n")
+	case "hr":
+		out.WriteString("\n\n---\n\n")
+	case "blockquote":
+		var inner strings.Builder
+		writeMarkdownNodes(&inner, s.Contents())
+		lines := strings.Split(strings.TrimSpace(collapseMarkdownBlankLines(inner.String())), "\n")
+		for i, line := range lines {
+			lines[i] = strings.TrimRight("> "+line, " ")
+		}
+		out.WriteString("\n\n" + strings.Join(lines, "\n") + "\n\n")
+	case "ul", "ol":
+		var items []string
+		s.ChildrenFiltered("li").Each(func(i int, li *goquery.Selection) {
+			marker := "- "
+			if name == "ol" {
+				marker = fmt.Sprintf("%d. ", i+1)
+			}
+			var inner strings.Builder
+			writeMarkdownNodes(&inner, li.Contents())
+			lines := strings.Split(strings.TrimSpace(collapseMarkdownBlankLines(inner.String())), "\n")
+			for j := range lines {
+				if j == 0 {
+					lines[j] = marker + lines[j]
+				} else {
+					lines[j] = strings.Repeat(" ", len(marker)) + lines[j]
+				}
+			}
+			items = append(items, strings.Join(lines, "\n"))
+		})
+		out.WriteString("\n\n" + strings.Join(items, "\n") + "\n\n")
+	default:
+		writeMarkdownNodes(out, s.Contents())
+	}
+}
+
+// renderMarkdownInline renders the children of an inline element on a single line
+func renderMarkdownInline(s *goquery.Selection) string {
+	var inner strings.Builder
+	writeMarkdownNodes(&inner, s.Contents())
+	return strings.TrimSpace(mustCompileRegex(`\s*\n\s*`).ReplaceAllString(inner.String(), " "))
+}
+
+// collapseMarkdownBlankLines turns block separators into single newlines
+func collapseMarkdownBlankLines(text string) string {
+	return mustCompileRegex(`[ \t]*\n(\s*\n)+`).ReplaceAllString(text, "\n")
+}
+
+// markdownEndsWithSpace reports whether the output is empty or ends with whitespace
+func markdownEndsWithSpace(out *strings.Builder) bool {
+	str := out.String()
+	return str == "" || strings.HasSuffix(str, "\n") || strings.HasSuffix(str, " ")
 }
 
-// markdownToHTML converts Markdown to HTML (simplified)
+// markdownToHTML converts Markdown to HTML using a CommonMark parser, so lists,
+// code fences, blockquotes and nested emphasis render correctly
+// arg1: comma-separated options: "safe" omits raw HTML and unsafe link URLs,
+// "gfm" enables GitHub tables, strikethrough, task lists and autolinks, "hardwraps" keeps line breaks
 func markdownToHTML(input, arg1, arg2 string) string {
+	var extensions []goldmark.Extender
+	var rendererOptions []renderer.Option
+	safe := false
+
+	for _, option := range strings.Split(arg1, ",") {
+		switch strings.ToLower(strings.TrimSpace(option)) {
+		case "safe":
+			safe = true
+		case "gfm":
+			extensions = append(extensions, extension.GFM)
+		case "hardwraps":
+			rendererOptions = append(rendererOptions, gmhtml.WithHardWraps())
+		}
+	}
+
+	// Raw HTML passes through unless sanitizing was requested
+	if !safe {
+		rendererOptions = append(rendererOptions, gmhtml.WithUnsafe())
+	}
+
+	md := goldmark.New(
+		goldmark.WithExtensions(extensions...),
+		goldmark.WithRendererOptions(rendererOptions...),
+	)
+
+	var buf bytes.Buffer
+	if err := md.Convert([]byte(input), &buf); err != nil {
+		return input
+	}
+
+	return strings.TrimSuffix(buf.String(), "\n")
+}
+
+// stripMarkdown removes Markdown formatting, leaving readable plain text
+func stripMarkdown(input, arg1, arg2 string) string {
+	if input == "" {
+		return input
+	}
+
 	result := input
 
-	// Simple conversions
-	result = regexp.MustCompile(`^# (.+)$`).ReplaceAllString(result, "<h1>$1</h1>")
-	result = regexp.MustCompile(`^## (.+)$`).ReplaceAllString(result, "<h2>$1</h2>")
-	result = regexp.MustCompile(`\*\*(.+?)\*\*`).ReplaceAllString(result, "<strong>$1</strong>")
-	result = regexp.MustCompile(`\*(.+?)\*`).ReplaceAllString(result, "<em>$1</em>")
-	result = regexp.MustCompile(`\[(.+?)\]\((.+?)\)`).ReplaceAllString(result, "<a href=\"$2\">$1</a>")
-	result = regexp.MustCompile(`^- (.+)$`).ReplaceAllString(result, "<li>$1</li>")
+	// Block-level syntax
+	result = mustCompileRegex("(?m)^\\s*```.*$\\n?").ReplaceAllString(result, "")
+	result = mustCompileRegex(`(?m)^#{1,6}\s+(.*?)\s*#*\s*$`).ReplaceAllString(result, "$1")
+	result = mustCompileRegex(`(?m)^(\s*)[-*+]\s+`).ReplaceAllString(result, "$1")
+	result = mustCompileRegex(`(?m)^\s*>\s?`).ReplaceAllString(result, "")
+
+	// Images and links keep their text
+	result = mustCompileRegex(`!\[([^\]]*)\]\([^)]*\)`).ReplaceAllString(result, "$1")
+	result = mustCompileRegex(`\[([^\]]+)\]\([^)]*\)`).ReplaceAllString(result, "$1")
+	result = mustCompileRegex(`\[([^\]]+)\]\[[^\]]*\]`).ReplaceAllString(result, "$1")
+
+	// Inline code and emphasis
+	result = mustCompileRegex("`([^`]*)`").ReplaceAllString(result, "$1")
+	result = mustCompileRegex(`\*\*([^*]+)\*\*`).ReplaceAllString(result, "$1")
+	result = mustCompileRegex(`\b__([^_]+)__\b`).ReplaceAllString(result, "$1")
+	result = mustCompileRegex(`\*([^*\n]+)\*`).ReplaceAllString(result, "$1")
+	result = mustCompileRegex(`\b_([^_\n]+)_\b`).ReplaceAllString(result, "$1")
 
 	return result
 }
@@ -2304,6 +4986,75 @@ func extractTextFromHTML(input, arg1, arg2 string) string {
 	return stripTags(input, arg1, arg2)
 }
 
+// htmlBlockElements are the elements a browser renders on their own line
+var htmlBlockElements = map[string]bool{
+	"address": true, "article": true, "aside": true, "blockquote": true, "body": true,
+	"caption": true, "dd": true, "details": true, "dialog": true, "div": true, "dl": true,
+	"dt": true, "fieldset": true, "figcaption": true, "figure": true, "footer": true,
+	"form": true, "h1": true, "h2": true, "h3": true, "h4": true, "h5": true, "h6": true,
+	"header": true, "hr": true, "html": true, "li": true, "main": true, "nav": true,
+	"ol": true, "p": true, "pre": true, "section": true, "summary": true, "table": true,
+	"tbody": true, "td": true, "tfoot": true, "th": true, "thead": true, "tr": true, "ul": true,
+}
+
+// normalizeHTMLText extracts the text of HTML roughly as a browser renders it: runs of
+// whitespace collapse to one space, block elements and <br> separate their text from
+// the text around them, and leading and trailing whitespace is trimmed
+// arg1: "lines" separates blocks with a newline instead of a space
+func normalizeHTMLText(input, arg1, arg2 string) string {
+	doc, err := goquery.NewDocumentFromReader(strings.NewReader(input))
+	if err != nil {
+		return strings.Join(strings.Fields(stripTags(input, "", "")), " ")
+	}
+	doc.Find("head, script, style, template").Remove()
+
+	blockSeparator := " "
+	if arg1 == "lines" {
+		blockSeparator = "\n"
+	}
+
+	var result strings.Builder
+	pendingSpace, pendingBreak := false, false
+
+	var walk func(s *goquery.Selection)
+	walk = func(s *goquery.Selection) {
+		s.Contents().Each(func(_ int, child *goquery.Selection) {
+			name := goquery.NodeName(child)
+			switch {
+			case name == "#text":
+				for _, r := range child.Text() {
+					if unicode.IsSpace(r) {
+						pendingSpace = true
+						continue
+					}
+					// Separators only go between text, never at the start
+					if result.Len() > 0 {
+						if pendingBreak {
+							result.WriteString(blockSeparator)
+						} else if pendingSpace {
+							result.WriteByte(' ')
+						}
+					}
+					pendingSpace, pendingBreak = false, false
+					result.WriteRune(r)
+				}
+			case name == "br":
+				pendingBreak = true
+			case htmlBlockElements[name]:
+				pendingBreak = true
+				walk(child)
+				pendingBreak = true
+			default:
+				// Inline elements pass their text through; comments have no text children
+				walk(child)
+			}
+		})
+	}
+	walk(doc.Selection)
+
+	return result.String()
+}
+
 // createMarkdownTable creates a Markdown table from delimited data
 // arg1: delimiter for columns
 // arg2: rows delimiter
@@ -2377,42 +5128,141 @@ func parseYAMLFrontMatter(input, arg1, arg2 string) string {
 }
 
 // markdownLinkFormat converts markdown links to custom format
-// arg1: output format (default "[text](url)")
+// Handles [text](url "title") and URLs with balanced parentheses, e.g. [x](https://en.wikipedia.org/wiki/Go_(game))
+// arg1: output format using text/url or {text}/{url}/{title}; without one, links are kept as
+// written, titles included
 func markdownLinkFormat(input, arg1, arg2 string) string {
-	re := regexp.MustCompile(`\[(.+?)\]\((.+?)\)`)
+	re := mustCompileRegex(`\[([^\[\]]+)\]\(`)
 
-	format := "[text](url)"
-	if arg1 != "" {
-		format = arg1
+	var result strings.Builder
+	pos := 0
+	for pos < len(input) {
+		loc := re.FindStringSubmatchIndex(input[pos:])
+		if loc == nil {
+			break
+		}
+		start, targetStart := pos+loc[0], pos+loc[1]
+		text := input[pos+loc[2] : pos+loc[3]]
+
+		url, title, end, ok := parseMarkdownLinkTarget(input, targetStart)
+		if !ok {
+			// Not a link after all, keep the text and continue after the opening parenthesis
+			result.WriteString(input[pos:targetStart])
+			pos = targetStart
+			continue
+		}
+
+		result.WriteString(input[pos:start])
+		if arg1 == "" {
+			result.WriteString(input[start:end])
+		} else {
+			// Replace in a single pass so tokens inside the link itself aren't substituted again
+			replacer := strings.NewReplacer(
+				"{text}", text, "{url}", url, "{title}", title,
+				"text", text, "url", url,
+			)
+			result.WriteString(replacer.Replace(arg1))
+		}
+		pos = end
 	}
+	result.WriteString(input[pos:])
 
-	result := re.ReplaceAllStringFunc(input, func(match string) string {
-		parts := re.FindStringSubmatch(match)
-		if len(parts) == 3 {
-			text := parts[1]
-			url := parts[2]
+	return result.String()
+}
 
-			output := strings.ReplaceAll(format, "text", text)
-			output = strings.ReplaceAll(output, "url", url)
-			return output
+// parseMarkdownLinkTarget parses the `url "title")` part of a markdown link starting at i
+// Returns the url, the optional title and the position after the closing parenthesis
+func parseMarkdownLinkTarget(input string, i int) (url, title string, end int, ok bool) {
+	skipSpaces := func(j int) int {
+		for j < len(input) && (input[j] == ' ' || input[j] == '\t') {
+			j++
 		}
-		return match
-	})
+		return j
+	}
 
-	return result
+	j := skipSpaces(i)
+	if j < len(input) && input[j] == '<' {
+		// <url> form may contain spaces and unbalanced parentheses
+		closeIdx := strings.IndexByte(input[j+1:], '>')
+		if closeIdx < 0 {
+			return "", "", 0, false
+		}
+		url = input[j+1 : j+1+closeIdx]
+		j += closeIdx + 2
+	} else {
+		urlStart := j
+		depth := 0
+	scan:
+		for j < len(input) {
+			switch input[j] {
+			case '\\':
+				j++ // Skip the escaped character
+			case '(':
+				depth++
+			case ')':
+				if depth == 0 {
+					break scan
+				}
+				depth--
+			case ' ', '\t', '\n':
+				break scan
+			}
+			j++
+		}
+		if j > len(input) {
+			j = len(input)
+		}
+		url = input[urlStart:j]
+	}
+	if url == "" {
+		return "", "", 0, false
+	}
+
+	j = skipSpaces(j)
+	if j < len(input) && (input[j] == '"' || input[j] == '\'' || input[j] == '(') {
+		closing := input[j]
+		if closing == '(' {
+			closing = ')'
+		}
+		closeIdx := strings.IndexByte(input[j+1:], closing)
+		if closeIdx < 0 {
+			return "", "", 0, false
+		}
+		title = input[j+1 : j+1+closeIdx]
+		j = skipSpaces(j + closeIdx + 2)
+	}
+
+	if j >= len(input) || input[j] != ')' {
+		return "", "", 0, false
+	}
+	return url, title, j + 1, true
 }
 
 // Phase 15: Unicode & Special Characters
 
-// unicodeNames converts characters to their Unicode names
+// unicodeNames replaces non-ASCII characters with their code point and Unicode name, like
+// "[U+00E9 LATIN SMALL LETTER E WITH ACUTE]"; characters without a name of their own, such as
+// controls and CJK ideographs, show just the code point
+// arg1: "compact" to leave out the code point of named characters
 func unicodeNames(input, arg1, arg2 string) string {
 	var result strings.Builder
+	compact := strings.EqualFold(strings.TrimSpace(arg1), "compact")
 
 	for _, r := range input {
 		if r < 128 {
 			result.WriteRune(r)
-		} else {
-			result.WriteString(fmt.Sprintf("U+%04X ", r))
+			continue
+		}
+
+		// Ranges such as "<control>" or "<CJK Ideograph>" label a group, not the character
+		name := runenames.Name(r)
+		switch {
+		case name == "" || strings.HasPrefix(name, "<"):
+			fmt.Fprintf(&result, "[U+%04X]", r)
+		case compact:
+			fmt.Fprintf(&result, "[%s]", name)
+		default:
+			fmt.Fprintf(&result, "[U+%04X %s]", r, name)
 		}
 	}
 
@@ -2425,20 +5275,63 @@ func convertUnicodeEscapes(input, arg1, arg2 string) string {
 }
 
 // escapeUnicode converts characters to \uXXXX format
+// Characters above U+FFFF become a UTF-16 surrogate pair like \uD83D\uDE00
+// arg1: "U" to write them as a single \UXXXXXXXX escape instead
 func escapeUnicode(input, arg1, arg2 string) string {
 	var result strings.Builder
+	longEscapes := strings.TrimSpace(arg1) == "U"
 
 	for _, r := range input {
-		if r < 128 && r >= 32 {
+		switch {
+		case r < 128 && r >= 32:
 			result.WriteRune(r)
-		} else {
+		case r <= 0xFFFF:
 			result.WriteString(fmt.Sprintf("\\u%04X", r))
+		case longEscapes:
+			result.WriteString(fmt.Sprintf("\\U%08X", r))
+		default:
+			high, low := utf16.EncodeRune(r)
+			result.WriteString(fmt.Sprintf("\\u%04X\\u%04X", high, low))
 		}
 	}
 
 	return result.String()
 }
 
+// toASCIIJSONString encodes the input as a JSON string literal using only ASCII, with
+// characters outside the BMP written as UTF-16 surrogate pairs like JSON requires
+func toASCIIJSONString(input, arg1, arg2 string) string {
+	var encoded bytes.Buffer
+	encoder := json.NewEncoder(&encoded)
+	encoder.SetEscapeHTML(false)
+	if err := encoder.Encode(input); err != nil {
+		return input
+	}
+
+	var result strings.Builder
+	for _, r := range strings.TrimSuffix(encoded.String(), "\n") {
+		if r < utf8.RuneSelf {
+			result.WriteRune(r)
+			continue
+		}
+		for _, unit := range utf16.Encode([]rune{r}) {
+			fmt.Fprintf(&result, "\\u%04x", unit)
+		}
+	}
+
+	return result.String()
+}
+
+// fromJSONString decodes a JSON string literal, including surrogate pair escapes, back to UTF-8
+// Input that isn't a JSON string is returned unchanged
+func fromJSONString(input, arg1, arg2 string) string {
+	var decoded string
+	if err := json.Unmarshal([]byte(strings.TrimSpace(input)), &decoded); err != nil {
+		return input
+	}
+	return decoded
+}
+
 // showInvisibleCharacters displays invisible characters visibly
 func showInvisibleCharacters(input, arg1, arg2 string) string {
 	result := input
@@ -2451,6 +5344,133 @@ func showInvisibleCharacters(input, arg1, arg2 string) string {
 	return result
 }
 
+// Symbols used by encodeWhitespace, from the Unicode Control Pictures block
+const (
+	wsSpace  = '␣' // U+2423 open box
+	wsTab    = '␉' // U+2409 symbol for horizontal tabulation
+	wsCR     = '␍' // U+240D symbol for carriage return
+	wsLF     = '␤' // U+2424 symbol for newline, followed by a real line break
+	wsEscape = '␛' // U+241B symbol for escape, marks a symbol that was in the input itself
+)
+
+// encodeWhitespace replaces spaces, tabs and line breaks with visible symbols, reversibly
+// Line breaks keep a real newline after the symbol so lines stay lines. Symbols that
+// already occur in the input are prefixed with wsEscape, so decodeWhitespace restores the input exactly
+func encodeWhitespace(input, arg1, arg2 string) string {
+	var b strings.Builder
+	for _, r := range input {
+		switch r {
+		case ' ':
+			b.WriteRune(wsSpace)
+		case '\t':
+			b.WriteRune(wsTab)
+		case '\r':
+			b.WriteRune(wsCR)
+		case '\n':
+			b.WriteRune(wsLF)
+			b.WriteByte('\n')
+		case wsSpace, wsTab, wsCR, wsLF, wsEscape:
+			b.WriteRune(wsEscape)
+			b.WriteRune(r)
+		default:
+			b.WriteRune(r)
+		}
+	}
+	return b.String()
+}
+
+// decodeWhitespace restores text written by encodeWhitespace
+// Real line breaks are only kept where no newline symbol precedes them, e.g. lines added by hand
+func decodeWhitespace(input, arg1, arg2 string) string {
+	var b strings.Builder
+	escaped, afterLF := false, false
+	for _, r := range input {
+		if afterLF {
+			afterLF = false
+			if r == '\n' {
+				continue
+			}
+		}
+
+		if escaped {
+			b.WriteRune(r)
+			escaped = false
+			continue
+		}
+
+		switch r {
+		case wsEscape:
+			escaped = true
+		case wsSpace:
+			b.WriteByte(' ')
+		case wsTab:
+			b.WriteByte('\t')
+		case wsCR:
+			b.WriteByte('\r')
+		case wsLF:
+			b.WriteByte('\n')
+			afterLF = true
+		default:
+			b.WriteRune(r)
+		}
+	}
+	return b.String()
+}
+
+// hexDump produces an xxd-style dump: offset, hex bytes and an ASCII gutter
+// arg1: bytes per row (default 16)
+func hexDump(input, arg1, arg2 string) string {
+	if input == "" {
+		return input
+	}
+
+	perRow := 16
+	if arg1 != "" {
+		n, err := strconv.Atoi(arg1)
+		if err != nil || n <= 0 {
+			return input
+		}
+		perRow = n
+	}
+
+	formatHex := func(chunk []byte) string {
+		var hexPart strings.Builder
+		for i, b := range chunk {
+			if i > 0 && i%2 == 0 {
+				hexPart.WriteByte(' ')
+			}
+			fmt.Fprintf(&hexPart, "%02x", b)
+		}
+		return hexPart.String()
+	}
+
+	// Pad short rows so the ASCII gutter lines up
+	hexWidth := len(formatHex(make([]byte, perRow)))
+
+	data := []byte(input)
+	var lines []string
+	for offset := 0; offset < len(data); offset += perRow {
+		end := offset + perRow
+		if end > len(data) {
+			end = len(data)
+		}
+		chunk := data[offset:end]
+
+		ascii := make([]byte, len(chunk))
+		for i, b := range chunk {
+			if b >= 0x20 && b < 0x7f {
+				ascii[i] = b
+			} else {
+				ascii[i] = '.'
+			}
+		}
+
+		lines = append(lines, fmt.Sprintf("%08x: %-*s  %s", offset, hexWidth, formatHex(chunk), ascii))
+	}
+
+	return strings.Join(lines, "\n")
+}
+
 // normalizeUnicode applies Unicode normalization (simplified - no decomposition)
 // arg1: normalization form (NFC, NFD, NFKC, NFKD - not fully implemented)
 func normalizeUnicode(input, arg1, arg2 string) string {
@@ -2459,10 +5479,81 @@ func normalizeUnicode(input, arg1, arg2 string) string {
 	return stripDiacritics(input, arg1, arg2)
 }
 
+// removeBOM strips a leading byte order mark (U+FEFF)
+// arg1: "all" to also remove stray zero-width no-break spaces anywhere in the text
+func removeBOM(input, arg1, arg2 string) string {
+	if strings.EqualFold(strings.TrimSpace(arg1), "all") {
+		return strings.ReplaceAll(input, "\uFEFF", "")
+	}
+	return strings.TrimPrefix(input, "\uFEFF")
+}
+
+// detectEncoding reports on text of unknown origin: whether it is valid UTF-8, its byte order
+// mark and line endings, and how many non-ASCII and control characters it has
+// The input is left as it is; the report replaces it
+func detectEncoding(input, arg1, arg2 string) string {
+	bom := "none"
+	switch {
+	case strings.HasPrefix(input, "\xEF\xBB\xBF"):
+		bom = "UTF-8"
+	case strings.HasPrefix(input, "\xFF\xFE"):
+		bom = "UTF-16 LE"
+	case strings.HasPrefix(input, "\xFE\xFF"):
+		bom = "UTF-16 BE"
+	}
+
+	crlf := strings.Count(input, "\r\n")
+	lf := strings.Count(input, "\n") - crlf
+	cr := strings.Count(input, "\r") - crlf
+
+	var endings []string
+	for _, ending := range []struct {
+		name  string
+		count int
+	}{{"CRLF", crlf}, {"LF", lf}, {"CR", cr}} {
+		if ending.count > 0 {
+			endings = append(endings, fmt.Sprintf("%s (%d)", ending.name, ending.count))
+		}
+	}
+	lineEndings := "none"
+	switch len(endings) {
+	case 0:
+	case 1:
+		lineEndings = endings[0]
+	default:
+		lineEndings = "mixed, " + strings.Join(endings, ", ")
+	}
+
+	nonASCII, control, invalid := 0, 0, 0
+	for i := 0; i < len(input); {
+		r, size := utf8.DecodeRuneInString(input[i:])
+		i += size
+		switch {
+		case r == utf8.RuneError && size == 1:
+			invalid++
+		case r >= utf8.RuneSelf:
+			nonASCII++
+			if unicode.IsControl(r) {
+				control++
+			}
+		case unicode.IsControl(r) && r != '\n' && r != '\r' && r != '\t':
+			control++
+		}
+	}
+
+	validUTF8 := "yes"
+	if invalid > 0 {
+		validUTF8 = fmt.Sprintf("no (invalid bytes: %d)", invalid)
+	}
+
+	return fmt.Sprintf("Valid UTF-8: %s\nBOM: %s\nLine endings: %s\nNon-ASCII characters: %d\nControl characters: %d",
+		validUTF8, bom, lineEndings, nonASCII, control)
+}
+
 // normalizeWhitespace collapses multiple whitespace characters to single spaces
 func normalizeWhitespace(input, arg1, arg2 string) string {
 	// Replace multiple spaces/tabs/etc with single space
-	result := regexp.MustCompile(`\s+`).ReplaceAllString(input, " ")
+	result := mustCompileRegex(`\s+`).ReplaceAllString(input, " ")
 	return strings.TrimSpace(result)
 }
 
@@ -2470,7 +5561,7 @@ func normalizeWhitespace(input, arg1, arg2 string) string {
 
 // extractLeadingNumber extracts the leading number from a string
 func extractLeadingNumber(s string) *float64 {
-	re := regexp.MustCompile(`^-?\d+(?:\.\d+)?`)
+	re := mustCompileRegex(`^-?\d+(?:\.\d+)?`)
 	match := re.FindString(s)
 	if match == "" {
 		return nil
@@ -2536,6 +5627,16 @@ func processEscapeSequences(s string) string {
 				if i+5 < len(runes) {
 					hexStr := string(runes[i+2 : i+6])
 					if val, err := strconv.ParseInt(hexStr, 16, 32); err == nil {
+						// A high surrogate followed by a low surrogate escape is one character
+						if utf16.IsSurrogate(rune(val)) && i+11 < len(runes) && runes[i+6] == '\\' && runes[i+7] == 'u' {
+							if low, err := strconv.ParseInt(string(runes[i+8:i+12]), 16, 32); err == nil {
+								if r := utf16.DecodeRune(rune(val), rune(low)); r != utf8.RuneError {
+									result.WriteRune(r)
+									i += 11
+									continue
+								}
+							}
+						}
 						result.WriteRune(rune(val))
 						i += 5
 					} else {
@@ -2585,11 +5686,57 @@ func addRegexFlags(pattern string, flags map[rune]bool) string {
 		prefix += "(?i)"
 	}
 	if flags['s'] {
-		prefix = "(?s)" + prefix[4:] // Replace multiline with singleline
+		if flags['m'] {
+			prefix = "(?s)" + prefix // Dotall and multiline together
+		} else {
+			prefix = "(?s)" + prefix[4:] // Replace multiline with singleline
+		}
 	}
 	return prefix + pattern
 }
 
+// maxRegexCacheSize bounds the compiled-pattern cache; patterns typed
+// interactively would otherwise accumulate without limit
+const maxRegexCacheSize = 1000
+
+var (
+	regexCache     sync.Map // pattern (including inline flags) -> *regexp.Regexp
+	regexCacheSize int64
+)
+
+// compileRegex compiles a pattern, reusing a cached result when the same
+// pattern (including any inline flags) has been compiled before
+func compileRegex(pattern string) (*regexp.Regexp, error) {
+	if cached, ok := regexCache.Load(pattern); ok {
+		return cached.(*regexp.Regexp), nil
+	}
+
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return nil, err
+	}
+
+	if atomic.AddInt64(&regexCacheSize, 1) > maxRegexCacheSize {
+		regexCache.Range(func(key, value interface{}) bool {
+			regexCache.Delete(key)
+			return true
+		})
+		atomic.StoreInt64(&regexCacheSize, 1)
+	}
+
+	actual, _ := regexCache.LoadOrStore(pattern, re)
+	return actual.(*regexp.Regexp), nil
+}
+
+// mustCompileRegex is like compileRegex but panics if the pattern is invalid
+func mustCompileRegex(pattern string) *regexp.Regexp {
+	re, err := compileRegex(pattern)
+	if err != nil {
+		panic(`regexp: Compile(` + strconv.Quote(pattern) + `): ` + err.Error())
+	}
+	return re
+}
+
 // Token represents a token in the expression
 type Token struct {
 	Type  string  // "number", "operator", "eof"
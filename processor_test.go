@@ -1,7 +1,11 @@
 package main
 
 import (
+	"context"
+	"errors"
 	"fmt"
+	"regexp"
+	"strings"
 	"testing"
 )
 
@@ -128,3 +132,2018 @@ func TestFormatNumber(t *testing.T) {
 		})
 	}
 }
+
+func TestWordFrequency(t *testing.T) {
+	tests := []struct {
+		input    string
+		arg1     string
+		arg2     string
+		expected string
+		desc     string
+	}{
+		{"the cat and the hat", "", "", "2\tthe\n1\tand\n1\tcat\n1\that", "Counts sorted by frequency"},
+		{"The cat saw the dog. THE end!", "i", "", "3\tthe\n1\tcat\n1\tdog\n1\tend\n1\tsaw", "Case-insensitive with punctuation"},
+		{"The the", "", "", "1\tThe\n1\tthe", "Case-sensitive by default"},
+		{"a b a c a b", "", "2", "3\ta\n2\tb", "Top-N cap"},
+		{"a b", "", "10", "1\ta\n1\tb", "Top-N larger than word count"},
+		{"... !!!", "", "", "", "Punctuation only"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.desc, func(t *testing.T) {
+			result := wordFrequency(test.input, test.arg1, test.arg2)
+			if result != test.expected {
+				t.Errorf("Input: %q, Expected: %q, Got: %q", test.input, test.expected, result)
+			}
+		})
+	}
+}
+
+func TestHeadAndTailLines(t *testing.T) {
+	input := "1\n2\n3\n4\n5"
+
+	tests := []struct {
+		fn       func(input, arg1, arg2 string) string
+		arg1     string
+		arg2     string
+		expected string
+		desc     string
+	}{
+		{headLines, "3", "", "1\n2\n3", "Head 3"},
+		{tailLines, "2", "", "4\n5", "Tail 2"},
+		{headLines, "10", "", input, "Head larger than line count"},
+		{tailLines, "10", "", input, "Tail larger than line count"},
+		{headLines, "2", "-", "1\n2\n3", "Head all but last 2"},
+		{tailLines, "2", "-", "3\n4\n5", "Tail all but first 2"},
+		{headLines, "10", "-", "", "Head all but more lines than exist"},
+		{headLines, "0", "", "", "Head 0"},
+		{headLines, "abc", "", input, "Invalid count"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.desc, func(t *testing.T) {
+			result := test.fn(input, test.arg1, test.arg2)
+			if result != test.expected {
+				t.Errorf("Expected: %q, Got: %q", test.expected, result)
+			}
+		})
+	}
+}
+
+func TestLineRange(t *testing.T) {
+	input := "1\n2\n3\n4\n5\n6"
+
+	tests := []struct {
+		arg1     string
+		arg2     string
+		expected string
+		desc     string
+	}{
+		{"2-4", "", "2\n3\n4", "Closed range"},
+		{"5-", "", "5\n6", "Open-ended start"},
+		{"-2", "", "1\n2", "Open-ended end"},
+		{"3", "", "3", "Single line"},
+		{"4-100", "", "4\n5\n6", "End clamped"},
+		{"0-2", "", "1\n2", "Start clamped"},
+		{"2-4", "delete", "1\n5\n6", "Delete range"},
+		{"5-", "delete", "1\n2\n3\n4", "Delete open-ended range"},
+		{"x-y", "", input, "Invalid range"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.desc, func(t *testing.T) {
+			result := lineRange(input, test.arg1, test.arg2)
+			if result != test.expected {
+				t.Errorf("Expected: %q, Got: %q", test.expected, result)
+			}
+		})
+	}
+}
+
+func TestSampleLines(t *testing.T) {
+	input := "a\nb\nc\nd\ne\nf\ng\nh\ni\nj"
+	order := map[string]int{}
+	for i, line := range strings.Split(input, "\n") {
+		order[line] = i
+	}
+
+	t.Run("Deterministic with seed", func(t *testing.T) {
+		first := sampleLines(input, "4", "42")
+		second := sampleLines(input, "4", "42")
+		if first != second {
+			t.Errorf("Expected identical samples for same seed, got %q and %q", first, second)
+		}
+	})
+
+	t.Run("Count and order", func(t *testing.T) {
+		lines := strings.Split(sampleLines(input, "4", "7"), "\n")
+		if len(lines) != 4 {
+			t.Fatalf("Expected 4 lines, got %d: %v", len(lines), lines)
+		}
+		for i := 1; i < len(lines); i++ {
+			if order[lines[i-1]] >= order[lines[i]] {
+				t.Errorf("Expected original order to be preserved, got %v", lines)
+			}
+		}
+	})
+
+	t.Run("N larger than input", func(t *testing.T) {
+		result := sampleLines(input, "50", "1")
+		if result != input {
+			t.Errorf("Expected all lines, got %q", result)
+		}
+	})
+}
+
+func TestChunkLines(t *testing.T) {
+	input := "1\n2\n3\n4\n5\n6\n7"
+
+	tests := []struct {
+		arg1     string
+		arg2     string
+		expected string
+		desc     string
+	}{
+		{"3", "", "1\n2\n3\n\n4\n5\n6\n\n7", "Chunks of 3 with blank line"},
+		{"3", "---", "1\n2\n3\n---\n4\n5\n6\n---\n7", "Chunks of 3 with delimiter"},
+		{"10", "", input, "Chunk larger than input"},
+		{"0", "", input, "Invalid chunk size"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.desc, func(t *testing.T) {
+			result := chunkLines(input, test.arg1, test.arg2)
+			if result != test.expected {
+				t.Errorf("Expected: %q, Got: %q", test.expected, result)
+			}
+		})
+	}
+}
+
+func TestInterleaveLines(t *testing.T) {
+	tests := []struct {
+		input    string
+		arg1     string
+		arg2     string
+		expected string
+		desc     string
+	}{
+		{"a\nb\nc\n\n1\n2\n3", "", "", "a\n1\nb\n2\nc\n3", "Equal blocks"},
+		{"a\nb\nc\n\n1\n2\n3", "", ": ", "a: 1\nb: 2\nc: 3", "Equal blocks with delimiter"},
+		{"a\nb\nc\n\n1", "", "=", "a=1\nb\nc", "First block longer"},
+		{"a\n\n1\n2\n3", "", "=", "a=1\n2\n3", "Second block longer"},
+		{"a\nb\n1\n2", "half", ",", "a,1\nb,2", "Split at midpoint"},
+		{"a\nb\nc", "", "", "a\nb\nc", "No separator"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.desc, func(t *testing.T) {
+			result := interleaveLines(test.input, test.arg1, test.arg2)
+			if result != test.expected {
+				t.Errorf("Expected: %q, Got: %q", test.expected, result)
+			}
+		})
+	}
+}
+
+func TestCommentLines(t *testing.T) {
+	tests := []struct {
+		fn       func(input, arg1, arg2 string) string
+		input    string
+		arg1     string
+		arg2     string
+		expected string
+		desc     string
+	}{
+		{commentLines, "echo hi\n\nls", "", "", "# echo hi\n\n# ls", "Shell comment skips blank lines"},
+		{commentLines, "a := 1\nb := 2", "// ", "", "// a := 1\n// b := 2", "Slash comment"},
+		{commentLines, "# done\ntodo", "", "skip", "# done\n# todo", "Skip already-commented lines"},
+		{commentLines, "# done", "", "", "# # done", "Comment already-commented line"},
+		{uncommentLines, "# echo hi\n#ls\nplain", "", "", "echo hi\nls\nplain", "Shell uncomment"},
+		{uncommentLines, "  // a := 1\n// b := 2", "// ", "", "  a := 1\nb := 2", "Slash uncomment keeps indentation"},
+		{uncommentLines, "#  two spaces", "", "", " two spaces", "Only one space removed"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.desc, func(t *testing.T) {
+			result := test.fn(test.input, test.arg1, test.arg2)
+			if result != test.expected {
+				t.Errorf("Expected: %q, Got: %q", test.expected, result)
+			}
+		})
+	}
+}
+
+func TestStripMarkdown(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+		desc     string
+	}{
+		{"# Title\n## Sub heading ##", "Title\nSub heading", "Headings"},
+		{"Some **bold** and *italic* and __strong__ and _em_", "Some bold and italic and strong and em", "Emphasis"},
+		{"Run `go test` now", "Run go test now", "Inline code"},
+		{"See [the docs](https://example.com) and ![logo](logo.png)", "See the docs and logo", "Links and images"},
+		{"- one\n* two\n  + three", "one\ntwo\n  three", "List bullets"},
+		{"> quoted text", "quoted text", "Blockquote"},
+		{"keep snake_case_names", "keep snake_case_names", "Underscores inside words"},
+		{"```go\nfmt.Println()\n```\n", "fmt.Println()\n", "Code fences"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.desc, func(t *testing.T) {
+			result := stripMarkdown(test.input, "", "")
+			if result != test.expected {
+				t.Errorf("Expected: %q, Got: %q", test.expected, result)
+			}
+		})
+	}
+}
+
+func TestHtmlToMarkdown(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+		desc     string
+	}{
+		{`<h2 class="title">Hello <em>world</em></h2>`, "## Hello *world*", "Heading with attributes and nested emphasis"},
+		{`<p>Some <strong>bold <em>and italic</em></strong> text</p>`, "Some **bold *and italic*** text", "Nested emphasis"},
+		{`<b><a href="https://example.com" title="x">link</a></b>`, "**[link](https://example.com)**", "Link inside bold"},
+		{"<ul>\n  <li><a href=\"/a\">A</a></li>\n  <li>B <code>x</code></li>\n</ul>", "- [A](/a)\n- B `x`", "List containing links"},
+		{"<ol><li>one<ul><li>nested</li></ul></li><li>two</li></ol>", "1. one\n   - nested\n2. two", "Nested lists"},
+		{"<blockquote><p>quoted</p><p>twice</p></blockquote>", "> quoted\n> twice", "Blockquote"},
+		{"<pre><code>a := 1\nb := 2</code></pre>", "```\na := 1\nb := 2\n```", "Preformatted code"},
+		{"<p>first</p><p>second</p>", "first\n\nsecond", "Paragraphs"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.desc, func(t *testing.T) {
+			result := htmlToMarkdown(test.input, "", "")
+			if result != test.expected {
+				t.Errorf("Expected: %q, Got: %q", test.expected, result)
+			}
+		})
+	}
+}
+
+func TestDedupeWords(t *testing.T) {
+	tests := []struct {
+		input    string
+		arg1     string
+		expected string
+		desc     string
+	}{
+		{"the the cat cat sat", "", "the cat sat", "Repeated words"},
+		{"The the cat Cat sat", "", "The the cat Cat sat", "Case-sensitive by default"},
+		{"The the cat Cat sat", "i", "The cat sat", "Case-insensitive"},
+		{"  indented  words words,  kept", "", "  indented  words,  kept", "Spacing and punctuation"},
+		{"a a\nb b a", "", "a\nb a", "Per line"},
+		{"The end end.", "", "The end.", "Trailing punctuation is kept"},
+		{"go (go home) now", "", "go (home) now", "Leading punctuation is kept"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.desc, func(t *testing.T) {
+			result := dedupeWords(test.input, test.arg1, "")
+			if result != test.expected {
+				t.Errorf("Expected: %q, Got: %q", test.expected, result)
+			}
+		})
+	}
+}
+
+func TestToggleCase(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"Hello World", "hELLO wORLD"},
+		{"ÄbC 123", "äBc 123"},
+		{"", ""},
+	}
+
+	for _, test := range tests {
+		t.Run(test.input, func(t *testing.T) {
+			result := toggleCase(test.input, "", "")
+			if result != test.expected {
+				t.Errorf("Expected: %q, Got: %q", test.expected, result)
+			}
+			if back := toggleCase(result, "", ""); back != test.input {
+				t.Errorf("Expected toggling twice to return %q, Got: %q", test.input, back)
+			}
+		})
+	}
+}
+
+func TestAlternateCase(t *testing.T) {
+	tests := []struct {
+		input    string
+		arg1     string
+		expected string
+		desc     string
+	}{
+		{"hello world", "", "HeLlO wOrLd", "Across letters"},
+		{"hello world", "word", "HeLlO WoRlD", "Reset per word"},
+		{"a-b c", "", "A-b C", "Non-letters are skipped"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.desc, func(t *testing.T) {
+			result := alternateCase(test.input, test.arg1, "")
+			if result != test.expected {
+				t.Errorf("Expected: %q, Got: %q", test.expected, result)
+			}
+		})
+	}
+}
+
+func TestSentenceCase(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+		desc     string
+	}{
+		{"THIS IS SHOUTING. STOP IT!", "This is shouting. Stop it!", "Shouting input"},
+		{"hello. how ARE you? fine!  thanks", "Hello. How are you? Fine!  Thanks", "Multiple sentences"},
+		{"use tools, e.g. a hammer. then rest.", "Use tools, e.g. a hammer. Then rest.", "Abbreviation e.g."},
+		{"ask Dr. Smith. he knows", "Ask dr. smith. He knows", "Title abbreviation"},
+		{"first line.\nsecond line", "First line.\nSecond line", "Newline after sentence"},
+		{"MiXeD CaSe", "Mixed case", "Mixed case"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.desc, func(t *testing.T) {
+			result := sentenceCase(test.input, "", "")
+			if result != test.expected {
+				t.Errorf("Expected: %q, Got: %q", test.expected, result)
+			}
+		})
+	}
+}
+
+func TestCountSyllables(t *testing.T) {
+	tests := []struct {
+		word     string
+		expected int
+	}{
+		{"cat", 1},
+		{"make", 1},
+		{"table", 2},
+		{"reading", 2},
+		{"readability", 5},
+		{"the", 1},
+	}
+
+	for _, test := range tests {
+		t.Run(test.word, func(t *testing.T) {
+			if result := countSyllables(test.word); result != test.expected {
+				t.Errorf("Expected: %d, Got: %d", test.expected, result)
+			}
+		})
+	}
+}
+
+func TestReadability(t *testing.T) {
+	parseValue := func(output string) float64 {
+		firstLine := strings.SplitN(output, "\n", 2)[0]
+		parts := strings.SplitN(firstLine, ": ", 2)
+		var value float64
+		fmt.Sscanf(parts[1], "%f", &value)
+		return value
+	}
+
+	simple := "The cat sat on the mat. The dog ran to the cat. It was fun."
+	difficult := "Comprehensive institutional accountability necessitates interdisciplinary collaboration. Organizational stakeholders consistently underestimate implementation complexity."
+
+	t.Run("Simple passage is easy", func(t *testing.T) {
+		result := readability(simple, "", "")
+		if !strings.HasPrefix(result, "Reading Ease: ") {
+			t.Fatalf("Unexpected output: %q", result)
+		}
+		if score := parseValue(result); score < 90 || score > 121 {
+			t.Errorf("Expected an easy score between 90 and 121, got %.2f", score)
+		}
+		if !strings.Contains(result, "Words: 15\nSentences: 3") {
+			t.Errorf("Unexpected counts: %q", result)
+		}
+	})
+
+	t.Run("Complex passage is hard", func(t *testing.T) {
+		if score := parseValue(readability(difficult, "", "")); score > 30 {
+			t.Errorf("Expected a difficult score below 30, got %.2f", score)
+		}
+	})
+
+	t.Run("Grade level", func(t *testing.T) {
+		result := readability(simple, "grade", "")
+		if !strings.HasPrefix(result, "Grade Level: ") {
+			t.Fatalf("Unexpected output: %q", result)
+		}
+		if grade := parseValue(result); grade > 3 {
+			t.Errorf("Expected a low grade level, got %.2f", grade)
+		}
+		if score := readability(simple, "", ""); !strings.HasSuffix(result, "\n"+score) {
+			t.Errorf("Expected the score and counts after the grade level, got %q", result)
+		}
+	})
+}
+
+func TestStripPunctuation(t *testing.T) {
+	tests := []struct {
+		input    string
+		arg1     string
+		expected string
+		desc     string
+	}{
+		{`"Hello," she said (quietly).`, "", "Hello she said quietly", "Quotes and parentheses"},
+		{"«Bonjour» — ¿qué tal?", "", "Bonjour  qué tal", "Unicode punctuation"},
+		{"don't re-enter!", "-'", "don't re-enter", "Exceptions list"},
+		{"a+b=3 $5", "", "a+b=3 $5", "Symbols are kept"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.desc, func(t *testing.T) {
+			result := stripPunctuation(test.input, test.arg1, "")
+			if result != test.expected {
+				t.Errorf("Expected: %q, Got: %q", test.expected, result)
+			}
+		})
+	}
+}
+
+func TestSplitSentences(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+		desc     string
+	}{
+		{"Dr. Smith went to Washington. He arrived at 3.5 p.m.", "Dr. Smith went to Washington.\nHe arrived at 3.5 p.m.", "Abbreviations and decimals"},
+		{"Really? Yes! Okay.", "Really?\nYes!\nOkay.", "Mixed terminators"},
+		{"Use a tool, e.g. a hammer.\nThen rest", "Use a tool, e.g. a hammer.\nThen rest", "Wrapped lines and trailing fragment"},
+		{`He said "stop." Then left.`, "He said \"stop.\"\nThen left.", "Closing quote after terminator"},
+		{"Name:\tAda  Lovelace.   Born  1815.", "Name:\tAda  Lovelace.\nBorn  1815.", "Spacing within sentences is kept"},
+		{"A sentence\nwrapped  over\r\nlines. Next.", "A sentence wrapped  over lines.\nNext.", "Wrapped sentence is joined"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.desc, func(t *testing.T) {
+			result := splitSentences(test.input, "", "")
+			if result != test.expected {
+				t.Errorf("Expected: %q, Got: %q", test.expected, result)
+			}
+		})
+	}
+}
+
+func TestRemoveBOM(t *testing.T) {
+	tests := []struct {
+		input    string
+		arg1     string
+		expected string
+		desc     string
+	}{
+		{"\uFEFFid,name", "", "id,name", "Leading BOM"},
+		{"\uFEFF\uFEFFid", "", "\uFEFFid", "Only one BOM removed"},
+		{"id\uFEFF,name", "", "id\uFEFF,name", "Stray BOM kept by default"},
+		{"\uFEFFid\uFEFF,name", "all", "id,name", "All BOMs removed"},
+		{"plain", "", "plain", "No BOM"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.desc, func(t *testing.T) {
+			result := removeBOM(test.input, test.arg1, "")
+			if result != test.expected {
+				t.Errorf("Expected: %q, Got: %q", test.expected, result)
+			}
+		})
+	}
+}
+
+func TestHexDump(t *testing.T) {
+	tests := []struct {
+		input    string
+		arg1     string
+		expected string
+		desc     string
+	}{
+		{"Hello\n", "", "00000000: 4865 6c6c 6f0a                           Hello.", "Short string"},
+		{"abcdef", "4", "00000000: 6162 6364  abcd\n00000004: 6566       ef", "Custom row width"},
+		{"A\tB", "", "00000000: 4109 42                                  A.B", "Non-printable in gutter"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.desc, func(t *testing.T) {
+			result := hexDump(test.input, test.arg1, "")
+			if result != test.expected {
+				t.Errorf("Expected: %q, Got: %q", test.expected, result)
+			}
+		})
+	}
+}
+
+func TestBinaryConversion(t *testing.T) {
+	tests := []struct {
+		fn       func(input, arg1, arg2 string) string
+		input    string
+		expected string
+		desc     string
+	}{
+		{toBinary, "A", "01000001", "Encode A"},
+		{fromBinary, "01000001", "A", "Decode A"},
+		{toBinary, "Hi", "01001000 01101001", "Encode multiple bytes"},
+		{fromBinary, "01001000\n01101001", "Hi", "Decode across lines"},
+		{fromBinary, "0100200", "0100200", "Malformed digit"},
+		{fromBinary, "101000001", "101000001", "Octet too long"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.desc, func(t *testing.T) {
+			result := test.fn(test.input, "", "")
+			if result != test.expected {
+				t.Errorf("Expected: %q, Got: %q", test.expected, result)
+			}
+		})
+	}
+
+	t.Run("Round trip", func(t *testing.T) {
+		input := "héllo, wörld"
+		if result := fromBinary(toBinary(input, "", ""), "", ""); result != input {
+			t.Errorf("Expected: %q, Got: %q", input, result)
+		}
+	})
+}
+
+func TestHtmlEntityEncode(t *testing.T) {
+	tests := []struct {
+		input    string
+		arg1     string
+		expected string
+		desc     string
+	}{
+		{"© 2024 — Acme", "", "&copy; 2024 &mdash; Acme", "Named by default"},
+		{"© 2024 — Acme", "numeric", "&#xA9; 2024 &#x2014; Acme", "Numeric"},
+		{"a < b & c", "numeric", "a &lt; b &amp; c", "Markup characters stay named"},
+		{"snow ☃", "named", "snow &#x2603;", "Numeric fallback for unknown names"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.desc, func(t *testing.T) {
+			result := htmlEntityEncode(test.input, test.arg1, "")
+			if result != test.expected {
+				t.Errorf("Expected: %q, Got: %q", test.expected, result)
+			}
+			if decoded := htmlEntityDecode(result, "", ""); decoded != test.input {
+				t.Errorf("Expected decode to return %q, Got: %q", test.input, decoded)
+			}
+		})
+	}
+}
+
+func TestEscapeFor(t *testing.T) {
+	tests := []struct {
+		input    string
+		context  string
+		expected string
+	}{
+		{"say \"hi\"\n\t<b> & \\", "json", `say \"hi\"\n\t<b> & \\`},
+		{`a "quoted", value`, "csv", `"a ""quoted"", value"`},
+		{"it's $HOME; rm -rf", "shell", `'it'\''s $HOME; rm -rf'`},
+		{"1+1=2 (a.b)*[c]", "regex", `1\+1=2 \(a\.b\)\*\[c\]`},
+		{"unchanged", "unknown", "unchanged"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.context, func(t *testing.T) {
+			result := escapeFor(test.input, test.context, "")
+			if result != test.expected {
+				t.Errorf("Expected: %q, Got: %q", test.expected, result)
+			}
+			if back := unescapeFor(result, test.context, ""); back != test.input {
+				t.Errorf("Expected unescape to return %q, Got: %q", test.input, back)
+			}
+		})
+	}
+}
+
+func TestSortLines(t *testing.T) {
+	tests := []struct {
+		input    string
+		arg1     string
+		expected string
+		desc     string
+	}{
+		{"b\na\nc", "", "a\nb\nc", "Alphabetical"},
+		{"b\na\nc", "r", "c\nb\na", "Reverse"},
+		{"10 b\n2 z\n10 a\n2 y\n1 x", "n", "1 x\n2 y\n2 z\n10 a\n10 b", "Equal numbers compare whole lines"},
+		{"2 b\n2 B\n1 a\n2 b", "ni", "1 a\n2 b\n2 B\n2 b", "Duplicate numeric keys keep input order"},
+		{"10 b\n2 z\n10 a\n2 y\n1 x", "nr", "10 b\n10 a\n2 z\n2 y\n1 x", "Numeric reverse"},
+		{"B\na\nb\nA", "i", "a\nA\nB\nb", "Case-insensitive ties keep input order"},
+		{"B\na\nb\nA", "ir", "B\nb\na\nA", "Case-insensitive reverse ties keep input order"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.desc, func(t *testing.T) {
+			// Repeat to catch nondeterministic ordering of equal keys
+			for i := 0; i < 20; i++ {
+				result := sortLines(test.input, test.arg1, "")
+				if result != test.expected {
+					t.Fatalf("Expected: %q, Got: %q", test.expected, result)
+				}
+			}
+		})
+	}
+}
+
+func TestLookaroundPatterns(t *testing.T) {
+	tests := []struct {
+		input  string
+		arg1   string
+		arg2   string
+		behind string
+		ahead  string
+		desc   string
+	}{
+		{"$10 20USD $30USD", `\d+`, `\$`, "10\n30", "", "Prefix only matches behind"},
+		{"$10 20USD $30USD", `\d+`, `USD`, "", "20\n30", "Suffix only matches ahead"},
+		{"id: 7\nkey: 8", `\d`, `(id|key): `, "7\n8", "", "Regex context"},
+		{"x1\ny2", `\d`, `x`, "1", "", "Context stays on the match's line"},
+		{"1567", `\d+`, `5`, "", "", "Rejected matches are not retried"},
+		{"abc", `[`, `a`, "abc", "abc", "Invalid pattern returns input"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.desc, func(t *testing.T) {
+			if result := lookbehindPattern(test.input, test.arg1, test.arg2); result != test.behind {
+				t.Errorf("Look-behind expected: %q, Got: %q", test.behind, result)
+			}
+			if result := lookaheadPattern(test.input, test.arg1, test.arg2); result != test.ahead {
+				t.Errorf("Look-ahead expected: %q, Got: %q", test.ahead, result)
+			}
+		})
+	}
+}
+
+func TestSmartQuotes(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+		desc     string
+	}{
+		{"don't", "don\u2019t", "Contraction"},
+		{"'quoted'", "\u2018quoted\u2019", "Single quoted word"},
+		{`"quoted"`, "\u201cquoted\u201d", "Double quoted word"},
+		{"the dogs' bowls", "the dogs\u2019 bowls", "Trailing possessive"},
+		{"back in '90s", "back in \u201990s", "Leading elision"},
+		{`"She said 'don't' twice"`, "\u201cShe said \u2018don\u2019t\u2019 twice\u201d", "Nested quotes with apostrophe"},
+		{`'"nested"'`, "\u2018\u201cnested\u201d\u2019", "Adjacent opening and closing quotes"},
+		{`"Hi!" he said ("ok")`, "\u201cHi!\u201d he said (\u201cok\u201d)", "Closing after punctuation"},
+		{`a "b" c "d"`, "a \u201cb\u201d c \u201cd\u201d", "Multiple pairs"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.desc, func(t *testing.T) {
+			result := smartQuotes(test.input, "", "")
+			if result != test.expected {
+				t.Errorf("Expected: %q, Got: %q", test.expected, result)
+			}
+		})
+	}
+}
+
+func TestMarkdownLinkFormat(t *testing.T) {
+	tests := []struct {
+		input    string
+		format   string
+		expected string
+		desc     string
+	}{
+		{"See [Go](https://go.dev) now", "text <url>", "See Go <https://go.dev> now", "Bare tokens"},
+		{"[Go](https://go.dev)", "{text}|{url}|{title}", "Go|https://go.dev|", "No title"},
+		{`[Go](https://go.dev "The Go site")`, "{text}|{url}|{title}", "Go|https://go.dev|The Go site", "Double-quoted title"},
+		{"[Go](https://go.dev 'Site')", "{title}: {url}", "Site: https://go.dev", "Single-quoted title"},
+		{"[Go](https://en.wikipedia.org/wiki/Go_(game)) rules", "{url}", "https://en.wikipedia.org/wiki/Go_(game) rules", "Balanced parentheses in URL"},
+		{`([Go](https://en.wikipedia.org/wiki/Go_(game) "Game"))`, "{url}={title}", "(https://en.wikipedia.org/wiki/Go_(game)=Game)", "Parentheses and title inside parentheses"},
+		{"[a] b [c](u)", "{text}", "[a] b c", "Brackets before the link"},
+		{"[url text](x)", "text: url", "url text: x", "Substituted values are not replaced again"},
+		{"[broken](no-close", "{url}", "[broken](no-close", "Unclosed link is left alone"},
+		{`[Go](https://go.dev "The Go site")`, `[{text}]({url} "{title}")`, `[Go](https://go.dev "The Go site")`, "Title in the format"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.desc, func(t *testing.T) {
+			result := markdownLinkFormat(test.input, test.format, "")
+			if result != test.expected {
+				t.Errorf("Expected: %q, Got: %q", test.expected, result)
+			}
+		})
+	}
+}
+
+// TestMarkdownLinkFormatDefault tests that links come through the default format unchanged, titles included
+func TestMarkdownLinkFormatDefault(t *testing.T) {
+	inputs := []string{
+		"See [Go](https://go.dev) now",
+		`[Go](https://go.dev "The Go site")`,
+		"[Go](https://go.dev 'Site') and [Game](https://en.wikipedia.org/wiki/Go_(game) (Wiki))",
+		`[spaced](<https://example.com/a b> "Title")`,
+	}
+
+	for _, input := range inputs {
+		if result := markdownLinkFormat(input, "", ""); result != input {
+			t.Errorf("Expected: %q, Got: %q", input, result)
+		}
+	}
+}
+
+func TestMarkdownToHTML(t *testing.T) {
+	tests := []struct {
+		input    string
+		options  string
+		expected string
+		desc     string
+	}{
+		{"# Title\n\nSome **bold *and italic* text**.", "", "<h1>Title</h1>\n<p>Some <strong>bold <em>and italic</em> text</strong>.</p>", "Heading and nested emphasis"},
+		{"```go\nfmt.Println(\"*not emphasis*\")\n```", "", "<pre><code class=\"language-go\">fmt.Println(&quot;*not emphasis*&quot;)\n</code></pre>", "Fenced code block"},
+		{"- one\n- two\n  - nested\n- three", "", "<ul>\n<li>one</li>\n<li>two\n<ul>\n<li>nested</li>\n</ul>\n</li>\n<li>three</li>\n</ul>", "Nested list"},
+		{"> quoted [link](https://go.dev)", "", "<blockquote>\n<p>quoted <a href=\"https://go.dev\">link</a></p>\n</blockquote>", "Blockquote with link"},
+		{"<b>raw</b>", "", "<p><b>raw</b></p>", "Raw HTML kept by default"},
+		{"<b>raw</b>", "safe", "<p><!-- raw HTML omitted -->raw<!-- raw HTML omitted --></p>", "Raw HTML omitted in safe mode"},
+		{"~~gone~~", "gfm", "<p><del>gone</del></p>", "GFM strikethrough"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.desc, func(t *testing.T) {
+			result := markdownToHTML(test.input, test.options, "")
+			if result != test.expected {
+				t.Errorf("Expected: %q, Got: %q", test.expected, result)
+			}
+		})
+	}
+}
+
+func TestTextWidth(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected int
+		desc     string
+	}{
+		{"hello", 5, "ASCII"},
+		{"日本語", 6, "CJK ideographs are wide"},
+		{"ＡＢ", 4, "Full-width letters"},
+		{"ｶﾀｶﾅ", 4, "Half-width katakana"},
+		{"e\u0301", 1, "Combining mark has no width"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.desc, func(t *testing.T) {
+			if result := textWidth(test.input, false); result != test.expected {
+				t.Errorf("Expected: %d, Got: %d", test.expected, result)
+			}
+		})
+	}
+}
+
+func TestCenterAndWrapWideText(t *testing.T) {
+	// "日本語" occupies 6 cells, leaving 4 cells of padding split evenly
+	if result := centerText("日本語", "10", ""); result != "  日本語" {
+		t.Errorf("Expected: %q, Got: %q", "  日本語", result)
+	}
+	if result := centerText("abc", "10", ""); result != "   abc" {
+		t.Errorf("Expected: %q, Got: %q", "   abc", result)
+	}
+	// Opting out counts runes, so the padding assumes 3 cells
+	if result := centerText("日本語", "10", "runes"); result != "   日本語" {
+		t.Errorf("Expected: %q, Got: %q", "   日本語", result)
+	}
+
+	// Two 4-cell words don't fit in 8 cells with a space between them
+	if result := wrapText("日本 中国 ab", "8", ""); result != "日本\n中国 ab" {
+		t.Errorf("Expected: %q, Got: %q", "日本\n中国 ab", result)
+	}
+	if result := wrapText("日本 中国 ab", "8", "runes"); result != "日本 中国 ab" {
+		t.Errorf("Expected: %q, Got: %q", "日本 中国 ab", result)
+	}
+}
+
+func TestRegexReplace(t *testing.T) {
+	tests := []struct {
+		input    string
+		pattern  string
+		arg2     string
+		expected string
+		desc     string
+	}{
+		{"Error error ERROR", "error", "warn", "Error warn ERROR", "Case-sensitive by default"},
+		{"Error error ERROR", "error", "warn/i", "warn warn warn", "Case-insensitive flag"},
+		{"key: a\nkey: b", "^key: (\\w)", "$1=/", "a=\nb=", "Multiline by default, empty flags"},
+		{"<p>one\ntwo</p>\n<p>three</p>", "^<p>.*?</p>$", "P/sm", "P\nP", "Dotall with multiline"},
+		{"<p>one\ntwo</p>\n<p>three</p>", "^<p>.*?</p>$", "P/s", "P", "Dotall alone anchors to the whole text"},
+		{"a-b", "-", "1/2", "a1/2b", "Non-flag suffix stays in the replacement"},
+		{"a-b", "-", "x/y/", "ax/yb", "Trailing slash keeps a literal slash"},
+		{"speed", "speed", `km\/s`, "km/s", "Escaped slash before flag letters"},
+		{"speed", "speed", `km\/s/i`, "km/s", "Escaped slash with flags"},
+		{"a-b", "-", `\\/i`, "a\\b", "Escaped backslash before the separator"},
+		{"a-b", "-", `\t\/`, "a\t/b", "Other escapes still apply"},
+		{"a-b", "[", "x", "a-b", "Invalid pattern returns input"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.desc, func(t *testing.T) {
+			result := regexReplace(test.input, test.pattern, test.arg2)
+			if result != test.expected {
+				t.Errorf("Expected: %q, Got: %q", test.expected, result)
+			}
+		})
+	}
+}
+
+func TestReplaceFullCount(t *testing.T) {
+	tests := []struct {
+		input   string
+		pattern string
+		desc    string
+	}{
+		{"Error error ERROR", "error", "Case-sensitive"},
+		{"Error error ERROR", "(?i)error", "Inline flag"},
+		{"a1b22c333", `\d+`, "Digit runs"},
+		{"nothing here", `\d`, "No matches"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.desc, func(t *testing.T) {
+			expected := fmt.Sprint(len(regexp.MustCompile(test.pattern).FindAllString(test.input, -1)))
+			if result := replaceFull(test.input, test.pattern, "/c"); result != expected {
+				t.Errorf("Expected: %q, Got: %q", expected, result)
+			}
+		})
+	}
+
+	// Replacements written before counting existed keep giving the same output
+	unchanged := []struct {
+		replacement string
+		expected    string
+	}{
+		{"/i", "a/ib"},
+		{"a/c", "aa/cb"},
+		{`usr\/bin`, `ausr\/binb`},
+		{`\/c`, `a\/cb`},
+	}
+	for _, test := range unchanged {
+		if result := replaceFull("a-b", "-", test.replacement); result != test.expected {
+			t.Errorf("Replacement %q: expected: %q, Got: %q", test.replacement, test.expected, result)
+		}
+	}
+}
+
+func TestRegexReplaceCount(t *testing.T) {
+	tests := []struct {
+		input   string
+		pattern string
+		flags   string
+		desc    string
+	}{
+		{"Error error ERROR", "error", "c", "Case-sensitive"},
+		{"Error error ERROR", "error", "ic", "Case-insensitive"},
+		{"a1b22c333", `\d+`, "c", "Digit runs"},
+		{"nothing here", `\d`, "c", "No matches"},
+		{"<p>one\ntwo</p>\n<p>three</p>", "^<p>.*?</p>$", "smc", "Dotall with multiline"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.desc, func(t *testing.T) {
+			re := regexp.MustCompile(addRegexFlags(test.pattern, parseRegexFlags(test.flags)))
+			expected := fmt.Sprint(len(re.FindAllString(test.input, -1)))
+
+			result := regexReplace(test.input, test.pattern, "ignored/"+test.flags)
+			if result != expected {
+				t.Errorf("Expected: %q, Got: %q", expected, result)
+			}
+		})
+	}
+
+	if result := regexReplace("a-b-c", "-", "/c"); result != "2" {
+		t.Errorf("Expected: %q, Got: %q", "2", result)
+	}
+}
+
+func TestSelectHtmlTable(t *testing.T) {
+	page := `<div>
+<table id="people">
+  <thead><tr><th>Name</th><th>Age</th></tr></thead>
+  <tbody>
+    <tr><td>Ann  Lee</td><td>31</td></tr>
+    <tr><td>Bob</td><td><b>42</b></td></tr>
+  </tbody>
+</table>
+<table id="other"><tr><td>x</td></tr></table>
+</div>`
+
+	tests := []struct {
+		selector string
+		command  string
+		expected string
+		desc     string
+	}{
+		{"#people", "table", "Name\tAge\nAnn Lee\t31\nBob\t42", "TSV rows"},
+		{"#people", "table:,", "Name,Age\nAnn Lee,31\nBob,42", "Custom delimiter"},
+		{"div", "table", "Name\tAge\nAnn Lee\t31\nBob\t42\nx", "Tables inside the selection"},
+		{"table", "table", "Name\tAge\nAnn Lee\t31\nBob\t42\nx", "Each matched table"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.desc, func(t *testing.T) {
+			result := selectHtml(page, test.selector, test.command)
+			if result != test.expected {
+				t.Errorf("Expected: %q, Got: %q", test.expected, result)
+			}
+		})
+	}
+
+	nested := `<table id="outer"><tr><td>a</td><td><table><tr><td>inner</td></tr></table></td></tr></table>`
+	if result := selectHtml(nested, "#outer", "table"); result != "a\tinner" {
+		t.Errorf("Expected nested table rows to stay out of the outer rows, Got: %q", result)
+	}
+}
+
+func TestFindHtmlLinksBaseURL(t *testing.T) {
+	page := `<a href="page.html">Relative</a>
+<a href="../up.html">Parent</a>
+<a href="/root.html">Root</a>
+<a href="https://other.org/x">Absolute</a>
+<a href="#top">Fragment</a>`
+
+	expected := strings.Join([]string{
+		"Relative https://example.com/dir/page.html",
+		"Parent https://example.com/up.html",
+		"Root https://example.com/root.html",
+		"Absolute https://other.org/x",
+		"Fragment https://example.com/dir/#top",
+	}, "\n")
+
+	result := findHtmlLinks(page, "{text} {href}", "https://example.com/dir/")
+	if result != expected {
+		t.Errorf("Expected: %q, Got: %q", expected, result)
+	}
+
+	// Without a base URL hrefs are returned as written
+	if result := findHtmlLinks(`<a href="page.html">Relative</a>`, "{href}", ""); result != "page.html" {
+		t.Errorf("Expected: %q, Got: %q", "page.html", result)
+	}
+}
+
+func TestExtractImages(t *testing.T) {
+	page := `<p><img src="logo.png" alt="Logo"></p>
+<img src="/img/photo.jpg">
+<img alt="No source">
+<img src="https://cdn.example.org/icon.svg" alt="Icon">`
+
+	tests := []struct {
+		format   string
+		base     string
+		expected string
+		desc     string
+	}{
+		{"", "", "logo.png\n/img/photo.jpg\nhttps://cdn.example.org/icon.svg", "Default format"},
+		{"{alt}: {src}", "", "Logo: logo.png\n: /img/photo.jpg\nIcon: https://cdn.example.org/icon.svg", "Missing alt is empty"},
+		{"{src}", "https://example.com/dir/", "https://example.com/dir/logo.png\nhttps://example.com/img/photo.jpg\nhttps://cdn.example.org/icon.svg", "Base URL resolution"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.desc, func(t *testing.T) {
+			result := extractImages(page, test.format, test.base)
+			if result != test.expected {
+				t.Errorf("Expected: %q, Got: %q", test.expected, result)
+			}
+		})
+	}
+}
+
+func TestExtractAttribute(t *testing.T) {
+	page := `<ul>
+<li class="item" data-id="101">One</li>
+<li class="item">No id</li>
+<li class="item" data-id="">Empty id</li>
+<li class="other" data-id="999">Other</li>
+<li class="item" data-id="103">Three</li>
+</ul>`
+
+	tests := []struct {
+		selector  string
+		attribute string
+		expected  string
+		desc      string
+	}{
+		{"li.item", "data-id", "101\n\n103", "Skips elements without the attribute"},
+		{"li", "data-id", "101\n\n999\n103", "All list items"},
+		{"li.item", "title", "", "No element has the attribute"},
+		{"li.item", "", page, "Missing attribute name returns input"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.desc, func(t *testing.T) {
+			result := extractAttribute(page, test.selector, test.attribute)
+			if result != test.expected {
+				t.Errorf("Expected: %q, Got: %q", test.expected, result)
+			}
+		})
+	}
+}
+
+func TestJSONKeyOrder(t *testing.T) {
+	input := `{"zeta": 1, "alpha": {"b": 2.50, "a": [3, {"y": true, "x": null}]}, "mid": "m"}`
+
+	pretty := formatJson(input, "", "")
+	expected := `{
+  "zeta": 1,
+  "alpha": {
+    "b": 2.50,
+    "a": [
+      3,
+      {
+        "y": true,
+        "x": null
+      }
+    ]
+  },
+  "mid": "m"
+}`
+	if pretty != expected {
+		t.Errorf("Expected: %q, Got: %q", expected, pretty)
+	}
+
+	if result := minifyJson(input, "", ""); result != `{"zeta":1,"alpha":{"b":2.50,"a":[3,{"y":true,"x":null}]},"mid":"m"}` {
+		t.Errorf("Unexpected minified JSON: %q", result)
+	}
+	if result := minifyJson(input, "", "sorted"); result != `{"alpha":{"a":[3,{"x":null,"y":true}],"b":2.5},"mid":"m","zeta":1}` {
+		t.Errorf("Unexpected sorted JSON: %q", result)
+	}
+	if result := selectJson(input, "alpha.a.1", ""); result != "{\n  \"y\": true,\n  \"x\": null\n}" {
+		t.Errorf("Unexpected selection: %q", result)
+	}
+	if result := formatJson(`{"a": 1} trailing`, "", ""); result != `{"a": 1} trailing` {
+		t.Errorf("Expected invalid JSON to be returned unchanged, Got: %q", result)
+	}
+
+	// Deeply nested objects and arrays are written in one pass
+	deep := strings.Repeat(`{"b":1,"a":[`, 2000) + "0" + strings.Repeat("]}", 2000)
+	if result := minifyJson(deep, "", ""); result != deep {
+		t.Errorf("Expected deeply nested JSON to come through unchanged, got %d bytes", len(result))
+	}
+}
+
+// forEachBenchInput builds a multi-line input for the foreach tests and benchmark
+func forEachBenchInput(n int) string {
+	lines := make([]string, n)
+	for i := range lines {
+		lines[i] = fmt.Sprintf("line %d value=%d", i, i*7)
+	}
+	return strings.Join(lines, "\n")
+}
+
+func TestForEachParallelMatchesSerial(t *testing.T) {
+	child := PipelineNode{ID: "node_1", Type: "operation", Operation: "Uppercase"}
+	serial := &PipelineNode{Type: "foreach", Children: []PipelineNode{child}}
+	parallel := &PipelineNode{Type: "foreach", Arg2: "parallel", Children: []PipelineNode{child}}
+
+	tests := []struct {
+		input string
+		desc  string
+	}{
+		{"", "Empty input"},
+		{"single", "Single line"},
+		{"a\n\nb\n", "Blank and trailing lines"},
+		{forEachBenchInput(1000), "Many lines"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.desc, func(t *testing.T) {
+			expected := ExecuteNode(serial, tt.input)
+			result := ExecuteNode(parallel, tt.input)
+			if result != expected {
+				t.Errorf("Expected: %q, Got: %q", expected, result)
+			}
+		})
+	}
+}
+
+func TestExecuteNodeContextCanceled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	child := PipelineNode{Type: "operation", Operation: "Uppercase"}
+	tests := []struct {
+		node *PipelineNode
+		desc string
+	}{
+		{&PipelineNode{Type: "operation", Operation: "Uppercase"}, "Operation"},
+		{&PipelineNode{Type: "foreach", Children: []PipelineNode{child}}, "Serial foreach"},
+		{&PipelineNode{Type: "foreach", Arg2: "parallel", Children: []PipelineNode{child}}, "Parallel foreach"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.desc, func(t *testing.T) {
+			result, err := ExecuteNodeContext(ctx, tt.node, "a\nb")
+			if !errors.Is(err, context.Canceled) {
+				t.Errorf("Expected context.Canceled, Got: %v", err)
+			}
+			if result != "a\nb" {
+				t.Errorf("Expected: %q, Got: %q", "a\nb", result)
+			}
+		})
+	}
+}
+
+func TestSearchOperations(t *testing.T) {
+	tests := []struct {
+		query    string
+		expected string
+		desc     string
+	}{
+		{"white", "Normalize Whitespace", "Word inside a name"},
+		{"dump", "Hex Dump", "Word inside a name, later in the list"},
+		{"upper", "Uppercase", "Name prefix"},
+		{"UPPERCASE", "Uppercase", "Exact name ignoring case"},
+		{"regex rep", "Regex Replace", "Prefixes of several words"},
+		{"md html", "Markdown to HTML", "Fuzzy match"},
+		{"trm", "Trim", "Fuzzy match prefers shorter names"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.desc, func(t *testing.T) {
+			results := SearchOperations(tt.query, 5)
+			if len(results) == 0 {
+				t.Fatalf("Expected: %q, Got no results", tt.expected)
+			}
+			if results[0].Name != tt.expected {
+				t.Errorf("Expected: %q, Got: %q", tt.expected, results[0].Name)
+			}
+		})
+	}
+
+	if results := SearchOperations("json", 2); len(results) != 2 {
+		t.Errorf("Expected limit of 2 results, Got: %d", len(results))
+	}
+	if results := SearchOperations("zzzqqq", 5); len(results) != 0 {
+		t.Errorf("Expected no results, Got: %d", len(results))
+	}
+}
+
+// TestApplyPipeline tests running an inline JSON pipeline as a single operation
+func TestApplyPipeline(t *testing.T) {
+	tests := []struct {
+		input    string
+		arg1     string
+		expected string
+		desc     string
+	}{
+		{"  hello world  ", `[{"type":"operation","operation":"Trim"},{"type":"operation","operation":"Uppercase"}]`, "HELLO WORLD", "Two nodes"},
+		{"  hello  ", `[{"operation":"Trim"},{"operation":"Replace Text","arg1":"hello","arg2":"bye"}]`, "bye", "Nodes without a type are operations"},
+		{"a\nb", `[{"type":"foreach","children":[{"operation":"Surround Text","arg1":"<","arg2":">"}]}]`, "<a>\n<b>", "Nested nodes"},
+		{"hello", `[{"operation":"Uppercase"`, "hello", "Invalid JSON"},
+		{"hello", `[{"type":"bogus","operation":"Uppercase"}]`, "hello", "Unknown node type"},
+		{"hello", "", "hello", "Empty pipeline"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.desc, func(t *testing.T) {
+			result := ProcessText(tt.input, "Apply Pipeline", tt.arg1, "")
+			if result != tt.expected {
+				t.Errorf("Expected: %q, Got: %q", tt.expected, result)
+			}
+		})
+	}
+}
+
+// TestEncodeWhitespaceRoundTrip tests that Decode Whitespace restores what Encode Whitespace changed
+func TestEncodeWhitespaceRoundTrip(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+		desc     string
+	}{
+		{"a b\tc", "a␣b␉c", "Space and tab"},
+		{"one\r\ntwo\n", "one␍␤\ntwo␤\n", "Line breaks stay lines"},
+		{"  \t\n\n", "␣␣␉␤\n␤\n", "Only whitespace"},
+		{"box ␣ tab ␉", "box␣␛␣␣tab␣␛␉", "Symbols in the input are escaped"},
+		{"␛␤\n␛", "␛␛␛␤␤\n␛␛", "Escape symbol in the input"},
+		{"", "", "Empty"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.desc, func(t *testing.T) {
+			encoded := ProcessText(tt.input, "Encode Whitespace", "", "")
+			if encoded != tt.expected {
+				t.Errorf("Expected: %q, Got: %q", tt.expected, encoded)
+			}
+			if decoded := ProcessText(encoded, "Decode Whitespace", "", ""); decoded != tt.input {
+				t.Errorf("Expected round trip to give %q, Got: %q", tt.input, decoded)
+			}
+		})
+	}
+
+	// Line breaks added to encoded text by hand survive decoding
+	if got := decodeWhitespace("a␣b\nc", "", ""); got != "a b\nc" {
+		t.Errorf("Expected: %q, Got: %q", "a b\nc", got)
+	}
+}
+
+// TestUnindentText tests removing common indentation measured in columns
+func TestUnindentText(t *testing.T) {
+	tests := []struct {
+		input    string
+		arg1     string
+		expected string
+		desc     string
+	}{
+		{"    a\n      b\n    c", "", "a\n  b\nc", "Space-indented block"},
+		{"\ta\n\t\tb", "", "a\n\tb", "Tab-indented block"},
+		{"\ta\n    b\n      c", "", "a\nb\n  c", "Mixed tabs and spaces line up at the tab stop"},
+		{"\ta\n    b", "8", "    a\nb", "Wider tab stop"},
+		{"  \ta\n  b", "", "  a\nb", "Tab past the cut becomes spaces"},
+		{"    a\n\n  \n    b", "", "a\n\n\nb", "Blank lines"},
+		{"a\n    b", "", "a\n    b", "No common indent"},
+		{"\ta", "x", "\ta", "Invalid tab width"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.desc, func(t *testing.T) {
+			result := unindentText(tt.input, tt.arg1, "")
+			if result != tt.expected {
+				t.Errorf("Expected: %q, Got: %q", tt.expected, result)
+			}
+		})
+	}
+}
+
+// TestIndentText tests the 4-space default indent, a custom indent and skipping blank lines
+func TestIndentText(t *testing.T) {
+	tests := []struct {
+		input    string
+		arg1     string
+		arg2     string
+		expected string
+		desc     string
+	}{
+		{"a\nb", "", "", "    a\n    b", "Default is 4 spaces"},
+		{"a\nb", "\t", "", "\ta\n\tb", "Custom indent"},
+		{"a\n\nb", "  ", "", "  a\n  \n  b", "Blank lines are indented"},
+		{"a\n\n \nb", "", "skip", "    a\n\n \n    b", "Blank lines are skipped"},
+		{"", "", "", "", "Empty input"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.desc, func(t *testing.T) {
+			result := indentText(tt.input, tt.arg1, tt.arg2)
+			if result != tt.expected {
+				t.Errorf("Expected: %q, Got: %q", tt.expected, result)
+			}
+		})
+	}
+}
+
+// TestTrimLines tests trimming each line on both or one side while keeping the line structure
+func TestTrimLines(t *testing.T) {
+	tests := []struct {
+		input    string
+		arg1     string
+		expected string
+		desc     string
+	}{
+		{"  a  \n\tb\t\n c", "", "a\nb\nc", "Both sides by default"},
+		{"  a  \n\tb\t\n c", "both", "a\nb\nc", "Both sides"},
+		{"  a  \n\tb\t\n c", "left", "a  \nb\t\nc", "Left side"},
+		{"  a  \n\tb\t\n c", "right", "  a\n\tb\n c", "Right side"},
+		{"a\n   \n\nb", "", "a\n\n\nb", "Blank lines are kept"},
+		{"  a  ", "middle", "  a  ", "Unknown side"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.desc, func(t *testing.T) {
+			result := trimLines(tt.input, tt.arg1, "")
+			if result != tt.expected {
+				t.Errorf("Expected: %q, Got: %q", tt.expected, result)
+			}
+		})
+	}
+}
+
+// TestTrimBlankLines tests removing leading and trailing blank lines while keeping interior ones
+func TestTrimBlankLines(t *testing.T) {
+	tests := []struct {
+		input    string
+		arg1     string
+		expected string
+		desc     string
+	}{
+		{"\n  \na\n\nb\n\t\n\n", "", "a\n\nb\n", "Both ends, interior blank kept"},
+		{"\n  \na\n\nb\n\t\n", "start", "a\n\nb\n\t\n", "Start only"},
+		{"\n  \na\n\nb\n\t\n", "end", "\n  \na\n\nb\n", "End only"},
+		{"\n\na\nb", "", "a\nb", "No final newline"},
+		{"a\n\nb", "", "a\n\nb", "Nothing to trim"},
+		{"\n \n\n", "", "", "Only blank lines"},
+		{"\na", "middle", "\na", "Unknown side"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.desc, func(t *testing.T) {
+			result := trimBlankLines(tt.input, tt.arg1, "")
+			if result != tt.expected {
+				t.Errorf("Expected: %q, Got: %q", tt.expected, result)
+			}
+		})
+	}
+}
+
+// TestLinesContainingSeveral tests keeping and removing lines that match any or all of several search strings
+func TestLinesContainingSeveral(t *testing.T) {
+	input := "apple pie\nbanana bread\napple banana\ncherry"
+	tests := []struct {
+		fn       func(string, string, string) string
+		arg1     string
+		arg2     string
+		expected string
+		desc     string
+	}{
+		{keepLinesContaining, "apple|cherry", "", "apple pie\napple banana\ncherry", "Keep any"},
+		{keepLinesContaining, "apple\nbanana", "a", "apple banana", "Keep all, newline separated"},
+		{keepLinesContaining, "APPLE|Banana", "ia", "apple banana", "Keep all, case-insensitive"},
+		{removeLinesContaining, "apple|cherry", "", "banana bread", "Remove any"},
+		{removeLinesContaining, "apple|banana", "a", "apple pie\nbanana bread\ncherry", "Remove all"},
+		{keepLinesContaining, "pie", "", "apple pie", "Single search string"},
+		{keepLinesContaining, "|", "", input, "Only separators"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.desc, func(t *testing.T) {
+			result := tt.fn(input, tt.arg1, tt.arg2)
+			if result != tt.expected {
+				t.Errorf("Expected: %q, Got: %q", tt.expected, result)
+			}
+		})
+	}
+}
+
+// TestLinesContainingLiteralPipe tests that an escaped pipe is searched for instead of separating search strings
+func TestLinesContainingLiteralPipe(t *testing.T) {
+	input := "a | b\na or b\nc || d\nplain"
+	tests := []struct {
+		fn       func(string, string, string) string
+		arg1     string
+		expected string
+		desc     string
+	}{
+		{keepLinesContaining, `\|`, "a | b\nc || d", "Keep a literal pipe"},
+		{keepLinesContaining, `\|\|`, "c || d", "Keep a double pipe"},
+		{keepLinesContaining, `\||plain`, "a | b\nc || d\nplain", "Literal pipe among several"},
+		{removeLinesContaining, `a \| b|or`, "c || d\nplain", "Remove with a literal pipe"},
+		{keepLinesContaining, `a\b`, "", "Other backslashes stay"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.desc, func(t *testing.T) {
+			result := tt.fn(input, tt.arg1, "")
+			if result != tt.expected {
+				t.Errorf("Expected: %q, Got: %q", tt.expected, result)
+			}
+		})
+	}
+}
+
+// TestKeepMatchLinesInvert tests the "v" flag on its own and combined with "i"
+func TestKeepMatchLinesInvert(t *testing.T) {
+	input := "Error: disk\nwarning: cpu\nERROR: net\ninfo: ok"
+	tests := []struct {
+		arg2     string
+		expected string
+		desc     string
+	}{
+		{"", "Error: disk", "No flags"},
+		{"i", "Error: disk\nERROR: net", "Case-insensitive"},
+		{"v", "warning: cpu\nERROR: net\ninfo: ok", "Inverted"},
+		{"iv", "warning: cpu\ninfo: ok", "Inverted case-insensitive"},
+		{"vi", "warning: cpu\ninfo: ok", "Flag order doesn't matter"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.desc, func(t *testing.T) {
+			result := keepMatchLines(input, "^Error", tt.arg2)
+			if result != tt.expected {
+				t.Errorf("Expected: %q, Got: %q", tt.expected, result)
+			}
+		})
+	}
+
+	// Inverting gives the same lines as Remove Match Lines
+	if got, want := keepMatchLines(input, "^error", "iv"), removeMatchLines(input, "^error", "i"); got != want {
+		t.Errorf("Expected: %q, Got: %q", want, got)
+	}
+}
+
+// TestMatchTextModes tests returning the match count and whole matching lines
+func TestMatchTextModes(t *testing.T) {
+	input := "id 12 and 34\nnone here\nID 56"
+	tests := []struct {
+		arg1     string
+		arg2     string
+		expected string
+		desc     string
+	}{
+		{`\d+`, "", "12\n34\n56", "Matches"},
+		{`\d+`, "count", "3", "Count"},
+		{`x+`, "count", "0", "Count without matches"},
+		{`id`, "i count", "2", "Count with flags"},
+		{`\d+`, "line", "id 12 and 34\nID 56", "Whole lines"},
+		{`^id`, "i,line", "id 12 and 34\nID 56", "Whole lines with flags"},
+		{`^id`, "line", "id 12 and 34", "Whole lines, case-sensitive"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.desc, func(t *testing.T) {
+			result := matchText(input, tt.arg1, tt.arg2)
+			if result != tt.expected {
+				t.Errorf("Expected: %q, Got: %q", tt.expected, result)
+			}
+		})
+	}
+}
+
+// TestReplaceNth tests replacing a single numbered or last occurrence
+func TestReplaceNth(t *testing.T) {
+	tests := []struct {
+		input    string
+		arg1     string
+		arg2     string
+		expected string
+		desc     string
+	}{
+		{"a-b-c-d", "-", "2:+", "a-b+c-d", "Second occurrence"},
+		{"a-b-c-d", "-", "last:+", "a-b-c+d", "Last occurrence"},
+		{"a-b-c-d", "-", "1:", "ab-c-d", "Empty replacement"},
+		{"a-b", "-", "1:x:y", "ax:yb", "Colon in the replacement"},
+		{"aaaa", "aa", "2:X", "aaX", "Occurrences don't overlap"},
+		{"a-b", "-", "3:+", "a-b", "Fewer occurrences"},
+		{"a-b", "+", "last:-", "a-b", "No occurrence"},
+		{"a-b", "-", "+", "a-b", "Missing occurrence"},
+		{"a-b", "-", "0:+", "a-b", "Invalid occurrence"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.desc, func(t *testing.T) {
+			result := replaceNth(tt.input, tt.arg1, tt.arg2)
+			if result != tt.expected {
+				t.Errorf("Expected: %q, Got: %q", tt.expected, result)
+			}
+		})
+	}
+}
+
+// TestGroupByPatternBucket tests gathering matching and other lines into two sections
+func TestGroupByPatternBucket(t *testing.T) {
+	tests := []struct {
+		input    string
+		arg2     string
+		expected string
+		desc     string
+	}{
+		{"apple\nkiwi\navocado\nfig", "bucket", "Matches:\napple\navocado\n\nOthers:\nkiwi\nfig", "Two buckets in input order"},
+		{"apple\navocado", "bucket", "Matches:\napple\navocado\n\nOthers:", "Empty bucket keeps its header"},
+		{"apple\nkiwi", "", "MATCH: apple\nNO MATCH: kiwi", "Labels without bucket"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.desc, func(t *testing.T) {
+			result := groupByPattern(tt.input, "^a", tt.arg2)
+			if result != tt.expected {
+				t.Errorf("Expected: %q, Got: %q", tt.expected, result)
+			}
+		})
+	}
+}
+
+// TestCommonItems tests alphabetical tie-breaking, counts and top/bottom N for Most and Least Common
+func TestCommonItems(t *testing.T) {
+	fruit := "pear\nfig\napple\nfig\npear\nkiwi\nplum"
+	tests := []struct {
+		fn       func(string, string, string) string
+		input    string
+		arg1     string
+		arg2     string
+		expected string
+		desc     string
+	}{
+		{mostCommon, fruit, "", "", "fig", "Most common, tie broken alphabetically"},
+		{leastCommon, fruit, "", "", "apple", "Least common, tie broken alphabetically"},
+		{mostCommon, fruit, "", "count", "2\tfig", "Most common with count"},
+		{mostCommon, fruit, "", "3", "fig\npear\napple", "Top 3"},
+		{leastCommon, fruit, "", "2,count", "1\tapple\n1\tkiwi", "Bottom 2 with counts"},
+		{mostCommon, fruit, "", "10", "fig\npear\napple\nkiwi\nplum", "N larger than the number of items"},
+		{mostCommon, "c,b,a,b,c", ",", "", "b", "Custom delimiter"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.desc, func(t *testing.T) {
+			result := tt.fn(tt.input, tt.arg1, tt.arg2)
+			if result != tt.expected {
+				t.Errorf("Expected: %q, Got: %q", tt.expected, result)
+			}
+		})
+	}
+
+	// Map iteration order must not leak into the result
+	for i := 0; i < 20; i++ {
+		if got := leastCommon(fruit, "", ""); got != "apple" {
+			t.Fatalf("Expected: %q, Got: %q", "apple", got)
+		}
+	}
+}
+
+// TestTemplateLines tests applying a per-line template with the line and its number
+func TestTemplateLines(t *testing.T) {
+	tests := []struct {
+		input    string
+		arg1     string
+		expected string
+		desc     string
+	}{
+		{"a\nb", "<li>{line}</li>", "<li>a</li>\n<li>b</li>", "List items"},
+		{"a\nb\nc", "{n}: {line}", "1: a\n2: b\n3: c", "Line numbers"},
+		{"a\nb", "{line}\\t{line}", "a\ta\nb\tb", "Escape sequences"},
+		{"{n}\n{line}", "[{line}]", "[{n}]\n[{line}]", "Placeholders in lines are kept"},
+		{"a\nb", "", "a\nb", "Empty template"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.desc, func(t *testing.T) {
+			result := templateLines(tt.input, tt.arg1, "")
+			if result != tt.expected {
+				t.Errorf("Expected: %q, Got: %q", tt.expected, result)
+			}
+		})
+	}
+}
+
+// TestFillTemplate tests filling placeholders from JSON and key=value values
+func TestFillTemplate(t *testing.T) {
+	tests := []struct {
+		input    string
+		arg1     string
+		arg2     string
+		expected string
+		desc     string
+	}{
+		{"Dear {{name}}, you owe {{ amount }}.", `{"name": "Ada", "amount": 12.5}`, "", "Dear Ada, you owe 12.5.", "JSON values"},
+		{"Dear {{name}}, you owe {{amount}}.", "name=Ada\namount=12.5", "", "Dear Ada, you owe 12.5.", "key=value lines"},
+		{"{{name}} {{url}}", `name=Ada\nurl=https://x.org/?a=b`, "", "Ada https://x.org/?a=b", "Escaped newlines, = in a value"},
+		{"Hi {{name}}{{title}}", `{"name": "Ada"}`, "", "Hi Ada{{title}}", "Unknown placeholders kept"},
+		{"Hi {{name}}{{title}}", `{"name": "Ada"}`, "empty", "Hi Ada", "Unknown placeholders emptied"},
+		{"Hi {{name}}", `{"name": `, "", "Hi {{name}}", "Invalid JSON"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.desc, func(t *testing.T) {
+			result := fillTemplate(tt.input, tt.arg1, tt.arg2)
+			if result != tt.expected {
+				t.Errorf("Expected: %q, Got: %q", tt.expected, result)
+			}
+		})
+	}
+}
+
+// TestDiffBlocks tests diffing the two blocks around a separator line
+func TestDiffBlocks(t *testing.T) {
+	tests := []struct {
+		input    string
+		arg1     string
+		expected string
+		desc     string
+	}{
+		{"a\nb\nc\n---\na\nB\nc\nd\n", "", " a\n-b\n+B\n c\n+d", "Changed and added lines"},
+		{"a\nb\n  ---  \nb", "", "-a\n b", "Separator with spaces"},
+		{"a\n===\na", "===", " a", "Custom separator, identical blocks"},
+		{"---\nx", "", "+x", "Empty first block"},
+		{"a\nb", "", "a\nb", "No separator"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.desc, func(t *testing.T) {
+			result := diffBlocks(tt.input, tt.arg1, "")
+			if result != tt.expected {
+				t.Errorf("Expected: %q, Got: %q", tt.expected, result)
+			}
+		})
+	}
+}
+
+// TestSortParagraphs tests sorting multi-line paragraphs as units
+func TestSortParagraphs(t *testing.T) {
+	input := "cherry\nred\n\napple\ngreen\n\n\nBanana\nyellow\n"
+	tests := []struct {
+		input    string
+		arg1     string
+		expected string
+		desc     string
+	}{
+		{input, "", "Banana\nyellow\n\napple\ngreen\n\ncherry\nred", "By first line"},
+		{input, "i", "apple\ngreen\n\nBanana\nyellow\n\ncherry\nred", "Case-insensitive"},
+		{input, "r", "cherry\nred\n\napple\ngreen\n\nBanana\nyellow", "Reverse"},
+		{input, "ri", "cherry\nred\n\nBanana\nyellow\n\napple\ngreen", "Reverse case-insensitive"},
+		{"b\nz\n\na\ny\n\nb\nx", "", "a\ny\n\nb\nz\n\nb\nx", "Equal first lines keep their order"},
+		{"b\nz\n\na\ny\n\nb\nx", "b", "a\ny\n\nb\nx\n\nb\nz", "Whole blocks"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.desc, func(t *testing.T) {
+			result := sortParagraphs(tt.input, tt.arg1, "")
+			if result != tt.expected {
+				t.Errorf("Expected: %q, Got: %q", tt.expected, result)
+			}
+		})
+	}
+}
+
+// TestShuffleAndSampleWords tests that a fixed seed gives a fixed permutation or sample of the words
+func TestShuffleAndSampleWords(t *testing.T) {
+	input := "one two three four five\nsix seven  eight"
+	tests := []struct {
+		fn       func(string, string, string) string
+		arg1     string
+		arg2     string
+		expected string
+		desc     string
+	}{
+		{shuffleWords, "42", "", "six eight five seven two four one three", "Shuffle all words"},
+		{shuffleWords, "42", "line", "three four five one two\nseven eight six", "Shuffle within lines"},
+		{sampleWords, "3,42", "", "one six seven", "Sample words in order"},
+		{sampleWords, "2,42", "line", "one two\nseven eight", "Sample words from each line"},
+		{sampleWords, "x", "", input, "Invalid count"},
+		{shuffleWords, "x", "", input, "Invalid seed"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.desc, func(t *testing.T) {
+			result := tt.fn(input, tt.arg1, tt.arg2)
+			if result != tt.expected {
+				t.Errorf("Expected: %q, Got: %q", tt.expected, result)
+			}
+		})
+	}
+}
+
+// TestDetectEncoding tests the encoding report for plain UTF-8, a BOM and control characters
+func TestDetectEncoding(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+		desc     string
+	}{
+		{"héllo\nwörld\n", "Valid UTF-8: yes\nBOM: none\nLine endings: LF (2)\nNon-ASCII characters: 2\nControl characters: 0", "UTF-8 with LF"},
+		{"\uFEFFa\r\nb\r\n", "Valid UTF-8: yes\nBOM: UTF-8\nLine endings: CRLF (2)\nNon-ASCII characters: 1\nControl characters: 0", "BOM with CRLF"},
+		{"a\x00b\x1b[0m\tc\rd\n", "Valid UTF-8: yes\nBOM: none\nLine endings: mixed, LF (1), CR (1)\nNon-ASCII characters: 0\nControl characters: 2", "Control characters"},
+		{"ab\xffc", "Valid UTF-8: no (invalid bytes: 1)\nBOM: none\nLine endings: none\nNon-ASCII characters: 0\nControl characters: 0", "Invalid UTF-8"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.desc, func(t *testing.T) {
+			result := detectEncoding(tt.input, "", "")
+			if result != tt.expected {
+				t.Errorf("Expected: %q, Got: %q", tt.expected, result)
+			}
+		})
+	}
+}
+
+// TestASCIIJSONStringRoundTrip tests encoding to an ASCII-only JSON string and decoding it again
+func TestASCIIJSONStringRoundTrip(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+		desc     string
+	}{
+		{"hello", `"hello"`, "Plain ASCII"},
+		{"café", `"caf\u00e9"`, "Accented letter"},
+		{"hi 😀", `"hi \ud83d\ude00"`, "Emoji as a surrogate pair"},
+		{"a\"b\\c\n<d>", `"a\"b\\c\n<d>"`, "Quotes, backslashes, newlines and HTML characters"},
+		{"", `""`, "Empty"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.desc, func(t *testing.T) {
+			encoded := toASCIIJSONString(tt.input, "", "")
+			if encoded != tt.expected {
+				t.Errorf("Expected: %q, Got: %q", tt.expected, encoded)
+			}
+			if decoded := fromJSONString(encoded, "", ""); decoded != tt.input {
+				t.Errorf("Expected the round trip to give %q, got %q", tt.input, decoded)
+			}
+		})
+	}
+
+	if got := fromJSONString("not json", "", ""); got != "not json" {
+		t.Errorf("Expected input that isn't a JSON string to be unchanged, got %q", got)
+	}
+}
+
+// TestEscapeUnicode tests BMP characters and emoji as surrogate pairs or long escapes
+func TestEscapeUnicode(t *testing.T) {
+	tests := []struct {
+		input    string
+		arg1     string
+		expected string
+		desc     string
+	}{
+		{"café", "", `caf\u00E9`, "BMP character"},
+		{"a😀b", "", `a\uD83D\uDE00b`, "Emoji as a surrogate pair"},
+		{"a😀b", "U", `a\U0001F600b`, "Emoji as a long escape"},
+		{"é\n", "U", `\u00E9\u000A`, "Long mode keeps BMP escapes short"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.desc, func(t *testing.T) {
+			result := escapeUnicode(tt.input, tt.arg1, "")
+			if result != tt.expected {
+				t.Errorf("Expected: %q, Got: %q", tt.expected, result)
+			}
+			if decoded := convertUnicodeEscapes(result, "", ""); decoded != tt.input {
+				t.Errorf("Expected Convert Unicode Escapes to give back %q, got %q", tt.input, decoded)
+			}
+		})
+	}
+}
+
+// TestUnicodeNames tests looking up character names, the compact mode and the code point fallback
+func TestUnicodeNames(t *testing.T) {
+	tests := []struct {
+		input    string
+		arg1     string
+		expected string
+		desc     string
+	}{
+		{"café", "", "caf[U+00E9 LATIN SMALL LETTER E WITH ACUTE]", "Accented letter"},
+		{"😀", "", "[U+1F600 GRINNING FACE]", "Emoji"},
+		{"a€b", "compact", "a[EURO SIGN]b", "Compact"},
+		{"中\u0085", "compact", "[U+4E2D][U+0085]", "No name of their own"},
+		{"plain", "", "plain", "ASCII only"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.desc, func(t *testing.T) {
+			result := unicodeNames(tt.input, tt.arg1, "")
+			if result != tt.expected {
+				t.Errorf("Expected: %q, Got: %q", tt.expected, result)
+			}
+		})
+	}
+}
+
+// TestNormalizeHTMLText tests collapsing HTML whitespace like a browser, compared with raw text extraction
+func TestNormalizeHTMLText(t *testing.T) {
+	snippet := "<html><head><title>Page</title></head><body>\n" +
+		"  <h1>  Hello\n   world </h1>\n" +
+		"  <p>Some <b>bold</b>and <i> italic </i>  text.</p><div><span>One</span><span>Two</span></div>\n" +
+		"  <ul>\n    <li>First</li>\n    <li>Second</li>\n  </ul>line<br>break<!-- note -->\n" +
+		"  <script>var x = 1;</script>\n</body></html>"
+
+	raw := extractTextFromHTML(snippet, "", "")
+	if !strings.Contains(raw, "  Hello\n   world ") || !strings.Contains(raw, "linebreak") {
+		t.Errorf("Expected raw extraction to keep the source whitespace and run text together, got %q", raw)
+	}
+
+	tests := []struct {
+		input    string
+		arg1     string
+		expected string
+		desc     string
+	}{
+		{snippet, "", "Hello world Some boldand italic text. OneTwo First Second line break", "Spaces between blocks"},
+		{snippet, "lines", "Hello world\nSome boldand italic text.\nOneTwo\nFirst\nSecond\nline\nbreak", "Lines between blocks"},
+		{"<p>a</p>\n\n<p>b</p>", "lines", "a\nb", "Whitespace between blocks is one break"},
+		{"  <span> x </span>  ", "", "x", "Trimmed"},
+		{"<p>caf&eacute;&nbsp;&amp; more</p>", "", "café & more", "Entities decoded"},
+		{"", "", "", "Empty input"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.desc, func(t *testing.T) {
+			result := normalizeHTMLText(tt.input, tt.arg1, "")
+			if result != tt.expected {
+				t.Errorf("Expected: %q, Got: %q", tt.expected, result)
+			}
+		})
+	}
+}
+
+// TestExtractNumbersWithUnits tests extracting numbers with units, currencies and on their own
+func TestExtractNumbersWithUnits(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+		desc     string
+	}{
+		{"Weight 5kg, size 3.2 MB", "5 kg\n3.2 MB", "Attached and spaced units"},
+		{"It costs $12.50, or €3 in Europe", "12.50 $\n3 €", "Currency symbols"},
+		{"Pay 20 EUR or 25 usd", "20 EUR\n25 usd", "Currency codes"},
+		{"50% off, -4°C outside", "50 %\n-4 °C", "Symbols as units"},
+		{"Rooms 3 and 42", "3\n42", "Plain numbers"},
+		{"3 apples at 60 km/h", "3\n60 km/h", "Only known units after a space"},
+		{"no numbers here", "", "Nothing to extract"},
+		{"Price $1,234.56", "1,234.56 $", "Grouped thousands after a currency symbol"},
+		{"Pay €1,000 or £2,500.50 or ¥ 300", "1,000 €\n2,500.50 £\n300 ¥", "Grouped currency amounts"},
+		{"Sent 1,250 kg", "1,250 kg", "Grouped thousands with a unit"},
+		{"Model X200v2", "", "Digits inside a word"},
+		{"Call 555-1234", "555\n1234", "Hyphen between digits"},
+		{"Down to -5 °C", "-5 °C", "Minus sign after a space"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.desc, func(t *testing.T) {
+			result := extractNumbersWithUnits(tt.input, "", "")
+			if result != tt.expected {
+				t.Errorf("Expected: %q, Got: %q", tt.expected, result)
+			}
+		})
+	}
+}
+
+// TestFormatCurrency tests formatting amounts for US and European currencies
+func TestFormatCurrency(t *testing.T) {
+	tests := []struct {
+		input    string
+		arg1     string
+		expected string
+		desc     string
+	}{
+		{"Total: 1234.5", "USD", "Total: $1,234.50", "USD"},
+		{"Total: 1234.5", "", "Total: $1,234.50", "USD by default"},
+		{"-42 and 1234567.891", "usd", "-$42.00 and $1,234,567.89", "Negative and large USD"},
+		{"Total: 1234.5", "EUR", "Total: 1.234,50 €", "EUR"},
+		{"-1234567.891", "EUR", "-1.234.567,89 €", "Negative EUR"},
+		{"1234.5", "JPY", "¥1,235", "No decimals"},
+		{"1234.5", "CHF", "CHF 1'234.50", "Apostrophe grouping"},
+		{"-0.001", "USD", "$0.00", "Rounds to zero"},
+		{"1234.5", "XYZ", "1234.5", "Unknown currency"},
+		{"Total: 1,234.50", "USD", "Total: $1,234.50", "Already grouped"},
+		{"Total: 1,234.50", "EUR", "Total: 1.234,50 €", "Already grouped to EUR"},
+		{"Due 2024-01-15: 99", "USD", "Due 2024-01-15: $99.00", "Dates stay as they are"},
+		{"Model X200v2 costs 5", "USD", "Model X200v2 costs $5.00", "Digits inside a word"},
+		{"Refund of -3", "USD", "Refund of -$3.00", "Minus sign after a space"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.desc, func(t *testing.T) {
+			result := formatCurrency(tt.input, tt.arg1, "")
+			if result != tt.expected {
+				t.Errorf("Expected: %q, Got: %q", tt.expected, result)
+			}
+		})
+	}
+}
+
+// TestScientificNotation tests scientific and engineering notation for small and large numbers
+func TestScientificNotation(t *testing.T) {
+	tests := []struct {
+		input    string
+		arg1     string
+		arg2     string
+		expected string
+		desc     string
+	}{
+		{"12345678", "", "", "1.235e+07", "Large"},
+		{"12345678", "", "engineering", "12.35e+06", "Large engineering"},
+		{"0.000123456", "3", "", "1.23e-04", "Small"},
+		{"0.000123456", "3", "engineering", "123e-06", "Small engineering"},
+		{"-0.5", "", "", "-5.000e-01", "Negative fraction"},
+		{"-0.5", "", "engineering", "-500.0e-03", "Negative fraction engineering"},
+		{"9999", "1", "", "1e+04", "Rounding carries into the exponent"},
+		{"9999", "1", "engineering", "10e+03", "Engineering pads with zeros"},
+		{"1500", "2", "engineering", "1.5e+03", "Exponent already a multiple of 3"},
+		{"0", "", "engineering", "0.000e+00", "Zero"},
+		{"x = 42 m, y = 6.02e23", "3", "", "x = 4.20e+01 m, y = 6.02e+23", "Text and e notation"},
+		{"no numbers", "", "", "no numbers", "Nothing to convert"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.desc, func(t *testing.T) {
+			result := scientificNotation(tt.input, tt.arg1, tt.arg2)
+			if result != tt.expected {
+				t.Errorf("Expected: %q, Got: %q", tt.expected, result)
+			}
+		})
+	}
+}
+
+// TestAggregateNumbers tests each aggregate over the numbers in a text
+func TestAggregateNumbers(t *testing.T) {
+	text := "Scores: 7, -2.5 and 10; then 4 and 1.5"
+
+	tests := []struct {
+		input    string
+		arg1     string
+		expected string
+		desc     string
+	}{
+		{text, "sum", "20", "Sum"},
+		{text, "", "20", "Sum by default"},
+		{text, "avg", "4", "Average"},
+		{text, "min", "-2.5", "Minimum"},
+		{text, "max", "10", "Maximum"},
+		{text, "median", "4", "Median of an odd count"},
+		{"3 1 4 1 5 9", "median", "3.5", "Median of an even count"},
+		{text, "count", "5", "Count"},
+		{text, "MAX", "10", "Case-insensitive"},
+		{"no numbers", "count", "0", "Count without numbers"},
+		{"no numbers", "avg", "", "Average without numbers"},
+		{text, "mode", text, "Unknown aggregate"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.desc, func(t *testing.T) {
+			result := aggregateNumbers(tt.input, tt.arg1, "")
+			if result != tt.expected {
+				t.Errorf("Expected: %q, Got: %q", tt.expected, result)
+			}
+		})
+	}
+}
+
+func TestCompileRegexCache(t *testing.T) {
+	first, err := compileRegex(`(?m)(?i)err(or)?`)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	second, err := compileRegex(`(?m)(?i)err(or)?`)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if first != second {
+		t.Errorf("Expected cached pattern to be reused")
+	}
+
+	if _, err := compileRegex(`(unclosed`); err == nil {
+		t.Errorf("Expected error for invalid pattern")
+	}
+
+	input := "ok\nError: disk\nfine\nerr: net"
+	expected := keepMatchLines(input, "err", "i")
+	for i := 0; i < 3; i++ {
+		if result := keepMatchLines(input, "err", "i"); result != expected {
+			t.Errorf("Expected cached result %q, Got: %q", expected, result)
+		}
+	}
+	if expected != "Error: disk\nerr: net" {
+		t.Errorf("Unexpected result: %q", expected)
+	}
+}
+
+// BenchmarkKeepMatchLinesPerLine compiles the pattern once per line, as a line-based
+// Keep Lines Matching does, with and without the regex cache
+func BenchmarkKeepMatchLinesPerLine(b *testing.B) {
+	var lines []string
+	for i := 0; i < 1000; i++ {
+		lines = append(lines, fmt.Sprintf("line %d value=%d", i, i*7))
+	}
+	pattern := `value=\d*7$`
+
+	compilers := []struct {
+		name    string
+		compile func(string) (*regexp.Regexp, error)
+	}{
+		{"Uncached", regexp.Compile},
+		{"Cached", compileRegex},
+	}
+
+	for _, compiler := range compilers {
+		b.Run(compiler.name, func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				for _, line := range lines {
+					re, err := compiler.compile(pattern)
+					if err != nil {
+						b.Fatal(err)
+					}
+					re.MatchString(line)
+				}
+			}
+		})
+	}
+}
+
+func BenchmarkForEach(b *testing.B) {
+	input := forEachBenchInput(10000)
+	children := []PipelineNode{
+		{Type: "operation", Operation: "Regex Replace", Arg1: `value=(\d+)`, Arg2: "v=$1"},
+		{Type: "operation", Operation: "Uppercase"},
+	}
+
+	b.Run("Serial", func(b *testing.B) {
+		node := &PipelineNode{Type: "foreach", Children: children}
+		for i := 0; i < b.N; i++ {
+			ExecuteNode(node, input)
+		}
+	})
+
+	b.Run("Parallel", func(b *testing.B) {
+		node := &PipelineNode{Type: "foreach", Arg2: "parallel", Children: children}
+		for i := 0; i < b.N; i++ {
+			ExecuteNode(node, input)
+		}
+	})
+}
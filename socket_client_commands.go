@@ -58,11 +58,12 @@ func (s *SocketClientCommands) CreateNode(nodeType, name, operation, arg1, arg2,
 }
 
 // UpdateNode implements TextCleanerCommands.UpdateNode
-func (s *SocketClientCommands) UpdateNode(nodeID, name, operation, arg1, arg2, condition string) error {
+func (s *SocketClientCommands) UpdateNode(nodeID, nodeType, name, operation, arg1, arg2, condition string) error {
 	cmdJSON, _ := json.Marshal(map[string]interface{}{
 		"action": "update_node",
 		"params": map[string]interface{}{
 			"node_id":   nodeID,
+			"type":      nodeType,
 			"name":      name,
 			"operation": operation,
 			"arg1":      arg1,
@@ -1,7 +1,10 @@
 package main
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
+	"math"
 )
 
 // Command represents a JSON command for AI agents
@@ -15,13 +18,139 @@ type Response struct {
 	Success bool        `json:"success"`
 	Result  interface{} `json:"result,omitempty"`
 	Error   string      `json:"error,omitempty"`
+	Code    string      `json:"code,omitempty"` // Machine-readable error code, set when Success is false
+}
+
+// Machine-readable error codes returned in Response.Code
+const (
+	ErrCodeInvalidJSON      = "INVALID_JSON"      // The command or a JSON parameter couldn't be parsed
+	ErrCodeUnknownAction    = "UNKNOWN_ACTION"    // The action isn't supported
+	ErrCodeMissingParam     = "MISSING_PARAM"     // A required parameter is missing
+	ErrCodeInvalidParam     = "INVALID_PARAM"     // A parameter has an invalid value
+	ErrCodeNodeNotFound     = "NODE_NOT_FOUND"    // A node ID or name doesn't exist
+	ErrCodeInvalidOperation = "INVALID_OPERATION" // The change isn't allowed in the current pipeline (e.g., nothing to indent under)
+	ErrCodeInternal         = "INTERNAL_ERROR"    // An unexpected failure inside the core
+	ErrCodeTimeout          = "TIMEOUT"           // Running the pipeline took longer than the execution timeout
+	ErrCodeCanceled         = "CANCELED"          // The pipeline run was canceled before it finished
+	ErrCodeOutputTooLarge   = "OUTPUT_TOO_LARGE"  // A node's output was larger than the output size limit
+	ErrCodeInvalidRegex     = "INVALID_REGEX"     // An operation's regex argument doesn't compile
+
+	// Transport-level codes used by the socket server and HTTP gateway
+	ErrCodeMessageTooLarge  = "MESSAGE_TOO_LARGE"
+	ErrCodeAuthRequired     = "AUTH_REQUIRED"
+	ErrCodeInvalidToken     = "INVALID_TOKEN"
+	ErrCodeMethodNotAllowed = "METHOD_NOT_ALLOWED"
+)
+
+// mutatingActions lists the actions that change the pipeline, input text or selection
+// Keep this in sync with ExecuteCommand when adding actions
+var mutatingActions = map[string]bool{
+	"create_node":           true,
+	"update_node":           true,
+	"delete_node":           true,
+	"add_child_node":        true,
+	"select_node":           true,
+	"set_input_text":        true,
+	"import_pipeline":       true,
+	"indent_node":           true,
+	"unindent_node":         true,
+	"move_node_up":          true,
+	"move_node_down":        true,
+	"move_node_to_position": true,
+	"save_preset":           true,
+	"delete_preset":         true,
+	"duplicate_node":        true,
+	"enable_node":           true,
+	"disable_node":          true,
+	"clear_pipeline":        true,
+	"set_seed":              true,
+	"set_line_based":        true,
+	"replace_node":          true,
+}
+
+// ProtocolVersion is reported by get_capabilities; it changes when actions or their parameters change
+const ProtocolVersion = "1.0"
+
+// commandActions lists the actions ExecuteCommand handles, in the order of its switch
+// Keep this in sync with ExecuteCommand when adding actions
+var commandActions = []string{
+	"create_node",
+	"update_node",
+	"delete_node",
+	"add_child_node",
+	"select_node",
+	"set_input_text",
+	"get_input_text",
+	"get_output_text",
+	"get_output_text_at_node",
+	"get_output_diff_at_node",
+	"get_pipeline",
+	"export_pipeline",
+	"import_pipeline",
+	"get_node",
+	"get_selected_node_id",
+	"list_nodes",
+	"indent_node",
+	"unindent_node",
+	"move_node_up",
+	"move_node_down",
+	"move_node_to_position",
+	"can_indent_node",
+	"can_unindent_node",
+	"can_move_node_up",
+	"can_move_node_down",
+	"list_node_types",
+	"ping",
+	"save_preset",
+	"delete_preset",
+	"list_presets",
+	"search_operations",
+	"duplicate_node",
+	"enable_node",
+	"disable_node",
+	"clear_pipeline",
+	"set_seed",
+	"set_line_based",
+	"pipeline_stats",
+	"find_nodes",
+	"get_node_path",
+	"get_capabilities",
+	"replace_node",
+	"process_batch",
+	"get_output_preview",
+}
+
+// Capabilities describes what a server supports, so clients can avoid sending unsupported commands
+type Capabilities struct {
+	Version  string          `json:"version"`
+	Actions  []string        `json:"actions"`
+	Features map[string]bool `json:"features"` // Optional features: batch, subscribe and auth
+}
+
+// Capabilities returns the version, actions and features of the core; the socket server and
+// HTTP gateway add the actions and features of their transport
+func (tc *TextCleanerCore) Capabilities() Capabilities {
+	return Capabilities{
+		Version: ProtocolVersion,
+		Actions: append([]string{}, commandActions...),
+		Features: map[string]bool{
+			"batch":     true, // process_batch
+			"subscribe": false,
+			"auth":      false,
+		},
+	}
+}
+
+// IsMutatingAction reports whether a command action changes the core state
+func IsMutatingAction(action string) bool {
+	return mutatingActions[action]
 }
 
 // ExecuteCommand executes a JSON command and returns a JSON response
 func (tc *TextCleanerCore) ExecuteCommand(cmdJSON string) string {
 	var cmd Command
 	if err := json.Unmarshal([]byte(cmdJSON), &cmd); err != nil {
-		return tc.errorResponse("Invalid JSON: " + err.Error())
+		return tc.errorResponse(ErrCodeInvalidJSON, "Invalid JSON: "+err.Error())
 	}
 
 	switch cmd.Action {
@@ -43,6 +172,8 @@ func (tc *TextCleanerCore) ExecuteCommand(cmdJSON string) string {
 		return tc.cmdGetOutputText(cmd.Params)
 	case "get_output_text_at_node":
 		return tc.cmdGetOutputTextAtNode(cmd.Params)
+	case "get_output_diff_at_node":
+		return tc.cmdGetOutputDiffAtNode(cmd.Params)
 	case "get_pipeline":
 		return tc.cmdGetPipeline(cmd.Params)
 	case "export_pipeline":
@@ -75,8 +206,44 @@ func (tc *TextCleanerCore) ExecuteCommand(cmdJSON string) string {
 		return tc.cmdCanMoveNodeDown(cmd.Params)
 	case "list_node_types":
 		return tc.cmdListNodeTypes(cmd.Params)
+	case "ping":
+		return tc.cmdPing(cmd.Params)
+	case "save_preset":
+		return tc.cmdSavePreset(cmd.Params)
+	case "delete_preset":
+		return tc.cmdDeletePreset(cmd.Params)
+	case "list_presets":
+		return tc.cmdListPresets(cmd.Params)
+	case "search_operations":
+		return tc.cmdSearchOperations(cmd.Params)
+	case "duplicate_node":
+		return tc.cmdDuplicateNode(cmd.Params)
+	case "enable_node":
+		return tc.cmdSetNodeEnabled(cmd.Params, true)
+	case "disable_node":
+		return tc.cmdSetNodeEnabled(cmd.Params, false)
+	case "clear_pipeline":
+		return tc.cmdClearPipeline(cmd.Params)
+	case "set_seed":
+		return tc.cmdSetSeed(cmd.Params)
+	case "set_line_based":
+		return tc.cmdSetLineBased(cmd.Params)
+	case "pipeline_stats":
+		return tc.cmdPipelineStats(cmd.Params)
+	case "find_nodes":
+		return tc.cmdFindNodes(cmd.Params)
+	case "get_node_path":
+		return tc.cmdGetNodePath(cmd.Params)
+	case "get_capabilities":
+		return tc.cmdGetCapabilities(cmd.Params)
+	case "replace_node":
+		return tc.cmdReplaceNode(cmd.Params)
+	case "process_batch":
+		return tc.cmdProcessBatch(cmd.Params)
+	case "get_output_preview":
+		return tc.cmdGetOutputPreview(cmd.Params)
 	default:
-		return tc.errorResponse("Unknown action: " + cmd.Action)
+		return tc.errorResponse(ErrCodeUnknownAction, "Unknown action: "+cmd.Action)
 	}
 }
 
@@ -95,7 +262,10 @@ func (tc *TextCleanerCore) cmdCreateNode(params map[string]interface{}) string {
 	parentIdentifier := getStr(params, "parent_id", "")
 
 	if nodeType == "" {
-		return tc.errorResponse("Missing required parameter: type")
+		return tc.errorResponse(ErrCodeMissingParam, "Missing required parameter: type")
+	}
+	if err := checkRegexArgs(operation, arg1, arg2); err != nil {
+		return tc.errorResponseFromErr(err)
 	}
 
 	var nodeID string
@@ -111,12 +281,12 @@ func (tc *TextCleanerCore) cmdCreateNode(params map[string]interface{}) string {
 		tc.mu.RUnlock()
 
 		if err != nil {
-			return tc.errorResponse(err.Error())
+			return tc.errorResponseFromErr(err)
 		}
 
 		nodeID, err = tc.AddChildNode(parentID, nodeType, name, operation, arg1, arg2, condition)
 		if err != nil {
-			return tc.errorResponse(err.Error())
+			return tc.errorResponseFromErr(err)
 		}
 	} else {
 		// Create as root-level node
@@ -131,6 +301,7 @@ func (tc *TextCleanerCore) cmdCreateNode(params map[string]interface{}) string {
 // cmdUpdateNode updates an existing node
 func (tc *TextCleanerCore) cmdUpdateNode(params map[string]interface{}) string {
 	nodeID := getStr(params, "node_id", "")
+	nodeType := getStr(params, "type", "")
 	name := getStr(params, "name", "")
 	operation := getStr(params, "operation", "")
 	arg1 := getStr(params, "arg1", "")
@@ -138,11 +309,14 @@ func (tc *TextCleanerCore) cmdUpdateNode(params map[string]interface{}) string {
 	condition := getStr(params, "condition", "")
 
 	if nodeID == "" {
-		return tc.errorResponse("Missing required parameter: node_id")
+		return tc.errorResponse(ErrCodeMissingParam, "Missing required parameter: node_id")
+	}
+	if err := checkRegexArgs(operation, arg1, arg2); err != nil {
+		return tc.errorResponseFromErr(err)
 	}
 
-	if err := tc.UpdateNode(nodeID, name, operation, arg1, arg2, condition); err != nil {
-		return tc.errorResponse(err.Error())
+	if err := tc.UpdateNode(nodeID, nodeType, name, operation, arg1, arg2, condition); err != nil {
+		return tc.errorResponseFromErr(err)
 	}
 
 	return tc.successResponse(map[string]interface{}{
@@ -150,15 +324,105 @@ func (tc *TextCleanerCore) cmdUpdateNode(params map[string]interface{}) string {
 	})
 }
 
+// cmdReplaceNode replaces a node with a full node definition, keeping its ID and position
+func (tc *TextCleanerCore) cmdReplaceNode(params map[string]interface{}) string {
+	nodeID := getStr(params, "node_id", "")
+	if nodeID == "" {
+		return tc.errorResponse(ErrCodeMissingParam, "Missing required parameter: node_id")
+	}
+	nodeData, ok := params["node"]
+	if !ok {
+		return tc.errorResponse(ErrCodeMissingParam, "Missing required parameter: node")
+	}
+
+	// Convert the parameter back to JSON to decode it as a node
+	nodeJSON, err := json.Marshal(nodeData)
+	if err != nil {
+		return tc.errorResponse(ErrCodeInvalidParam, "Invalid node parameter: "+err.Error())
+	}
+	var node PipelineNode
+	if err := json.Unmarshal(nodeJSON, &node); err != nil {
+		return tc.errorResponse(ErrCodeInvalidParam, "Invalid node parameter: "+err.Error())
+	}
+	if err := checkNodeRegexArgs(&node); err != nil {
+		return tc.errorResponseFromErr(err)
+	}
+
+	if err := tc.ReplaceNode(nodeID, node); err != nil {
+		return tc.errorResponseFromErr(err)
+	}
+
+	return tc.successResponse(map[string]interface{}{
+		"node": tc.GetNode(nodeID),
+	})
+}
+
 // cmdDeleteNode deletes a node by ID
 func (tc *TextCleanerCore) cmdDeleteNode(params map[string]interface{}) string {
 	nodeID := getStr(params, "node_id", "")
 	if nodeID == "" {
-		return tc.errorResponse("Missing required parameter: node_id")
+		return tc.errorResponse(ErrCodeMissingParam, "Missing required parameter: node_id")
 	}
 
 	if err := tc.DeleteNode(nodeID); err != nil {
-		return tc.errorResponse(err.Error())
+		return tc.errorResponseFromErr(err)
+	}
+
+	return tc.successResponse(map[string]interface{}{
+		"success": true,
+	})
+}
+
+// cmdDuplicateNode copies a node and its children next to the original
+func (tc *TextCleanerCore) cmdDuplicateNode(params map[string]interface{}) string {
+	nodeID := getStr(params, "node_id", "")
+	if nodeID == "" {
+		return tc.errorResponse(ErrCodeMissingParam, "Missing required parameter: node_id")
+	}
+
+	newID, err := tc.DuplicateNode(nodeID)
+	if err != nil {
+		return tc.errorResponseFromErr(err)
+	}
+
+	return tc.successResponse(map[string]interface{}{
+		"node_id": newID,
+	})
+}
+
+// cmdSetNodeEnabled enables or disables a node
+func (tc *TextCleanerCore) cmdSetNodeEnabled(params map[string]interface{}, enabled bool) string {
+	nodeID := getStr(params, "node_id", "")
+	if nodeID == "" {
+		return tc.errorResponse(ErrCodeMissingParam, "Missing required parameter: node_id")
+	}
+
+	if err := tc.SetNodeEnabled(nodeID, enabled); err != nil {
+		return tc.errorResponseFromErr(err)
+	}
+
+	return tc.successResponse(map[string]interface{}{
+		"success": true,
+	})
+}
+
+// cmdSetLineBased switches an operation node between whole-text and per-line application
+func (tc *TextCleanerCore) cmdSetLineBased(params map[string]interface{}) string {
+	nodeID := getStr(params, "node_id", "")
+	if nodeID == "" {
+		return tc.errorResponse(ErrCodeMissingParam, "Missing required parameter: node_id")
+	}
+	value, ok := params["line_based"]
+	if !ok {
+		return tc.errorResponse(ErrCodeMissingParam, "Missing required parameter: line_based")
+	}
+	lineBased, ok := value.(bool)
+	if !ok {
+		return tc.errorResponse(ErrCodeInvalidParam, "line_based must be true or false")
+	}
+
+	if err := tc.SetNodeLineBased(nodeID, lineBased); err != nil {
+		return tc.errorResponseFromErr(err)
 	}
 
 	return tc.successResponse(map[string]interface{}{
@@ -166,6 +430,15 @@ func (tc *TextCleanerCore) cmdDeleteNode(params map[string]interface{}) string {
 	})
 }
 
+// cmdClearPipeline removes all nodes from the pipeline
+func (tc *TextCleanerCore) cmdClearPipeline(params map[string]interface{}) string {
+	tc.ClearPipeline()
+
+	return tc.successResponse(map[string]interface{}{
+		"success": true,
+	})
+}
+
 // cmdAddChildNode adds a child node to a parent
 func (tc *TextCleanerCore) cmdAddChildNode(params map[string]interface{}) string {
 	parentID := getStr(params, "parent_id", "")
@@ -177,15 +450,18 @@ func (tc *TextCleanerCore) cmdAddChildNode(params map[string]interface{}) string
 	condition := getStr(params, "condition", "")
 
 	if parentID == "" {
-		return tc.errorResponse("Missing required parameter: parent_id")
+		return tc.errorResponse(ErrCodeMissingParam, "Missing required parameter: parent_id")
 	}
 	if nodeType == "" {
-		return tc.errorResponse("Missing required parameter: type")
+		return tc.errorResponse(ErrCodeMissingParam, "Missing required parameter: type")
+	}
+	if err := checkRegexArgs(operation, arg1, arg2); err != nil {
+		return tc.errorResponseFromErr(err)
 	}
 
 	childID, err := tc.AddChildNode(parentID, nodeType, name, operation, arg1, arg2, condition)
 	if err != nil {
-		return tc.errorResponse(err.Error())
+		return tc.errorResponseFromErr(err)
 	}
 
 	return tc.successResponse(map[string]interface{}{
@@ -197,11 +473,11 @@ func (tc *TextCleanerCore) cmdAddChildNode(params map[string]interface{}) string
 func (tc *TextCleanerCore) cmdSelectNode(params map[string]interface{}) string {
 	nodeID := getStr(params, "node_id", "")
 	if nodeID == "" {
-		return tc.errorResponse("Missing required parameter: node_id")
+		return tc.errorResponse(ErrCodeMissingParam, "Missing required parameter: node_id")
 	}
 
 	if err := tc.SelectNode(nodeID); err != nil {
-		return tc.errorResponse(err.Error())
+		return tc.errorResponseFromErr(err)
 	}
 
 	return tc.successResponse(map[string]interface{}{
@@ -227,16 +503,89 @@ func (tc *TextCleanerCore) cmdGetInputText(params map[string]interface{}) string
 
 // cmdGetOutputText returns the current output text
 func (tc *TextCleanerCore) cmdGetOutputText(params map[string]interface{}) string {
+	output, err := tc.GetOutputTextWithError()
+	if err != nil {
+		return tc.errorResponseFromErr(err)
+	}
 	return tc.successResponse(map[string]interface{}{
-		"output": tc.GetOutputText(),
+		"output": output,
+	})
+}
+
+// cmdGetOutputPreview returns at most max_bytes of the output, for displaying large outputs
+func (tc *TextCleanerCore) cmdGetOutputPreview(params map[string]interface{}) string {
+	if _, ok := params["max_bytes"]; !ok {
+		return tc.errorResponse(ErrCodeMissingParam, "Missing required parameter: max_bytes")
+	}
+	maxBytes := getInt(params, "max_bytes", -1)
+	if maxBytes < 0 {
+		return tc.errorResponse(ErrCodeInvalidParam, "max_bytes must be a non-negative number")
+	}
+
+	preview, truncated, totalBytes, err := tc.GetOutputPreview(maxBytes)
+	if err != nil {
+		return tc.errorResponseFromErr(err)
+	}
+	return tc.successResponse(map[string]interface{}{
+		"output":       preview,
+		"truncated":    truncated,
+		"total_length": totalBytes,
+	})
+}
+
+// cmdProcessBatch runs several named inputs through the pipeline, leaving the stored input alone
+func (tc *TextCleanerCore) cmdProcessBatch(params map[string]interface{}) string {
+	inputsData, ok := params["inputs"]
+	if !ok {
+		return tc.errorResponse(ErrCodeMissingParam, "Missing required parameter: inputs")
+	}
+
+	// Convert the parameter back to JSON to decode it as a list of inputs
+	inputsJSON, err := json.Marshal(inputsData)
+	if err != nil {
+		return tc.errorResponse(ErrCodeInvalidParam, "Invalid inputs parameter: "+err.Error())
+	}
+	var inputs []BatchInput
+	if err := json.Unmarshal(inputsJSON, &inputs); err != nil {
+		return tc.errorResponse(ErrCodeInvalidParam, "Invalid inputs parameter: "+err.Error())
+	}
+
+	results, err := tc.ProcessBatch(inputs)
+	if err != nil {
+		return tc.errorResponseFromErr(err)
+	}
+	return tc.successResponse(map[string]interface{}{
+		"results": results,
 	})
 }
 
 // cmdGetOutputTextAtNode returns the text after processing through nodes up to the specified node
 func (tc *TextCleanerCore) cmdGetOutputTextAtNode(params map[string]interface{}) string {
 	nodeID := getStr(params, "node_id", "")
+	output, err := tc.GetOutputTextAtNodeWithError(nodeID)
+	if err != nil {
+		return tc.errorResponseFromErr(err)
+	}
+	return tc.successResponse(map[string]interface{}{
+		"output": output,
+	})
+}
+
+// cmdGetOutputDiffAtNode returns the text a node receives, its output and the line diff between them
+func (tc *TextCleanerCore) cmdGetOutputDiffAtNode(params map[string]interface{}) string {
+	nodeID := getStr(params, "node_id", "")
+	if nodeID == "" {
+		return tc.errorResponse(ErrCodeMissingParam, "Missing required parameter: node_id")
+	}
+
+	input, output, diff, err := tc.GetOutputDiffAtNode(nodeID)
+	if err != nil {
+		return tc.errorResponseFromErr(err)
+	}
 	return tc.successResponse(map[string]interface{}{
-		"output": tc.GetOutputTextAtNode(nodeID),
+		"input":  input,
+		"output": output,
+		"diff":   diff,
 	})
 }
 
@@ -260,13 +609,13 @@ func (tc *TextCleanerCore) cmdGetPipeline(params map[string]interface{}) string
 func (tc *TextCleanerCore) cmdExportPipeline(params map[string]interface{}) string {
 	jsonStr, err := tc.ExportPipeline()
 	if err != nil {
-		return tc.errorResponse(err.Error())
+		return tc.errorResponse(ErrCodeInternal, err.Error())
 	}
 
 	// Parse the JSON string back to return as an object
 	var pipeline interface{}
 	if err := json.Unmarshal([]byte(jsonStr), &pipeline); err != nil {
-		return tc.errorResponse(err.Error())
+		return tc.errorResponse(ErrCodeInternal, err.Error())
 	}
 
 	return tc.successResponse(map[string]interface{}{
@@ -278,17 +627,17 @@ func (tc *TextCleanerCore) cmdExportPipeline(params map[string]interface{}) stri
 func (tc *TextCleanerCore) cmdImportPipeline(params map[string]interface{}) string {
 	jsonData, ok := params["json"]
 	if !ok {
-		return tc.errorResponse("Missing required parameter: json")
+		return tc.errorResponse(ErrCodeMissingParam, "Missing required parameter: json")
 	}
 
 	// Convert the parameter to JSON string
 	jsonBytes, err := json.Marshal(jsonData)
 	if err != nil {
-		return tc.errorResponse("Invalid json parameter: " + err.Error())
+		return tc.errorResponse(ErrCodeInvalidParam, "Invalid json parameter: "+err.Error())
 	}
 
 	if err := tc.ImportPipeline(string(jsonBytes)); err != nil {
-		return tc.errorResponse(err.Error())
+		return tc.errorResponseFromErr(err)
 	}
 
 	return tc.successResponse(map[string]interface{}{
@@ -300,12 +649,12 @@ func (tc *TextCleanerCore) cmdImportPipeline(params map[string]interface{}) stri
 func (tc *TextCleanerCore) cmdGetNode(params map[string]interface{}) string {
 	nodeID := getStr(params, "node_id", "")
 	if nodeID == "" {
-		return tc.errorResponse("Missing required parameter: node_id")
+		return tc.errorResponse(ErrCodeMissingParam, "Missing required parameter: node_id")
 	}
 
 	node := tc.GetNode(nodeID)
 	if node == nil {
-		return tc.errorResponse("node not found: " + nodeID)
+		return tc.errorResponse(ErrCodeNodeNotFound, "node not found: "+nodeID)
 	}
 
 	return tc.successResponse(map[string]interface{}{
@@ -321,15 +670,49 @@ func (tc *TextCleanerCore) cmdListNodes(params map[string]interface{}) string {
 	})
 }
 
+// cmdPipelineStats returns node counts, the pipeline depth and any nodes with invalid regular expressions
+func (tc *TextCleanerCore) cmdPipelineStats(params map[string]interface{}) string {
+	return tc.successResponse(tc.GetPipelineStats())
+}
+
+// cmdFindNodes returns the nodes with an operation and/or a name containing some text
+func (tc *TextCleanerCore) cmdFindNodes(params map[string]interface{}) string {
+	operation := getStr(params, "operation", "")
+	nameContains := getStr(params, "name_contains", "")
+	if operation == "" && nameContains == "" {
+		return tc.errorResponse(ErrCodeMissingParam, "Missing required parameter: operation or name_contains")
+	}
+
+	return tc.successResponse(map[string]interface{}{
+		"nodes": tc.FindNodes(operation, nameContains),
+	})
+}
+
+// cmdGetNodePath returns the IDs and names of a node's ancestors, from the root down to the node
+func (tc *TextCleanerCore) cmdGetNodePath(params map[string]interface{}) string {
+	nodeID := getStr(params, "node_id", "")
+	if nodeID == "" {
+		return tc.errorResponse(ErrCodeMissingParam, "Missing required parameter: node_id")
+	}
+
+	path, err := tc.GetNodePath(nodeID)
+	if err != nil {
+		return tc.errorResponseFromErr(err)
+	}
+	return tc.successResponse(map[string]interface{}{
+		"path": path,
+	})
+}
+
 // cmdIndentNode indents a node (makes it a child of previous sibling)
 func (tc *TextCleanerCore) cmdIndentNode(params map[string]interface{}) string {
 	nodeID := getStr(params, "node_id", "")
 	if nodeID == "" {
-		return tc.errorResponse("Missing required parameter: node_id")
+		return tc.errorResponse(ErrCodeMissingParam, "Missing required parameter: node_id")
 	}
 
 	if err := tc.IndentNode(nodeID); err != nil {
-		return tc.errorResponse(err.Error())
+		return tc.errorResponseFromErr(err)
 	}
 
 	return tc.successResponse(map[string]interface{}{
@@ -341,11 +724,11 @@ func (tc *TextCleanerCore) cmdIndentNode(params map[string]interface{}) string {
 func (tc *TextCleanerCore) cmdUnindentNode(params map[string]interface{}) string {
 	nodeID := getStr(params, "node_id", "")
 	if nodeID == "" {
-		return tc.errorResponse("Missing required parameter: node_id")
+		return tc.errorResponse(ErrCodeMissingParam, "Missing required parameter: node_id")
 	}
 
 	if err := tc.UnindentNode(nodeID); err != nil {
-		return tc.errorResponse(err.Error())
+		return tc.errorResponseFromErr(err)
 	}
 
 	return tc.successResponse(map[string]interface{}{
@@ -357,11 +740,11 @@ func (tc *TextCleanerCore) cmdUnindentNode(params map[string]interface{}) string
 func (tc *TextCleanerCore) cmdMoveNodeUp(params map[string]interface{}) string {
 	nodeID := getStr(params, "node_id", "")
 	if nodeID == "" {
-		return tc.errorResponse("Missing required parameter: node_id")
+		return tc.errorResponse(ErrCodeMissingParam, "Missing required parameter: node_id")
 	}
 
 	if err := tc.MoveNodeUp(nodeID); err != nil {
-		return tc.errorResponse(err.Error())
+		return tc.errorResponseFromErr(err)
 	}
 
 	return tc.successResponse(map[string]interface{}{
@@ -373,11 +756,11 @@ func (tc *TextCleanerCore) cmdMoveNodeUp(params map[string]interface{}) string {
 func (tc *TextCleanerCore) cmdMoveNodeDown(params map[string]interface{}) string {
 	nodeID := getStr(params, "node_id", "")
 	if nodeID == "" {
-		return tc.errorResponse("Missing required parameter: node_id")
+		return tc.errorResponse(ErrCodeMissingParam, "Missing required parameter: node_id")
 	}
 
 	if err := tc.MoveNodeDown(nodeID); err != nil {
-		return tc.errorResponse(err.Error())
+		return tc.errorResponseFromErr(err)
 	}
 
 	return tc.successResponse(map[string]interface{}{
@@ -389,14 +772,14 @@ func (tc *TextCleanerCore) cmdMoveNodeDown(params map[string]interface{}) string
 func (tc *TextCleanerCore) cmdMoveNodeToPosition(params map[string]interface{}) string {
 	nodeID := getStr(params, "node_id", "")
 	if nodeID == "" {
-		return tc.errorResponse("Missing required parameter: node_id")
+		return tc.errorResponse(ErrCodeMissingParam, "Missing required parameter: node_id")
 	}
 
 	newParentID := getStr(params, "new_parent_id", "")
 	position := getInt(params, "position", 0)
 
 	if err := tc.MoveNodeToPosition(nodeID, newParentID, position); err != nil {
-		return tc.errorResponse(err.Error())
+		return tc.errorResponseFromErr(err)
 	}
 
 	return tc.successResponse(map[string]interface{}{
@@ -408,7 +791,7 @@ func (tc *TextCleanerCore) cmdMoveNodeToPosition(params map[string]interface{})
 func (tc *TextCleanerCore) cmdCanIndentNode(params map[string]interface{}) string {
 	nodeID := getStr(params, "node_id", "")
 	if nodeID == "" {
-		return tc.errorResponse("Missing required parameter: node_id")
+		return tc.errorResponse(ErrCodeMissingParam, "Missing required parameter: node_id")
 	}
 
 	canIndent := tc.CanIndentNode(nodeID)
@@ -421,7 +804,7 @@ func (tc *TextCleanerCore) cmdCanIndentNode(params map[string]interface{}) strin
 func (tc *TextCleanerCore) cmdCanUnindentNode(params map[string]interface{}) string {
 	nodeID := getStr(params, "node_id", "")
 	if nodeID == "" {
-		return tc.errorResponse("Missing required parameter: node_id")
+		return tc.errorResponse(ErrCodeMissingParam, "Missing required parameter: node_id")
 	}
 
 	canUnindent := tc.CanUnindentNode(nodeID)
@@ -434,7 +817,7 @@ func (tc *TextCleanerCore) cmdCanUnindentNode(params map[string]interface{}) str
 func (tc *TextCleanerCore) cmdCanMoveNodeUp(params map[string]interface{}) string {
 	nodeID := getStr(params, "node_id", "")
 	if nodeID == "" {
-		return tc.errorResponse("Missing required parameter: node_id")
+		return tc.errorResponse(ErrCodeMissingParam, "Missing required parameter: node_id")
 	}
 
 	canMove := tc.CanMoveNodeUp(nodeID)
@@ -447,7 +830,7 @@ func (tc *TextCleanerCore) cmdCanMoveNodeUp(params map[string]interface{}) strin
 func (tc *TextCleanerCore) cmdCanMoveNodeDown(params map[string]interface{}) string {
 	nodeID := getStr(params, "node_id", "")
 	if nodeID == "" {
-		return tc.errorResponse("Missing required parameter: node_id")
+		return tc.errorResponse(ErrCodeMissingParam, "Missing required parameter: node_id")
 	}
 
 	canMove := tc.CanMoveNodeDown(nodeID)
@@ -456,10 +839,11 @@ func (tc *TextCleanerCore) cmdCanMoveNodeDown(params map[string]interface{}) str
 	})
 }
 
+// nodeTypes lists the node types the pipeline can execute, as reported by list_node_types
+var nodeTypes = []string{"operation", "if", "foreach", "group", "capture", "subroutine"}
+
 // cmdListNodeTypes returns available node types and operations
 func (tc *TextCleanerCore) cmdListNodeTypes(params map[string]interface{}) string {
-	nodeTypes := []string{"operation", "if", "foreach", "group"}
-
 	operations := GetOperations()
 	operationNames := make([]string, len(operations))
 	for i, op := range operations {
@@ -472,6 +856,99 @@ func (tc *TextCleanerCore) cmdListNodeTypes(params map[string]interface{}) strin
 	})
 }
 
+// cmdSearchOperations returns the operations that best match a query, best match first
+func (tc *TextCleanerCore) cmdSearchOperations(params map[string]interface{}) string {
+	query := getStr(params, "query", "")
+	if query == "" {
+		return tc.errorResponse(ErrCodeMissingParam, "Missing required parameter: query")
+	}
+
+	matches := SearchOperations(query, getInt(params, "limit", 10))
+	operations := make([]map[string]interface{}, len(matches))
+	for i, op := range matches {
+		operations[i] = map[string]interface{}{
+			"name":        op.Name,
+			"description": op.Description,
+		}
+	}
+
+	return tc.successResponse(map[string]interface{}{
+		"operations": operations,
+	})
+}
+
+// cmdPing lets long-lived clients check that the connection is alive
+func (tc *TextCleanerCore) cmdPing(params map[string]interface{}) string {
+	return tc.successResponse(map[string]interface{}{
+		"pong":           true,
+		"uptime_seconds": tc.Uptime().Seconds(),
+	})
+}
+
+// cmdGetCapabilities returns the protocol version, the supported actions and feature flags
+func (tc *TextCleanerCore) cmdGetCapabilities(params map[string]interface{}) string {
+	return tc.successResponse(tc.Capabilities())
+}
+
+// cmdSavePreset saves the current pipeline as a named preset
+func (tc *TextCleanerCore) cmdSavePreset(params map[string]interface{}) string {
+	name := getStr(params, "name", "")
+	if name == "" {
+		return tc.errorResponse(ErrCodeMissingParam, "Missing required parameter: name")
+	}
+
+	if err := tc.SavePreset(name); err != nil {
+		return tc.errorResponseFromErr(err)
+	}
+
+	return tc.successResponse(map[string]interface{}{
+		"success": true,
+	})
+}
+
+// cmdDeletePreset deletes a named preset
+func (tc *TextCleanerCore) cmdDeletePreset(params map[string]interface{}) string {
+	name := getStr(params, "name", "")
+	if name == "" {
+		return tc.errorResponse(ErrCodeMissingParam, "Missing required parameter: name")
+	}
+
+	if err := tc.DeletePreset(name); err != nil {
+		return tc.errorResponseFromErr(err)
+	}
+
+	return tc.successResponse(map[string]interface{}{
+		"success": true,
+	})
+}
+
+// cmdSetSeed makes random operations reproducible with an integer seed, or
+// nondeterministic again when the seed is missing or null
+func (tc *TextCleanerCore) cmdSetSeed(params map[string]interface{}) string {
+	switch seed := params["seed"].(type) {
+	case nil:
+		tc.ClearSeed()
+	case float64:
+		if seed != math.Trunc(seed) {
+			return tc.errorResponse(ErrCodeInvalidParam, "Seed must be an integer")
+		}
+		tc.SetSeed(int64(seed))
+	default:
+		return tc.errorResponse(ErrCodeInvalidParam, "Seed must be an integer or null")
+	}
+
+	return tc.successResponse(map[string]interface{}{
+		"seeded": params["seed"] != nil,
+	})
+}
+
+// cmdListPresets returns the names of the saved presets
+func (tc *TextCleanerCore) cmdListPresets(params map[string]interface{}) string {
+	return tc.successResponse(map[string]interface{}{
+		"presets": tc.ListPresets(),
+	})
+}
+
 // ============================================================================
 // Helper Functions
 // ============================================================================
@@ -515,12 +992,45 @@ func (tc *TextCleanerCore) successResponse(result interface{}) string {
 	return string(data)
 }
 
-// errorResponse creates an error response
-func (tc *TextCleanerCore) errorResponse(errorMsg string) string {
+// errorResponse creates an error response with a machine-readable code
+func (tc *TextCleanerCore) errorResponse(code, errorMsg string) string {
 	resp := Response{
 		Success: false,
 		Error:   errorMsg,
+		Code:    code,
 	}
 	data, _ := json.Marshal(resp)
 	return string(data)
 }
+
+// errorResponseFromErr creates an error response, deriving the code from the error
+func (tc *TextCleanerCore) errorResponseFromErr(err error) string {
+	return tc.errorResponse(errorCode(err), err.Error())
+}
+
+// errorCode maps an error returned by the core to a machine-readable code
+func errorCode(err error) string {
+	var syntaxErr *json.SyntaxError
+	var typeErr *json.UnmarshalTypeError
+
+	switch {
+	case errors.Is(err, ErrNodeNotFound):
+		return ErrCodeNodeNotFound
+	case errors.Is(err, ErrInvalidPipeline):
+		return ErrCodeInvalidParam
+	case errors.Is(err, ErrPresetNotFound):
+		return ErrCodeInvalidParam
+	case errors.Is(err, context.DeadlineExceeded):
+		return ErrCodeTimeout
+	case errors.Is(err, context.Canceled):
+		return ErrCodeCanceled
+	case errors.Is(err, ErrOutputTooLarge):
+		return ErrCodeOutputTooLarge
+	case errors.Is(err, ErrInvalidRegex):
+		return ErrCodeInvalidRegex
+	case errors.As(err, &syntaxErr), errors.As(err, &typeErr):
+		return ErrCodeInvalidJSON
+	default:
+		return ErrCodeInvalidOperation
+	}
+}
@@ -1,19 +1,44 @@
 package main
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"slices"
+	"sort"
+	"strings"
 	"sync"
+	"time"
+	"unicode/utf8"
 )
 
+// ErrNodeNotFound is wrapped by errors returned when a node ID or name doesn't exist
+var ErrNodeNotFound = errors.New("node not found")
+
+// ErrInvalidPipeline is wrapped by errors returned when an imported pipeline or node definition can't be used
+var ErrInvalidPipeline = errors.New("invalid pipeline")
+
+// ErrPresetNotFound is wrapped by errors returned when a preset name doesn't exist
+var ErrPresetNotFound = errors.New("preset not found")
+
+// ErrInvalidRegex is wrapped by errors returned when an operation's regex argument doesn't compile
+var ErrInvalidRegex = errors.New("invalid regex")
+
 // TextCleanerCore is the headless core for text processing with no GTK dependencies
 type TextCleanerCore struct {
-	mu             sync.RWMutex // Protects all fields below for thread-safe concurrent access
-	pipeline       []PipelineNode
-	selectedNodeID string
-	inputText      string
-	outputText     string
-	nodeCounter    int // For generating unique IDs
+	mu               sync.RWMutex // Protects all fields below for thread-safe concurrent access
+	pipeline         []PipelineNode
+	selectedNodeID   string
+	inputText        string
+	outputText       string
+	dirty            bool                      // Set when outputText is stale and the pipeline must be reprocessed
+	nodeCounter      int                       // For generating unique IDs
+	startTime        time.Time                 // When the core was created, reported by ping
+	executionTimeout time.Duration             // Limit for one pipeline run, zero means no limit
+	maxOutputSize    int                       // Largest output in bytes one node may produce, zero means no limit
+	presets          map[string][]PipelineNode // Saved pipelines that subroutine nodes run by name
+	seed             *int64                    // Seed for random operations, nil for nondeterministic runs
 }
 
 // NewTextCleanerCore creates a new TextCleanerCore instance
@@ -24,9 +49,16 @@ func NewTextCleanerCore() *TextCleanerCore {
 		inputText:      "",
 		outputText:     "",
 		nodeCounter:    0,
+		startTime:      time.Now(),
+		presets:        map[string][]PipelineNode{},
 	}
 }
 
+// Uptime returns how long the core has been running
+func (tc *TextCleanerCore) Uptime() time.Duration {
+	return time.Since(tc.startTime)
+}
+
 // ============================================================================
 // Node Management Methods
 // ============================================================================
@@ -49,32 +81,53 @@ func (tc *TextCleanerCore) CreateNode(nodeType, name, operation, arg1, arg2, con
 		Children:  []PipelineNode{},
 	}
 
-	// Set defaults if name is empty
-	if node.Name == "" || node.Name == "[Empty]" {
-		switch node.Type {
-		case "operation":
-			node.Name = operation
-		case "if":
-			node.Name = "If: " + condition
-		case "foreach":
-			node.Name = "For Each Line"
-		case "group":
-			node.Name = "Group"
-		}
-	}
+	setDefaultName(&node)
 
 	tc.pipeline = append(tc.pipeline, node)
+	tc.markDirty()
 	return nodeID
 }
 
+// setDefaultName names a node after its type and settings when it has no name of its own
+func setDefaultName(node *PipelineNode) {
+	if node.Name != "" && node.Name != "[Empty]" {
+		return
+	}
+
+	switch node.Type {
+	case "operation":
+		node.Name = node.Operation
+	case "if":
+		node.Name = "If: " + node.Condition
+	case "foreach":
+		node.Name = "For Each Line"
+	case "group":
+		node.Name = "Group"
+	case "capture":
+		node.Name = "Capture: " + node.Arg1
+	case "subroutine":
+		node.Name = "Subroutine: " + node.Arg1
+	}
+}
+
 // UpdateNode updates an existing node by ID
-func (tc *TextCleanerCore) UpdateNode(nodeID, name, operation, arg1, arg2, condition string) error {
+// An empty nodeType keeps the node's type; a different type clears the fields the new type doesn't use
+// An if node with an else branch can't change its type, since its else nodes would be lost
+func (tc *TextCleanerCore) UpdateNode(nodeID, nodeType, name, operation, arg1, arg2, condition string) error {
 	tc.mu.Lock()
 	defer tc.mu.Unlock()
 
 	node := tc.findNodeByID(nodeID)
 	if node == nil {
-		return fmt.Errorf("node not found: %s", nodeID)
+		return fmt.Errorf("%w: %s", ErrNodeNotFound, nodeID)
+	}
+
+	nodeType = tc.normalizeNodeType(nodeType)
+	if nodeType != "" && !isValidNodeType(nodeType) {
+		return fmt.Errorf("%w: unknown node type %q", ErrInvalidPipeline, nodeType)
+	}
+	if nodeType != "" && nodeType != node.Type && len(node.ElseChildren) > 0 {
+		return fmt.Errorf("node %s has an else branch; move or delete its nodes before changing its type", nodeID)
 	}
 
 	node.Name = name
@@ -83,24 +136,39 @@ func (tc *TextCleanerCore) UpdateNode(nodeID, name, operation, arg1, arg2, condi
 	node.Arg2 = arg2
 	node.Condition = condition
 
-	// Auto-fill name if empty
-	if node.Name == "" || node.Name == "[Empty]" {
-		switch node.Type {
-		case "operation":
-			node.Name = operation
-		case "if":
-			node.Name = "If: " + condition
-		case "foreach":
-			node.Name = "For Each Line"
-		case "group":
-			node.Name = "Group"
-		}
+	if nodeType != "" && nodeType != node.Type {
+		node.Type = nodeType
+		clearUnusedFields(node)
 	}
 
-	tc.processText()
+	setDefaultName(node)
+
+	tc.markDirty()
 	return nil
 }
 
+// clearUnusedFields empties the fields that a node's type doesn't use
+// Children are kept, since every node type passes text to them; callers make sure a node
+// leaving the if type has no else branch
+func clearUnusedFields(node *PipelineNode) {
+	if node.Type != "operation" {
+		node.Operation = ""
+		node.LineBased = false
+	}
+	if node.Type != "if" {
+		node.Condition = ""
+	}
+
+	switch node.Type {
+	case "if", "group":
+		node.Arg1 = ""
+		node.Arg2 = ""
+	case "capture", "subroutine":
+		// arg1 holds the variable or preset name
+		node.Arg2 = ""
+	}
+}
+
 // DeleteNode deletes a node by ID from anywhere in the pipeline
 func (tc *TextCleanerCore) DeleteNode(nodeID string) error {
 	tc.mu.Lock()
@@ -111,7 +179,7 @@ func (tc *TextCleanerCore) DeleteNode(nodeID string) error {
 		if tc.pipeline[i].ID == nodeID {
 			tc.pipeline = append(tc.pipeline[:i], tc.pipeline[i+1:]...)
 			tc.selectedNodeID = ""
-			tc.processText()
+			tc.markDirty()
 			return nil
 		}
 	}
@@ -119,11 +187,11 @@ func (tc *TextCleanerCore) DeleteNode(nodeID string) error {
 	// Try to delete from nested children
 	if tc.deleteNodeByID(&tc.pipeline, nodeID) {
 		tc.selectedNodeID = ""
-		tc.processText()
+		tc.markDirty()
 		return nil
 	}
 
-	return fmt.Errorf("node not found: %s", nodeID)
+	return fmt.Errorf("%w: %s", ErrNodeNotFound, nodeID)
 }
 
 // AddChildNode adds a child node to a parent node
@@ -133,11 +201,11 @@ func (tc *TextCleanerCore) AddChildNode(parentID, nodeType, name, operation, arg
 
 	parentNode := tc.findNodeByID(parentID)
 	if parentNode == nil {
-		return "", fmt.Errorf("parent node not found: %s", parentID)
+		return "", fmt.Errorf("parent %w: %s", ErrNodeNotFound, parentID)
 	}
 
-	// Generate child node ID based on parent
-	childID := fmt.Sprintf("%s_child_%d", parentID, len(parentNode.Children))
+	// Children share the pipeline-wide counter, so IDs never depend on sibling positions
+	childID := tc.generateNodeID()
 
 	child := PipelineNode{
 		ID:        childID,
@@ -150,25 +218,135 @@ func (tc *TextCleanerCore) AddChildNode(parentID, nodeType, name, operation, arg
 		Children:  []PipelineNode{},
 	}
 
-	// Set defaults if name is empty
-	if child.Name == "" || child.Name == "[Empty]" {
-		switch child.Type {
-		case "operation":
-			child.Name = operation
-		case "if":
-			child.Name = "If: " + condition
-		case "foreach":
-			child.Name = "For Each Line"
-		case "group":
-			child.Name = "Group"
-		}
-	}
+	setDefaultName(&child)
 
 	parentNode.Children = append(parentNode.Children, child)
-	tc.processText()
+	tc.markDirty()
 	return childID, nil
 }
 
+// DuplicateNode inserts a copy of a node, including its children, right after the original
+// The copy and every node inside it get fresh IDs; returns the ID of the copy
+func (tc *TextCleanerCore) DuplicateNode(nodeID string) (string, error) {
+	tc.mu.Lock()
+	defer tc.mu.Unlock()
+
+	siblings, index := tc.findSiblingList(&tc.pipeline, nodeID)
+	if siblings == nil {
+		return "", fmt.Errorf("%w: %s", ErrNodeNotFound, nodeID)
+	}
+
+	duplicate := clonePipeline((*siblings)[index : index+1])[0]
+	tc.assignFreshIDs(&duplicate)
+
+	*siblings = append(*siblings, PipelineNode{})
+	copy((*siblings)[index+2:], (*siblings)[index+1:])
+	(*siblings)[index+1] = duplicate
+
+	tc.markDirty()
+	return duplicate.ID, nil
+}
+
+// ReplaceNode swaps a node for a new definition in the same position, keeping the node's ID
+// Unlike UpdateNode, the type and children can change too; children without an ID, or with
+// an ID used elsewhere in the pipeline, get fresh IDs
+func (tc *TextCleanerCore) ReplaceNode(nodeID string, replacement PipelineNode) error {
+	tc.mu.Lock()
+	defer tc.mu.Unlock()
+
+	siblings, index := tc.findSiblingList(&tc.pipeline, nodeID)
+	if siblings == nil {
+		return fmt.Errorf("%w: %s", ErrNodeNotFound, nodeID)
+	}
+
+	if err := invalidPipelineError(tc.checkNodeTypes(&replacement, nodeID)); err != nil {
+		return err
+	}
+
+	// Take the old subtree out first, so its IDs can be reused by the replacement
+	(*siblings)[index] = PipelineNode{ID: nodeID}
+	used := map[string]bool{}
+	var collect func(nodes []PipelineNode)
+	collect = func(nodes []PipelineNode) {
+		for _, node := range nodes {
+			used[node.ID] = true
+			collect(node.Children)
+			collect(node.ElseChildren)
+		}
+	}
+	collect(tc.pipeline)
+
+	var assignIDs func(nodes []PipelineNode)
+	assignIDs = func(nodes []PipelineNode) {
+		for i := range nodes {
+			for nodes[i].ID == "" || used[nodes[i].ID] {
+				nodes[i].ID = tc.generateNodeID()
+			}
+			used[nodes[i].ID] = true
+			assignIDs(nodes[i].Children)
+			assignIDs(nodes[i].ElseChildren)
+		}
+	}
+	replacement.ID = nodeID
+	assignIDs(replacement.Children)
+	assignIDs(replacement.ElseChildren)
+
+	(*siblings)[index] = replacement
+
+	// The selected node may have been one of the replaced children
+	if tc.selectedNodeID != "" && tc.findNodeByID(tc.selectedNodeID) == nil {
+		tc.selectedNodeID = ""
+	}
+
+	tc.markDirty()
+	return nil
+}
+
+// SetNodeEnabled turns a node on or off; a disabled node and its children are skipped when the pipeline runs
+func (tc *TextCleanerCore) SetNodeEnabled(nodeID string, enabled bool) error {
+	tc.mu.Lock()
+	defer tc.mu.Unlock()
+
+	node := tc.findNodeByID(nodeID)
+	if node == nil {
+		return fmt.Errorf("%w: %s", ErrNodeNotFound, nodeID)
+	}
+
+	node.Disabled = !enabled
+	tc.markDirty()
+	return nil
+}
+
+// SetNodeLineBased makes an operation node apply its operation to each line separately,
+// like wrapping it in a foreach node, or to the whole text again
+func (tc *TextCleanerCore) SetNodeLineBased(nodeID string, lineBased bool) error {
+	tc.mu.Lock()
+	defer tc.mu.Unlock()
+
+	node := tc.findNodeByID(nodeID)
+	if node == nil {
+		return fmt.Errorf("%w: %s", ErrNodeNotFound, nodeID)
+	}
+	if node.Type != "operation" {
+		return fmt.Errorf("node %s is a %s node; only operation nodes can be line-based", nodeID, node.Type)
+	}
+
+	node.LineBased = lineBased
+	tc.markDirty()
+	return nil
+}
+
+// ClearPipeline removes every node, keeping the input text and presets
+func (tc *TextCleanerCore) ClearPipeline() {
+	tc.mu.Lock()
+	defer tc.mu.Unlock()
+
+	tc.pipeline = []PipelineNode{}
+	tc.selectedNodeID = ""
+	tc.nodeCounter = 0
+	tc.markDirty()
+}
+
 // ============================================================================
 // Tree Operations (Indent, Unindent, Move Up, Move Down)
 // ============================================================================
@@ -202,14 +380,14 @@ func (tc *TextCleanerCore) IndentNode(nodeID string) error {
 		// Remove from root pipeline
 		tc.pipeline = append(tc.pipeline[:rootIdx], tc.pipeline[rootIdx+1:]...)
 
-		tc.processText()
+		tc.markDirty()
 		return nil
 	}
 
 	// Handle nested node
 	parentNode, idx := tc.findNodeParentAndIndex(&tc.pipeline, nodeID)
 	if parentNode == nil || idx < 0 {
-		return fmt.Errorf("node not found: %s", nodeID)
+		return fmt.Errorf("%w: %s", ErrNodeNotFound, nodeID)
 	}
 
 	// Check if there's a previous sibling
@@ -226,7 +404,7 @@ func (tc *TextCleanerCore) IndentNode(nodeID string) error {
 	// Remove from parent's children
 	parentNode.Children = append(parentNode.Children[:idx], parentNode.Children[idx+1:]...)
 
-	tc.processText()
+	tc.markDirty()
 	return nil
 }
 
@@ -238,7 +416,7 @@ func (tc *TextCleanerCore) UnindentNode(nodeID string) error {
 	// Find the node's parent
 	parentNode, idx := tc.findNodeParentAndIndex(&tc.pipeline, nodeID)
 	if parentNode == nil || idx < 0 {
-		return fmt.Errorf("node not found: %s", nodeID)
+		return fmt.Errorf("%w: %s", ErrNodeNotFound, nodeID)
 	}
 
 	// Find the parent's parent and index
@@ -279,7 +457,7 @@ func (tc *TextCleanerCore) UnindentNode(nodeID string) error {
 		*grandChildrenList = newChildren
 	}
 
-	tc.processText()
+	tc.markDirty()
 	return nil
 }
 
@@ -306,14 +484,14 @@ func (tc *TextCleanerCore) MoveNodeUp(nodeID string) error {
 		// Swap with previous sibling
 		tc.pipeline[rootIdx], tc.pipeline[rootIdx-1] = tc.pipeline[rootIdx-1], tc.pipeline[rootIdx]
 
-		tc.processText()
+		tc.markDirty()
 		return nil
 	}
 
 	// Handle nested node
 	parentNode, idx := tc.findNodeParentAndIndex(&tc.pipeline, nodeID)
 	if parentNode == nil || idx < 0 {
-		return fmt.Errorf("node not found: %s", nodeID)
+		return fmt.Errorf("%w: %s", ErrNodeNotFound, nodeID)
 	}
 
 	if idx == 0 {
@@ -323,7 +501,7 @@ func (tc *TextCleanerCore) MoveNodeUp(nodeID string) error {
 	// Swap with previous sibling
 	parentNode.Children[idx], parentNode.Children[idx-1] = parentNode.Children[idx-1], parentNode.Children[idx]
 
-	tc.processText()
+	tc.markDirty()
 	return nil
 }
 
@@ -350,14 +528,14 @@ func (tc *TextCleanerCore) MoveNodeDown(nodeID string) error {
 		// Swap with next sibling
 		tc.pipeline[rootIdx], tc.pipeline[rootIdx+1] = tc.pipeline[rootIdx+1], tc.pipeline[rootIdx]
 
-		tc.processText()
+		tc.markDirty()
 		return nil
 	}
 
 	// Handle nested node
 	parentNode, idx := tc.findNodeParentAndIndex(&tc.pipeline, nodeID)
 	if parentNode == nil || idx < 0 {
-		return fmt.Errorf("node not found: %s", nodeID)
+		return fmt.Errorf("%w: %s", ErrNodeNotFound, nodeID)
 	}
 
 	if idx >= len(parentNode.Children)-1 {
@@ -367,13 +545,14 @@ func (tc *TextCleanerCore) MoveNodeDown(nodeID string) error {
 	// Swap with next sibling
 	parentNode.Children[idx], parentNode.Children[idx+1] = parentNode.Children[idx+1], parentNode.Children[idx]
 
-	tc.processText()
+	tc.markDirty()
 	return nil
 }
 
 // MoveNodeToPosition moves a node to a new parent at a specific position
 // parentID: "" means root level, otherwise the ID of the new parent node
-// position: index in the parent's children list (or root pipeline)
+// position: index in the parent's children list (or root pipeline) as it is before the move,
+// i.e. the index of the sibling to insert before; negative or past the end appends
 func (tc *TextCleanerCore) MoveNodeToPosition(nodeID, newParentID string, position int) error {
 	tc.mu.Lock()
 	defer tc.mu.Unlock()
@@ -383,82 +562,86 @@ func (tc *TextCleanerCore) MoveNodeToPosition(nodeID, newParentID string, positi
 		return fmt.Errorf("cannot move node into itself")
 	}
 
-	// Check if newParentID is a descendant of nodeID (would create a cycle)
+	node := tc.findNodeByID(nodeID)
+	if node == nil {
+		return fmt.Errorf("%w: %s", ErrNodeNotFound, nodeID)
+	}
+
+	// Check if newParentID is a descendant of nodeID (would create a cycle);
+	// searchNodeInChildren walks both Children and ElseChildren
 	if newParentID != "" {
-		node := tc.findNodeByID(nodeID)
-		if node != nil && tc.isNodeDescendant(nodeID, newParentID) {
+		if tc.searchNodeInChildren(node, newParentID) {
 			return fmt.Errorf("cannot move node into its own descendant")
 		}
+
+		// Check before removing anything, so a bad parent doesn't lose the node
+		if tc.findNodeByID(newParentID) == nil {
+			return fmt.Errorf("new parent %w: %s", ErrNodeNotFound, newParentID)
+		}
 	}
 
 	// Find and remove node from its current location
-	var nodeToMove *PipelineNode
+	var nodeToMove PipelineNode
+	sourceParentID := ""
+	sourceIdx := -1
+	sourceInElse := false
 
 	// Try to find at root level
-	rootIdx := -1
 	for i := range tc.pipeline {
 		if tc.pipeline[i].ID == nodeID {
-			rootIdx = i
-			nodeToMove = &tc.pipeline[i]
+			sourceIdx = i
 			break
 		}
 	}
 
-	if rootIdx >= 0 {
-		// Node is at root level, remove it
-		nodeToMove = &tc.pipeline[rootIdx]
-		// Make a copy before removing
-		nodeCopy := *nodeToMove
-		tc.pipeline = append(tc.pipeline[:rootIdx], tc.pipeline[rootIdx+1:]...)
-		nodeToMove = &nodeCopy
+	if sourceIdx >= 0 {
+		// Node is at root level, copy it before removing
+		nodeToMove = tc.pipeline[sourceIdx]
+		tc.pipeline = append(tc.pipeline[:sourceIdx], tc.pipeline[sourceIdx+1:]...)
 	} else {
 		// Find in nested children
 		parentNode, idx := tc.findNodeParentAndIndex(&tc.pipeline, nodeID)
 		if parentNode == nil || idx < 0 {
-			return fmt.Errorf("node not found: %s", nodeID)
+			return fmt.Errorf("%w: %s", ErrNodeNotFound, nodeID)
 		}
 
-		// Make a copy before removing
-		nodeCopy := parentNode.Children[idx]
-		parentNode.Children = append(parentNode.Children[:idx], parentNode.Children[idx+1:]...)
-		nodeToMove = &nodeCopy
-	}
-
-	// Insert node at new position
-	if newParentID == "" {
-		// Insert at root level
-		if position < 0 {
-			position = 0
-		}
-		if position > len(tc.pipeline) {
-			position = len(tc.pipeline)
+		// The index may refer to either branch of an if node, so check
+		// which list actually holds the node before removing it
+		siblings := &parentNode.Children
+		if idx >= len(parentNode.Children) || parentNode.Children[idx].ID != nodeID {
+			siblings = &parentNode.ElseChildren
+			sourceInElse = true
 		}
 
-		newPipeline := append([]PipelineNode{}, tc.pipeline[:position]...)
-		newPipeline = append(newPipeline, *nodeToMove)
-		newPipeline = append(newPipeline, tc.pipeline[position:]...)
-		tc.pipeline = newPipeline
-	} else {
-		// Insert into parent's children
-		newParent := tc.findNodeByID(newParentID)
-		if newParent == nil {
-			return fmt.Errorf("new parent node not found: %s", newParentID)
-		}
+		// Copy before removing
+		sourceParentID = parentNode.ID
+		sourceIdx = idx
+		nodeToMove = (*siblings)[idx]
+		*siblings = append((*siblings)[:idx], (*siblings)[idx+1:]...)
+	}
 
-		if position < 0 {
-			position = 0
-		}
-		if position > len(newParent.Children) {
-			position = len(newParent.Children)
-		}
+	// Removing the node shifted its later siblings down by one, so a position
+	// after it in the same list now points one slot further than intended
+	if sourceParentID == newParentID && !sourceInElse && position > sourceIdx {
+		position--
+	}
 
-		newChildren := append([]PipelineNode{}, newParent.Children[:position]...)
-		newChildren = append(newChildren, *nodeToMove)
-		newChildren = append(newChildren, newParent.Children[position:]...)
-		newParent.Children = newChildren
+	// Insert node at new position
+	siblings := &tc.pipeline
+	if newParentID != "" {
+		siblings = &tc.findNodeByID(newParentID).Children
+	}
+
+	if position < 0 || position > len(*siblings) {
+		position = len(*siblings)
 	}
 
-	tc.processText()
+	newSiblings := append([]PipelineNode{}, (*siblings)[:position]...)
+	newSiblings = append(newSiblings, nodeToMove)
+	newSiblings = append(newSiblings, (*siblings)[position:]...)
+	*siblings = newSiblings
+
+	tc.markDirty()
 	return nil
 }
 
@@ -581,7 +764,7 @@ func (tc *TextCleanerCore) SelectNode(nodeID string) error {
 
 	node := tc.findNodeByID(nodeID)
 	if node == nil {
-		return fmt.Errorf("node not found: %s", nodeID)
+		return fmt.Errorf("%w: %s", ErrNodeNotFound, nodeID)
 	}
 	tc.selectedNodeID = nodeID
 	return nil
@@ -591,13 +774,13 @@ func (tc *TextCleanerCore) SelectNode(nodeID string) error {
 // Text Processing Methods
 // ============================================================================
 
-// SetInputText sets the input text and processes it through the pipeline
+// SetInputText sets the input text; it is processed through the pipeline on the next GetOutputText
 func (tc *TextCleanerCore) SetInputText(text string) {
 	tc.mu.Lock()
 	defer tc.mu.Unlock()
 
 	tc.inputText = text
-	tc.processText()
+	tc.markDirty()
 }
 
 // GetInputText returns the current input text
@@ -609,153 +792,318 @@ func (tc *TextCleanerCore) GetInputText() string {
 }
 
 // GetOutputText returns the current output text
+// The pipeline is only reprocessed when the input or pipeline changed since the last call
+// If processing exceeds the execution timeout, the last successful output is returned
 func (tc *TextCleanerCore) GetOutputText() string {
+	output, _ := tc.GetOutputTextWithError()
+	return output
+}
+
+// GetOutputTextWithError is GetOutputText, but reports a run that exceeded the execution timeout
+func (tc *TextCleanerCore) GetOutputTextWithError() (string, error) {
+	tc.mu.RLock()
+	if !tc.dirty {
+		defer tc.mu.RUnlock()
+		return tc.outputText, nil
+	}
+	tc.mu.RUnlock()
+
+	tc.mu.Lock()
+	defer tc.mu.Unlock()
+
+	// Another caller may have processed the pipeline while we waited for the lock
+	if tc.dirty {
+		if err := tc.processText(); err != nil {
+			return tc.outputText, err
+		}
+	}
+	return tc.outputText, nil
+}
+
+// BatchInput is one named text for ProcessBatch
+type BatchInput struct {
+	ID   string `json:"id"`
+	Text string `json:"text"`
+}
+
+// BatchResult is the pipeline's output for one BatchInput
+type BatchResult struct {
+	ID     string `json:"id"`
+	Output string `json:"output"`
+}
+
+// ProcessBatch runs each input through the current pipeline without touching the stored input text
+// Every input gets its own run, so captures and seeded randomness start fresh, just as they would
+// for a set_input_text and get_output_text pair; the execution timeout applies to each run
+func (tc *TextCleanerCore) ProcessBatch(inputs []BatchInput) ([]BatchResult, error) {
+	tc.mu.RLock()
+	defer tc.mu.RUnlock()
+
+	results := make([]BatchResult, 0, len(inputs))
+	for _, input := range inputs {
+		ctx, cancel := tc.executionContext()
+		output, err := executePipelineRun(ctx, tc.newRun(), tc.pipeline, input.Text)
+		cancel()
+		if err != nil {
+			return nil, fmt.Errorf("input %q: %w", input.ID, tc.executionError(err))
+		}
+		results = append(results, BatchResult{ID: input.ID, Output: output})
+	}
+	return results, nil
+}
+
+// GetOutputPreview returns the start of the output for display, at most maxBytes long
+// The cut never splits a UTF-8 character, so the preview can be a few bytes shorter than maxBytes
+// truncated reports whether anything was left out, and totalBytes is the full output's length
+func (tc *TextCleanerCore) GetOutputPreview(maxBytes int) (preview string, truncated bool, totalBytes int, err error) {
+	output, err := tc.GetOutputTextWithError()
+	if err != nil {
+		return "", false, 0, err
+	}
+	cut := max(maxBytes, 0)
+	if len(output) <= cut {
+		return output, false, len(output), nil
+	}
+
+	for cut > 0 && !utf8.RuneStart(output[cut]) {
+		cut--
+	}
+	return output[:cut], true, len(output), nil
+}
+
+// SetExecutionTimeout limits how long a single pipeline run may take before it is
+// abandoned with an error; zero or negative disables the limit
+func (tc *TextCleanerCore) SetExecutionTimeout(timeout time.Duration) {
+	tc.mu.Lock()
+	defer tc.mu.Unlock()
+
+	tc.executionTimeout = timeout
+}
+
+// SetMaxOutputSize limits the output of each node to maxBytes, so an operation that blows up
+// its input fails the run with ErrOutputTooLarge instead of exhausting memory; zero or
+// negative disables the limit
+func (tc *TextCleanerCore) SetMaxOutputSize(maxBytes int) {
+	tc.mu.Lock()
+	defer tc.mu.Unlock()
+
+	tc.maxOutputSize = maxBytes
+	tc.markDirty()
+}
+
+// SetSeed makes random operations (e.g. Randomize Lines) reproducible: every run starts
+// from the same seed, so the same input and pipeline always give the same output
+func (tc *TextCleanerCore) SetSeed(seed int64) {
 	tc.mu.Lock()
 	defer tc.mu.Unlock()
 
-	// Reprocess the pipeline to ensure output is always up-to-date
-	// This handles cases where the pipeline was modified after input was set
-	tc.processText()
-	return tc.outputText
+	tc.seed = &seed
+	tc.markDirty()
+}
+
+// ClearSeed makes random operations nondeterministic again
+func (tc *TextCleanerCore) ClearSeed() {
+	tc.mu.Lock()
+	defer tc.mu.Unlock()
+
+	tc.seed = nil
+	tc.markDirty()
+}
+
+// newRun starts the state for one pipeline run, seeding random operations when a seed is set
+func (tc *TextCleanerCore) newRun() *pipelineRun {
+	run := newPipelineRun(tc.presets)
+	run.maxSize = tc.maxOutputSize
+	if tc.seed != nil {
+		run.seeded(*tc.seed)
+	}
+	return run
 }
 
 // GetOutputTextAtNode returns the text after processing through all nodes up to and including the specified node
 // Processes nodes in depth-first traversal order from the top of the pipeline
 // This is useful for debugging - see what the text looks like at each step of the pipeline
+// Ancestors of the node only run up to it, so a node inside an if branch, foreach or group
+// yields the same intermediate text the full pipeline passes on at that point
 func (tc *TextCleanerCore) GetOutputTextAtNode(nodeID string) string {
+	output, _ := tc.GetOutputTextAtNodeWithError(nodeID)
+	return output
+}
+
+// GetOutputTextAtNodeWithError is GetOutputTextAtNode, but reports a run that exceeded the
+// execution timeout instead of falling back to the input text
+func (tc *TextCleanerCore) GetOutputTextAtNodeWithError(nodeID string) (string, error) {
 	tc.mu.RLock()
 	defer tc.mu.RUnlock()
 
 	if nodeID == "" {
-		return tc.inputText
+		return tc.inputText, nil
 	}
 
-	// Get all nodes in depth-first order up to the selected node
-	nodes := tc.getNodesUpToNode(nodeID)
-	if nodes == nil {
-		return tc.inputText // Node not found, return input
-	}
-
-	// Only execute top-level nodes (those whose parent is not in the collected list)
-	// This prevents double-execution: children are already executed by their parents via ExecuteNode
-	result := tc.inputText
-	for _, node := range nodes {
-		// Check if this node's parent is in our list
-		hasParentInList := false
-		for _, potentialParent := range nodes {
-			if potentialParent.ID != node.ID && tc.isNodeChild(potentialParent, node) {
-				hasParentInList = true
-				break
-			}
-		}
+	ctx, cancel := tc.executionContext()
+	defer cancel()
 
-		// Only execute if this node doesn't have a parent in the list
-		if !hasParentInList {
-			result = ExecuteNode(node, result)
-		}
+	_, result, found, err := tc.executeUpToNode(ctx, tc.newRun(), tc.pipeline, tc.inputText, nodeID)
+	if err != nil {
+		return tc.inputText, tc.executionError(err)
+	}
+	if !found {
+		return tc.inputText, nil // Node not found, return input
 	}
 
-	return result
+	return result, nil
 }
 
-// getNodesUpToNode returns a list of nodes in depth-first traversal order up to and including the target node
-// Includes all root nodes before the target's branch, and the branch path to the target
-// Returns the nodes themselves (not just IDs) so we can execute them with their full structure
-func (tc *TextCleanerCore) getNodesUpToNode(nodeID string) []*PipelineNode {
-	var result []*PipelineNode
-	var found bool
+// GetOutputDiffAtNode returns the text a node receives, the output at the node and a line diff between them
+// The output is the same as GetOutputTextAtNode's, so for operation nodes it includes their children
+func (tc *TextCleanerCore) GetOutputDiffAtNode(nodeID string) (input, output string, diff []DiffLine, err error) {
+	tc.mu.RLock()
+	defer tc.mu.RUnlock()
 
-	// Traverse root-level nodes in order
-	for i := range tc.pipeline {
-		if found {
-			break // Stop once we've found the target node
-		}
-		nodes, nodeFound := tc.collectNodesUpToNode(&tc.pipeline[i], nodeID)
-		result = append(result, nodes...)
-		found = nodeFound
+	if tc.findNodeByID(nodeID) == nil {
+		return "", "", nil, fmt.Errorf("%w: %s", ErrNodeNotFound, nodeID)
 	}
 
-	if !found {
-		return nil // Node not found
+	ctx, cancel := tc.executionContext()
+	defer cancel()
+
+	// Both texts come from one run, so operations with random or time-based output agree with each other
+	if input, output, _, err = tc.executeUpToNode(ctx, tc.newRun(), tc.pipeline, tc.inputText, nodeID); err != nil {
+		return "", "", nil, tc.executionError(err)
 	}
 
-	return result
+	return input, output, DiffText(input, output), nil
 }
 
-// collectNodesUpToNode recursively collects nodes in depth-first order up to the target node
-// Returns the list of nodes and whether the target was found
-func (tc *TextCleanerCore) collectNodesUpToNode(node *PipelineNode, targetID string) ([]*PipelineNode, bool) {
-	var result []*PipelineNode
-
-	// Add current node to result
-	result = append(result, node)
-
-	// Check if this is the target
-	if node.ID == targetID {
-		return result, true
-	}
+// executeUpToNode runs a list of sibling nodes in order, stopping at the node that is or contains the target
+// Returns the text the target receives, the text it outputs and whether the target was found
+// Inside a foreach the target runs once per record, so both texts are the joined records
+func (tc *TextCleanerCore) executeUpToNode(ctx context.Context, run *pipelineRun, nodes []PipelineNode, input, targetID string) (before, after string, found bool, err error) {
+	result := input
+	for i := range nodes {
+		node := &nodes[i]
+
+		if node.ID == targetID {
+			output, err := executeNode(ctx, run, node, result)
+			return result, output, true, err
+		}
 
-	// Recursively process children in order
-	for i := range node.Children {
-		childNodes, found := tc.collectNodesUpToNode(&node.Children[i], targetID)
-		result = append(result, childNodes...)
-		if found {
-			return result, true
+		if tc.searchNodeInChildren(node, targetID) {
+			before, after, err := tc.executeNodeUpTo(ctx, run, node, result, targetID)
+			return before, after, true, err
 		}
-	}
 
-	// Process else-children (for if-nodes)
-	for i := range node.ElseChildren {
-		childNodes, found := tc.collectNodesUpToNode(&node.ElseChildren[i], targetID)
-		result = append(result, childNodes...)
-		if found {
-			return result, true
+		if result, err = executeNode(ctx, run, node, result); err != nil {
+			return input, input, false, err
 		}
 	}
 
-	// Target not found in this subtree
-	return result, false
+	return result, result, false, nil
 }
 
-// isNodeChild checks if targetNode is a descendant of parentNode
-func (tc *TextCleanerCore) isNodeChild(parentNode *PipelineNode, targetNode *PipelineNode) bool {
-	if parentNode == nil || targetNode == nil {
-		return false
+// executeNodeUpTo runs an ancestor of the target the way ExecuteNode would, but only up to the target
+// Returns the text the target receives and the text it outputs
+func (tc *TextCleanerCore) executeNodeUpTo(ctx context.Context, run *pipelineRun, node *PipelineNode, input, targetID string) (before, after string, err error) {
+	if node.Disabled {
+		// Nothing inside a disabled node runs, so the text reaches the target unchanged
+		return input, input, nil
 	}
 
-	// Check direct children
-	for i := range parentNode.Children {
-		if parentNode.Children[i].ID == targetNode.ID {
-			return true
+	switch node.Type {
+	case "operation":
+		result, err := run.applyOperation(ctx, input, node.Operation, run.vars.expand(node.Arg1), run.vars.expand(node.Arg2), node.LineBased)
+		if err != nil {
+			return input, input, err
 		}
-		// Recursively check descendants
-		if tc.isNodeChild(&parentNode.Children[i], targetNode) {
-			return true
+		if err := run.checkOutputSize(node.Name, result); err != nil {
+			return input, input, err
+		}
+		before, after, _, err := tc.executeUpToNode(ctx, run, node.Children, result, targetID)
+		return before, after, err
+	case "if":
+		if node.Condition == "" {
+			return input, input, nil
 		}
-	}
 
-	// Check else-children
-	for i := range parentNode.ElseChildren {
-		if parentNode.ElseChildren[i].ID == targetNode.ID {
-			return true
+		// Work out which branch holds the target and whether the condition selects it
+		matches := ifConditionMatches(node, input)
+		branch, taken := node.Children, matches
+		if !tc.searchNodeInChildren(&PipelineNode{Children: node.Children}, targetID) {
+			branch, taken = node.ElseChildren, !matches
 		}
-		// Recursively check descendants
-		if tc.isNodeChild(&parentNode.ElseChildren[i], targetNode) {
-			return true
+
+		if !taken {
+			// The pipeline skips the target's branch for this text, so the text passes through unchanged
+			return input, input, nil
 		}
-	}
 
-	return false
+		before, after, _, err := tc.executeUpToNode(ctx, run, branch, input, targetID)
+		return before, after, err
+	case "foreach":
+		if input == "" {
+			return input, input, nil
+		}
+
+		records, separators := splitRecords(node.Arg1, input)
+		outputs := make([]string, len(records))
+		runs := run.recordRuns(len(records))
+		for i, record := range records {
+			if err := ctx.Err(); err != nil {
+				return input, input, err
+			}
+
+			var err error
+			if records[i], outputs[i], _, err = tc.executeUpToNode(ctx, runs[i], node.Children, record, targetID); err != nil {
+				return input, input, err
+			}
+		}
+		return joinSeparated(records, separators), joinSeparated(outputs, separators), nil
+	default:
+		// Groups and sequences pass the text straight to their children
+		before, after, _, err := tc.executeUpToNode(ctx, run, node.Children, input, targetID)
+		return before, after, err
+	}
 }
 
 // processText executes the pipeline on the input text and updates outputText
-// This is a private method called automatically by SetInputText and other operations
-func (tc *TextCleanerCore) processText() {
-	output := tc.inputText
-	for i := range tc.pipeline {
-		output = ExecuteNode(&tc.pipeline[i], output)
+// This is a private method called lazily by GetOutputText when the output is stale
+// A run that exceeds the execution timeout leaves the output stale and returns the context's error
+func (tc *TextCleanerCore) processText() error {
+	ctx, cancel := tc.executionContext()
+	defer cancel()
+
+	output, err := executePipelineRun(ctx, tc.newRun(), tc.pipeline, tc.inputText)
+	if err != nil {
+		return tc.executionError(err)
 	}
 	tc.outputText = output
+	tc.dirty = false
+	return nil
+}
+
+// executionContext returns the context a single pipeline run is limited by
+func (tc *TextCleanerCore) executionContext() (context.Context, context.CancelFunc) {
+	if tc.executionTimeout <= 0 {
+		return context.WithCancel(context.Background())
+	}
+	return context.WithTimeout(context.Background(), tc.executionTimeout)
+}
+
+// executionError describes why a pipeline run was abandoned
+func (tc *TextCleanerCore) executionError(err error) error {
+	if errors.Is(err, context.DeadlineExceeded) {
+		return fmt.Errorf("pipeline run exceeded the %v execution timeout: %w", tc.executionTimeout, err)
+	}
+	if errors.Is(err, context.Canceled) {
+		return fmt.Errorf("pipeline run was canceled: %w", err)
+	}
+	return err
+}
+
+// markDirty records that the input or pipeline changed, so the cached output is stale
+// Every method that modifies inputText or the pipeline must call this
+func (tc *TextCleanerCore) markDirty() {
+	tc.dirty = true
 }
 
 // ============================================================================
@@ -786,6 +1134,180 @@ func (tc *TextCleanerCore) GetPipeline() []PipelineNode {
 	return append([]PipelineNode{}, tc.pipeline...)
 }
 
+// PipelineStats summarizes the shape of a pipeline
+type PipelineStats struct {
+	TotalNodes        int            `json:"total_nodes"`
+	MaxDepth          int            `json:"max_depth"` // 1 when there are only root nodes, 0 for an empty pipeline
+	NodesByType       map[string]int `json:"nodes_by_type"`
+	HasInvalidRegex   bool           `json:"has_invalid_regex"`
+	InvalidRegexNodes []string       `json:"invalid_regex_nodes"` // IDs of nodes whose pattern doesn't compile
+}
+
+// regexArgs tells which arguments of an operation are regular expressions
+type regexArgs struct {
+	arg1, arg2 bool
+}
+
+// regexOperations lists the operations that take regular expressions
+// Regex flags given in arg2, as in "i" or "X/i", only add inline flags in front of the
+// pattern, so they can't make a valid pattern invalid and aren't checked
+var regexOperations = map[string]regexArgs{
+	"Keep Match Lines":    {arg1: true},
+	"Remove Match Lines":  {arg1: true},
+	"Match Text":          {arg1: true},
+	"Replace Full":        {arg1: true},
+	"Regex Replace":       {arg1: true},
+	"Extract with Groups": {arg1: true},
+	"Replace with Groups": {arg1: true},
+	"Split by Regex":      {arg1: true},
+	"Match Count":         {arg1: true},
+	"Has Pattern":         {arg1: true},
+	"Group By Pattern":    {arg1: true},
+	"Multi-line Pattern":  {arg1: true},
+	"Look-ahead Pattern":  {arg1: true, arg2: true},
+	"Look-behind Pattern": {arg1: true, arg2: true},
+	"Conditional Replace": {arg1: true},
+}
+
+// regexPatterns returns the arguments of an operation that are regular expressions
+func regexPatterns(operation, arg1, arg2 string) []string {
+	var patterns []string
+	args := regexOperations[operation]
+	if args.arg1 {
+		patterns = append(patterns, arg1)
+	}
+	if args.arg2 {
+		patterns = append(patterns, arg2)
+	}
+	return patterns
+}
+
+// checkRegexArgs returns an error wrapping ErrInvalidRegex when an operation is given a
+// regular expression that doesn't compile
+func checkRegexArgs(operation, arg1, arg2 string) error {
+	for _, pattern := range regexPatterns(operation, arg1, arg2) {
+		if _, err := compileRegex(pattern); err != nil {
+			return fmt.Errorf("%w for %s: %v", ErrInvalidRegex, operation, err)
+		}
+	}
+	return nil
+}
+
+// checkNodeRegexArgs checks the regex arguments of a node's operation and of every node below it
+func checkNodeRegexArgs(node *PipelineNode) error {
+	if node.Type == "operation" {
+		if err := checkRegexArgs(node.Operation, node.Arg1, node.Arg2); err != nil {
+			return fmt.Errorf("node %s: %w", node.ID, err)
+		}
+	}
+	for _, children := range [][]PipelineNode{node.Children, node.ElseChildren} {
+		for i := range children {
+			if err := checkNodeRegexArgs(&children[i]); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// GetPipelineStats counts the pipeline's nodes by type, measures its depth and
+// checks the regular expressions of if nodes and regex operations
+func (tc *TextCleanerCore) GetPipelineStats() PipelineStats {
+	tc.mu.RLock()
+	defer tc.mu.RUnlock()
+
+	stats := PipelineStats{
+		NodesByType:       map[string]int{},
+		InvalidRegexNodes: []string{},
+	}
+
+	var walk func(nodes []PipelineNode, depth int)
+	walk = func(nodes []PipelineNode, depth int) {
+		for i := range nodes {
+			node := &nodes[i]
+			stats.TotalNodes++
+			stats.NodesByType[node.Type]++
+			stats.MaxDepth = max(stats.MaxDepth, depth)
+
+			var patterns []string
+			switch node.Type {
+			case "if":
+				patterns = append(patterns, node.Condition)
+			case "operation":
+				patterns = regexPatterns(node.Operation, node.Arg1, node.Arg2)
+			}
+			for _, pattern := range patterns {
+				if _, err := compileRegex(pattern); err != nil {
+					stats.HasInvalidRegex = true
+					stats.InvalidRegexNodes = append(stats.InvalidRegexNodes, node.ID)
+					break
+				}
+			}
+
+			walk(node.Children, depth+1)
+			walk(node.ElseChildren, depth+1)
+		}
+	}
+	walk(tc.pipeline, 1)
+
+	return stats
+}
+
+// NodeMatch is a node found by FindNodes
+type NodeMatch struct {
+	ID        string   `json:"id"`
+	Name      string   `json:"name"`
+	Operation string   `json:"operation"`
+	Path      []string `json:"path"` // Node IDs from the root-level ancestor down to the node itself
+}
+
+// FindNodes returns the nodes, in tree order, whose operation is operation (ignoring case) and
+// whose name contains nameContains (ignoring case); an empty criterion matches every node
+func (tc *TextCleanerCore) FindNodes(operation, nameContains string) []NodeMatch {
+	tc.mu.RLock()
+	defer tc.mu.RUnlock()
+
+	nameContains = strings.ToLower(nameContains)
+	matches := []NodeMatch{}
+	for i := range tc.pipeline {
+		tc.searchNodes(&tc.pipeline[i], nil, func(node *PipelineNode) bool {
+			return (operation == "" || strings.EqualFold(node.Operation, operation)) &&
+				strings.Contains(strings.ToLower(node.Name), nameContains)
+		}, &matches)
+	}
+	return matches
+}
+
+// NodePathEntry is one node on the path from the root of the pipeline to a node
+type NodePathEntry struct {
+	ID   string `json:"id"`
+	Name string `json:"name"`
+}
+
+// GetNodePath returns the node's ancestors from the root-level one down, ending with the node itself
+func (tc *TextCleanerCore) GetNodePath(nodeID string) ([]NodePathEntry, error) {
+	tc.mu.RLock()
+	defer tc.mu.RUnlock()
+
+	node := tc.findNodeByID(nodeID)
+	if node == nil {
+		return nil, fmt.Errorf("%w: %s", ErrNodeNotFound, nodeID)
+	}
+
+	path := []NodePathEntry{{ID: node.ID, Name: node.Name}}
+	for {
+		parent, _ := tc.findNodeParentAndIndex(&tc.pipeline, node.ID)
+		if parent == nil {
+			break
+		}
+		path = append(path, NodePathEntry{ID: parent.ID, Name: parent.Name})
+		node = parent
+	}
+
+	slices.Reverse(path)
+	return path, nil
+}
+
 // ============================================================================
 // Import/Export Methods
 // ============================================================================
@@ -812,25 +1334,169 @@ func (tc *TextCleanerCore) ImportPipeline(jsonStr string) error {
 		return err
 	}
 
+	if err := tc.validateImportedPipeline(pipeline); err != nil {
+		return err
+	}
+
 	tc.pipeline = pipeline
 	tc.selectedNodeID = ""
 
 	// Reset node counter to max ID + 1
 	tc.nodeCounter = tc.calculateMaxNodeCounter() + 1
 
-	tc.processText()
+	tc.markDirty()
 	return nil
 }
 
+// ============================================================================
+// Preset Methods
+// ============================================================================
+
+// SavePreset stores a copy of the current pipeline under name, replacing any preset with that name
+// Subroutine nodes with arg1 set to the name run the preset
+func (tc *TextCleanerCore) SavePreset(name string) error {
+	tc.mu.Lock()
+	defer tc.mu.Unlock()
+
+	if name == "" {
+		return fmt.Errorf("preset name cannot be empty")
+	}
+
+	tc.presets[name] = clonePipeline(tc.pipeline)
+	tc.markDirty()
+	return nil
+}
+
+// DeletePreset removes a saved preset
+func (tc *TextCleanerCore) DeletePreset(name string) error {
+	tc.mu.Lock()
+	defer tc.mu.Unlock()
+
+	if _, ok := tc.presets[name]; !ok {
+		return fmt.Errorf("%w: %s", ErrPresetNotFound, name)
+	}
+
+	delete(tc.presets, name)
+	tc.markDirty()
+	return nil
+}
+
+// ListPresets returns the names of the saved presets in sorted order
+func (tc *TextCleanerCore) ListPresets() []string {
+	tc.mu.RLock()
+	defer tc.mu.RUnlock()
+
+	names := make([]string, 0, len(tc.presets))
+	for name := range tc.presets {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// clonePipeline returns a deep copy of nodes, so later edits to the pipeline don't change it
+func clonePipeline(nodes []PipelineNode) []PipelineNode {
+	if nodes == nil {
+		return nil
+	}
+
+	cloned := make([]PipelineNode, len(nodes))
+	for i, node := range nodes {
+		cloned[i] = node
+		cloned[i].Children = clonePipeline(node.Children)
+		cloned[i].ElseChildren = clonePipeline(node.ElseChildren)
+	}
+	return cloned
+}
+
 // ============================================================================
 // Helper Methods (Private)
 // ============================================================================
 
-// generateNodeID generates a unique node ID
+// validateImportedPipeline checks a hand-written or imported tree before it replaces the pipeline
+// Blank and duplicate IDs are repaired with fresh IDs and node types are checked by checkNodeTypes
+func (tc *TextCleanerCore) validateImportedPipeline(pipeline []PipelineNode) error {
+	maxCounter := 0
+	tc.findMaxCounter(&pipeline, &maxCounter)
+	nextCounter := maxCounter + 1
+
+	seen := make(map[string]bool)
+	var repairIDs func(nodes []PipelineNode)
+	repairIDs = func(nodes []PipelineNode) {
+		for i := range nodes {
+			node := &nodes[i]
+			if node.ID == "" || seen[node.ID] {
+				node.ID = fmt.Sprintf("node_%d", nextCounter)
+				nextCounter++
+			}
+			seen[node.ID] = true
+
+			repairIDs(node.Children)
+			repairIDs(node.ElseChildren)
+		}
+	}
+	repairIDs(pipeline)
+
+	var problems []string
+	for i := range pipeline {
+		problems = append(problems, tc.checkNodeTypes(&pipeline[i], fmt.Sprint(i+1))...)
+	}
+	return invalidPipelineError(problems)
+}
+
+// checkNodeTypes normalizes the type of a node and of every node below it, and returns a
+// problem for each type that is unknown
+// UI type names become their internal names and nodes without a type become operations, as
+// in Apply Pipeline. path names the node in the problems; its children are path.1, path.2
+// and so on, and the nodes of its else branch path.else.1 and so on
+func (tc *TextCleanerCore) checkNodeTypes(node *PipelineNode, path string) []string {
+	var problems []string
+
+	node.Type = tc.normalizeNodeType(node.Type)
+	if node.Type == "" {
+		node.Type = "operation"
+	}
+	if !isValidNodeType(node.Type) {
+		problems = append(problems, fmt.Sprintf("node %s %q: unknown type %q", path, node.Name, node.Type))
+	}
+
+	for i := range node.Children {
+		problems = append(problems, tc.checkNodeTypes(&node.Children[i], fmt.Sprintf("%s.%d", path, i+1))...)
+	}
+	for i := range node.ElseChildren {
+		problems = append(problems, tc.checkNodeTypes(&node.ElseChildren[i], fmt.Sprintf("%s.else.%d", path, i+1))...)
+	}
+	return problems
+}
+
+// invalidPipelineError reports the problems checkNodeTypes found together in one error, or nil if there are none
+func invalidPipelineError(problems []string) error {
+	if len(problems) == 0 {
+		return nil
+	}
+	return fmt.Errorf("%w: %s", ErrInvalidPipeline, strings.Join(problems, "; "))
+}
+
+// isValidNodeType reports whether nodeType is one of the node types the pipeline can execute
+func isValidNodeType(nodeType string) bool {
+	switch nodeType {
+	case "operation", "if", "foreach", "group", "capture", "subroutine":
+		return true
+	default:
+		return false
+	}
+}
+
+// generateNodeID generates a unique node ID from a monotonic counter
+// The counter never goes back, and IDs already present in the tree (e.g. hand-written ones) are skipped
 func (tc *TextCleanerCore) generateNodeID() string {
-	id := fmt.Sprintf("node_%d", tc.nodeCounter)
-	tc.nodeCounter++
-	return id
+	for {
+		id := fmt.Sprintf("node_%d", tc.nodeCounter)
+		tc.nodeCounter++
+		if tc.findNodeByID(id) == nil {
+			return id
+		}
+	}
 }
 
 // normalizeNodeType converts UI node type names to internal representation
@@ -844,6 +1510,10 @@ func (tc *TextCleanerCore) normalizeNodeType(nodeTypeText string) string {
 		return "foreach"
 	case "Group":
 		return "group"
+	case "Capture":
+		return "capture"
+	case "Subroutine":
+		return "subroutine"
 	default:
 		// If it's already normalized, return as-is
 		return nodeTypeText
@@ -916,6 +1586,29 @@ func (tc *TextCleanerCore) searchNodeByName(node *PipelineNode, name string) *Pi
 	return nil
 }
 
+// searchNodes recursively collects the nodes that match, with the IDs of their ancestors in path
+func (tc *TextCleanerCore) searchNodes(node *PipelineNode, path []string, match func(*PipelineNode) bool, matches *[]NodeMatch) {
+	path = append(path[:len(path):len(path)], node.ID)
+	if match(node) {
+		*matches = append(*matches, NodeMatch{
+			ID:        node.ID,
+			Name:      node.Name,
+			Operation: node.Operation,
+			Path:      path,
+		})
+	}
+
+	// Search in children
+	for i := range node.Children {
+		tc.searchNodes(&node.Children[i], path, match, matches)
+	}
+
+	// Search in else children
+	for i := range node.ElseChildren {
+		tc.searchNodes(&node.ElseChildren[i], path, match, matches)
+	}
+}
+
 // resolveNodeIdentifier resolves either a node ID or name to a node ID
 // First tries as ID, then tries as name
 // Must be called with appropriate locking (RLock or Lock) held
@@ -932,7 +1625,7 @@ func (tc *TextCleanerCore) resolveNodeIdentifier(identifier string) (string, err
 		return node.ID, nil
 	}
 
-	return "", fmt.Errorf("node not found: %s", identifier)
+	return "", fmt.Errorf("%w: %s", ErrNodeNotFound, identifier)
 }
 
 // deleteNodeByID recursively deletes a node by ID from the pipeline
@@ -992,6 +1685,36 @@ func (tc *TextCleanerCore) findMaxCounter(nodes *[]PipelineNode, maxCounter *int
 	}
 }
 
+// findSiblingList finds the list holding a node (the root pipeline, or a parent's children or else children)
+// Returns (list, index) or (nil, -1) if the node is not found
+func (tc *TextCleanerCore) findSiblingList(nodes *[]PipelineNode, nodeID string) (*[]PipelineNode, int) {
+	for i := range *nodes {
+		if (*nodes)[i].ID == nodeID {
+			return nodes, i
+		}
+
+		if list, idx := tc.findSiblingList(&(*nodes)[i].Children, nodeID); list != nil {
+			return list, idx
+		}
+
+		if list, idx := tc.findSiblingList(&(*nodes)[i].ElseChildren, nodeID); list != nil {
+			return list, idx
+		}
+	}
+	return nil, -1
+}
+
+// assignFreshIDs gives a copied node and all its descendants new IDs
+func (tc *TextCleanerCore) assignFreshIDs(node *PipelineNode) {
+	node.ID = tc.generateNodeID()
+	for i := range node.Children {
+		tc.assignFreshIDs(&node.Children[i])
+	}
+	for i := range node.ElseChildren {
+		tc.assignFreshIDs(&node.ElseChildren[i])
+	}
+}
+
 // findNodeParentAndIndex finds a node's parent and its index in the parent's children list
 // Returns (parentNode, index) or (nil, -1) if node is root-level or not found
 func (tc *TextCleanerCore) findNodeParentAndIndex(nodes *[]PipelineNode, nodeID string) (*PipelineNode, int) {
@@ -1,8 +1,21 @@
 package main
 
 import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"math/rand"
+	"reflect"
+	"runtime"
+	"slices"
+	"strconv"
 	"strings"
 	"testing"
+	"time"
 )
 
 // ============================================================================
@@ -53,7 +66,7 @@ func TestUpdateNode(t *testing.T) {
 	core := NewTextCleanerCore()
 	nodeID := core.CreateNode("operation", "Test", "Uppercase", "", "", "")
 
-	err := core.UpdateNode(nodeID, "Updated", "Replace Text", "arg1", "arg2", "")
+	err := core.UpdateNode(nodeID, "", "Updated", "Replace Text", "arg1", "arg2", "")
 	if err != nil {
 		t.Fatalf("Update should succeed, got error: %v", err)
 	}
@@ -74,12 +87,81 @@ func TestUpdateNode(t *testing.T) {
 func TestUpdateNonexistentNode(t *testing.T) {
 	core := NewTextCleanerCore()
 
-	err := core.UpdateNode("nonexistent", "Name", "Op", "", "", "")
+	err := core.UpdateNode("nonexistent", "", "Name", "Op", "", "", "")
 	if err == nil {
 		t.Error("Expected error when updating nonexistent node")
 	}
 }
 
+// TestUpdateNodeType tests changing a node from operation to group and back
+func TestUpdateNodeType(t *testing.T) {
+	core := NewTextCleanerCore()
+	nodeID := core.CreateNode("operation", "Upper", "Uppercase", "", "", "")
+	childID, _ := core.AddChildNode(nodeID, "operation", "Suffix", "Add Suffix", "!", "", "")
+	core.SetNodeLineBased(nodeID, true)
+	core.SetInputText("hello")
+
+	if err := core.UpdateNode(nodeID, "group", "Wrapper", "Uppercase", "x", "y", ""); err != nil {
+		t.Fatalf("UpdateNode failed: %v", err)
+	}
+	node := core.GetNode(nodeID)
+	if node.Type != "group" || node.Name != "Wrapper" {
+		t.Errorf("Expected a group named Wrapper, got %+v", node)
+	}
+	if node.Operation != "" || node.Arg1 != "" || node.Arg2 != "" || node.LineBased {
+		t.Errorf("Expected the operation fields to be cleared, got %+v", node)
+	}
+	if len(node.Children) != 1 || node.Children[0].ID != childID {
+		t.Errorf("Expected the children to be kept, got %+v", node.Children)
+	}
+	if got := core.GetOutputText(); got != "hello!" {
+		t.Errorf("Expected: %q, Got: %q", "hello!", got)
+	}
+
+	resp := executeForResponse(t, core, `{"action":"update_node","params":{"node_id":"`+nodeID+`","type":"operation","name":"","operation":"Uppercase"}}`)
+	if !resp.Success {
+		t.Fatalf("update_node failed: %s", resp.Error)
+	}
+	node = core.GetNode(nodeID)
+	if node.Type != "operation" || node.Name != "Uppercase" {
+		t.Errorf("Expected an operation named after its operation, got %+v", node)
+	}
+	if got := core.GetOutputText(); got != "HELLO!" {
+		t.Errorf("Expected: %q, Got: %q", "HELLO!", got)
+	}
+
+	// Leaving out the type keeps it
+	if err := core.UpdateNode(nodeID, "", "Lower", "Lowercase", "", "", ""); err != nil {
+		t.Fatalf("UpdateNode failed: %v", err)
+	}
+	if node = core.GetNode(nodeID); node.Type != "operation" {
+		t.Errorf("Expected the type to stay operation, got %q", node.Type)
+	}
+
+	resp = executeForResponse(t, core, `{"action":"update_node","params":{"node_id":"`+nodeID+`","type":"bogus"}}`)
+	if resp.Success || resp.Code != ErrCodeInvalidParam {
+		t.Errorf("Expected INVALID_PARAM for an unknown type, got %+v", resp)
+	}
+	if node = core.GetNode(nodeID); node.Name != "Lower" {
+		t.Errorf("Expected a rejected update to leave the node alone, got %+v", node)
+	}
+
+	// Converting an if node would lose its else branch, so it is refused
+	err := core.ImportPipeline(`[{"id": "node_10", "type": "if", "name": "Check", "condition": "x",
+		"else_children": [{"id": "node_11", "type": "operation", "name": "Lower", "operation": "Lowercase"}]}]`)
+	if err != nil {
+		t.Fatalf("ImportPipeline failed: %v", err)
+	}
+	ifID, elseID := "node_10", "node_11"
+	resp = executeForResponse(t, core, `{"action":"update_node","params":{"node_id":"`+ifID+`","type":"group","name":"Check"}}`)
+	if resp.Success || resp.Code != ErrCodeInvalidOperation {
+		t.Errorf("Expected INVALID_OPERATION for an if node with an else branch, got %+v", resp)
+	}
+	if node = core.GetNode(ifID); node.Type != "if" || node.Condition != "x" || len(node.ElseChildren) != 1 || node.ElseChildren[0].ID != elseID {
+		t.Errorf("Expected the if node and its else branch to be kept, got %+v", node)
+	}
+}
+
 // TestDeleteNode tests deleting a root-level node
 func TestDeleteNode(t *testing.T) {
 	core := NewTextCleanerCore()
@@ -182,6 +264,90 @@ func TestAddChildToNonexistentParent(t *testing.T) {
 	}
 }
 
+// collectNodeIDs returns every node ID in the tree, including else branches
+func collectNodeIDs(nodes []PipelineNode) []string {
+	var ids []string
+	for _, node := range nodes {
+		ids = append(ids, node.ID)
+		ids = append(ids, collectNodeIDs(node.Children)...)
+		ids = append(ids, collectNodeIDs(node.ElseChildren)...)
+	}
+	return ids
+}
+
+// assertUniqueNodeIDs fails the test if any node ID appears more than once
+func assertUniqueNodeIDs(t *testing.T, core *TextCleanerCore) {
+	t.Helper()
+	seen := make(map[string]bool)
+	for _, id := range collectNodeIDs(core.GetPipeline()) {
+		if seen[id] {
+			t.Errorf("Duplicate node ID: %s", id)
+		}
+		seen[id] = true
+	}
+}
+
+// TestChildIDNotReusedAfterDelete tests that a deleted child's ID isn't handed out again
+func TestChildIDNotReusedAfterDelete(t *testing.T) {
+	core := NewTextCleanerCore()
+
+	parentID := core.CreateNode("group", "Parent", "", "", "", "")
+	firstID, _ := core.AddChildNode(parentID, "operation", "First", "Uppercase", "", "", "")
+	secondID, _ := core.AddChildNode(parentID, "operation", "Second", "Lowercase", "", "", "")
+
+	if err := core.DeleteNode(firstID); err != nil {
+		t.Fatalf("Failed to delete child: %v", err)
+	}
+
+	newID, err := core.AddChildNode(parentID, "operation", "Third", "Trim", "", "", "")
+	if err != nil {
+		t.Fatalf("Failed to add child: %v", err)
+	}
+	if newID == firstID || newID == secondID {
+		t.Errorf("New child reused ID %s", newID)
+	}
+	assertUniqueNodeIDs(t, core)
+}
+
+// TestMovedSubtreesKeepUniqueIDs tests that IDs stay unique when subtrees move and new nodes are added
+func TestMovedSubtreesKeepUniqueIDs(t *testing.T) {
+	core := NewTextCleanerCore()
+
+	aID := core.CreateNode("group", "A", "", "", "", "")
+	core.AddChildNode(aID, "operation", "A1", "Uppercase", "", "", "")
+	bID := core.CreateNode("group", "B", "", "", "", "")
+	core.AddChildNode(bID, "operation", "B1", "Lowercase", "", "", "")
+
+	// Move B (with its child) under A, then add children to both
+	if err := core.IndentNode(bID); err != nil {
+		t.Fatalf("Failed to indent: %v", err)
+	}
+	core.AddChildNode(aID, "operation", "A2", "Trim", "", "", "")
+	core.AddChildNode(bID, "operation", "B2", "Trim", "", "", "")
+	core.CreateNode("operation", "C", "Trim", "", "", "")
+
+	assertUniqueNodeIDs(t, core)
+}
+
+// TestGenerateNodeIDSkipsExistingIDs tests that IDs from an imported pipeline are never handed out again
+func TestGenerateNodeIDSkipsExistingIDs(t *testing.T) {
+	core := NewTextCleanerCore()
+	err := core.ImportPipeline(`[
+		{"id": "node_0_child_0", "type": "group", "name": "Legacy", "children": [
+			{"id": "node_1", "type": "operation", "name": "X", "operation": "Trim"}
+		]}
+	]`)
+	if err != nil {
+		t.Fatalf("Import failed: %v", err)
+	}
+
+	for i := 0; i < 3; i++ {
+		core.AddChildNode("node_0_child_0", "operation", "New", "Trim", "", "", "")
+		core.CreateNode("operation", "Root", "Trim", "", "", "")
+	}
+	assertUniqueNodeIDs(t, core)
+}
+
 // TestAddMultipleChildren tests adding multiple children to a parent
 func TestAddMultipleChildren(t *testing.T) {
 	core := NewTextCleanerCore()
@@ -255,6 +421,86 @@ func TestEmptyPipelineProcessing(t *testing.T) {
 	}
 }
 
+// TestOutputTextCached tests that GetOutputText doesn't reprocess an unchanged pipeline
+func TestOutputTextCached(t *testing.T) {
+	// A counting operation, registered as a random one so seeded runs look it up
+	calls := 0
+	randomOperations["Count Calls"] = func(rng *rand.Rand, input, arg1, arg2 string) string {
+		calls++
+		return strings.ToUpper(input)
+	}
+	t.Cleanup(func() { delete(randomOperations, "Count Calls") })
+
+	core := NewTextCleanerCore()
+	core.SetSeed(1)
+	core.CreateNode("operation", "Upper", "Count Calls", "", "", "")
+	core.SetInputText("hello")
+
+	first := core.GetOutputText()
+	for i := 0; i < 5; i++ {
+		if output := core.GetOutputText(); output != first {
+			t.Fatalf("Expected cached output '%s', got '%s'", first, output)
+		}
+	}
+	if first != "HELLO" || calls != 1 {
+		t.Errorf("Expected the pipeline to run once, ran %d times with output %q", calls, first)
+	}
+
+	core.SetInputText("now")
+	if output := core.GetOutputText(); output != "NOW" {
+		t.Errorf("Expected output to be reprocessed after input change, got '%s'", output)
+	}
+	if calls != 2 {
+		t.Errorf("Expected the pipeline to run again after input change, ran %d times", calls)
+	}
+}
+
+// TestMutatorsMarkOutputDirty tests that every pipeline change invalidates the cached output
+func TestMutatorsMarkOutputDirty(t *testing.T) {
+	core := NewTextCleanerCore()
+	core.SetInputText("hello")
+
+	first := core.CreateNode("operation", "Uppercase", "Uppercase", "", "", "")
+	second := core.CreateNode("group", "Group", "", "", "", "")
+
+	mutations := []struct {
+		name string
+		fn   func() error
+	}{
+		{"SetInputText", func() error { core.SetInputText("hello world"); return nil }},
+		{"CreateNode", func() error { core.CreateNode("operation", "Trim", "Trim", "", "", ""); return nil }},
+		{"UpdateNode", func() error { return core.UpdateNode(first, "", "Upper", "Uppercase", "", "", "") }},
+		{"AddChildNode", func() error {
+			_, err := core.AddChildNode(second, "operation", "Lowercase", "Lowercase", "", "", "")
+			return err
+		}},
+		{"MoveNodeDown", func() error { return core.MoveNodeDown(first) }},
+		{"MoveNodeUp", func() error { return core.MoveNodeUp(first) }},
+		{"MoveNodeToPosition", func() error { return core.MoveNodeToPosition(first, "", 1) }},
+		{"DeleteNode", func() error { return core.DeleteNode(first) }},
+		{"ImportPipeline", func() error {
+			return core.ImportPipeline(`[{"id":"node_0","type":"operation","name":"Uppercase","operation":"Uppercase"}]`)
+		}},
+	}
+
+	for _, m := range mutations {
+		core.GetOutputText()
+		if core.dirty {
+			t.Fatalf("Expected clean output before %s", m.name)
+		}
+		if err := m.fn(); err != nil {
+			t.Fatalf("%s failed: %v", m.name, err)
+		}
+		if !core.dirty {
+			t.Errorf("Expected %s to mark output dirty", m.name)
+		}
+	}
+
+	if output := core.GetOutputText(); output != "HELLO WORLD" {
+		t.Errorf("Expected 'HELLO WORLD', got '%s'", output)
+	}
+}
+
 // TestIfNodeTrueBranch tests if node that matches the pattern
 func TestIfNodeTrueBranch(t *testing.T) {
 	core := NewTextCleanerCore()
@@ -298,6 +544,167 @@ func TestForEachLineOperation(t *testing.T) {
 	}
 }
 
+// TestForEachParagraph tests foreach over blank-line separated paragraphs
+func TestForEachParagraph(t *testing.T) {
+	core := NewTextCleanerCore()
+	forEachID := core.CreateNode("foreach", "ForEach", "", "paragraph", "", "")
+	core.AddChildNode(forEachID, "operation", "Join List", "Join List", " ", "", "")
+
+	core.SetInputText("first line\nsecond line\n\nnext para\nends here")
+
+	output := core.GetOutputText()
+	expected := "first line second line\n\nnext para ends here"
+	if output != expected {
+		t.Errorf("Expected '%s', got '%s'", expected, output)
+	}
+
+	// Several blank lines, or lines of only whitespace, separate paragraphs too and are kept as they are
+	core.SetInputText("first line\nsecond line\n  \n\t\nnext para\nends here\n\n\nlast\npara")
+	expected = "first line second line\n  \n\t\nnext para ends here\n\n\nlast para"
+	if output := core.GetOutputText(); output != expected {
+		t.Errorf("Expected '%s', got '%s'", expected, output)
+	}
+	childID := core.GetNode(forEachID).Children[0].ID
+	if output := core.GetOutputTextAtNode(childID); output != expected {
+		t.Errorf("Expected '%s' at node, got '%s'", expected, output)
+	}
+
+	// Windows line endings stay with the separator instead of ending the paragraph before it
+	core = NewTextCleanerCore()
+	forEachID = core.CreateNode("foreach", "ForEach", "", "paragraph", "", "")
+	core.AddChildNode(forEachID, "operation", "Suffix", "Add Suffix", ".", "", "")
+	core.SetInputText("first\r\n\r\nsecond")
+	if output := core.GetOutputText(); output != "first.\r\n\r\nsecond." {
+		t.Errorf("Expected: %q, Got: %q", "first.\r\n\r\nsecond.", output)
+	}
+}
+
+// TestForEachCustomSeparator tests foreach over a comma-separated list
+func TestForEachCustomSeparator(t *testing.T) {
+	core := NewTextCleanerCore()
+	forEachID := core.CreateNode("foreach", "ForEach", "", ",", "", "")
+	core.AddChildNode(forEachID, "operation", "Trim", "Trim", "", "", "")
+	core.AddChildNode(forEachID, "operation", "Uppercase", "Uppercase", "", "", "")
+
+	core.SetInputText("apple, banana ,cherry")
+
+	output := core.GetOutputText()
+	expected := "APPLE,BANANA,CHERRY"
+	if output != expected {
+		t.Errorf("Expected '%s', got '%s'", expected, output)
+	}
+
+	// Partial output runs the records the same way
+	childID := core.GetNode(forEachID).Children[0].ID
+	if got := core.GetOutputTextAtNode(childID); got != "apple,banana,cherry" {
+		t.Errorf("Expected 'apple,banana,cherry' at node, got '%s'", got)
+	}
+}
+
+// TestCaptureVariable tests capturing a child's output and injecting it into later nodes
+func TestCaptureVariable(t *testing.T) {
+	core := NewTextCleanerCore()
+	captureID := core.CreateNode("capture", "", "", "title", "", "")
+	headID, _ := core.AddChildNode(captureID, "operation", "First Line", "Head Lines", "1", "", "")
+	forEachID := core.CreateNode("foreach", "ForEach", "", "", "", "")
+	core.AddChildNode(forEachID, "operation", "Prefix", "Add Prefix", "${var:title}: ", "", "")
+
+	core.SetInputText("Doc\na\nb")
+
+	if name := core.GetNode(captureID).Name; name != "Capture: title" {
+		t.Errorf("Expected default name 'Capture: title', got '%s'", name)
+	}
+
+	// The capture passes its input through, so only the prefix changes the text
+	output := core.GetOutputText()
+	expected := "Doc: Doc\nDoc: a\nDoc: b"
+	if output != expected {
+		t.Errorf("Expected '%s', got '%s'", expected, output)
+	}
+
+	// Partial output inside the capture shows the value being captured
+	if got := core.GetOutputTextAtNode(headID); got != "Doc" {
+		t.Errorf("Expected 'Doc' at node, got '%s'", got)
+	}
+}
+
+// TestCaptureInputAndUnknownVariable tests capturing the input itself and leaving unknown references alone
+func TestCaptureInputAndUnknownVariable(t *testing.T) {
+	core := NewTextCleanerCore()
+	core.CreateNode("capture", "Keep Original", "", "original", "", "")
+	core.CreateNode("operation", "Upper", "Uppercase", "", "", "")
+	core.CreateNode("operation", "Surround", "Surround Text", "${var:original} -> ", " ${var:missing}", "")
+
+	core.SetInputText("hello")
+
+	output := core.GetOutputText()
+	expected := "hello -> HELLO ${var:missing}"
+	if output != expected {
+		t.Errorf("Expected '%s', got '%s'", expected, output)
+	}
+}
+
+// TestSubroutineRunsPreset tests a subroutine node running a saved preset
+func TestSubroutineRunsPreset(t *testing.T) {
+	core := NewTextCleanerCore()
+	core.CreateNode("operation", "Trim", "Trim", "", "", "")
+	core.CreateNode("operation", "Upper", "Uppercase", "", "", "")
+	if err := core.SavePreset("shout"); err != nil {
+		t.Fatalf("SavePreset failed: %v", err)
+	}
+
+	err := core.ImportPipeline(`[
+		{"id": "node_0", "type": "subroutine", "name": "Shout", "arg1": "shout", "children": []},
+		{"id": "node_1", "type": "operation", "name": "Bang", "operation": "Add Suffix", "arg1": "!", "children": []}
+	]`)
+	if err != nil {
+		t.Fatalf("Import failed: %v", err)
+	}
+	core.SetInputText("  hello  ")
+
+	// The preset is a copy, so replacing the pipeline doesn't change it
+	if output := core.GetOutputText(); output != "HELLO!" {
+		t.Errorf("Expected 'HELLO!', got '%s'", output)
+	}
+
+	if got := core.ListPresets(); len(got) != 1 || got[0] != "shout" {
+		t.Errorf("Expected presets [shout], got %v", got)
+	}
+	if err := core.DeletePreset("shout"); err != nil {
+		t.Fatalf("DeletePreset failed: %v", err)
+	}
+	if output := core.GetOutputText(); output != "  hello  !" {
+		t.Errorf("Expected missing preset to pass text through, got '%s'", output)
+	}
+	if err := core.DeletePreset("shout"); !errors.Is(err, ErrPresetNotFound) {
+		t.Errorf("Expected ErrPresetNotFound, got %v", err)
+	}
+}
+
+// TestSubroutineRecursionGuard tests that presets calling themselves fail instead of recursing forever
+func TestSubroutineRecursionGuard(t *testing.T) {
+	core := NewTextCleanerCore()
+
+	// "a" calls "b", which calls "a"
+	core.CreateNode("subroutine", "", "", "b", "", "")
+	core.SavePreset("a")
+	core.ImportPipeline(`[{"id": "node_0", "type": "subroutine", "arg1": "a", "children": []}]`)
+	core.SavePreset("b")
+	core.SetInputText("text")
+
+	if _, err := core.GetOutputTextWithError(); !errors.Is(err, ErrSubroutineRecursion) {
+		t.Errorf("Expected ErrSubroutineRecursion, got %v", err)
+	}
+
+	resp := executeForResponse(t, core, `{"action":"get_output_text"}`)
+	if resp.Success || resp.Code != ErrCodeInvalidOperation {
+		t.Errorf("Expected %s error, got %+v", ErrCodeInvalidOperation, resp)
+	}
+	if !strings.Contains(resp.Error, "a -> b") {
+		t.Errorf("Expected error to show the call chain, got %q", resp.Error)
+	}
+}
+
 // TestGroupOperation tests group node structure
 func TestGroupOperation(t *testing.T) {
 	core := NewTextCleanerCore()
@@ -313,6 +720,98 @@ func TestGroupOperation(t *testing.T) {
 	}
 }
 
+// ifElsePipelineJSON is an if node with two steps in each branch, followed by a root node
+const ifElsePipelineJSON = `[
+	{"id": "node_0", "type": "if", "name": "If", "condition": "^hello",
+	 "children": [
+		{"id": "node_1", "type": "operation", "name": "Upper", "operation": "Uppercase", "children": []},
+		{"id": "node_2", "type": "operation", "name": "Wrap", "operation": "Replace Text", "arg1": "HELLO", "arg2": "[HELLO]", "children": []}
+	 ],
+	 "else_children": [
+		{"id": "node_3", "type": "operation", "name": "Reverse", "operation": "Replace Text", "arg1": "bye", "arg2": "eyb", "children": []},
+		{"id": "node_4", "type": "operation", "name": "Upper", "operation": "Uppercase", "children": []}
+	 ]},
+	{"id": "node_5", "type": "operation", "name": "Suffix", "operation": "Replace Text", "arg1": "!", "arg2": "?", "children": []}
+]`
+
+// TestOutputTextAtNodeInThenBranch tests partial output for nodes inside the then branch
+func TestOutputTextAtNodeInThenBranch(t *testing.T) {
+	core := NewTextCleanerCore()
+	if err := core.ImportPipeline(ifElsePipelineJSON); err != nil {
+		t.Fatalf("Import failed: %v", err)
+	}
+	core.SetInputText("hello!")
+
+	tests := []struct {
+		nodeID   string
+		expected string
+	}{
+		{"node_1", "HELLO!"},
+		{"node_2", "[HELLO]!"},
+		{"node_0", "[HELLO]!"},
+		{"node_5", "[HELLO]?"},
+		// The else branch is skipped for matching input, so text passes through unchanged
+		{"node_3", "hello!"},
+		{"node_4", "hello!"},
+	}
+
+	for _, tt := range tests {
+		if got := core.GetOutputTextAtNode(tt.nodeID); got != tt.expected {
+			t.Errorf("At %s: expected %q, got %q", tt.nodeID, tt.expected, got)
+		}
+	}
+
+	if got := core.GetOutputText(); got != core.GetOutputTextAtNode("node_5") {
+		t.Errorf("Output at the last node should match the full output %q, got %q", core.GetOutputText(), got)
+	}
+}
+
+// TestOutputTextAtNodeInElseBranch tests partial output for nodes inside the else branch
+func TestOutputTextAtNodeInElseBranch(t *testing.T) {
+	core := NewTextCleanerCore()
+	if err := core.ImportPipeline(ifElsePipelineJSON); err != nil {
+		t.Fatalf("Import failed: %v", err)
+	}
+	core.SetInputText("goodbye!")
+
+	tests := []struct {
+		nodeID   string
+		expected string
+	}{
+		// Only the first else step has run, not the rest of the branch
+		{"node_3", "goodeyb!"},
+		{"node_4", "GOODEYB!"},
+		{"node_0", "GOODEYB!"},
+		{"node_5", "GOODEYB?"},
+		// The then branch is skipped for non-matching input
+		{"node_1", "goodbye!"},
+		{"node_2", "goodbye!"},
+	}
+
+	for _, tt := range tests {
+		if got := core.GetOutputTextAtNode(tt.nodeID); got != tt.expected {
+			t.Errorf("At %s: expected %q, got %q", tt.nodeID, tt.expected, got)
+		}
+	}
+
+	if got := core.GetOutputText(); got != "GOODEYB?" {
+		t.Errorf("Expected full output 'GOODEYB?', got %q", got)
+	}
+}
+
+// TestOutputTextAtNodeInForEach tests that partial output inside a foreach applies to every line
+func TestOutputTextAtNodeInForEach(t *testing.T) {
+	core := NewTextCleanerCore()
+	forEachID := core.CreateNode("foreach", "Lines", "", "", "", "")
+	firstID, _ := core.AddChildNode(forEachID, "operation", "Upper", "Uppercase", "", "", "")
+	core.AddChildNode(forEachID, "operation", "Prefix", "Replace Text", "A", "-", "")
+	core.SetInputText("abc\nbca")
+
+	if got := core.GetOutputTextAtNode(firstID); got != "ABC\nBCA" {
+		t.Errorf("Expected 'ABC\\nBCA', got %q", got)
+	}
+}
+
 // ============================================================================
 // Import/Export Tests
 // ============================================================================
@@ -390,6 +889,116 @@ func TestImportInvalidJSON(t *testing.T) {
 	}
 }
 
+// TestImportDuplicateID tests that a duplicate ID is replaced with a fresh unique ID
+func TestImportDuplicateID(t *testing.T) {
+	core := NewTextCleanerCore()
+
+	err := core.ImportPipeline(`[
+		{"id": "node_1", "type": "operation", "name": "A", "operation": "Uppercase"},
+		{"id": "node_1", "type": "group", "name": "B", "children": [
+			{"id": "node_1", "type": "operation", "name": "C", "operation": "Trim"}
+		]}
+	]`)
+	if err != nil {
+		t.Fatalf("Import should repair duplicate IDs, got error: %v", err)
+	}
+
+	pipeline := core.GetPipeline()
+	first, second, child := pipeline[0].ID, pipeline[1].ID, pipeline[1].Children[0].ID
+	if first != "node_1" {
+		t.Errorf("Expected the first node to keep its ID, got %s", first)
+	}
+	if second == first || child == first || child == second {
+		t.Errorf("Expected unique IDs, got %s, %s, %s", first, second, child)
+	}
+
+	// New nodes must not collide with the repaired IDs
+	newID := core.CreateNode("operation", "D", "Lowercase", "", "", "")
+	if newID == first || newID == second || newID == child {
+		t.Errorf("New node reused an existing ID: %s", newID)
+	}
+}
+
+// TestImportBlankID tests that nodes without an ID get a fresh one and UI type names are normalized
+func TestImportBlankID(t *testing.T) {
+	core := NewTextCleanerCore()
+
+	err := core.ImportPipeline(`[
+		{"id": "node_3", "type": "operation", "name": "A", "operation": "Uppercase"},
+		{"id": "", "type": "Group", "name": "B", "children": [
+			{"type": "operation", "name": "C", "operation": "Trim"}
+		]}
+	]`)
+	if err != nil {
+		t.Fatalf("Import should assign missing IDs, got error: %v", err)
+	}
+
+	pipeline := core.GetPipeline()
+	if pipeline[1].ID == "" || pipeline[1].Children[0].ID == "" {
+		t.Fatalf("Expected blank IDs to be filled, got %q and %q", pipeline[1].ID, pipeline[1].Children[0].ID)
+	}
+	if pipeline[1].ID == "node_3" || pipeline[1].ID == pipeline[1].Children[0].ID {
+		t.Errorf("Expected fresh unique IDs, got %q and %q", pipeline[1].ID, pipeline[1].Children[0].ID)
+	}
+	if pipeline[1].Type != "group" {
+		t.Errorf("Expected type 'Group' to be normalized to 'group', got %q", pipeline[1].Type)
+	}
+	if core.GetNode(pipeline[1].Children[0].ID) == nil {
+		t.Error("Expected the child to be reachable by its new ID")
+	}
+}
+
+// TestImportUnknownType tests that unknown node types are rejected with every problem listed
+func TestImportUnknownType(t *testing.T) {
+	core := NewTextCleanerCore()
+	existingID := core.CreateNode("operation", "Keep", "Uppercase", "", "", "")
+
+	err := core.ImportPipeline(`[
+		{"id": "node_1", "type": "loop", "name": "Bad"},
+		{"id": "node_2", "type": "group", "name": "G", "children": [
+			{"id": "node_3", "type": "", "name": "Blank"},
+			{"id": "node_4", "type": "repeat", "name": "Worse"}
+		]}
+	]`)
+	if !errors.Is(err, ErrInvalidPipeline) {
+		t.Fatalf("Expected ErrInvalidPipeline, got %v", err)
+	}
+	for _, want := range []string{`node 1 "Bad": unknown type "loop"`, `node 2.2 "Worse": unknown type "repeat"`} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("Expected error to mention %q, got %q", want, err.Error())
+		}
+	}
+	if strings.Contains(err.Error(), "Blank") {
+		t.Errorf("Expected a node without a type not to be a problem, got %q", err.Error())
+	}
+
+	// A rejected import leaves the pipeline untouched
+	if pipeline := core.GetPipeline(); len(pipeline) != 1 || pipeline[0].ID != existingID {
+		t.Errorf("Expected the original pipeline to be kept, got %+v", pipeline)
+	}
+}
+
+// TestImportUntypedNode tests that nodes without a type are imported as operations, like in Apply Pipeline
+func TestImportUntypedNode(t *testing.T) {
+	core := NewTextCleanerCore()
+	err := core.ImportPipeline(`[
+		{"name": "Upper", "operation": "Uppercase"},
+		{"type": "group", "children": [{"type": "", "name": "Suffix", "operation": "Add Suffix", "arg1": "!"}]}
+	]`)
+	if err != nil {
+		t.Fatalf("ImportPipeline failed: %v", err)
+	}
+
+	pipeline := core.GetPipeline()
+	if pipeline[0].Type != "operation" || pipeline[1].Children[0].Type != "operation" {
+		t.Errorf("Expected untyped nodes to become operations, got %+v", pipeline)
+	}
+	core.SetInputText("hi")
+	if got := core.GetOutputText(); got != "HI!" {
+		t.Errorf("Expected: %q, Got: %q", "HI!", got)
+	}
+}
+
 // ============================================================================
 // Edge Cases Tests
 // ============================================================================
@@ -507,14 +1116,14 @@ func TestMultipleSelectionsAndUpdates(t *testing.T) {
 		t.Error("Selected node should be id1")
 	}
 
-	core.UpdateNode(id1, "Updated1", "Replace", "a", "b", "")
+	core.UpdateNode(id1, "", "Updated1", "Replace", "a", "b", "")
 
 	core.SelectNode(id2)
 	if core.GetSelectedNodeID() != id2 {
 		t.Error("Selected node should be id2")
 	}
 
-	core.UpdateNode(id2, "Updated2", "Uppercase", "", "", "")
+	core.UpdateNode(id2, "", "Updated2", "Uppercase", "", "", "")
 
 	node1 := core.GetNode(id1)
 	if node1.Name != "Updated1" {
@@ -682,43 +1291,1251 @@ func TestMoveNodeDown(t *testing.T) {
 	}
 }
 
-// TestCanIndentNode tests the CanIndentNode predicate
-func TestCanIndentNode(t *testing.T) {
-	core := NewTextCleanerCore()
+// nodeNames returns the names of a list of nodes, for asserting order
+func nodeNames(nodes []PipelineNode) string {
+	names := make([]string, len(nodes))
+	for i, node := range nodes {
+		names[i] = node.Name
+	}
+	return strings.Join(names, ",")
+}
 
-	id1 := core.CreateNode("operation", "Op1", "Uppercase", "", "", "")
-	id2 := core.CreateNode("operation", "Op2", "Lowercase", "", "", "")
+// TestMoveNodeToPositionSameParent tests moving forward and backward within one list
+func TestMoveNodeToPositionSameParent(t *testing.T) {
+	tests := []struct {
+		move     string
+		position int
+		expected string
+	}{
+		{"A", 3, "B,C,A,D"},  // Forward: insert before D
+		{"A", 4, "B,C,D,A"},  // Forward to the end
+		{"A", 1, "A,B,C,D"},  // Before its own next sibling: no change
+		{"D", 1, "A,D,B,C"},  // Backward
+		{"C", 0, "C,A,B,D"},  // Backward to the start
+		{"B", -1, "A,C,D,B"}, // Negative appends
+	}
+
+	for _, tt := range tests {
+		// Root level
+		core := NewTextCleanerCore()
+		ids := map[string]string{}
+		for _, name := range []string{"A", "B", "C", "D"} {
+			ids[name] = core.CreateNode("operation", name, "Identity", "", "", "")
+		}
+		if err := core.MoveNodeToPosition(ids[tt.move], "", tt.position); err != nil {
+			t.Fatalf("Move %s to %d failed: %v", tt.move, tt.position, err)
+		}
+		if got := nodeNames(core.GetPipeline()); got != tt.expected {
+			t.Errorf("Root: move %s to %d: expected %s, got %s", tt.move, tt.position, tt.expected, got)
+		}
 
-	// Can indent id2 (has previous sibling)
-	if !core.CanIndentNode(id2) {
-		t.Error("Should be able to indent id2")
+		// Inside a parent
+		core = NewTextCleanerCore()
+		parentID := core.CreateNode("group", "P", "", "", "", "")
+		for _, name := range []string{"A", "B", "C", "D"} {
+			ids[name], _ = core.AddChildNode(parentID, "operation", name, "Identity", "", "", "")
+		}
+		if err := core.MoveNodeToPosition(ids[tt.move], parentID, tt.position); err != nil {
+			t.Fatalf("Move %s to %d failed: %v", tt.move, tt.position, err)
+		}
+		if got := nodeNames(core.GetNode(parentID).Children); got != tt.expected {
+			t.Errorf("Child: move %s to %d: expected %s, got %s", tt.move, tt.position, tt.expected, got)
+		}
 	}
+}
 
-	// Cannot indent id1 (no previous sibling)
-	if core.CanIndentNode(id1) {
-		t.Error("Should not be able to indent id1")
+// TestMoveNodeToPositionAcrossParents tests moving between parents and to the root
+func TestMoveNodeToPositionAcrossParents(t *testing.T) {
+	core := NewTextCleanerCore()
+	p1 := core.CreateNode("group", "P1", "", "", "", "")
+	a, _ := core.AddChildNode(p1, "operation", "A", "Identity", "", "", "")
+	core.AddChildNode(p1, "operation", "B", "Identity", "", "", "")
+	p2 := core.CreateNode("group", "P2", "", "", "", "")
+	core.AddChildNode(p2, "operation", "X", "Identity", "", "", "")
+	core.AddChildNode(p2, "operation", "Y", "Identity", "", "", "")
+
+	if err := core.MoveNodeToPosition(a, p2, 1); err != nil {
+		t.Fatalf("Move failed: %v", err)
+	}
+	if got := nodeNames(core.GetNode(p1).Children); got != "B" {
+		t.Errorf("Expected P1 children B, got %s", got)
+	}
+	if got := nodeNames(core.GetNode(p2).Children); got != "X,A,Y" {
+		t.Errorf("Expected P2 children X,A,Y, got %s", got)
 	}
 
-	// Cannot indent root level node that doesn't exist
-	if core.CanIndentNode("nonexistent") {
-		t.Error("Should not be able to indent nonexistent node")
+	if err := core.MoveNodeToPosition(a, "", 1); err != nil {
+		t.Fatalf("Move to root failed: %v", err)
+	}
+	if got := nodeNames(core.GetPipeline()); got != "P1,A,P2" {
+		t.Errorf("Expected root P1,A,P2, got %s", got)
+	}
+
+	// A missing parent is an error and leaves the node where it was
+	if err := core.MoveNodeToPosition(a, "missing", 0); !errors.Is(err, ErrNodeNotFound) {
+		t.Errorf("Expected ErrNodeNotFound, got %v", err)
+	}
+	if got := nodeNames(core.GetPipeline()); got != "P1,A,P2" {
+		t.Errorf("Expected root unchanged after failed move, got %s", got)
 	}
 }
 
-// TestCanUnindentNode tests the CanUnindentNode predicate
-func TestCanUnindentNode(t *testing.T) {
+// TestMoveNodeIntoElseDescendant tests that a node can't be moved under a grandchild in its else branch
+func TestMoveNodeIntoElseDescendant(t *testing.T) {
 	core := NewTextCleanerCore()
+	err := core.ImportPipeline(`[
+		{"id": "node_0", "type": "if", "name": "If", "condition": "x",
+		 "children": [],
+		 "else_children": [
+			{"id": "node_1", "type": "group", "name": "Group",
+			 "children": [
+				{"id": "node_2", "type": "group", "name": "Inner", "children": []}
+			 ]}
+		 ]}
+	]`)
+	if err != nil {
+		t.Fatalf("Import failed: %v", err)
+	}
 
-	parentID := core.CreateNode("operation", "Parent", "Uppercase", "", "", "")
-	childID, _ := core.AddChildNode(parentID, "operation", "Child", "Lowercase", "", "", "")
-
-	// Can unindent child
-	if !core.CanUnindentNode(childID) {
-		t.Error("Should be able to unindent child")
+	for _, target := range []string{"node_1", "node_2"} {
+		if err := core.MoveNodeToPosition("node_0", target, 0); err == nil {
+			t.Errorf("Expected error moving node_0 into %s", target)
+		}
 	}
 
-	// Cannot unindent root level node
-	if core.CanUnindentNode(parentID) {
+	pipeline := core.GetPipeline()
+	if len(pipeline) != 1 || pipeline[0].ID != "node_0" {
+		t.Fatalf("Expected pipeline unchanged, got %s", nodeNames(pipeline))
+	}
+	if got := nodeNames(pipeline[0].ElseChildren); got != "Group" {
+		t.Errorf("Expected else branch unchanged, got %s", got)
+	}
+}
+
+// TestMoveNodeOutOfElseBranch tests moving an else-branch node removes it from the else branch
+func TestMoveNodeOutOfElseBranch(t *testing.T) {
+	core := NewTextCleanerCore()
+	if err := core.ImportPipeline(ifElsePipelineJSON); err != nil {
+		t.Fatalf("Import failed: %v", err)
+	}
+
+	if err := core.MoveNodeToPosition("node_3", "", -1); err != nil {
+		t.Fatalf("Move failed: %v", err)
+	}
+
+	ifNode := core.GetNode("node_0")
+	if got := nodeNames(ifNode.Children); got != "Upper,Wrap" {
+		t.Errorf("Expected then branch Upper,Wrap, got %s", got)
+	}
+	if got := nodeNames(ifNode.ElseChildren); got != "Upper" {
+		t.Errorf("Expected else branch Upper, got %s", got)
+	}
+	if got := nodeNames(core.GetPipeline()); got != "If,Suffix,Reverse" {
+		t.Errorf("Expected root If,Suffix,Reverse, got %s", got)
+	}
+	assertUniqueNodeIDs(t, core)
+}
+
+// TestDuplicateNode tests copying nodes with their children at the root and in an else branch
+func TestDuplicateNode(t *testing.T) {
+	core := NewTextCleanerCore()
+	if err := core.ImportPipeline(ifElsePipelineJSON); err != nil {
+		t.Fatalf("Import failed: %v", err)
+	}
+
+	copyID, err := core.DuplicateNode("node_0")
+	if err != nil {
+		t.Fatalf("Duplicate failed: %v", err)
+	}
+	if got := nodeNames(core.GetPipeline()); got != "If,If,Suffix" {
+		t.Errorf("Expected root If,If,Suffix, got %s", got)
+	}
+	duplicate := core.GetNode(copyID)
+	if duplicate == nil || nodeNames(duplicate.Children) != "Upper,Wrap" || nodeNames(duplicate.ElseChildren) != "Reverse,Upper" {
+		t.Errorf("Expected the copy to keep both branches, got %+v", duplicate)
+	}
+
+	if _, err := core.DuplicateNode("node_3"); err != nil {
+		t.Fatalf("Duplicate failed: %v", err)
+	}
+	if got := nodeNames(core.GetNode("node_0").ElseChildren); got != "Reverse,Reverse,Upper" {
+		t.Errorf("Expected else branch Reverse,Reverse,Upper, got %s", got)
+	}
+	assertUniqueNodeIDs(t, core)
+
+	if _, err := core.DuplicateNode("missing"); !errors.Is(err, ErrNodeNotFound) {
+		t.Errorf("Expected ErrNodeNotFound, got %v", err)
+	}
+}
+
+// TestDisableNode tests that disabled nodes pass their input through, in full and partial output
+func TestDisableNode(t *testing.T) {
+	core := NewTextCleanerCore()
+	if err := core.ImportPipeline(ifElsePipelineJSON); err != nil {
+		t.Fatalf("Import failed: %v", err)
+	}
+	core.SetInputText("hello!")
+
+	if err := core.SetNodeEnabled("node_1", false); err != nil {
+		t.Fatalf("Disable failed: %v", err)
+	}
+	if got := core.GetOutputText(); got != "hello?" {
+		t.Errorf("Expected: %q, Got: %q", "hello?", got)
+	}
+	if got := core.GetOutputTextAtNode("node_1"); got != "hello!" {
+		t.Errorf("Expected disabled node to pass input through, got %q", got)
+	}
+
+	// Nothing inside a disabled if node runs
+	resp := executeForResponse(t, core, `{"action":"disable_node","params":{"node_id":"node_0"}}`)
+	if !resp.Success {
+		t.Fatalf("disable_node failed: %s", resp.Error)
+	}
+	core.SetNodeEnabled("node_1", true)
+	if got := core.GetOutputTextAtNode("node_2"); got != "hello!" {
+		t.Errorf("Expected: %q, Got: %q", "hello!", got)
+	}
+	if got := core.GetOutputText(); got != "hello?" {
+		t.Errorf("Expected: %q, Got: %q", "hello?", got)
+	}
+
+	resp = executeForResponse(t, core, `{"action":"enable_node","params":{"node_id":"node_0"}}`)
+	if !resp.Success {
+		t.Fatalf("enable_node failed: %s", resp.Error)
+	}
+	if got := core.GetOutputText(); got != "[HELLO]?" {
+		t.Errorf("Expected: %q, Got: %q", "[HELLO]?", got)
+	}
+}
+
+// TestClearPipeline tests that clearing removes all nodes but keeps the input text
+func TestClearPipeline(t *testing.T) {
+	core := NewTextCleanerCore()
+	if err := core.ImportPipeline(ifElsePipelineJSON); err != nil {
+		t.Fatalf("Import failed: %v", err)
+	}
+	core.SetInputText("hello!")
+	core.SelectNode("node_1")
+
+	resp := executeForResponse(t, core, `{"action":"clear_pipeline","params":{}}`)
+	if !resp.Success {
+		t.Fatalf("clear_pipeline failed: %s", resp.Error)
+	}
+	if len(core.GetPipeline()) != 0 || core.GetSelectedNodeID() != "" {
+		t.Errorf("Expected an empty pipeline and no selection")
+	}
+	if got := core.GetOutputText(); got != "hello!" {
+		t.Errorf("Expected: %q, Got: %q", "hello!", got)
+	}
+	if id := core.CreateNode("operation", "Upper", "Uppercase", "", "", ""); id != "node_0" {
+		t.Errorf("Expected IDs to start over at node_0, got %s", id)
+	}
+}
+
+// TestCanIndentNode tests the CanIndentNode predicate
+func TestCanIndentNode(t *testing.T) {
+	core := NewTextCleanerCore()
+
+	id1 := core.CreateNode("operation", "Op1", "Uppercase", "", "", "")
+	id2 := core.CreateNode("operation", "Op2", "Lowercase", "", "", "")
+
+	// Can indent id2 (has previous sibling)
+	if !core.CanIndentNode(id2) {
+		t.Error("Should be able to indent id2")
+	}
+
+	// Cannot indent id1 (no previous sibling)
+	if core.CanIndentNode(id1) {
+		t.Error("Should not be able to indent id1")
+	}
+
+	// Cannot indent root level node that doesn't exist
+	if core.CanIndentNode("nonexistent") {
+		t.Error("Should not be able to indent nonexistent node")
+	}
+}
+
+// TestCanUnindentNode tests the CanUnindentNode predicate
+func TestCanUnindentNode(t *testing.T) {
+	core := NewTextCleanerCore()
+
+	parentID := core.CreateNode("operation", "Parent", "Uppercase", "", "", "")
+	childID, _ := core.AddChildNode(parentID, "operation", "Child", "Lowercase", "", "", "")
+
+	// Can unindent child
+	if !core.CanUnindentNode(childID) {
+		t.Error("Should be able to unindent child")
+	}
+
+	// Cannot unindent root level node
+	if core.CanUnindentNode(parentID) {
 		t.Error("Should not be able to unindent root level node")
 	}
 }
+
+// ============================================================================
+// Command Error Code Tests
+// ============================================================================
+
+// executeForResponse runs a command and decodes the JSON response
+func executeForResponse(t *testing.T, core *TextCleanerCore, command string) Response {
+	t.Helper()
+
+	var resp Response
+	if err := json.Unmarshal([]byte(core.ExecuteCommand(command)), &resp); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	return resp
+}
+
+// TestErrorCodeNodeNotFound tests that commands on a missing node report NODE_NOT_FOUND
+func TestErrorCodeNodeNotFound(t *testing.T) {
+	core := NewTextCleanerCore()
+
+	commands := []string{
+		`{"action":"get_node","params":{"node_id":"missing"}}`,
+		`{"action":"update_node","params":{"node_id":"missing","name":"X"}}`,
+		`{"action":"delete_node","params":{"node_id":"missing"}}`,
+		`{"action":"add_child_node","params":{"parent_id":"missing","type":"operation"}}`,
+	}
+
+	for _, command := range commands {
+		resp := executeForResponse(t, core, command)
+		if resp.Success {
+			t.Errorf("Expected failure for %s", command)
+		}
+		if resp.Code != ErrCodeNodeNotFound {
+			t.Errorf("Expected code %q for %s, got %q", ErrCodeNodeNotFound, command, resp.Code)
+		}
+		if resp.Error == "" {
+			t.Errorf("Expected a human-readable error for %s", command)
+		}
+	}
+
+	if err := core.DeleteNode("missing"); !errors.Is(err, ErrNodeNotFound) {
+		t.Errorf("Expected DeleteNode error to wrap ErrNodeNotFound, got %v", err)
+	}
+}
+
+// TestErrorCodeMissingParam tests that a missing required parameter reports MISSING_PARAM
+func TestErrorCodeMissingParam(t *testing.T) {
+	core := NewTextCleanerCore()
+
+	resp := executeForResponse(t, core, `{"action":"delete_node","params":{}}`)
+	if resp.Success {
+		t.Error("Expected failure when node_id is missing")
+	}
+	if resp.Code != ErrCodeMissingParam {
+		t.Errorf("Expected code %q, got %q", ErrCodeMissingParam, resp.Code)
+	}
+}
+
+// TestErrorCodeInvalidRegex tests that node commands with a regex argument that doesn't compile report INVALID_REGEX
+func TestErrorCodeInvalidRegex(t *testing.T) {
+	core := NewTextCleanerCore()
+	nodeID := core.CreateNode("operation", "Keep", "Keep Match Lines", "err", "", "")
+
+	commands := []string{
+		`{"action":"create_node","params":{"type":"operation","operation":"Regex Replace","arg1":"(unclosed"}}`,
+		`{"action":"add_child_node","params":{"parent_id":"` + nodeID + `","type":"operation","operation":"Match Text","arg1":"[a-"}}`,
+		`{"action":"update_node","params":{"node_id":"` + nodeID + `","name":"Keep","operation":"Keep Match Lines","arg1":"*"}}`,
+		`{"action":"update_node","params":{"node_id":"` + nodeID + `","name":"Keep","operation":"Look-ahead Pattern","arg1":"a","arg2":"(b"}}`,
+		`{"action":"replace_node","params":{"node_id":"` + nodeID + `","node":{"type":"group","children":[{"type":"operation","operation":"Split by Regex","arg1":"+"}]}}}`,
+	}
+
+	for _, command := range commands {
+		resp := executeForResponse(t, core, command)
+		if resp.Success || resp.Code != ErrCodeInvalidRegex {
+			t.Errorf("Expected INVALID_REGEX for %s, got %+v", command, resp)
+		}
+	}
+
+	pipeline := core.GetPipeline()
+	if len(pipeline) != 1 || pipeline[0].Arg1 != "err" || pipeline[0].Operation != "Keep Match Lines" || len(pipeline[0].Children) != 0 {
+		t.Errorf("Expected the rejected commands to leave the pipeline alone, got %+v", pipeline)
+	}
+
+	// Operations without regex arguments take any text, and if conditions fall back to a literal match
+	for _, command := range []string{
+		`{"action":"create_node","params":{"type":"operation","operation":"Replace Text","arg1":"(unclosed"}}`,
+		`{"action":"create_node","params":{"type":"if","condition":"(unclosed"}}`,
+	} {
+		if resp := executeForResponse(t, core, command); !resp.Success {
+			t.Errorf("Expected %s to succeed, got %+v", command, resp)
+		}
+	}
+}
+
+// TestExecutionTimeout tests that a slow pipeline run is abandoned with a TIMEOUT error
+func TestExecutionTimeout(t *testing.T) {
+	core := NewTextCleanerCore()
+	core.SetExecutionTimeout(50 * time.Millisecond)
+
+	// Each record repeats an operation many times, so the whole run takes seconds
+	forEachID := core.CreateNode("foreach", "ForEach", "", "", "", "")
+	repeatID, _ := core.AddChildNode(forEachID, "operation", "Slow", "Repeat Operation", "Uppercase", "1000", "")
+	core.SetInputText(strings.Repeat("slow line\n", 1000))
+
+	start := time.Now()
+	for _, command := range []string{
+		`{"action":"get_output_text"}`,
+		`{"action":"get_output_text_at_node","params":{"node_id":"` + repeatID + `"}}`,
+	} {
+		resp := executeForResponse(t, core, command)
+		if resp.Success || resp.Code != ErrCodeTimeout {
+			t.Errorf("%s: expected %s error, got %+v", command, ErrCodeTimeout, resp)
+		}
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("Expected runs to stop near the timeout, took %v", elapsed)
+	}
+
+	// Small inputs finish well within the limit
+	core.SetInputText("a\nb")
+	resp := executeForResponse(t, core, `{"action":"get_output_text"}`)
+	if !resp.Success {
+		t.Fatalf("Expected success, got %+v", resp)
+	}
+	if output := resp.Result.(map[string]interface{})["output"]; output != "A\nB" {
+		t.Errorf("Expected 'A\\nB', got %q", output)
+	}
+
+	// A single operation that loops stops between its steps
+	core.ClearPipeline()
+	core.CreateNode("operation", "Slower", "Repeat Operation", "Uppercase", "100000000", "")
+	start = time.Now()
+	if resp := executeForResponse(t, core, `{"action":"get_output_text"}`); resp.Success || resp.Code != ErrCodeTimeout {
+		t.Errorf("Expected %s error inside Repeat Operation, got %+v", ErrCodeTimeout, resp)
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("Expected Repeat Operation to stop near the timeout, took %v", elapsed)
+	}
+
+	// Cancellation isn't reported as a timeout
+	if code := errorCode(core.executionError(context.Canceled)); code != ErrCodeCanceled {
+		t.Errorf("Expected %s for a canceled run, got %s", ErrCodeCanceled, code)
+	}
+}
+
+// TestMaxOutputSize tests that a node whose output passes the size limit fails the run with OUTPUT_TOO_LARGE
+func TestMaxOutputSize(t *testing.T) {
+	core := NewTextCleanerCore()
+	core.SetMaxOutputSize(1000)
+
+	// Each Base64 Encode grows the text by a third, so 20 of them turn 11 bytes into about 3.5 KB
+	repeatID := core.CreateNode("operation", "Grow", "Repeat Operation", "Base64 Encode", "20", "")
+	core.CreateNode("operation", "Upper", "Uppercase", "", "", "")
+	core.SetInputText("hello world")
+
+	if _, err := core.GetOutputTextWithError(); !errors.Is(err, ErrOutputTooLarge) {
+		t.Errorf("Expected ErrOutputTooLarge, got %v", err)
+	}
+	for _, command := range []string{
+		`{"action":"get_output_text"}`,
+		`{"action":"get_output_text_at_node","params":{"node_id":"` + repeatID + `"}}`,
+		`{"action":"process_batch","params":{"inputs":[{"id":"a","text":"hi"}]}}`,
+	} {
+		resp := executeForResponse(t, core, command)
+		if resp.Success || resp.Code != ErrCodeOutputTooLarge {
+			t.Errorf("%s: expected %s error, got %+v", command, ErrCodeOutputTooLarge, resp)
+		}
+	}
+
+	// Records within the limit can still add up to more than it
+	core.ClearPipeline()
+	forEachID := core.CreateNode("foreach", "Each", "", "", "", "")
+	core.AddChildNode(forEachID, "operation", "Double", "Repeat Operation", "Base64 Encode", "2", "")
+	core.SetInputText(strings.Repeat("line of text\n", 100))
+	if _, err := core.GetOutputTextWithError(); !errors.Is(err, ErrOutputTooLarge) {
+		t.Errorf("Expected ErrOutputTooLarge for the joined records, got %v", err)
+	}
+
+	core.SetMaxOutputSize(0)
+	if _, err := core.GetOutputTextWithError(); err != nil {
+		t.Errorf("Expected no error without a limit, got %v", err)
+	}
+
+	// Changing the limit invalidates the cached output
+	core.SetMaxOutputSize(1000)
+	if _, err := core.GetOutputTextWithError(); !errors.Is(err, ErrOutputTooLarge) {
+		t.Errorf("Expected ErrOutputTooLarge after lowering the limit, got %v", err)
+	}
+}
+
+// TestMaxOutputSizeInsideOperations tests that operations running other operations stop as soon as
+// a step crosses the limit; without that, these would grow the text far beyond memory
+func TestMaxOutputSizeInsideOperations(t *testing.T) {
+	tests := []struct {
+		operation string
+		arg1      string
+		arg2      string
+		desc      string
+	}{
+		{"Repeat Operation", "Base64 Encode", "1000", "Repeat"},
+		{"Chain Operations", strings.Repeat("Base64 Encode|", 1000), "", "Chain"},
+		{"Apply Pipeline", `[{"operation": "Repeat Operation", "arg1": "Base64 Encode", "arg2": "1000"}]`, "", "Inline pipeline"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.desc, func(t *testing.T) {
+			core := NewTextCleanerCore()
+			core.SetMaxOutputSize(1000)
+			core.CreateNode("operation", "Grow", tt.operation, tt.arg1, tt.arg2, "")
+			core.SetInputText("hello world")
+			if _, err := core.GetOutputTextWithError(); !errors.Is(err, ErrOutputTooLarge) {
+				t.Errorf("Expected ErrOutputTooLarge, got %v", err)
+			}
+		})
+	}
+}
+
+// TestOutputDiffAtNode tests the input, output and line diff for a single node
+func TestOutputDiffAtNode(t *testing.T) {
+	core := NewTextCleanerCore()
+	core.CreateNode("operation", "Rename", "Replace Text", "world", "there", "")
+	upperID := core.CreateNode("operation", "Upper", "Uppercase", "", "", "")
+	core.SetInputText("hello\n123\nworld")
+
+	input, output, diff, err := core.GetOutputDiffAtNode(upperID)
+	if err != nil {
+		t.Fatalf("GetOutputDiffAtNode failed: %v", err)
+	}
+	if input != "hello\n123\nthere" || output != "HELLO\n123\nTHERE" {
+		t.Errorf("Expected the text before and after Upper, got %q and %q", input, output)
+	}
+	if got := formatDiff(diff); got != "-hello|+HELLO| 123|-there|+THERE" {
+		t.Errorf("Expected: %q, Got: %q", "-hello|+HELLO| 123|-there|+THERE", got)
+	}
+
+	resp := executeForResponse(t, core, `{"action":"get_output_diff_at_node","params":{"node_id":"node_0"}}`)
+	if !resp.Success {
+		t.Fatalf("get_output_diff_at_node failed: %s", resp.Error)
+	}
+	result := resp.Result.(map[string]interface{})
+	if result["input"] != "hello\n123\nworld" || result["output"] != "hello\n123\nthere" {
+		t.Errorf("Unexpected input/output: %v", result)
+	}
+	lines := result["diff"].([]interface{})
+	if len(lines) != 4 || lines[2].(map[string]interface{})["kind"] != DiffRemoved || lines[3].(map[string]interface{})["text"] != "there" {
+		t.Errorf("Expected the last line to be replaced, got %v", lines)
+	}
+
+	resp = executeForResponse(t, core, `{"action":"get_output_diff_at_node","params":{"node_id":"missing"}}`)
+	if resp.Success || resp.Code != ErrCodeNodeNotFound {
+		t.Errorf("Expected NODE_NOT_FOUND, got %+v", resp)
+	}
+
+	// The text before and after come from the same run, so a shuffle before the node is the same in both
+	core.ClearPipeline()
+	core.CreateNode("operation", "Shuffle", "Randomize Lines", "", "", "")
+	upperID = core.CreateNode("operation", "Upper", "Uppercase", "", "", "")
+	records := make([]string, 40)
+	for i := range records {
+		records[i] = fmt.Sprintf("line %d", i)
+	}
+	core.SetInputText(strings.Join(records, "\n"))
+	input, output, _, err = core.GetOutputDiffAtNode(upperID)
+	if err != nil {
+		t.Fatalf("GetOutputDiffAtNode failed: %v", err)
+	}
+	if strings.ToUpper(input) != output {
+		t.Errorf("Expected the output to be the uppercased input, got %q and %q", input, output)
+	}
+}
+
+// seededRandomCore builds a core that shuffles lines and randomizes case per line, with the given foreach mode
+func seededRandomCore(t *testing.T, mode string, seed int64) *TextCleanerCore {
+	t.Helper()
+	core := NewTextCleanerCore()
+	core.CreateNode("operation", "Shuffle", "Randomize Lines", "", "", "")
+	loopID := core.CreateNode("foreach", "Each", "", "", mode, "")
+	if _, err := core.AddChildNode(loopID, "operation", "Case", "Randomcase", "", "", ""); err != nil {
+		t.Fatalf("AddChildNode failed: %v", err)
+	}
+
+	lines := make([]string, 40)
+	for i := range lines {
+		lines[i] = fmt.Sprintf("line number %d", i)
+	}
+	core.SetInputText(strings.Join(lines, "\n"))
+	core.SetSeed(seed)
+	return core
+}
+
+// TestSetSeedReproducible tests that a seed makes random operations give the same output every run
+func TestSetSeedReproducible(t *testing.T) {
+	core := seededRandomCore(t, "", 42)
+	first := core.GetOutputText()
+
+	core.SetInputText(core.GetInputText()) // Force a second run
+	if second := core.GetOutputText(); second != first {
+		t.Errorf("Expected two seeded runs to match:\n%s\n---\n%s", first, second)
+	}
+	if got := seededRandomCore(t, "", 42).GetOutputText(); got != first {
+		t.Errorf("Expected another core with the same seed to match")
+	}
+	if got := seededRandomCore(t, "parallel", 42).GetOutputText(); got != first {
+		t.Errorf("Expected a parallel foreach to match the serial one with the same seed")
+	}
+	if got := seededRandomCore(t, "", 43).GetOutputText(); got == first {
+		t.Errorf("Expected a different seed to give a different output")
+	}
+
+	resp := executeForResponse(t, core, `{"action":"set_seed","params":{"seed":null}}`)
+	if !resp.Success || resp.Result.(map[string]interface{})["seeded"] != false {
+		t.Errorf("Expected clearing the seed to succeed, got %+v", resp)
+	}
+	resp = executeForResponse(t, core, `{"action":"set_seed","params":{"seed":42}}`)
+	if !resp.Success {
+		t.Fatalf("set_seed failed: %s", resp.Error)
+	}
+	if got := core.GetOutputText(); got != first {
+		t.Errorf("Expected set_seed to restore the seeded output")
+	}
+
+	resp = executeForResponse(t, core, `{"action":"set_seed","params":{"seed":"abc"}}`)
+	if resp.Success || resp.Code != ErrCodeInvalidParam {
+		t.Errorf("Expected INVALID_PARAM for a non-integer seed, got %+v", resp)
+	}
+}
+
+// TestSetSeedNestedOperations tests that random operations run by other operations use the seed too
+func TestSetSeedNestedOperations(t *testing.T) {
+	tests := []struct {
+		operation string
+		arg1      string
+		arg2      string
+		desc      string
+	}{
+		{"Repeat Operation", "Randomize Lines", "2", "Repeat"},
+		{"Chain Operations", "Randomize Lines|Randomcase", "", "Chain"},
+		{"Apply Pipeline", `[{"operation": "Randomize Lines"}, {"type": "foreach", "children": [{"operation": "Shuffle Words"}]}]`, "", "Inline pipeline"},
+	}
+
+	lines := make([]string, 40)
+	for i := range lines {
+		lines[i] = fmt.Sprintf("line number %d of the text", i)
+	}
+	input := strings.Join(lines, "\n")
+
+	output := func(operation, arg1, arg2 string, seed int64) string {
+		core := NewTextCleanerCore()
+		core.SetSeed(seed)
+		core.CreateNode("operation", "Shuffle", operation, arg1, arg2, "")
+		core.SetInputText(input)
+		return core.GetOutputText()
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.desc, func(t *testing.T) {
+			first := output(tt.operation, tt.arg1, tt.arg2, 42)
+			if first == input {
+				t.Fatal("Expected the operation to change the text")
+			}
+			if got := output(tt.operation, tt.arg1, tt.arg2, 42); got != first {
+				t.Errorf("Expected two runs with the same seed to match:\n%s\n---\n%s", first, got)
+			}
+			if got := output(tt.operation, tt.arg1, tt.arg2, 43); got == first {
+				t.Errorf("Expected a different seed to give a different output")
+			}
+		})
+	}
+}
+
+// TestPipelineStats tests node counts, depth and invalid regex detection for a nested pipeline
+func TestPipelineStats(t *testing.T) {
+	core := NewTextCleanerCore()
+
+	stats := core.GetPipelineStats()
+	if stats.TotalNodes != 0 || stats.MaxDepth != 0 || stats.HasInvalidRegex {
+		t.Errorf("Expected empty stats for an empty pipeline, got %+v", stats)
+	}
+
+	core.CreateNode("operation", "Trim", "Trim", "", "", "")
+	loopID := core.CreateNode("foreach", "Each", "", "", "", "")
+	ifID, _ := core.AddChildNode(loopID, "if", "Numbers", "", "", "", `^\d+$`)
+	core.AddChildNode(ifID, "operation", "Upper", "Uppercase", "", "", "")
+	badID, _ := core.AddChildNode(ifID, "operation", "Bad", "Match Text", "(unclosed", "", "")
+
+	stats = core.GetPipelineStats()
+	if stats.TotalNodes != 5 {
+		t.Errorf("Expected 5 nodes, got %d", stats.TotalNodes)
+	}
+	if stats.MaxDepth != 3 {
+		t.Errorf("Expected depth 3, got %d", stats.MaxDepth)
+	}
+	expected := map[string]int{"operation": 3, "foreach": 1, "if": 1}
+	for nodeType, count := range expected {
+		if stats.NodesByType[nodeType] != count {
+			t.Errorf("Expected %d %s nodes, got %d", count, nodeType, stats.NodesByType[nodeType])
+		}
+	}
+	if len(stats.NodesByType) != len(expected) {
+		t.Errorf("Unexpected node types: %v", stats.NodesByType)
+	}
+	if !stats.HasInvalidRegex || len(stats.InvalidRegexNodes) != 1 || stats.InvalidRegexNodes[0] != badID {
+		t.Errorf("Expected %s to have an invalid regex, got %+v", badID, stats)
+	}
+
+	core.UpdateNode(badID, "", "Bad", "Match Text", "(closed)", "", "")
+	core.UpdateNode(ifID, "", "Numbers", "", "", "", "[")
+	resp := executeForResponse(t, core, `{"action":"pipeline_stats"}`)
+	if !resp.Success {
+		t.Fatalf("pipeline_stats failed: %s", resp.Error)
+	}
+	result := resp.Result.(map[string]interface{})
+	if result["total_nodes"] != float64(5) || result["max_depth"] != float64(3) {
+		t.Errorf("Unexpected stats: %v", result)
+	}
+	invalid := result["invalid_regex_nodes"].([]interface{})
+	if result["has_invalid_regex"] != true || len(invalid) != 1 || invalid[0] != ifID {
+		t.Errorf("Expected the if condition to be the invalid regex, got %v", result)
+	}
+
+	// Look-ahead Pattern takes a regex in both arguments
+	core.UpdateNode(ifID, "", "Numbers", "", "", "", `^\d+$`)
+	core.UpdateNode(badID, "", "Bad", "Look-ahead Pattern", `\d+`, "(unclosed", "")
+	stats = core.GetPipelineStats()
+	if len(stats.InvalidRegexNodes) != 1 || stats.InvalidRegexNodes[0] != badID {
+		t.Errorf("Expected the invalid arg2 of %s to be found, got %+v", badID, stats)
+	}
+}
+
+// TestFindNodes tests finding nested nodes by operation and by part of their name
+func TestFindNodes(t *testing.T) {
+	core := NewTextCleanerCore()
+	firstID := core.CreateNode("operation", "Shout", "Uppercase", "", "", "")
+	groupID := core.CreateNode("group", "Cleanup", "", "", "", "")
+	trimID, _ := core.AddChildNode(groupID, "operation", "Clean spaces", "Trim", "", "", "")
+	ifID, _ := core.AddChildNode(groupID, "if", "Numbers", "", "", "", `\d`)
+	nestedID, _ := core.AddChildNode(ifID, "operation", "Louder", "Uppercase", "", "", "")
+	core.CreateNode("operation", "Lower", "Lowercase", "", "", "")
+
+	ids := func(matches []NodeMatch) []string {
+		result := make([]string, len(matches))
+		for i, match := range matches {
+			result[i] = match.ID
+		}
+		return result
+	}
+
+	upper := core.FindNodes("uppercase", "")
+	if got := strings.Join(ids(upper), ","); got != firstID+","+nestedID {
+		t.Errorf("Expected the Uppercase nodes %s and %s, got %s", firstID, nestedID, got)
+	}
+	if got := strings.Join(upper[1].Path, "/"); got != groupID+"/"+ifID+"/"+nestedID {
+		t.Errorf("Expected the nested node's path through its ancestors, got %s", got)
+	}
+
+	if got := strings.Join(ids(core.FindNodes("", "clean")), ","); got != groupID+","+trimID {
+		t.Errorf("Expected the nodes named like clean, got %s", got)
+	}
+	if got := core.FindNodes("Uppercase", "clean"); len(got) != 0 {
+		t.Errorf("Expected both criteria to have to match, got %v", got)
+	}
+
+	resp := executeForResponse(t, core, `{"action":"find_nodes","params":{"name_contains":"CLEAN"}}`)
+	if !resp.Success {
+		t.Fatalf("find_nodes failed: %s", resp.Error)
+	}
+	nodes := resp.Result.(map[string]interface{})["nodes"].([]interface{})
+	if len(nodes) != 2 {
+		t.Fatalf("Expected 2 nodes, got %v", nodes)
+	}
+	second := nodes[1].(map[string]interface{})
+	if second["id"] != trimID || second["name"] != "Clean spaces" || len(second["path"].([]interface{})) != 2 {
+		t.Errorf("Unexpected match: %v", second)
+	}
+
+	resp = executeForResponse(t, core, `{"action":"find_nodes","params":{}}`)
+	if resp.Success || resp.Code != ErrCodeMissingParam {
+		t.Errorf("Expected MISSING_PARAM, got %+v", resp)
+	}
+}
+
+// TestGetNodePath tests the ancestor chain of a deeply nested node, including an else branch
+func TestGetNodePath(t *testing.T) {
+	core := NewTextCleanerCore()
+	err := core.ImportPipeline(`[
+		{"id": "node_0", "type": "operation", "name": "Trim", "operation": "Trim"},
+		{"id": "node_1", "type": "group", "name": "Outer", "children": [
+			{"id": "node_2", "type": "foreach", "name": "Each", "children": [
+				{"id": "node_3", "type": "if", "name": "Numbers", "condition": "\\d",
+					"children": [{"id": "node_4", "type": "operation", "name": "Upper", "operation": "Uppercase"}],
+					"else_children": [{"id": "node_5", "type": "operation", "name": "Lower", "operation": "Lowercase"}]}
+			]}
+		]}
+	]`)
+	if err != nil {
+		t.Fatalf("ImportPipeline failed: %v", err)
+	}
+	path, err := core.GetNodePath("node_5")
+	if err != nil {
+		t.Fatalf("GetNodePath failed: %v", err)
+	}
+	var names []string
+	for _, entry := range path {
+		names = append(names, entry.ID+"="+entry.Name)
+	}
+	expected := "node_1=Outer,node_2=Each,node_3=Numbers,node_5=Lower"
+	if got := strings.Join(names, ","); got != expected {
+		t.Errorf("Expected: %q, Got: %q", expected, got)
+	}
+
+	resp := executeForResponse(t, core, `{"action":"get_node_path","params":{"node_id":"node_0"}}`)
+	if !resp.Success {
+		t.Fatalf("get_node_path failed: %s", resp.Error)
+	}
+	rootPath := resp.Result.(map[string]interface{})["path"].([]interface{})
+	if len(rootPath) != 1 || rootPath[0].(map[string]interface{})["name"] != "Trim" {
+		t.Errorf("Expected a root node's path to be just the node, got %v", rootPath)
+	}
+
+	resp = executeForResponse(t, core, `{"action":"get_node_path","params":{"node_id":"missing"}}`)
+	if resp.Success || resp.Code != ErrCodeNodeNotFound {
+		t.Errorf("Expected NODE_NOT_FOUND, got %+v", resp)
+	}
+}
+
+// TestLineBasedOperationNode tests that a line-based node gives the same result as the operation in a foreach
+func TestLineBasedOperationNode(t *testing.T) {
+	input := "  alpha  \n\tbeta\n gamma "
+
+	wrapped := NewTextCleanerCore()
+	loopID := wrapped.CreateNode("foreach", "Each", "", "", "", "")
+	wrapped.AddChildNode(loopID, "operation", "Trim", "Trim", "", "", "")
+	wrapped.SetInputText(input)
+
+	core := NewTextCleanerCore()
+	trimID := core.CreateNode("operation", "Trim", "Trim", "", "", "")
+	core.SetInputText(input)
+	if got := core.GetOutputText(); got != "alpha  \n\tbeta\n gamma" {
+		t.Errorf("Expected Trim to apply to the whole text, got %q", got)
+	}
+
+	resp := executeForResponse(t, core, fmt.Sprintf(`{"action":"set_line_based","params":{"node_id":%q,"line_based":true}}`, trimID))
+	if !resp.Success {
+		t.Fatalf("set_line_based failed: %s", resp.Error)
+	}
+	if got, want := core.GetOutputText(), wrapped.GetOutputText(); got != want || got != "alpha\nbeta\ngamma" {
+		t.Errorf("Expected the line-based node to match the foreach (%q), got %q", want, got)
+	}
+	if got := core.GetOutputTextAtNode(trimID); got != "alpha\nbeta\ngamma" {
+		t.Errorf("Expected the output at the node to be line-based too, got %q", got)
+	}
+
+	// The setting is saved with the pipeline
+	exported, _ := core.ExportPipeline()
+	if !strings.Contains(exported, `"line_based": true`) {
+		t.Errorf("Expected line_based in the exported pipeline, got %s", exported)
+	}
+
+	core.SetNodeLineBased(trimID, false)
+	if got := core.GetOutputText(); got != "alpha  \n\tbeta\n gamma" {
+		t.Errorf("Expected Trim to apply to the whole text again, got %q", got)
+	}
+
+	resp = executeForResponse(t, core, fmt.Sprintf(`{"action":"set_line_based","params":{"node_id":%q,"line_based":"yes"}}`, trimID))
+	if resp.Success || resp.Code != ErrCodeInvalidParam {
+		t.Errorf("Expected INVALID_PARAM, got %+v", resp)
+	}
+
+	groupID := core.CreateNode("group", "Group", "", "", "", "")
+	resp = executeForResponse(t, core, fmt.Sprintf(`{"action":"set_line_based","params":{"node_id":%q,"line_based":true}}`, groupID))
+	if resp.Success || resp.Code != ErrCodeInvalidOperation {
+		t.Errorf("Expected INVALID_OPERATION for a group node, got %+v", resp)
+	}
+	if core.GetNode(groupID).LineBased {
+		t.Error("Expected the group node not to become line-based")
+	}
+}
+
+// TestRegexOperationsListed tests that regexOperations lists exactly the operations that pass
+// arg1 or arg2 to compileRegex, directly or through helpers such as matchWithContext
+func TestRegexOperationsListed(t *testing.T) {
+	file, err := parser.ParseFile(token.NewFileSet(), "processor.go", nil, 0)
+	if err != nil {
+		t.Fatalf("Failed to parse processor.go: %v", err)
+	}
+
+	funcs := map[string]*ast.FuncDecl{}
+	for _, decl := range file.Decls {
+		if fn, ok := decl.(*ast.FuncDecl); ok && fn.Recv == nil {
+			funcs[fn.Name.Name] = fn
+		}
+	}
+
+	// mentions reports whether expr uses one of the names; the flags given to addRegexFlags
+	// and text quoted by regexp.QuoteMeta aren't patterns, so they are skipped
+	var mentions func(expr ast.Node, names map[string]bool) bool
+	mentions = func(expr ast.Node, names map[string]bool) bool {
+		found := false
+		ast.Inspect(expr, func(n ast.Node) bool {
+			switch n := n.(type) {
+			case *ast.CallExpr:
+				if sel, ok := n.Fun.(*ast.SelectorExpr); ok && sel.Sel.Name == "QuoteMeta" {
+					return false
+				}
+				if ident, ok := n.Fun.(*ast.Ident); ok && ident.Name == "addRegexFlags" {
+					found = found || mentions(n.Args[0], names)
+					return false
+				}
+			case *ast.Ident:
+				found = found || names[n.Name]
+			}
+			return !found
+		})
+		return found
+	}
+
+	// sinks[fn] holds the indexes of fn's parameters that end up compiled as a pattern
+	sinks := map[string]map[int]bool{"compileRegex": {0: true}, "mustCompileRegex": {0: true}}
+	for changed := true; changed; {
+		changed = false
+		for name, fn := range funcs {
+			var params []string
+			for _, field := range fn.Type.Params.List {
+				for _, ident := range field.Names {
+					params = append(params, ident.Name)
+				}
+			}
+			for i, param := range params {
+				if sinks[name][i] {
+					continue
+				}
+				// Follow the parameter through local variables assigned from it
+				tainted := map[string]bool{param: true}
+				ast.Inspect(fn.Body, func(n ast.Node) bool {
+					if assign, ok := n.(*ast.AssignStmt); ok {
+						for _, rhs := range assign.Rhs {
+							if mentions(rhs, tainted) {
+								for _, lhs := range assign.Lhs {
+									if ident, ok := lhs.(*ast.Ident); ok {
+										tainted[ident.Name] = true
+									}
+								}
+							}
+						}
+					}
+					return true
+				})
+				ast.Inspect(fn.Body, func(n ast.Node) bool {
+					call, ok := n.(*ast.CallExpr)
+					if !ok {
+						return true
+					}
+					ident, ok := call.Fun.(*ast.Ident)
+					if !ok {
+						return true
+					}
+					for j, arg := range call.Args {
+						if sinks[ident.Name][j] && mentions(arg, tainted) {
+							if sinks[name] == nil {
+								sinks[name] = map[int]bool{}
+							}
+							sinks[name][i] = true
+							changed = true
+						}
+					}
+					return true
+				})
+			}
+		}
+	}
+
+	for _, op := range GetOperations() {
+		name := runtime.FuncForPC(reflect.ValueOf(op.Func).Pointer()).Name()
+		name = name[strings.LastIndex(name, ".")+1:]
+		expected := regexArgs{arg1: sinks[name][1], arg2: sinks[name][2]}
+		if regexOperations[op.Name] != expected {
+			t.Errorf("%s (%s): expected regexOperations entry %+v, got %+v", op.Name, name, expected, regexOperations[op.Name])
+		}
+	}
+}
+
+// TestCapabilitiesMatchDispatch tests that get_capabilities lists exactly the actions ExecuteCommand handles
+func TestCapabilitiesMatchDispatch(t *testing.T) {
+	file, err := parser.ParseFile(token.NewFileSet(), "textcleaner_commands.go", nil, 0)
+	if err != nil {
+		t.Fatalf("Failed to parse textcleaner_commands.go: %v", err)
+	}
+
+	// Collect the case labels of the switch in ExecuteCommand
+	var dispatched []string
+	for _, decl := range file.Decls {
+		fn, ok := decl.(*ast.FuncDecl)
+		if !ok || fn.Name.Name != "ExecuteCommand" {
+			continue
+		}
+		ast.Inspect(fn.Body, func(n ast.Node) bool {
+			if clause, ok := n.(*ast.CaseClause); ok {
+				for _, expr := range clause.List {
+					if lit, ok := expr.(*ast.BasicLit); ok && lit.Kind == token.STRING {
+						action, _ := strconv.Unquote(lit.Value)
+						dispatched = append(dispatched, action)
+					}
+				}
+			}
+			return true
+		})
+	}
+	if len(dispatched) == 0 {
+		t.Fatal("Found no actions in ExecuteCommand")
+	}
+
+	core := NewTextCleanerCore()
+	resp := executeForResponse(t, core, `{"action":"get_capabilities"}`)
+	if !resp.Success {
+		t.Fatalf("get_capabilities failed: %s", resp.Error)
+	}
+	result := resp.Result.(map[string]interface{})
+	if result["version"] != ProtocolVersion {
+		t.Errorf("Expected version %q, got %v", ProtocolVersion, result["version"])
+	}
+
+	var listed []string
+	for _, action := range result["actions"].([]interface{}) {
+		listed = append(listed, action.(string))
+	}
+	if strings.Join(listed, ",") != strings.Join(dispatched, ",") {
+		t.Errorf("Expected the actions of ExecuteCommand\n%v\ngot\n%v", dispatched, listed)
+	}
+
+	for action := range mutatingActions {
+		if !slices.Contains(listed, action) {
+			t.Errorf("Mutating action %q isn't a listed action", action)
+		}
+	}
+
+	features := result["features"].(map[string]interface{})
+	if features["batch"] != true || features["subscribe"] != false || features["auth"] != false {
+		t.Errorf("Expected the core alone to offer batch but no transport features, got %v", features)
+	}
+}
+
+// TestReplaceNode tests replacing an operation node with an if node that has its own children
+func TestReplaceNode(t *testing.T) {
+	core := NewTextCleanerCore()
+	err := core.ImportPipeline(`[
+		{"id": "node_0", "type": "operation", "name": "Trim", "operation": "Trim"},
+		{"id": "node_1", "type": "operation", "name": "Upper", "operation": "Uppercase"},
+		{"id": "node_2", "type": "operation", "name": "Suffix", "operation": "Add Suffix", "arg1": "!"}
+	]`)
+	if err != nil {
+		t.Fatalf("ImportPipeline failed: %v", err)
+	}
+	core.SetInputText("  hello 42  ")
+
+	resp := executeForResponse(t, core, `{"action":"replace_node","params":{"node_id":"node_1","node":{
+		"type": "if", "name": "Numbers", "condition": "\\d",
+		"children": [{"id": "node_0", "type": "operation", "name": "Upper", "operation": "Uppercase"}],
+		"else_children": [{"type": "operation", "name": "Lower", "operation": "Lowercase"}]
+	}}}`)
+	if !resp.Success {
+		t.Fatalf("replace_node failed: %s", resp.Error)
+	}
+
+	pipeline := core.GetPipeline()
+	if len(pipeline) != 3 {
+		t.Fatalf("Expected 3 root nodes, got %d", len(pipeline))
+	}
+	replaced := pipeline[1]
+	if replaced.ID != "node_1" || replaced.Type != "if" || replaced.Name != "Numbers" {
+		t.Errorf("Expected node_1 to become the if node in place, got %+v", replaced)
+	}
+	if len(replaced.Children) != 1 || len(replaced.ElseChildren) != 1 {
+		t.Fatalf("Expected one child in each branch, got %+v", replaced)
+	}
+
+	// The clashing and the missing child ID both get fresh IDs
+	seen := map[string]bool{"node_0": true, "node_1": true, "node_2": true}
+	for _, child := range []PipelineNode{replaced.Children[0], replaced.ElseChildren[0]} {
+		if child.ID == "" || seen[child.ID] {
+			t.Errorf("Expected a fresh ID for child %q, got %q", child.Name, child.ID)
+		}
+		seen[child.ID] = true
+	}
+
+	if got := core.GetOutputText(); got != "HELLO 42!" {
+		t.Errorf("Expected: %q, Got: %q", "HELLO 42!", got)
+	}
+	core.SetInputText("hello")
+	if got := core.GetOutputText(); got != "hello!" {
+		t.Errorf("Expected: %q, Got: %q", "hello!", got)
+	}
+
+	resp = executeForResponse(t, core, `{"action":"replace_node","params":{"node_id":"node_2","node":{
+		"type": "group", "children": [{"type": "bogus"}]
+	}}}`)
+	if resp.Success || resp.Code != ErrCodeInvalidParam {
+		t.Errorf("Expected INVALID_PARAM for an unknown child type, got %+v", resp)
+	}
+	if node := core.GetNode("node_2"); node == nil || node.Type != "operation" {
+		t.Errorf("Expected a rejected replacement to leave the node alone, got %+v", node)
+	}
+	if !strings.Contains(resp.Error, `node node_2.1 "": unknown type "bogus"`) {
+		t.Errorf("Expected the problem to name the child by its path, got %q", resp.Error)
+	}
+
+	// As in an import, a node without a type is an operation
+	resp = executeForResponse(t, core, `{"action":"replace_node","params":{"node_id":"node_2","node":{
+		"type": "group", "children": [{"name": "Exclaim", "operation": "Add Suffix", "arg1": "?"}]
+	}}}`)
+	if !resp.Success {
+		t.Fatalf("replace_node failed: %s", resp.Error)
+	}
+	if node := core.GetNode("node_2"); len(node.Children) != 1 || node.Children[0].Type != "operation" {
+		t.Errorf("Expected the untyped child to become an operation, got %+v", node)
+	}
+
+	resp = executeForResponse(t, core, `{"action":"replace_node","params":{"node_id":"missing","node":{"type":"operation"}}}`)
+	if resp.Success || resp.Code != ErrCodeNodeNotFound {
+		t.Errorf("Expected NODE_NOT_FOUND, got %+v", resp)
+	}
+}
+
+// TestProcessBatch tests that each batch input is transformed on its own, leaving the stored input alone
+func TestProcessBatch(t *testing.T) {
+	core := NewTextCleanerCore()
+	core.CreateNode("capture", "Original", "", "original", "", "")
+	core.CreateNode("operation", "Upper", "Uppercase", "", "", "")
+	core.CreateNode("operation", "Suffix", "Add Suffix", " (${var:original})", "", "")
+	core.SetInputText("stored")
+
+	resp := executeForResponse(t, core, `{"action":"process_batch","params":{"inputs":[
+		{"id": "a", "text": "one"},
+		{"id": "b", "text": "two\nthree"},
+		{"id": "c", "text": ""}
+	]}}`)
+	if !resp.Success {
+		t.Fatalf("process_batch failed: %s", resp.Error)
+	}
+
+	results := resp.Result.(map[string]interface{})["results"].([]interface{})
+	expected := []struct{ id, output string }{
+		{"a", "ONE (one)"},
+		{"b", "TWO\nTHREE (two\nthree)"},
+		{"c", " ()"},
+	}
+	if len(results) != len(expected) {
+		t.Fatalf("Expected %d results, got %d", len(expected), len(results))
+	}
+	for i, want := range expected {
+		result := results[i].(map[string]interface{})
+		if result["id"] != want.id || result["output"] != want.output {
+			t.Errorf("Result %d: expected {%q %q}, got %v", i, want.id, want.output, result)
+		}
+	}
+
+	if got := core.GetInputText(); got != "stored" {
+		t.Errorf("Expected the stored input to be unchanged, got %q", got)
+	}
+	if got := core.GetOutputText(); got != "STORED (stored)" {
+		t.Errorf("Expected: %q, Got: %q", "STORED (stored)", got)
+	}
+
+	resp = executeForResponse(t, core, `{"action":"process_batch","params":{}}`)
+	if resp.Success || resp.Code != ErrCodeMissingParam {
+		t.Errorf("Expected MISSING_PARAM, got %+v", resp)
+	}
+	resp = executeForResponse(t, core, `{"action":"process_batch","params":{"inputs":"one"}}`)
+	if resp.Success || resp.Code != ErrCodeInvalidParam {
+		t.Errorf("Expected INVALID_PARAM, got %+v", resp)
+	}
+}
+
+// TestGetOutputPreview tests that a preview is cut at a byte limit without splitting a character
+func TestGetOutputPreview(t *testing.T) {
+	core := NewTextCleanerCore()
+	core.CreateNode("operation", "Upper", "Uppercase", "", "", "")
+	core.SetInputText("café ☕ time") // é is 2 bytes and ☕ is 3, so the output is 14 bytes
+
+	tests := []struct {
+		maxBytes  int
+		expected  string
+		truncated bool
+		desc      string
+	}{
+		{100, "CAFÉ ☕ TIME", false, "Fits"},
+		{14, "CAFÉ ☕ TIME", false, "Exactly the length"},
+		{5, "CAFÉ", true, "Cut after a 2-byte character"},
+		{4, "CAF", true, "Cut inside a 2-byte character"},
+		{7, "CAFÉ ", true, "Cut inside a 3-byte character"},
+		{9, "CAFÉ ☕", true, "Cut after a 3-byte character"},
+		{0, "", true, "Nothing"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.desc, func(t *testing.T) {
+			resp := executeForResponse(t, core, fmt.Sprintf(`{"action":"get_output_preview","params":{"max_bytes":%d}}`, tt.maxBytes))
+			if !resp.Success {
+				t.Fatalf("get_output_preview failed: %s", resp.Error)
+			}
+			result := resp.Result.(map[string]interface{})
+			if result["output"] != tt.expected {
+				t.Errorf("Expected: %q, Got: %q", tt.expected, result["output"])
+			}
+			if result["truncated"] != tt.truncated {
+				t.Errorf("Expected truncated=%v, got %v", tt.truncated, result["truncated"])
+			}
+			if result["total_length"] != float64(14) {
+				t.Errorf("Expected total_length 14, got %v", result["total_length"])
+			}
+		})
+	}
+
+	resp := executeForResponse(t, core, `{"action":"get_output_preview"}`)
+	if resp.Success || resp.Code != ErrCodeMissingParam {
+		t.Errorf("Expected MISSING_PARAM, got %+v", resp)
+	}
+	resp = executeForResponse(t, core, `{"action":"get_output_preview","params":{"max_bytes":-1}}`)
+	if resp.Success || resp.Code != ErrCodeInvalidParam {
+		t.Errorf("Expected INVALID_PARAM, got %+v", resp)
+	}
+
+	// A negative limit counts as zero, so empty output still fits
+	core.SetInputText("")
+	if preview, truncated, total, err := core.GetOutputPreview(-1); preview != "" || truncated || total != 0 || err != nil {
+		t.Errorf("Expected an untruncated empty preview, got %q, %v, %d, %v", preview, truncated, total, err)
+	}
+}
+
+// TestSearchOperationsCommand tests ranking operations through the command interface
+func TestSearchOperationsCommand(t *testing.T) {
+	core := NewTextCleanerCore()
+
+	for _, query := range []string{"white", "norm white"} {
+		resp := executeForResponse(t, core, fmt.Sprintf(`{"action":"search_operations","params":{"query":%q,"limit":3}}`, query))
+		if !resp.Success {
+			t.Fatalf("Expected success, got %+v", resp)
+		}
+		operations := resp.Result.(map[string]interface{})["operations"].([]interface{})
+		if len(operations) == 0 || len(operations) > 3 {
+			t.Fatalf("Expected 1 to 3 operations, got %d", len(operations))
+		}
+		if name := operations[0].(map[string]interface{})["name"]; name != "Normalize Whitespace" {
+			t.Errorf("%q: expected 'Normalize Whitespace' first, got %v", query, name)
+		}
+	}
+
+	if resp := executeForResponse(t, core, `{"action":"search_operations","params":{}}`); resp.Code != ErrCodeMissingParam {
+		t.Errorf("Expected code %q, got %q", ErrCodeMissingParam, resp.Code)
+	}
+}
+
+// TestErrorCodeCommandParsing tests the codes for malformed and unknown commands
+func TestErrorCodeCommandParsing(t *testing.T) {
+	core := NewTextCleanerCore()
+
+	if resp := executeForResponse(t, core, `{not json`); resp.Code != ErrCodeInvalidJSON {
+		t.Errorf("Expected code %q, got %q", ErrCodeInvalidJSON, resp.Code)
+	}
+	if resp := executeForResponse(t, core, `{"action":"no_such_action"}`); resp.Code != ErrCodeUnknownAction {
+		t.Errorf("Expected code %q, got %q", ErrCodeUnknownAction, resp.Code)
+	}
+
+	// Successful responses carry no code
+	if resp := executeForResponse(t, core, `{"action":"get_pipeline"}`); !resp.Success || resp.Code != "" {
+		t.Errorf("Expected success without a code, got %+v", resp)
+	}
+}
@@ -0,0 +1,129 @@
+package main
+
+import "strings"
+
+// Kinds of DiffLine
+const (
+	DiffContext = "context" // The line is in both texts
+	DiffRemoved = "removed" // The line is only in the old text
+	DiffAdded   = "added"   // The line is only in the new text
+)
+
+// maxDiffCells caps the size of the table DiffLines builds for the changed middle of two texts
+// Larger changes are shown as all old lines removed and all new lines added
+const maxDiffCells = 4 * 1024 * 1024
+
+// DiffLine is one line of a line-by-line diff
+type DiffLine struct {
+	Kind string `json:"kind"` // DiffContext, DiffRemoved or DiffAdded
+	Text string `json:"text"`
+}
+
+// Marker returns the prefix a unified diff shows for the line: " ", "-" or "+"
+func (d DiffLine) Marker() string {
+	switch d.Kind {
+	case DiffRemoved:
+		return "-"
+	case DiffAdded:
+		return "+"
+	default:
+		return " "
+	}
+}
+
+// DiffText compares two texts line by line
+func DiffText(oldText, newText string) []DiffLine {
+	return DiffLines(splitDiffLines(oldText), splitDiffLines(newText))
+}
+
+// DiffLines returns the changes from a to b, based on their longest common subsequence
+// Removed lines come before the added lines that replace them
+// When the changed parts are too large to compare, they are replaced as a whole
+func DiffLines(a, b []string) []DiffLine {
+	// Lines shared at the start and end don't need the quadratic table
+	prefix := 0
+	for prefix < len(a) && prefix < len(b) && a[prefix] == b[prefix] {
+		prefix++
+	}
+	suffix := 0
+	for suffix < len(a)-prefix && suffix < len(b)-prefix && a[len(a)-1-suffix] == b[len(b)-1-suffix] {
+		suffix++
+	}
+
+	diff := []DiffLine{}
+	for _, line := range a[:prefix] {
+		diff = append(diff, DiffLine{DiffContext, line})
+	}
+
+	midA, midB := a[prefix:len(a)-suffix], b[prefix:len(b)-suffix]
+	if len(midA)*len(midB) > maxDiffCells {
+		// Too large for the table: report the middle as replaced, which is still a valid diff
+		midA, midB = nil, nil
+		for _, line := range a[prefix : len(a)-suffix] {
+			diff = append(diff, DiffLine{DiffRemoved, line})
+		}
+		for _, line := range b[prefix : len(b)-suffix] {
+			diff = append(diff, DiffLine{DiffAdded, line})
+		}
+	}
+
+	// lcs[i][j] is the length of the longest common subsequence of midA[i:] and midB[j:]
+	lcs := make([][]int, len(midA)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(midB)+1)
+	}
+	for i := len(midA) - 1; i >= 0; i-- {
+		for j := len(midB) - 1; j >= 0; j-- {
+			if midA[i] == midB[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else {
+				lcs[i][j] = max(lcs[i+1][j], lcs[i][j+1])
+			}
+		}
+	}
+
+	i, j := 0, 0
+	for i < len(midA) && j < len(midB) {
+		switch {
+		case midA[i] == midB[j]:
+			diff = append(diff, DiffLine{DiffContext, midA[i]})
+			i++
+			j++
+		case lcs[i+1][j] >= lcs[i][j+1]:
+			diff = append(diff, DiffLine{DiffRemoved, midA[i]})
+			i++
+		default:
+			diff = append(diff, DiffLine{DiffAdded, midB[j]})
+			j++
+		}
+	}
+	for ; i < len(midA); i++ {
+		diff = append(diff, DiffLine{DiffRemoved, midA[i]})
+	}
+	for ; j < len(midB); j++ {
+		diff = append(diff, DiffLine{DiffAdded, midB[j]})
+	}
+
+	for _, line := range a[len(a)-suffix:] {
+		diff = append(diff, DiffLine{DiffContext, line})
+	}
+	return diff
+}
+
+// DiffChanged reports whether a diff has any added or removed lines
+func DiffChanged(diff []DiffLine) bool {
+	for _, line := range diff {
+		if line.Kind != DiffContext {
+			return true
+		}
+	}
+	return false
+}
+
+// splitDiffLines splits text into lines; a final newline doesn't start another line
+func splitDiffLines(text string) []string {
+	if text == "" {
+		return nil
+	}
+	return strings.Split(strings.TrimSuffix(text, "\n"), "\n")
+}
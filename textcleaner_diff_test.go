@@ -0,0 +1,75 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+// formatDiff renders a diff as marker-prefixed lines joined by "|"
+func formatDiff(diff []DiffLine) string {
+	lines := make([]string, len(diff))
+	for i, line := range diff {
+		lines[i] = line.Marker() + line.Text
+	}
+	return strings.Join(lines, "|")
+}
+
+// TestDiffText tests the add, remove and context markers of the line diff
+func TestDiffText(t *testing.T) {
+	tests := []struct {
+		oldText  string
+		newText  string
+		expected string
+		desc     string
+	}{
+		{"a\nb\nc", "a\nb\nc", " a| b| c", "Unchanged"},
+		{"a\nb\nc", "a\nB\nc", " a|-b|+B| c", "Changed line"},
+		{"a\nb\nc", "a\nc", " a|-b| c", "Removed line"},
+		{"a\nc", "a\nb\nc", " a|+b| c", "Added line"},
+		{"one\ntwo", "ONE\nTWO", "-one|-two|+ONE|+TWO", "Every line changed"},
+		{"a\nb\nc\nd", "b\nx\nd\ne", "-a| b|-c|+x| d|+e", "Changes around common lines"},
+		{"", "a\nb", "+a|+b", "From empty"},
+		{"a\nb\n", "", "-a|-b", "To empty, final newline"},
+		{"a\nb\n", "a\nb", " a| b", "Final newline isn't a line"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.desc, func(t *testing.T) {
+			result := formatDiff(DiffText(tt.oldText, tt.newText))
+			if result != tt.expected {
+				t.Errorf("Expected: %q, Got: %q", tt.expected, result)
+			}
+		})
+	}
+}
+
+// TestDiffLinesLargeChange tests that changes too large to compare are shown as replaced
+func TestDiffLinesLargeChange(t *testing.T) {
+	a := make([]string, 5000)
+	b := make([]string, 5000)
+	for i := range a {
+		a[i] = fmt.Sprintf("old %d", i)
+		b[i] = fmt.Sprintf("new %d", i)
+	}
+	a = append([]string{"same"}, a...)
+	b = append([]string{"same"}, b...)
+
+	diff := DiffLines(a, b)
+	if len(diff) != 10001 {
+		t.Fatalf("Expected 10001 lines, got %d", len(diff))
+	}
+	if diff[0].Kind != DiffContext || diff[1].Kind != DiffRemoved || diff[5000].Kind != DiffRemoved || diff[5001].Kind != DiffAdded || diff[10000].Text != "new 4999" {
+		t.Errorf("Expected the shared line, then all old lines removed and all new lines added, got %v ... %v", diff[:2], diff[5000:5002])
+	}
+}
+
+// TestDiffChanged tests telling a diff with changes from one with only context lines
+func TestDiffChanged(t *testing.T) {
+	if DiffChanged(DiffText("a\nb", "a\nb")) {
+		t.Error("Expected identical texts to have no changes")
+	}
+	if !DiffChanged(DiffText("a\nb", "a")) {
+		t.Error("Expected a removed line to be a change")
+	}
+}
@@ -0,0 +1,162 @@
+package main
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+)
+
+const (
+	// DefaultHTTPReadTimeout bounds reading a request's headers and body, and how long an idle
+	// connection is kept open
+	DefaultHTTPReadTimeout = 30 * time.Second
+
+	// DefaultHTTPWriteTimeout bounds handling a request once its headers are read, including
+	// running the pipeline and writing the response
+	DefaultHTTPWriteTimeout = 2 * time.Minute
+)
+
+// HTTPGateway exposes the command layer of a TextCleanerCore over HTTP
+//
+// Endpoints:
+//
+//	POST /command   - body is a JSON command, response is the JSON command response
+//	GET  /pipeline  - shortcut for the get_pipeline command
+//	GET  /output    - shortcut for the get_output_text command
+type HTTPGateway struct {
+	core           *TextCleanerCore
+	execute        func(cmdJSON string) string // Runs commands: the core's ExecuteCommand, or a socket server's
+	authToken      string                      // Required as "Authorization: Bearer <token>" when set
+	maxMessageSize int64                       // Largest accepted request body in bytes
+	readTimeout    time.Duration               // Deadline for reading a request
+	writeTimeout   time.Duration               // Deadline for handling a request and writing the response
+}
+
+// NewHTTPGateway creates an HTTP gateway for the given core
+func NewHTTPGateway(core *TextCleanerCore) *HTTPGateway {
+	return &HTTPGateway{
+		core:           core,
+		execute:        core.ExecuteCommand,
+		maxMessageSize: DefaultMaxMessageSize,
+		readTimeout:    DefaultHTTPReadTimeout,
+		writeTimeout:   DefaultHTTPWriteTimeout,
+	}
+}
+
+// SetSocketServer runs commands through a socket server sharing the gateway's core, so changes
+// made over HTTP refresh the server's UIs and push state_changed events to its subscribers
+func (g *HTTPGateway) SetSocketServer(server *SocketServer) {
+	g.execute = server.ExecuteCommand
+}
+
+// SetTimeouts sets the deadlines for reading a request and for handling it
+// A zero duration disables that deadline
+func (g *HTTPGateway) SetTimeouts(read, write time.Duration) {
+	g.readTimeout = read
+	g.writeTimeout = write
+}
+
+// SetAuthToken requires requests to carry "Authorization: Bearer <token>"
+// An empty token disables authentication
+func (g *HTTPGateway) SetAuthToken(token string) {
+	g.authToken = token
+}
+
+// Handler returns the http.Handler serving the gateway endpoints
+func (g *HTTPGateway) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/command", g.handleCommand)
+	mux.HandleFunc("/pipeline", g.handleShortcut("get_pipeline"))
+	mux.HandleFunc("/output", g.handleShortcut("get_output_text"))
+	return g.requireAuth(mux)
+}
+
+// Server returns an http.Server for the gateway on the given address, with the gateway's timeouts
+// so a client that sends its request slowly can't hold a connection open forever
+func (g *HTTPGateway) Server(addr string) *http.Server {
+	return &http.Server{
+		Addr:              addr,
+		Handler:           g.Handler(),
+		ReadHeaderTimeout: g.readTimeout,
+		ReadTimeout:       g.readTimeout,
+		WriteTimeout:      g.writeTimeout,
+	}
+}
+
+// ListenAndServe serves the gateway on the given address until it fails
+func (g *HTTPGateway) ListenAndServe(addr string) error {
+	return g.Server(addr).ListenAndServe()
+}
+
+// requireAuth rejects requests without the configured bearer token
+func (g *HTTPGateway) requireAuth(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if g.authToken != "" {
+			token, hasBearer := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+			if !hasBearer || subtle.ConstantTimeCompare([]byte(token), []byte(g.authToken)) != 1 {
+				writeHTTPResponse(w, http.StatusUnauthorized, ErrorResponse(ErrCodeAuthRequired, "authentication required"))
+				return
+			}
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// handleCommand executes a JSON command from the request body
+func (g *HTTPGateway) handleCommand(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		writeHTTPResponse(w, http.StatusMethodNotAllowed, ErrorResponse(ErrCodeMethodNotAllowed, "method not allowed, use POST"))
+		return
+	}
+
+	body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, g.maxMessageSize))
+	if err != nil {
+		writeHTTPResponse(w, http.StatusRequestEntityTooLarge, ErrorResponse(ErrCodeMessageTooLarge, fmt.Sprintf("failed to read request: %v", err)))
+		return
+	}
+
+	// Bearer token auth belongs to the gateway, so report it here
+	if action, _ := parseAction(body); action == "get_capabilities" {
+		capabilities := g.core.Capabilities()
+		capabilities.Features["auth"] = g.authToken != ""
+		writeHTTPResponse(w, http.StatusOK, SuccessResponse(capabilities))
+		return
+	}
+
+	g.writeCommandResponse(w, g.execute(string(body)))
+}
+
+// handleShortcut returns a GET handler that runs a parameterless command
+func (g *HTTPGateway) handleShortcut(action string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			w.Header().Set("Allow", http.MethodGet)
+			writeHTTPResponse(w, http.StatusMethodNotAllowed, ErrorResponse(ErrCodeMethodNotAllowed, "method not allowed, use GET"))
+			return
+		}
+
+		cmdJSON, _ := json.Marshal(Command{Action: action, Params: map[string]interface{}{}})
+		g.writeCommandResponse(w, g.execute(string(cmdJSON)))
+	}
+}
+
+// writeCommandResponse writes a command response, using 400 for failed commands
+func (g *HTTPGateway) writeCommandResponse(w http.ResponseWriter, response string) {
+	status := http.StatusOK
+	if !responseSucceeded(response) {
+		status = http.StatusBadRequest
+	}
+	writeHTTPResponse(w, status, response)
+}
+
+// writeHTTPResponse writes a JSON body with the given status code
+func writeHTTPResponse(w http.ResponseWriter, status int, body string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	io.WriteString(w, body)
+}
@@ -0,0 +1,204 @@
+package main
+
+import (
+	"encoding/json"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+// postCommand sends a JSON command to the gateway and decodes the response
+func postCommand(t *testing.T, handler http.Handler, cmdJSON string) (int, Response) {
+	t.Helper()
+
+	req := httptest.NewRequest(http.MethodPost, "/command", strings.NewReader(cmdJSON))
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+
+	var resp Response
+	if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("Response is not valid JSON: %v (%s)", err, rec.Body.String())
+	}
+	return rec.Code, resp
+}
+
+// TestHTTPCreateNodeAndGetOutput tests a create-node + get-output flow over HTTP
+func TestHTTPCreateNodeAndGetOutput(t *testing.T) {
+	core := NewTextCleanerCore()
+	handler := NewHTTPGateway(core).Handler()
+
+	code, resp := postCommand(t, handler, `{"action":"create_node","params":{"type":"operation","name":"Upper","operation":"Uppercase"}}`)
+	if code != http.StatusOK || !resp.Success {
+		t.Fatalf("Expected create_node to succeed, got %d: %+v", code, resp)
+	}
+
+	code, resp = postCommand(t, handler, `{"action":"set_input_text","params":{"text":"hello http"}}`)
+	if code != http.StatusOK || !resp.Success {
+		t.Fatalf("Expected set_input_text to succeed, got %d: %+v", code, resp)
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/output", nil)
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected 200, got %d", rec.Code)
+	}
+	if ct := rec.Header().Get("Content-Type"); ct != "application/json" {
+		t.Errorf("Expected JSON content type, got '%s'", ct)
+	}
+	if !strings.Contains(rec.Body.String(), "HELLO HTTP") {
+		t.Errorf("Expected output to contain 'HELLO HTTP', got: %s", rec.Body.String())
+	}
+
+	req = httptest.NewRequest(http.MethodGet, "/pipeline", nil)
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), `"Uppercase"`) {
+		t.Errorf("Expected pipeline with Uppercase node, got %d: %s", rec.Code, rec.Body.String())
+	}
+}
+
+// TestHTTPCapabilities tests that the gateway reports whether it requires a bearer token
+func TestHTTPCapabilities(t *testing.T) {
+	gateway := NewHTTPGateway(NewTextCleanerCore())
+	gateway.SetAuthToken("s3cret")
+
+	req := httptest.NewRequest(http.MethodPost, "/command", strings.NewReader(`{"action":"get_capabilities"}`))
+	req.Header.Set("Authorization", "Bearer s3cret")
+	rec := httptest.NewRecorder()
+	gateway.Handler().ServeHTTP(rec, req)
+
+	var resp Response
+	if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("Response is not valid JSON: %v (%s)", err, rec.Body.String())
+	}
+	if rec.Code != http.StatusOK || !resp.Success {
+		t.Fatalf("Expected get_capabilities to succeed, got %d: %+v", rec.Code, resp)
+	}
+	features := resp.Result.(map[string]interface{})["features"].(map[string]interface{})
+	if features["auth"] != true || features["subscribe"] != false || features["batch"] != true {
+		t.Errorf("Unexpected features: %v", features)
+	}
+}
+
+// TestHTTPErrors tests failed commands, wrong methods and authentication
+func TestHTTPErrors(t *testing.T) {
+	core := NewTextCleanerCore()
+	gateway := NewHTTPGateway(core)
+	handler := gateway.Handler()
+
+	code, resp := postCommand(t, handler, `{"action":"delete_node","params":{"node_id":"missing"}}`)
+	if code != http.StatusBadRequest || resp.Success {
+		t.Errorf("Expected 400 for failed command, got %d: %+v", code, resp)
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/command", nil)
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	if rec.Code != http.StatusMethodNotAllowed {
+		t.Errorf("Expected 405 for GET /command, got %d", rec.Code)
+	}
+
+	gateway.SetAuthToken("s3cret")
+	handler = gateway.Handler()
+
+	req = httptest.NewRequest(http.MethodGet, "/pipeline", nil)
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	if rec.Code != http.StatusUnauthorized {
+		t.Errorf("Expected 401 without token, got %d", rec.Code)
+	}
+
+	req = httptest.NewRequest(http.MethodGet, "/pipeline", nil)
+	req.Header.Set("Authorization", "s3cret")
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	if rec.Code != http.StatusUnauthorized {
+		t.Errorf("Expected 401 for a token without the Bearer scheme, got %d", rec.Code)
+	}
+
+	req = httptest.NewRequest(http.MethodGet, "/pipeline", nil)
+	req.Header.Set("Authorization", "Bearer s3cret")
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Errorf("Expected 200 with token, got %d", rec.Code)
+	}
+}
+
+// TestHTTPChangesReachSubscribers tests that commands sent over HTTP notify socket subscribers
+func TestHTTPChangesReachSubscribers(t *testing.T) {
+	socketPath := "/tmp/test_textcleaner_19.sock"
+	defer os.Remove(socketPath)
+
+	core := NewTextCleanerCore()
+	server := NewSocketServer(socketPath, core)
+	updates := 0
+	server.SetUpdateCallback(func() { updates++ })
+	if err := server.Start(); err != nil {
+		t.Fatalf("Failed to start socket server: %v", err)
+	}
+	defer server.Stop()
+
+	subscriber, err := NewSocketClient(socketPath)
+	if err != nil {
+		t.Fatalf("Failed to connect subscriber: %v", err)
+	}
+	defer subscriber.Close()
+	if err := subscriber.Subscribe(false); err != nil {
+		t.Fatalf("Failed to subscribe: %v", err)
+	}
+
+	gateway := NewHTTPGateway(core)
+	gateway.SetSocketServer(server)
+	code, resp := postCommand(t, gateway.Handler(), `{"action":"create_node","params":{"type":"operation","name":"Upper","operation":"Uppercase"}}`)
+	if code != http.StatusOK || !resp.Success {
+		t.Fatalf("Expected create_node to succeed, got %d: %+v", code, resp)
+	}
+
+	subscriber.conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+	event, err := subscriber.ReceiveEvent()
+	if err != nil {
+		t.Fatalf("Expected a pushed event: %v", err)
+	}
+	if event["event"] != "state_changed" || event["action"] != "create_node" {
+		t.Errorf("Unexpected event: %v", event)
+	}
+	if updates != 1 {
+		t.Errorf("Expected the update callback to run once, ran %d times", updates)
+	}
+}
+
+// TestHTTPReadTimeout tests that a client that never finishes its request is disconnected
+func TestHTTPReadTimeout(t *testing.T) {
+	gateway := NewHTTPGateway(NewTextCleanerCore())
+	gateway.SetTimeouts(100*time.Millisecond, time.Second)
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+	server := gateway.Server("")
+	go server.Serve(listener)
+	defer server.Close()
+
+	conn, err := net.Dial("tcp", listener.Addr().String())
+	if err != nil {
+		t.Fatalf("Failed to connect: %v", err)
+	}
+	defer conn.Close()
+
+	// The headers never end
+	io.WriteString(conn, "POST /command HTTP/1.1\r\nHost: localhost\r\n")
+	conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+	if _, err := io.ReadAll(conn); err != nil {
+		t.Errorf("Expected the server to close the connection, got: %v", err)
+	}
+}
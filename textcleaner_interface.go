@@ -11,8 +11,8 @@ type TextCleanerCommands interface {
 	// CreateNode creates a new root-level node and returns its ID
 	CreateNode(nodeType, name, operation, arg1, arg2, condition string) string
 
-	// UpdateNode updates an existing node's properties
-	UpdateNode(nodeID, name, operation, arg1, arg2, condition string) error
+	// UpdateNode updates an existing node's properties; an empty nodeType keeps the node's type
+	UpdateNode(nodeID, nodeType, name, operation, arg1, arg2, condition string) error
 
 	// DeleteNode removes a node and its subtree
 	DeleteNode(nodeID string) error
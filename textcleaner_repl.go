@@ -3,7 +3,11 @@ package main
 import (
 	"encoding/json"
 	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
 	"strings"
+	"time"
 
 	"github.com/chzyer/readline"
 	"github.com/fatih/color"
@@ -11,14 +15,16 @@ import (
 
 // REPLCommand represents a parsed command
 type REPLCommand struct {
-	Verb   string
-	Object string
-	Args   []string
+	Verb      string
+	Object    string
+	Args      []string
+	RawObject string // Object as typed, for values such as file paths where case matters
 }
 
 // REPLFormatter handles output formatting
 type REPLFormatter struct {
-	useColor bool
+	useColor   bool
+	errorCount int // Number of errors printed, so scripts can tell a command failed
 }
 
 // NewREPLFormatter creates a new formatter
@@ -37,6 +43,7 @@ func (f *REPLFormatter) PrintSuccess(message string) {
 
 // PrintError prints an error message
 func (f *REPLFormatter) PrintError(message string) {
+	f.errorCount++
 	if f.useColor {
 		color.Red("✗ Error: %s\n", message)
 	} else {
@@ -53,6 +60,21 @@ func (f *REPLFormatter) PrintInfo(message string) {
 	}
 }
 
+// PrintDiff prints a line diff, with removed lines in red and added lines in green
+func (f *REPLFormatter) PrintDiff(diff []DiffLine) {
+	for _, line := range diff {
+		text := line.Marker() + " " + line.Text
+		switch {
+		case !f.useColor || line.Kind == DiffContext:
+			fmt.Println(text)
+		case line.Kind == DiffRemoved:
+			color.New(color.FgRed).Println(text)
+		default:
+			color.New(color.FgGreen).Println(text)
+		}
+	}
+}
+
 // PrintTable prints a formatted ASCII table
 func (f *REPLFormatter) PrintTable(headers []string, rows [][]string) {
 	// Simple table printing without tablewriter
@@ -189,6 +211,7 @@ func ParseCommand(input string) (*REPLCommand, error) {
 
 	if len(parts) > 1 {
 		cmd.Object = strings.ToLower(parts[1])
+		cmd.RawObject = parts[1]
 		cmd.Args = parts[2:]
 	}
 
@@ -257,6 +280,8 @@ func ExecuteREPLCommand(cmd *REPLCommand, client *SocketClient, formatter *REPLF
 		return handleDeleteCommand(cmd, client, formatter)
 	case "select":
 		return handleSelectCommand(cmd, client, formatter)
+	case "duplicate", "enable", "disable":
+		return handleNodeActionCommand(cmd, client, formatter)
 
 	// Tree operations
 	case "indent":
@@ -277,10 +302,20 @@ func ExecuteREPLCommand(cmd *REPLCommand, client *SocketClient, formatter *REPLF
 	// Meta commands
 	case "info":
 		return handleInfoCommand(cmd, client, formatter)
+	case "ping":
+		return handlePingCommand(cmd, client, formatter)
+	case "search":
+		return handleSearchCommand(cmd, client, formatter)
+	case "diff":
+		return handleDiffCommand(cmd, client, formatter)
+	case "run":
+		return handleRunCommand(cmd, client, formatter)
 
 	// Text processing
 	case "set":
 		return handleSetCommand(cmd, client, formatter, rl)
+	case "process":
+		return handleProcessCommand(cmd, client, formatter, rl)
 
 	// Pipeline commands
 	case "export":
@@ -294,6 +329,9 @@ func ExecuteREPLCommand(cmd *REPLCommand, client *SocketClient, formatter *REPLF
 	case "quit", "exit":
 		return fmt.Errorf("exit")
 	case "clear":
+		if cmd.Object == "pipeline" {
+			return handleNodeActionCommand(cmd, client, formatter)
+		}
 		fmt.Print("\033[2J\033[H") // Clear screen
 		return nil
 
@@ -310,7 +348,7 @@ func handleCreateCommand(cmd *REPLCommand, client *SocketClient, formatter *REPL
 	if cmd.Object == "node" {
 		// create node <name> [type <node_type>] [operation <op_name>] [arg1 <value>] [arg2 <value>] [parent <parent_id>]
 		// Support both: "create node Name OpName" and "create node Name operation OpName"
-		// Node types: operation (default), foreach, if, group
+		// Node types: operation (default), foreach, if, group, capture, subroutine
 		if len(cmd.Args) < 1 {
 			formatter.PrintError("create node requires a name")
 			return nil
@@ -322,6 +360,7 @@ func handleCreateCommand(cmd *REPLCommand, client *SocketClient, formatter *REPL
 		arg2 := ""
 		condition := ""
 		parentID := ""
+		positionalOperation := false
 
 		// Parse remaining arguments
 		i := 1
@@ -369,6 +408,7 @@ func handleCreateCommand(cmd *REPLCommand, client *SocketClient, formatter *REPL
 				// If not a keyword, treat as positional: first extra arg is operation
 				if operation == "" {
 					operation = cmd.Args[i]
+					positionalOperation = true
 				} else if arg1 == "" {
 					arg1 = cmd.Args[i]
 				} else if arg2 == "" {
@@ -382,6 +422,13 @@ func handleCreateCommand(cmd *REPLCommand, client *SocketClient, formatter *REPL
 			i++
 		}
 
+		if positionalOperation && strings.EqualFold(nodeType, "operation") {
+			if err := checkPositionalOperation("create node", name, operation); err != nil {
+				formatter.PrintError(err.Error())
+				return nil
+			}
+		}
+
 		// Build JSON command with parent_id and node type
 		var jsonCmd string
 		if parentID != "" {
@@ -415,7 +462,7 @@ func handleCreateCommand(cmd *REPLCommand, client *SocketClient, formatter *REPL
 			formatter.PrintError(errMsg)
 		}
 	} else if cmd.Object == "child" {
-		// create child <parent_id> <name> [operation] [arg1] [arg2]
+		// create child <parent_id> <name> [[operation] <op_name>] [arg1] [arg2]
 		if len(cmd.Args) < 2 {
 			formatter.PrintError("create child requires parent_id and name")
 			return nil
@@ -426,14 +473,28 @@ func handleCreateCommand(cmd *REPLCommand, client *SocketClient, formatter *REPL
 		arg1 := ""
 		arg2 := ""
 
-		if len(cmd.Args) > 2 {
-			operation = cmd.Args[2]
+		// The operation keyword is optional, as with create node
+		rest := cmd.Args[2:]
+		positionalOperation := true
+		if len(rest) > 1 && strings.EqualFold(rest[0], "operation") {
+			rest = rest[1:]
+			positionalOperation = false
+		}
+
+		if len(rest) > 0 {
+			operation = rest[0]
+			if positionalOperation {
+				if err := checkPositionalOperation("create child "+parentID, name, operation); err != nil {
+					formatter.PrintError(err.Error())
+					return nil
+				}
+			}
 		}
-		if len(cmd.Args) > 3 {
-			arg1 = cmd.Args[3]
+		if len(rest) > 1 {
+			arg1 = rest[1]
 		}
-		if len(cmd.Args) > 4 {
-			arg2 = cmd.Args[4]
+		if len(rest) > 2 {
+			arg2 = rest[2]
 		}
 
 		jsonCmd := fmt.Sprintf(
@@ -517,7 +578,7 @@ func handleUpdateCommand(cmd *REPLCommand, client *SocketClient, formatter *REPL
 		}
 
 		jsonCmd := fmt.Sprintf(
-			`{"action":"update_node","params":{"node_id":"%s","type":"operation","name":"%s","operation":"%s","arg1":"%s","arg2":"%s","condition":""}}`,
+			`{"action":"update_node","params":{"node_id":"%s","name":"%s","operation":"%s","arg1":"%s","arg2":"%s","condition":""}}`,
 			escapeJSON(nodeID), escapeJSON(name), escapeJSON(operation), escapeJSON(arg1), escapeJSON(arg2),
 		)
 
@@ -575,6 +636,62 @@ func handleDeleteCommand(cmd *REPLCommand, client *SocketClient, formatter *REPL
 	return nil
 }
 
+// nodeActionJSON builds the command for duplicate/enable/disable node <node_id> and clear pipeline
+func nodeActionJSON(cmd *REPLCommand) (string, error) {
+	if cmd.Verb == "clear" {
+		return `{"action":"clear_pipeline","params":{}}`, nil
+	}
+
+	if cmd.Object != "node" {
+		return "", fmt.Errorf("%s requires 'node' argument", cmd.Verb)
+	}
+	if len(cmd.Args) < 1 {
+		return "", fmt.Errorf("%s node requires node_id", cmd.Verb)
+	}
+
+	return fmt.Sprintf(
+		`{"action":"%s_node","params":{"node_id":"%s"}}`,
+		cmd.Verb, escapeJSON(cmd.Args[0]),
+	), nil
+}
+
+func handleNodeActionCommand(cmd *REPLCommand, client *SocketClient, formatter *REPLFormatter) error {
+	jsonCmd, err := nodeActionJSON(cmd)
+	if err != nil {
+		formatter.PrintError(err.Error())
+		return nil
+	}
+
+	response, err := client.Execute(jsonCmd)
+	if err != nil {
+		formatter.PrintError(err.Error())
+		return nil
+	}
+
+	if success, ok := response["success"].(bool); ok && success {
+		switch cmd.Verb {
+		case "duplicate":
+			if result, ok := response["result"].(map[string]interface{}); ok {
+				if nodeID, ok := result["node_id"].(string); ok {
+					formatter.PrintSuccess(fmt.Sprintf("Duplicated node %s as %s", cmd.Args[0], nodeID))
+				}
+			}
+		case "enable":
+			formatter.PrintSuccess(fmt.Sprintf("Enabled node: %s", cmd.Args[0]))
+		case "disable":
+			formatter.PrintSuccess(fmt.Sprintf("Disabled node: %s", cmd.Args[0]))
+		case "clear":
+			formatter.PrintSuccess("Pipeline cleared")
+		}
+		return nil
+	}
+
+	if errMsg, ok := response["error"].(string); ok {
+		formatter.PrintError(errMsg)
+	}
+	return nil
+}
+
 func handleSelectCommand(cmd *REPLCommand, client *SocketClient, formatter *REPLFormatter) error {
 	if cmd.Object == "node" {
 		// select node <node_id>
@@ -948,6 +1065,142 @@ func handleSetCommand(cmd *REPLCommand, client *SocketClient, formatter *REPLFor
 	return nil
 }
 
+func handleProcessCommand(cmd *REPLCommand, client *SocketClient, formatter *REPLFormatter, rl *readline.Instance) error {
+	// process [<in>] [to <out>]; without <in> the text is read until EOF
+	var words []string
+	if cmd.RawObject != "" {
+		words = append([]string{cmd.RawObject}, cmd.Args...)
+	}
+
+	outPath := ""
+	if n := len(words); n >= 2 && strings.EqualFold(words[n-2], "to") {
+		outPath = words[n-1]
+		words = words[:n-2]
+	}
+	if len(words) > 1 {
+		formatter.PrintError("usage: process [<file>] [to <file>]")
+		return nil
+	}
+
+	var text string
+	if len(words) == 1 {
+		data, err := os.ReadFile(words[0])
+		if err != nil {
+			formatter.PrintError(err.Error())
+			return nil
+		}
+		text = string(data)
+	} else {
+		var err error
+		if text, err = readUntilEOF(rl, formatter); err != nil {
+			formatter.PrintError(err.Error())
+			return nil
+		}
+	}
+
+	response, err := client.Execute(fmt.Sprintf(
+		`{"action":"set_input_text","params":{"text":"%s"}}`,
+		escapeJSON(text),
+	))
+	if err != nil {
+		formatter.PrintError(err.Error())
+		return nil
+	}
+	if success, ok := response["success"].(bool); !ok || !success {
+		if errMsg, ok := response["error"].(string); ok {
+			formatter.PrintError(errMsg)
+		}
+		return nil
+	}
+
+	response, err = client.Execute(`{"action":"get_output_text","params":{}}`)
+	if err != nil {
+		formatter.PrintError(err.Error())
+		return nil
+	}
+	if success, ok := response["success"].(bool); !ok || !success {
+		if errMsg, ok := response["error"].(string); ok {
+			formatter.PrintError(errMsg)
+		}
+		return nil
+	}
+
+	output := ""
+	if result, ok := response["result"].(map[string]interface{}); ok {
+		output, _ = result["output"].(string)
+	}
+
+	if outPath == "" {
+		fmt.Println(output)
+		return nil
+	}
+	if err := os.WriteFile(outPath, []byte(output), 0644); err != nil {
+		formatter.PrintError(err.Error())
+		return nil
+	}
+	formatter.PrintSuccess(fmt.Sprintf("Wrote output to %s", outPath))
+	return nil
+}
+
+// readUntilEOF reads text for process from the line editor until Ctrl+D
+// Scripts have no line editor; they must name the input file, rather than take whatever is on stdin
+func readUntilEOF(rl *readline.Instance, formatter *REPLFormatter) (string, error) {
+	if rl == nil {
+		return "", fmt.Errorf("process needs an input file here: process <file> [to <file>]")
+	}
+
+	formatter.PrintInfo("Enter text (end with Ctrl+D):")
+
+	var lines []string
+	rl.SetPrompt("")
+	defer rl.SetPrompt("textcleaner> ")
+	for {
+		line, err := rl.Readline()
+		if err == readline.ErrInterrupt {
+			continue
+		} else if err != nil {
+			break
+		}
+		lines = append(lines, line)
+	}
+	return strings.Join(lines, "\n"), nil
+}
+
+func handleDiffCommand(cmd *REPLCommand, client *SocketClient, formatter *REPLFormatter) error {
+	// diff
+	texts := make([]string, 0, 2)
+	for _, query := range []struct{ action, key string }{
+		{"get_input_text", "text"},
+		{"get_output_text", "output"},
+	} {
+		response, err := client.Execute(fmt.Sprintf(`{"action":"%s","params":{}}`, query.action))
+		if err != nil {
+			formatter.PrintError(err.Error())
+			return nil
+		}
+		if success, ok := response["success"].(bool); !ok || !success {
+			if errMsg, ok := response["error"].(string); ok {
+				formatter.PrintError(errMsg)
+			}
+			return nil
+		}
+
+		text := ""
+		if result, ok := response["result"].(map[string]interface{}); ok {
+			text, _ = result[query.key].(string)
+		}
+		texts = append(texts, text)
+	}
+
+	diff := DiffText(texts[0], texts[1])
+	if !DiffChanged(diff) {
+		formatter.PrintInfo("The pipeline doesn't change the input")
+		return nil
+	}
+	formatter.PrintDiff(diff)
+	return nil
+}
+
 func handleExportCommand(cmd *REPLCommand, client *SocketClient, formatter *REPLFormatter) error {
 	// export
 	jsonCmd := `{"action":"export_pipeline","params":{}}`
@@ -1050,6 +1303,157 @@ func handleInfoCommand(cmd *REPLCommand, client *SocketClient, formatter *REPLFo
 	return nil
 }
 
+func handlePingCommand(cmd *REPLCommand, client *SocketClient, formatter *REPLFormatter) error {
+	uptime, err := client.Ping()
+	if err != nil {
+		formatter.PrintError(err.Error())
+		return nil
+	}
+
+	formatter.PrintSuccess(fmt.Sprintf("pong (server up %s)", time.Duration(uptime*float64(time.Second)).Round(time.Second)))
+	return nil
+}
+
+func handleSearchCommand(cmd *REPLCommand, client *SocketClient, formatter *REPLFormatter) error {
+	// search <query> - rank operations by how well their name matches
+	query := strings.TrimSpace(strings.Join(append([]string{cmd.Object}, cmd.Args...), " "))
+	if query == "" {
+		formatter.PrintError("search requires a query")
+		return nil
+	}
+
+	jsonCmd := fmt.Sprintf(`{"action":"search_operations","params":{"query":"%s"}}`, escapeJSON(query))
+
+	response, err := client.Execute(jsonCmd)
+	if err != nil {
+		formatter.PrintError(err.Error())
+		return nil
+	}
+
+	if success, ok := response["success"].(bool); ok && success {
+		if result, ok := response["result"].(map[string]interface{}); ok {
+			operations, _ := result["operations"].([]interface{})
+			if len(operations) == 0 {
+				formatter.PrintInfo("No operations match '" + query + "'")
+				return nil
+			}
+
+			headers := []string{"Operation Name", "Description"}
+			var rows [][]string
+			for _, opInterface := range operations {
+				if op, ok := opInterface.(map[string]interface{}); ok {
+					name, _ := op["name"].(string)
+					desc, _ := op["description"].(string)
+					rows = append(rows, []string{name, desc})
+				}
+			}
+
+			formatter.PrintTable(headers, rows)
+			return nil
+		}
+	}
+
+	if errMsg, ok := response["error"].(string); ok {
+		formatter.PrintError(errMsg)
+	}
+	return nil
+}
+
+func handleRunCommand(cmd *REPLCommand, client *SocketClient, formatter *REPLFormatter) error {
+	return runScriptCommand(cmd, client, formatter, nil)
+}
+
+// runScriptCommand runs the script a run command names; running holds the absolute paths of
+// the scripts that led to it
+func runScriptCommand(cmd *REPLCommand, client *SocketClient, formatter *REPLFormatter, running []string) error {
+	// run <file> [continue]
+	if cmd.RawObject == "" {
+		formatter.PrintError("run requires a file")
+		return nil
+	}
+	continueOnError := len(cmd.Args) > 0 && strings.ToLower(cmd.Args[0]) == "continue"
+
+	if err := runScriptFile(cmd.RawObject, client, formatter, continueOnError, running); err != nil {
+		formatter.PrintError(err.Error())
+	}
+	return nil
+}
+
+// runScript executes a file of REPL commands, one per line
+// Blank lines and lines starting with # are skipped. Unless continueOnError is set, the first
+// command that fails stops the script and is reported in the returned error
+func runScript(path string, client *SocketClient, formatter *REPLFormatter, continueOnError bool) error {
+	return runScriptFile(path, client, formatter, continueOnError, nil)
+}
+
+// runScriptFile runs a script started from the scripts in running
+// A script that is already running, directly or through other scripts, is refused, since
+// running it again would never end
+func runScriptFile(path string, client *SocketClient, formatter *REPLFormatter, continueOnError bool, running []string) error {
+	absPath, err := filepath.Abs(path)
+	if err != nil {
+		return err
+	}
+	if slices.Contains(running, absPath) {
+		return fmt.Errorf("%s: script runs itself through 'run'", path)
+	}
+	running = append(running[:len(running):len(running)], absPath)
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+
+	failed := 0
+	for i, line := range strings.Split(string(data), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		errorsBefore := formatter.errorCount
+		cmd, err := ParseCommand(line)
+		switch {
+		case err != nil:
+			formatter.PrintError(err.Error())
+		case needsInteractiveInput(cmd):
+			formatter.PrintError(fmt.Sprintf("'%s %s' reads more lines interactively, put the text on the same line in scripts", cmd.Verb, cmd.Object))
+		case cmd.Verb == "run":
+			runScriptCommand(cmd, client, formatter, running)
+		default:
+			if err := ExecuteREPLCommand(cmd, client, formatter, nil); err != nil {
+				if err.Error() == "exit" {
+					return nil
+				}
+				formatter.PrintError(err.Error())
+			}
+		}
+
+		if formatter.errorCount > errorsBefore {
+			failed++
+			if !continueOnError {
+				return fmt.Errorf("%s:%d: script stopped at '%s'", path, i+1, line)
+			}
+		}
+	}
+
+	if failed > 0 {
+		return fmt.Errorf("%s: %d command(s) failed", path, failed)
+	}
+	return nil
+}
+
+// needsInteractiveInput reports whether a command would prompt for more lines, which a script can't answer
+func needsInteractiveInput(cmd *REPLCommand) bool {
+	switch {
+	case cmd.Verb == "set" && cmd.Object == "input" && len(cmd.Args) == 0:
+		return true
+	case cmd.Verb == "import" && cmd.Object == "":
+		return true
+	}
+	return false
+}
+
 func showAvailableTypes(client *SocketClient, formatter *REPLFormatter) error {
 	jsonCmd := `{"action":"list_node_types","params":{}}`
 
@@ -1110,6 +1514,9 @@ NODE MANAGEMENT:
                               Update an existing node
   delete node <node_id>        Delete a node and its children
   select node <node_id>        Select a node
+  duplicate node <node_id>     Copy a node and its children next to it
+  enable node <node_id>        Run a disabled node again
+  disable node <node_id>       Skip a node and its children, passing text through
 
 TREE OPERATIONS:
   indent <node_id>            Make node a child of previous sibling
@@ -1125,19 +1532,27 @@ QUERY COMMANDS:
   get input                   Get current input text
   get output                  Get processed output text
   get selected                Get currently selected node ID
+  search <query>              Find operations by name (e.g. search white)
+  diff                        Show the lines the pipeline changes (- input, + output)
 
 TEXT PROCESSING:
   set input <text>            Set input text
   set input                   Enter multiline input mode
+  process <file> [to <file>]  Run a file through the pipeline, printing or saving the output
+  process                     Same, reading the text until Ctrl+D (stdin with --script)
 
 PIPELINE MANAGEMENT:
   export                      Export pipeline as JSON
   import <json>               Import pipeline from JSON
   import                      Enter multiline JSON import mode
+  clear pipeline              Remove all nodes (input text is kept)
 
 UTILITIES:
+  run <file> [continue]       Run the REPL commands in a file, stopping at the first error
+                              unless 'continue' is given
   help [command]              Show this help or help for specific command
   info [types]                Show available node types and operations
+  ping                        Check the server connection and show its uptime
   clear                       Clear the screen
   quit, exit                  Exit the REPL
 
@@ -1165,6 +1580,10 @@ create node <name> [operation] [arg1] [arg2] [condition]
   Examples:
     create node Uppercase operation Uppercase
     create node Replace operation Replace foo bar
+    create node "My Cleaner" operation Trim
+
+  Quote names with spaces: a word after the name that isn't a keyword
+  is taken as the operation, and an unknown operation is an error.
 
 create child <parent_id> <name> [operation] [arg1] [arg2]
   Creates a child node under a parent node.
@@ -1185,6 +1604,22 @@ delete node <node_id>
 
   Example:
     delete node node_0
+`,
+		"duplicate": `
+duplicate node <node_id>
+  Inserts a copy of a node, including its children, right after it.
+  The copies get new node IDs.
+
+  Example:
+    duplicate node node_0
+`,
+		"enable": `
+enable node <node_id>   Run a disabled node again
+disable node <node_id>  Skip a node and its children; its input passes through unchanged
+`,
+		"clear": `
+clear                   Clear the screen
+clear pipeline          Remove all nodes from the pipeline, keeping the input text
 `,
 		"set": `
 set input <text>
@@ -1194,6 +1629,19 @@ set input <text>
     set input hello world
     set input
       (then enter multiline text)
+`,
+		"process": `
+process <file>
+process <file> to <out_file>
+process
+  Sets the input text to the contents of a file and prints the output,
+  like 'set input' followed by 'get output'. With 'to', the output is
+  written to <out_file> instead. Without a file, the text is read until
+  Ctrl+D; scripts must always name the input file.
+
+  Examples:
+    process notes.txt
+    process notes.txt to cleaned.txt
 `,
 		"show": `
 show node <node_id>     Show details of a specific node
@@ -1203,12 +1651,39 @@ show tree               Show the pipeline as a tree diagram
 		"move": `
 move up <node_id>       Move a node earlier in its sibling list
 move down <node_id>     Move a node later in its sibling list
+`,
+		"run": `
+run <file> [continue]
+  Runs the REPL commands in a file, one per line. Blank lines and lines
+  starting with # are skipped. The script stops at the first command that
+  fails, unless 'continue' is given. Scripts can run other scripts, but
+  not one that is already running.
+
+  Example:
+    run build-pipeline.txt
+`,
+		"diff": `
+diff
+  Shows a line-by-line diff between the input and the output: lines the
+  pipeline removed or changed start with -, lines in the output start
+  with +, and unchanged lines are shown for context. Run with --no-color
+  (or NO_COLOR set) for plain output.
+`,
+		"search": `
+search <query>
+  Lists the operations whose names best match the query, best match first.
+  Whole words, word prefixes and loosely typed names all match.
+
+  Examples:
+    search white          (finds Normalize Whitespace)
+    search regex rep      (finds Regex Replace)
 `,
 		"indent": `
 indent <node_id>        Make a node a child of the previous sibling
 unindent <node_id>      Make a node a sibling of its parent
 `,
 	}
+	helps["disable"] = helps["enable"]
 
 	if help, ok := helps[command]; ok {
 		fmt.Println(help)
@@ -1220,9 +1695,10 @@ unindent <node_id>      Make a node a sibling of its parent
 
 // REPLSession manages the REPL interactive session
 type REPLSession struct {
-	client    *SocketClient
-	formatter *REPLFormatter
-	history   []string
+	client      *SocketClient
+	formatter   *REPLFormatter
+	history     []string
+	historyFile string // Where readline keeps history between sessions, empty for none
 }
 
 // NewREPLSession creates a new REPL session
@@ -1232,19 +1708,64 @@ func NewREPLSession(socketPath string) (*REPLSession, error) {
 		return nil, err
 	}
 
+	return newREPLSession(client), nil
+}
+
+// NewTCPREPLSession creates a new REPL session connected to a TCP socket server
+func NewTCPREPLSession(address string) (*REPLSession, error) {
+	client, err := NewTCPSocketClient(address)
+	if err != nil {
+		return nil, err
+	}
+
+	return newREPLSession(client), nil
+}
+
+// newREPLSession creates a REPL session using an established client connection
+func newREPLSession(client *SocketClient) *REPLSession {
 	session := &REPLSession{
 		client:    client,
-		formatter: NewREPLFormatter(true),
+		formatter: NewREPLFormatter(!color.NoColor),
 		history:   make([]string, 0),
 	}
 
-	return session, nil
+	return session
+}
+
+// RunScript executes a file of REPL commands without starting the interactive loop
+func (rs *REPLSession) RunScript(path string, continueOnError bool) error {
+	defer rs.client.Close()
+	return runScript(path, rs.client, rs.formatter, continueOnError)
+}
+
+// SetHistoryFile makes the session load and save its command history in path
+func (rs *REPLSession) SetHistoryFile(path string) {
+	rs.historyFile = path
+}
+
+// newReadline creates the line editor, with history when the history file can be written
+func (rs *REPLSession) newReadline(config *readline.Config) (*readline.Instance, error) {
+	config.Prompt = "textcleaner> "
+	config.AutoComplete = &replCompleter{
+		operations: operationNames,
+		nodeIDs:    rs.liveNodeIDs,
+	}
+
+	if rs.historyFile != "" {
+		if err := prepareHistoryFile(rs.historyFile); err != nil {
+			rs.formatter.PrintInfo(fmt.Sprintf("History won't be saved: %v", err))
+		} else {
+			config.HistoryFile = rs.historyFile
+		}
+	}
+
+	return readline.NewEx(config)
 }
 
 // Run starts the interactive REPL loop
 func (rs *REPLSession) Run() error {
 	// Create readline instance
-	rl, err := readline.New("textcleaner> ")
+	rl, err := rs.newReadline(&readline.Config{})
 	if err != nil {
 		return err
 	}
@@ -1298,8 +1819,235 @@ func (rs *REPLSession) Run() error {
 	return nil
 }
 
+// replHistoryPath returns where the REPL keeps history between sessions:
+// $XDG_DATA_HOME/textcleaner/history, or ~/.local/share/textcleaner/history
+// Returns "" if there is no home directory
+func replHistoryPath() string {
+	dataHome := os.Getenv("XDG_DATA_HOME")
+	if dataHome == "" {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return ""
+		}
+		dataHome = filepath.Join(home, ".local", "share")
+	}
+	return filepath.Join(dataHome, "textcleaner", "history")
+}
+
+// prepareHistoryFile creates the history file and its directory, and checks it can be appended to
+// A read-only home directory makes this fail, so the REPL can run without history
+func prepareHistoryFile(path string) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return err
+	}
+
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0600)
+	if err != nil {
+		return err
+	}
+	return f.Close()
+}
+
+// liveNodeIDs fetches the IDs of every node in the server's pipeline, for completion
+func (rs *REPLSession) liveNodeIDs() []string {
+	response, err := rs.client.Execute(`{"action":"list_nodes","params":{}}`)
+	if err != nil {
+		return nil
+	}
+
+	result, _ := response["result"].(map[string]interface{})
+	nodes, _ := result["nodes"].([]interface{})
+
+	var ids []string
+	var collect func(nodes []interface{})
+	collect = func(nodes []interface{}) {
+		for _, nodeInterface := range nodes {
+			node, ok := nodeInterface.(map[string]interface{})
+			if !ok {
+				continue
+			}
+			if id, ok := node["id"].(string); ok {
+				ids = append(ids, id)
+			}
+			children, _ := node["children"].([]interface{})
+			collect(children)
+			elseChildren, _ := node["else_children"].([]interface{})
+			collect(elseChildren)
+		}
+	}
+	collect(nodes)
+	return ids
+}
+
+// operationNames returns the names of all operations, for completion
+func operationNames() []string {
+	operations := GetOperations()
+	names := make([]string, len(operations))
+	for i, op := range operations {
+		names[i] = op.Name
+	}
+	return names
+}
+
+// Tab completion
+
+// replVerbs lists the commands that can start a REPL line
+var replVerbs = []string{
+	"create", "update", "delete", "select", "duplicate", "enable", "disable", "indent", "unindent", "move",
+	"show", "list", "get", "diff", "info", "ping", "search", "run", "set", "process", "export", "import",
+	"help", "clear", "quit", "exit",
+}
+
+// replObjects lists the words that can follow each verb
+var replObjects = map[string][]string{
+	"create":    {"node", "child"},
+	"update":    {"node"},
+	"delete":    {"node"},
+	"select":    {"node"},
+	"duplicate": {"node"},
+	"enable":    {"node"},
+	"disable":   {"node"},
+	"clear":     {"pipeline"},
+	"move":      {"up", "down"},
+	"show":      {"node", "pipeline", "tree"},
+	"list":      {"nodes"},
+	"get":       {"input", "output", "selected"},
+	"set":       {"input"},
+	"info":      {"types"},
+}
+
+// replCompleter completes verbs, their objects, operation names and node IDs
+type replCompleter struct {
+	operations func() []string // Operation names
+	nodeIDs    func() []string // IDs of the nodes in the live pipeline
+}
+
+// Do implements readline.AutoCompleter
+// Words with spaces are completed with escaped spaces, or closed with the quote the word was started with
+func (c *replCompleter) Do(line []rune, pos int) ([][]rune, int) {
+	words, current, quote, typed := splitCompletionLine(string(line[:pos]))
+
+	var newLine [][]rune
+	for _, candidate := range c.candidates(words) {
+		if !strings.HasPrefix(candidate, current) {
+			continue
+		}
+
+		suffix := candidate[len(current):]
+		if quote != 0 {
+			suffix += string(quote)
+		} else {
+			suffix = strings.ReplaceAll(suffix, " ", `\ `)
+		}
+		newLine = append(newLine, []rune(suffix+" "))
+	}
+
+	return newLine, typed
+}
+
+// candidates returns the possible values for the word after words
+func (c *replCompleter) candidates(words []string) []string {
+	if len(words) == 0 {
+		return replVerbs
+	}
+
+	verb := strings.ToLower(words[0])
+	if len(words) == 1 {
+		switch verb {
+		case "indent", "unindent":
+			return c.nodeIDs()
+		case "help":
+			return replVerbs
+		}
+		return replObjects[verb]
+	}
+
+	// Keywords name the value that follows them
+	switch strings.ToLower(words[len(words)-1]) {
+	case "operation":
+		return c.operations()
+	case "parent":
+		return c.nodeIDs()
+	case "type":
+		return nodeTypes
+	}
+
+	command := verb + " " + strings.ToLower(words[1])
+	switch {
+	case len(words) == 2 && (command == "update node" || command == "delete node" || command == "select node" ||
+		command == "duplicate node" || command == "enable node" || command == "disable node" || command == "show node" || command == "move up" || command == "move down" || command == "create child"):
+		return c.nodeIDs()
+	case len(words) == 3 && command == "create node":
+		// create node <name> [operation]
+		return c.operations()
+	case len(words) == 4 && (command == "create child" || command == "update node"):
+		// create child <parent_id> <name> [operation], update node <node_id> <name> [operation]
+		return c.operations()
+	}
+
+	return nil
+}
+
+// splitCompletionLine splits a partial REPL line the way splitArgs does
+// Returns the complete words, the unescaped word being typed, the quote it was started with
+// (0 if none) and how many runes of the line that word takes
+func splitCompletionLine(line string) (words []string, current string, quote rune, typed int) {
+	var word strings.Builder
+	inWord := false
+	escaped := false
+
+	for _, ch := range line {
+		if inWord {
+			typed++
+		}
+
+		switch {
+		case escaped:
+			word.WriteRune(ch)
+			escaped = false
+		case ch == '\\':
+			escaped = true
+		case quote == 0 && (ch == '"' || ch == '\''):
+			quote = ch
+		case ch == quote:
+			quote = 0
+		case ch == ' ' && quote == 0:
+			if inWord {
+				words = append(words, word.String())
+				word.Reset()
+				inWord = false
+			}
+			continue
+		default:
+			word.WriteRune(ch)
+		}
+
+		if !inWord {
+			inWord = true
+			typed = 1
+		}
+	}
+
+	if !inWord {
+		typed = 0
+	}
+	return words, word.String(), quote, typed
+}
+
 // Helper functions
 
+// checkPositionalOperation reports an operation given without the operation keyword that doesn't exist
+// This is usually the second word of an unquoted name with spaces, so the error suggests quoting it
+func checkPositionalOperation(prefix, name, operation string) error {
+	for _, op := range operationNames() {
+		if op == operation {
+			return nil
+		}
+	}
+	return fmt.Errorf("unknown operation %q; if it is part of the name, quote the name: %s \"%s %s\"",
+		operation, prefix, name, operation)
+}
+
 func isKeyword(arg string) bool {
 	switch strings.ToLower(arg) {
 	case "type", "operation", "arg1", "arg2", "condition", "parent":
@@ -0,0 +1,406 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/chzyer/readline"
+)
+
+// newTestCompleter returns a completer with a fixed set of operations and node IDs
+func newTestCompleter() *replCompleter {
+	return &replCompleter{
+		operations: func() []string { return []string{"Uppercase", "Upper First", "Normalize Whitespace", "Trim"} },
+		nodeIDs:    func() []string { return []string{"node_0", "node_1", "node_12"} },
+	}
+}
+
+// complete runs the completer at the end of line and returns the candidates it offers
+func complete(c *replCompleter, line string) ([]string, int) {
+	newLine, length := c.Do([]rune(line), len([]rune(line)))
+	candidates := make([]string, len(newLine))
+	for i, suffix := range newLine {
+		candidates[i] = string(suffix)
+	}
+	return candidates, length
+}
+
+// TestREPLCompleter tests completion of verbs, objects, operation names and node IDs
+func TestREPLCompleter(t *testing.T) {
+	c := newTestCompleter()
+
+	tests := []struct {
+		line     string
+		expected []string
+		length   int
+		desc     string
+	}{
+		{"cr", []string{"eate "}, 2, "Verb prefix"},
+		{"s", []string{"elect ", "how ", "earch ", "et "}, 1, "Several verbs"},
+		{"show ", []string{"node ", "pipeline ", "tree "}, 0, "Objects after a verb"},
+		{"delete node node_1", []string{" ", "2 "}, 6, "Node ID prefix"},
+		{"indent ", []string{"node_0 ", "node_1 ", "node_12 "}, 0, "Node ID after indent"},
+		{"create node Shout Up", []string{"percase ", "per\\ First "}, 2, "Positional operation"},
+		{"create node Tidy operation Norm", []string{"alize\\ Whitespace "}, 4, "Operation after keyword"},
+		{`create node Tidy operation "Norm`, []string{"alize Whitespace\" "}, 5, "Quoted operation"},
+		{"create child node_0 Name T", []string{"rim "}, 1, "Operation for a child"},
+		{"create node Loop type f", []string{"oreach "}, 1, "Node type after keyword"},
+		{"create node Name parent node_", []string{"0 ", "1 ", "12 "}, 5, "Parent keyword"},
+		{"disable node node_1", []string{" ", "2 "}, 6, "Node ID after disable node"},
+		{"get output x", nil, 1, "Nothing to complete"},
+		{"xyz", nil, 3, "Unknown verb"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.desc, func(t *testing.T) {
+			candidates, length := complete(c, tt.line)
+			if strings.Join(candidates, "|") != strings.Join(tt.expected, "|") {
+				t.Errorf("Expected: %q, Got: %q", tt.expected, candidates)
+			}
+			if length != tt.length {
+				t.Errorf("Expected length %d, Got: %d", tt.length, length)
+			}
+		})
+	}
+}
+
+// TestNodeActionJSON tests the commands sent for duplicate, enable, disable and clear pipeline
+func TestNodeActionJSON(t *testing.T) {
+	tests := []struct {
+		line     string
+		expected string
+		desc     string
+	}{
+		{"duplicate node node_1", `{"action":"duplicate_node","params":{"node_id":"node_1"}}`, "Duplicate"},
+		{"enable node node_2", `{"action":"enable_node","params":{"node_id":"node_2"}}`, "Enable"},
+		{"Disable Node node_3", `{"action":"disable_node","params":{"node_id":"node_3"}}`, "Disable, any case"},
+		{"clear pipeline", `{"action":"clear_pipeline","params":{}}`, "Clear pipeline"},
+		{"duplicate node", "", "Missing node ID"},
+		{"enable node_2", "", "Missing node object"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.desc, func(t *testing.T) {
+			cmd, err := ParseCommand(tt.line)
+			if err != nil {
+				t.Fatalf("Parse failed: %v", err)
+			}
+			result, err := nodeActionJSON(cmd)
+			if tt.expected == "" {
+				if err == nil {
+					t.Errorf("Expected an error, got %q", result)
+				}
+				return
+			}
+			if err != nil || result != tt.expected {
+				t.Errorf("Expected: %q, Got: %q (%v)", tt.expected, result, err)
+			}
+			if !json.Valid([]byte(result)) {
+				t.Errorf("Invalid JSON: %s", result)
+			}
+		})
+	}
+}
+
+// TestSplitCompletionLine tests splitting partial lines with quotes and escapes
+func TestSplitCompletionLine(t *testing.T) {
+	tests := []struct {
+		line    string
+		words   []string
+		current string
+		quote   rune
+		desc    string
+	}{
+		{"", nil, "", 0, "Empty line"},
+		{"create node ", []string{"create", "node"}, "", 0, "Trailing space"},
+		{`create node "My Name" Up`, []string{"create", "node", "My Name"}, "Up", 0, "Quoted word"},
+		{`set input 'hello wo`, []string{"set", "input"}, "hello wo", '\'', "Open quote"},
+		{`update node node_0 Normalize\ Wh`, []string{"update", "node", "node_0"}, "Normalize Wh", 0, "Escaped space"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.desc, func(t *testing.T) {
+			words, current, quote, _ := splitCompletionLine(tt.line)
+			if strings.Join(words, "|") != strings.Join(tt.words, "|") {
+				t.Errorf("Expected words: %q, Got: %q", tt.words, words)
+			}
+			if current != tt.current || quote != tt.quote {
+				t.Errorf("Expected current %q (quote %q), Got: %q (quote %q)", tt.current, tt.quote, current, quote)
+			}
+		})
+	}
+}
+
+// readTestLine reads one line from a line editor fed with keystrokes
+func readTestLine(t *testing.T, rs *REPLSession, keys string) string {
+	t.Helper()
+
+	rl, err := rs.newReadline(&readline.Config{
+		Stdin:  io.NopCloser(strings.NewReader(keys)),
+		Stdout: io.Discard,
+		Stderr: io.Discard,
+	})
+	if err != nil {
+		t.Fatalf("Failed to create readline: %v", err)
+	}
+	defer rl.Close()
+
+	line, err := rl.Readline()
+	if err != nil {
+		t.Fatalf("Readline failed: %v", err)
+	}
+	return line
+}
+
+// TestREPLHistoryPersists tests that history is written to the data directory and recalled by the next session
+func TestREPLHistoryPersists(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	t.Setenv("XDG_DATA_HOME", "")
+
+	path := replHistoryPath()
+	if expected := filepath.Join(home, ".local", "share", "textcleaner", "history"); path != expected {
+		t.Fatalf("Expected history path %s, got %s", expected, path)
+	}
+
+	first := &REPLSession{formatter: NewREPLFormatter(false)}
+	first.SetHistoryFile(path)
+	if line := readTestLine(t, first, "show tree\n"); line != "show tree" {
+		t.Fatalf("Expected 'show tree', got %q", line)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil || !strings.Contains(string(data), "show tree") {
+		t.Fatalf("Expected history file to contain the command, got %q (%v)", data, err)
+	}
+
+	// Up arrow in a new session recalls the previous session's command
+	second := &REPLSession{formatter: NewREPLFormatter(false)}
+	second.SetHistoryFile(path)
+	if line := readTestLine(t, second, "\x1b[A\n"); line != "show tree" {
+		t.Errorf("Expected recalled 'show tree', got %q", line)
+	}
+}
+
+// TestREPLHistoryUnwritable tests that the REPL still starts when the history file can't be created
+func TestREPLHistoryUnwritable(t *testing.T) {
+	// A file where the data directory should be makes creating it fail, like a read-only home
+	blocker := filepath.Join(t.TempDir(), "share")
+	if err := os.WriteFile(blocker, nil, 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	rs := &REPLSession{formatter: NewREPLFormatter(false)}
+	rs.SetHistoryFile(filepath.Join(blocker, "textcleaner", "history"))
+	if line := readTestLine(t, rs, "get output\n"); line != "get output" {
+		t.Errorf("Expected 'get output', got %q", line)
+	}
+}
+
+// writeTestScript writes a REPL command file and returns its path
+func writeTestScript(t *testing.T, lines ...string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "pipeline.tc")
+	if err := os.WriteFile(path, []byte(strings.Join(lines, "\n")+"\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+// TestREPLRunScript tests running a command file and stopping at the first failing line
+func TestREPLRunScript(t *testing.T) {
+	socketPath := "/tmp/test_textcleaner_14.sock"
+	core := NewTextCleanerCore()
+	server := NewSocketServer(socketPath, core)
+	if err := server.Start(); err != nil {
+		t.Fatalf("Failed to start server: %v", err)
+	}
+	defer server.Stop()
+	time.Sleep(50 * time.Millisecond)
+
+	run := func(path string, continueOnError bool) error {
+		t.Helper()
+		session, err := NewREPLSession(socketPath)
+		if err != nil {
+			t.Fatalf("Failed to connect: %v", err)
+		}
+		session.formatter = NewREPLFormatter(false)
+		return session.RunScript(path, continueOnError)
+	}
+
+	script := writeTestScript(t,
+		"# Uppercase everything",
+		"",
+		"create node Upper operation Uppercase",
+		"set input hello world",
+	)
+	if err := run(script, false); err != nil {
+		t.Fatalf("Expected script to succeed, got %v", err)
+	}
+	if got := core.GetOutputText(); got != "HELLO WORLD" {
+		t.Errorf("Expected: %q, Got: %q", "HELLO WORLD", got)
+	}
+
+	failing := writeTestScript(t,
+		"delete node missing",
+		"set input not reached",
+	)
+	err := run(failing, false)
+	if err == nil || !strings.Contains(err.Error(), ":1: script stopped at 'delete node missing'") {
+		t.Errorf("Expected script to stop at line 1, got %v", err)
+	}
+	if got := core.GetInputText(); got != "hello world" {
+		t.Errorf("Expected the line after the failure to be skipped, input is %q", got)
+	}
+
+	err = run(failing, true)
+	if err == nil || !strings.Contains(err.Error(), "1 command(s) failed") {
+		t.Errorf("Expected failure count with continue, got %v", err)
+	}
+	if got := core.GetInputText(); got != "not reached" {
+		t.Errorf("Expected the script to continue past the failure, input is %q", got)
+	}
+
+	// A script that runs itself, directly or through another script, fails instead of looping
+	dir := t.TempDir()
+	first, second := filepath.Join(dir, "first.tc"), filepath.Join(dir, "second.tc")
+	os.WriteFile(first, []byte("set input first\nrun "+second+"\n"), 0600)
+	os.WriteFile(second, []byte("run "+first+"\n"), 0600)
+	err = run(first, false)
+	if err == nil || !strings.Contains(err.Error(), "script stopped at 'run "+second+"'") {
+		t.Errorf("Expected the loop to stop the script, got %v", err)
+	}
+	if got := core.GetInputText(); got != "first" {
+		t.Errorf("Expected the script to run once, input is %q", got)
+	}
+}
+
+// TestREPLProcessFile tests running a file through the pipeline and writing the result to a file
+func TestREPLProcessFile(t *testing.T) {
+	socketPath := "/tmp/test_textcleaner_15.sock"
+	core := NewTextCleanerCore()
+	core.CreateNode("operation", "Upper", "Uppercase", "", "", "")
+	server := NewSocketServer(socketPath, core)
+	if err := server.Start(); err != nil {
+		t.Fatalf("Failed to start server: %v", err)
+	}
+	defer server.Stop()
+	time.Sleep(50 * time.Millisecond)
+
+	client, err := NewSocketClient(socketPath)
+	if err != nil {
+		t.Fatalf("Failed to connect: %v", err)
+	}
+	defer client.Close()
+	formatter := NewREPLFormatter(false)
+
+	dir := t.TempDir()
+	inPath := filepath.Join(dir, "Notes In.txt")
+	outPath := filepath.Join(dir, "Out.txt")
+	if err := os.WriteFile(inPath, []byte("hello\nworld\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	cmd, err := ParseCommand(fmt.Sprintf("process %q to %s", inPath, outPath))
+	if err != nil {
+		t.Fatalf("Parse failed: %v", err)
+	}
+	if err := ExecuteREPLCommand(cmd, client, formatter, nil); err != nil {
+		t.Fatalf("process failed: %v", err)
+	}
+
+	data, err := os.ReadFile(outPath)
+	if err != nil {
+		t.Fatalf("Expected output file: %v", err)
+	}
+	if string(data) != "HELLO\nWORLD\n" {
+		t.Errorf("Expected: %q, Got: %q", "HELLO\nWORLD\n", data)
+	}
+	if got := core.GetInputText(); got != "hello\nworld\n" {
+		t.Errorf("Expected the file to become the input text, got %q", got)
+	}
+	if formatter.errorCount != 0 {
+		t.Errorf("Expected no errors, got %d", formatter.errorCount)
+	}
+
+	// A missing input file is reported and leaves the input text alone
+	cmd, _ = ParseCommand("process " + filepath.Join(dir, "missing.txt"))
+	ExecuteREPLCommand(cmd, client, formatter, nil)
+	if formatter.errorCount != 1 {
+		t.Errorf("Expected one error for a missing file, got %d", formatter.errorCount)
+	}
+	if got := core.GetInputText(); got != "hello\nworld\n" {
+		t.Errorf("Expected input text to be unchanged, got %q", got)
+	}
+
+	// Without a line editor, as in scripts, the input file can't be left out
+	for _, line := range []string{"process", "process to " + outPath} {
+		errorsBefore := formatter.errorCount
+		cmd, _ = ParseCommand(line)
+		ExecuteREPLCommand(cmd, client, formatter, nil)
+		if formatter.errorCount != errorsBefore+1 {
+			t.Errorf("%s: expected an error without an input file", line)
+		}
+	}
+	if got := core.GetInputText(); got != "hello\nworld\n" {
+		t.Errorf("Expected input text to be unchanged, got %q", got)
+	}
+}
+
+// TestREPLCreateNodeUnquotedName tests that a name with spaces must be quoted instead of filling the operation slot
+func TestREPLCreateNodeUnquotedName(t *testing.T) {
+	socketPath := "/tmp/test_textcleaner_16.sock"
+	core := NewTextCleanerCore()
+	server := NewSocketServer(socketPath, core)
+	if err := server.Start(); err != nil {
+		t.Fatalf("Failed to start server: %v", err)
+	}
+	defer server.Stop()
+	time.Sleep(50 * time.Millisecond)
+
+	client, err := NewSocketClient(socketPath)
+	if err != nil {
+		t.Fatalf("Failed to connect: %v", err)
+	}
+	defer client.Close()
+
+	tests := []struct {
+		line      string
+		wantError bool
+		desc      string
+	}{
+		{`create node My Cleaner`, true, "Unquoted name"},
+		{`create node "My Cleaner" Uppercase`, false, "Quoted name"},
+		{`create child node_0 Trim Step`, true, "Unquoted child name"},
+		{`create child node_0 "Trim Step" operation Trim`, false, "Quoted child name with keyword"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.desc, func(t *testing.T) {
+			formatter := NewREPLFormatter(false)
+			cmd, err := ParseCommand(tt.line)
+			if err != nil {
+				t.Fatalf("Parse failed: %v", err)
+			}
+			ExecuteREPLCommand(cmd, client, formatter, nil)
+			if got := formatter.errorCount > 0; got != tt.wantError {
+				t.Errorf("Expected error %v, got %d errors", tt.wantError, formatter.errorCount)
+			}
+		})
+	}
+
+	pipeline := core.GetPipeline()
+	if len(pipeline) != 1 || pipeline[0].Name != "My Cleaner" || pipeline[0].Operation != "Uppercase" {
+		t.Fatalf("Expected only the quoted node, got %+v", pipeline)
+	}
+	children := pipeline[0].Children
+	if len(children) != 1 || children[0].Name != "Trim Step" || children[0].Operation != "Trim" {
+		t.Errorf("Expected only the quoted child, got %+v", children)
+	}
+}
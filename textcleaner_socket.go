@@ -1,8 +1,10 @@
 package main
 
 import (
+	"crypto/subtle"
 	"encoding/binary"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"net"
@@ -10,8 +12,24 @@ import (
 	"os/signal"
 	"sync"
 	"syscall"
+	"time"
 )
 
+const (
+	// DefaultMaxMessageSize is the largest message the server accepts unless configured otherwise
+	DefaultMaxMessageSize = 8 * 1024 * 1024
+
+	// DefaultReadTimeout bounds how long the server waits for a message body once its length prefix arrived
+	DefaultReadTimeout = 30 * time.Second
+
+	// DefaultWriteTimeout bounds how long writing one message to a client may take, so a client
+	// that stops reading can't hold up the clients whose changes are pushed to it
+	DefaultWriteTimeout = 10 * time.Second
+)
+
+// ErrMessageTooLarge is returned when a length prefix exceeds the configured maximum message size
+var ErrMessageTooLarge = errors.New("message too large")
+
 // UpdateCallback is called when the core state changes via socket command
 type UpdateCallback func()
 
@@ -22,14 +40,102 @@ type SocketClient struct {
 
 // NewSocketClient connects to a running socket server
 func NewSocketClient(socketPath string) (*SocketClient, error) {
-	conn, err := net.Dial("unix", socketPath)
+	return dialSocketClient("unix", socketPath)
+}
+
+// NewTCPSocketClient connects to a socket server listening on a TCP address (host:port)
+func NewTCPSocketClient(address string) (*SocketClient, error) {
+	return dialSocketClient("tcp", address)
+}
+
+// dialSocketClient connects to a socket server over the given network ("unix" or "tcp")
+func dialSocketClient(network, address string) (*SocketClient, error) {
+	conn, err := net.Dial(network, address)
 	if err != nil {
-		return nil, fmt.Errorf("failed to connect to socket server at %s: %w", socketPath, err)
+		return nil, fmt.Errorf("failed to connect to socket server at %s: %w", address, err)
 	}
 
 	return &SocketClient{conn: conn}, nil
 }
 
+// Authenticate performs the auth handshake with a server that requires a shared token
+func (sc *SocketClient) Authenticate(token string) error {
+	cmdJSON, err := json.Marshal(map[string]interface{}{
+		"action": "auth",
+		"params": map[string]interface{}{"token": token},
+	})
+	if err != nil {
+		return err
+	}
+
+	resp, err := sc.Execute(string(cmdJSON))
+	if err != nil {
+		return err
+	}
+
+	if success, ok := resp["success"].(bool); !ok || !success {
+		errMsg, _ := resp["error"].(string)
+		return fmt.Errorf("authentication failed: %s", errMsg)
+	}
+	return nil
+}
+
+// Subscribe asks the server to push state_changed events on this connection
+// Use a dedicated connection: events arrive unsolicited and would be mistaken for command responses
+func (sc *SocketClient) Subscribe(includePipeline bool) error {
+	cmdJSON, err := json.Marshal(map[string]interface{}{
+		"action": "subscribe",
+		"params": map[string]interface{}{"include_pipeline": includePipeline},
+	})
+	if err != nil {
+		return err
+	}
+
+	resp, err := sc.Execute(string(cmdJSON))
+	if err != nil {
+		return err
+	}
+
+	if success, ok := resp["success"].(bool); !ok || !success {
+		errMsg, _ := resp["error"].(string)
+		return fmt.Errorf("subscribe failed: %s", errMsg)
+	}
+	return nil
+}
+
+// Ping checks that the server is responsive and returns its uptime in seconds
+func (sc *SocketClient) Ping() (float64, error) {
+	resp, err := sc.Execute(`{"action":"ping"}`)
+	if err != nil {
+		return 0, err
+	}
+
+	if success, ok := resp["success"].(bool); !ok || !success {
+		errMsg, _ := resp["error"].(string)
+		return 0, fmt.Errorf("ping failed: %s", errMsg)
+	}
+
+	result, _ := resp["result"].(map[string]interface{})
+	uptime, _ := result["uptime_seconds"].(float64)
+	return uptime, nil
+}
+
+// ReceiveEvent blocks until the server pushes an event to a subscribed connection
+// Events are {"event":"state_changed",...}, or {"event":"keepalive"} when the server has keepalives enabled
+func (sc *SocketClient) ReceiveEvent() (map[string]interface{}, error) {
+	data, err := sc.receiveMessage()
+	if err != nil {
+		return nil, err
+	}
+
+	var event map[string]interface{}
+	if err := json.Unmarshal(data, &event); err != nil {
+		return nil, fmt.Errorf("failed to parse event: %w", err)
+	}
+
+	return event, nil
+}
+
 // Close closes the connection to the socket server
 func (sc *SocketClient) Close() error {
 	if sc.conn != nil {
@@ -93,9 +199,10 @@ func (sc *SocketClient) receiveMessage() ([]byte, error) {
 	return data, nil
 }
 
-// SocketServer manages the Unix domain socket interface for TextCleanerCore
+// SocketServer manages the Unix domain socket (or TCP) interface for TextCleanerCore
 type SocketServer struct {
-	socketPath  string
+	network     string // "unix" or "tcp"
+	socketPath  string // Socket file path, or host:port for TCP
 	core        *TextCleanerCore
 	listener    net.Listener
 	mu          sync.Mutex
@@ -104,16 +211,40 @@ type SocketServer struct {
 	callbacks   []UpdateCallback // Callbacks called after each command execution to update UIs
 	logJSON     bool             // Log raw JSON commands
 	logCommands bool             // Log formatted commands with truncation
+
+	maxMessageSize uint32        // Largest accepted message body in bytes
+	readTimeout    time.Duration // Deadline for reading a message body after its length prefix
+	writeTimeout   time.Duration // Deadline for writing one message to a client
+	authToken      string        // Shared token clients must send via "auth" before other commands; empty disables auth
+	keepalive      time.Duration // Interval for keepalive events on idle subscribed connections; 0 disables
+
+	subscribers map[*lengthPrefixedWriter]bool // Connections receiving state_changed events; value is whether to include the pipeline
 }
 
 // NewSocketServer creates a new socket server instance
 func NewSocketServer(socketPath string, core *TextCleanerCore) *SocketServer {
+	return newSocketServer("unix", socketPath, core)
+}
+
+// NewTCPSocketServer creates a socket server that listens on a TCP address (host:port)
+// The protocol has no encryption, so only expose it on trusted networks
+func NewTCPSocketServer(address string, core *TextCleanerCore) *SocketServer {
+	return newSocketServer("tcp", address, core)
+}
+
+// newSocketServer creates a socket server for the given network ("unix" or "tcp")
+func newSocketServer(network, socketPath string, core *TextCleanerCore) *SocketServer {
 	return &SocketServer{
-		socketPath: socketPath,
-		core:       core,
-		done:       make(chan struct{}),
-		stopped:    make(chan struct{}),
-		callbacks:  make([]UpdateCallback, 0),
+		network:        network,
+		socketPath:     socketPath,
+		core:           core,
+		done:           make(chan struct{}),
+		stopped:        make(chan struct{}),
+		callbacks:      make([]UpdateCallback, 0),
+		maxMessageSize: DefaultMaxMessageSize,
+		readTimeout:    DefaultReadTimeout,
+		writeTimeout:   DefaultWriteTimeout,
+		subscribers:    make(map[*lengthPrefixedWriter]bool),
 	}
 }
 
@@ -139,15 +270,60 @@ func (ss *SocketServer) SetLogCommands(enabled bool) {
 	ss.logCommands = enabled
 }
 
-// Start begins listening on the Unix domain socket
+// SetMaxMessageSize sets the largest message (in bytes) a client may send
+// Larger messages are rejected before any memory is allocated for them
+func (ss *SocketServer) SetMaxMessageSize(size uint32) {
+	ss.mu.Lock()
+	defer ss.mu.Unlock()
+	ss.maxMessageSize = size
+}
+
+// SetReadTimeout sets how long the server waits for a message body after its length prefix
+// A zero duration disables the deadline
+func (ss *SocketServer) SetReadTimeout(timeout time.Duration) {
+	ss.mu.Lock()
+	defer ss.mu.Unlock()
+	ss.readTimeout = timeout
+}
+
+// SetWriteTimeout sets how long writing one message to a client may take
+// A subscriber that doesn't read its events within this time is disconnected
+// A zero duration disables the deadline
+func (ss *SocketServer) SetWriteTimeout(timeout time.Duration) {
+	ss.mu.Lock()
+	defer ss.mu.Unlock()
+	ss.writeTimeout = timeout
+}
+
+// SetAuthToken requires clients to authenticate with this token before any other command
+// Clients authenticate by sending {"action":"auth","params":{"token":"..."}} as their first message
+// An empty token disables authentication
+func (ss *SocketServer) SetAuthToken(token string) {
+	ss.mu.Lock()
+	defer ss.mu.Unlock()
+	ss.authToken = token
+}
+
+// SetKeepaliveInterval makes the server push {"event":"keepalive"} to subscribed connections
+// that have been idle for this long, so clients can tell a quiet server from a dead one
+// A zero duration disables keepalives
+func (ss *SocketServer) SetKeepaliveInterval(interval time.Duration) {
+	ss.mu.Lock()
+	defer ss.mu.Unlock()
+	ss.keepalive = interval
+}
+
+// Start begins listening on the Unix domain socket (or TCP address)
 func (ss *SocketServer) Start() error {
 	// Remove existing socket file if it exists
-	if err := os.Remove(ss.socketPath); err != nil && !os.IsNotExist(err) {
-		return fmt.Errorf("failed to remove existing socket: %w", err)
+	if ss.network == "unix" {
+		if err := os.Remove(ss.socketPath); err != nil && !os.IsNotExist(err) {
+			return fmt.Errorf("failed to remove existing socket: %w", err)
+		}
 	}
 
-	// Create Unix domain socket listener
-	listener, err := net.Listen("unix", ss.socketPath)
+	// Create the listener
+	listener, err := net.Listen(ss.network, ss.socketPath)
 	if err != nil {
 		return fmt.Errorf("failed to listen on socket %s: %w", ss.socketPath, err)
 	}
@@ -193,8 +369,21 @@ func (ss *SocketServer) acceptConnections() {
 func (ss *SocketServer) handleClient(conn net.Conn) {
 	defer conn.Close()
 
-	reader := &lengthPrefixedReader{conn: conn}
-	writer := &lengthPrefixedWriter{conn: conn}
+	ss.mu.Lock()
+	reader := &lengthPrefixedReader{conn: conn, maxSize: ss.maxMessageSize, timeout: ss.readTimeout}
+	authToken := ss.authToken
+	keepalive := ss.keepalive
+	writer := &lengthPrefixedWriter{conn: conn, timeout: ss.writeTimeout}
+	ss.mu.Unlock()
+	defer ss.removeSubscriber(writer)
+
+	// Closed when this handler returns, stopping the keepalive goroutine
+	closed := make(chan struct{})
+	defer close(closed)
+	keepaliveStarted := false
+
+	// Without a configured token every client is trusted
+	authenticated := authToken == ""
 
 	for {
 		// Read JSON command
@@ -204,6 +393,10 @@ func (ss *SocketServer) handleClient(conn net.Conn) {
 				// Client disconnected normally
 				return
 			}
+			if errors.Is(err, ErrMessageTooLarge) {
+				// The oversized body was never read, so the stream can't be resynchronised
+				writer.Write([]byte(ErrorResponse(ErrCodeMessageTooLarge, err.Error())))
+			}
 			fmt.Fprintf(os.Stderr, "Error reading from client: %v\n", err)
 			return
 		}
@@ -214,8 +407,81 @@ func (ss *SocketServer) handleClient(conn net.Conn) {
 		logCommands := ss.logCommands
 		ss.mu.Unlock()
 
+		action, params := parseAction(data)
+
 		if logJSON {
-			ss.logJSONCommand(string(data))
+			if action == "auth" {
+				// Never write the token to the log
+				ss.logJSONCommand(`{"action":"auth","params":{"token":"<redacted>"}}`)
+			} else {
+				ss.logJSONCommand(string(data))
+			}
+		}
+
+		// The auth handshake is handled here, before commands reach the core
+		if action == "auth" {
+			response := SuccessResponse(map[string]interface{}{"authenticated": true})
+			token, _ := params["token"].(string)
+			failed := false
+			switch {
+			case authToken == "":
+				// Nothing to check, so clients can authenticate unconditionally
+			case authenticated:
+				response = ErrorResponse(ErrCodeInvalidOperation, "already authenticated")
+			case subtle.ConstantTimeCompare([]byte(token), []byte(authToken)) == 1:
+				authenticated = true
+			default:
+				response = ErrorResponse(ErrCodeInvalidToken, "invalid auth token")
+				failed = true
+			}
+			if err := writer.Write([]byte(response)); err != nil {
+				fmt.Fprintf(os.Stderr, "Error writing to client: %v\n", err)
+				return
+			}
+			if failed {
+				// Close the connection so a client can't keep guessing on it
+				return
+			}
+			continue
+		} else if !authenticated {
+			if err := writer.Write([]byte(ErrorResponse(ErrCodeAuthRequired, "authentication required: send an auth command first"))); err != nil {
+				fmt.Fprintf(os.Stderr, "Error writing to client: %v\n", err)
+				return
+			}
+			continue
+		}
+
+		// The core doesn't know about auth and subscriptions, so add them to its capabilities here
+		if action == "get_capabilities" {
+			capabilities := ss.core.Capabilities()
+			capabilities.Actions = append(capabilities.Actions, "auth", "subscribe")
+			capabilities.Features["subscribe"] = true
+			capabilities.Features["auth"] = authToken != ""
+
+			if err := writer.Write([]byte(SuccessResponse(capabilities))); err != nil {
+				fmt.Fprintf(os.Stderr, "Error writing to client: %v\n", err)
+				return
+			}
+			continue
+		}
+
+		// Subscriptions are connection state, so they are handled here rather than in the core
+		if action == "subscribe" {
+			includePipeline, _ := params["include_pipeline"].(bool)
+			ss.mu.Lock()
+			ss.subscribers[writer] = includePipeline
+			ss.mu.Unlock()
+
+			if keepalive > 0 && !keepaliveStarted {
+				keepaliveStarted = true
+				go ss.sendKeepalives(writer, keepalive, closed)
+			}
+
+			if err := writer.Write([]byte(SuccessResponse(map[string]interface{}{"subscribed": true}))); err != nil {
+				fmt.Fprintf(os.Stderr, "Error writing to client: %v\n", err)
+				return
+			}
+			continue
 		}
 
 		// Execute command through the core
@@ -232,22 +498,144 @@ func (ss *SocketServer) handleClient(conn net.Conn) {
 			return
 		}
 
-		// Trigger all registered update callbacks (e.g., to refresh all GUIs)
-		ss.mu.Lock()
-		callbacks := append([]UpdateCallback{}, ss.callbacks...)
-		logCommands = ss.logCommands
-		ss.mu.Unlock()
+		ss.commandExecuted(action, response)
+	}
+}
+
+// ExecuteCommand runs a command on the server's core as if a client had sent it, so registered
+// UIs refresh and subscribers hear about the change
+// Other transports sharing the core, such as the HTTP gateway, run their commands through this
+func (ss *SocketServer) ExecuteCommand(cmdJSON string) string {
+	response := ss.core.ExecuteCommand(cmdJSON)
+	action, _ := parseAction([]byte(cmdJSON))
+	ss.commandExecuted(action, response)
+	return response
+}
+
+// commandExecuted triggers the update callbacks and, after a successful change, notifies subscribers
+func (ss *SocketServer) commandExecuted(action, response string) {
+	// Trigger all registered update callbacks (e.g., to refresh all GUIs)
+	ss.mu.Lock()
+	callbacks := append([]UpdateCallback{}, ss.callbacks...)
+	logCommands := ss.logCommands
+	ss.mu.Unlock()
+
+	if len(callbacks) > 0 && logCommands {
+		fmt.Printf("[CALLBACK] Notifying %d connected client(s)\n", len(callbacks))
+	}
+
+	for _, callback := range callbacks {
+		callback()
+	}
+
+	if IsMutatingAction(action) && responseSucceeded(response) {
+		ss.notifySubscribers(action)
+	}
+}
 
-		if len(callbacks) > 0 && logCommands {
-			fmt.Printf("[CALLBACK] Notifying %d connected client(s)\n", len(callbacks))
+// notifySubscribers pushes a state_changed event to every subscribed connection
+func (ss *SocketServer) notifySubscribers(action string) {
+	ss.mu.Lock()
+	subscribers := make(map[*lengthPrefixedWriter]bool, len(ss.subscribers))
+	for writer, includePipeline := range ss.subscribers {
+		subscribers[writer] = includePipeline
+	}
+	ss.mu.Unlock()
+
+	if len(subscribers) == 0 {
+		return
+	}
+
+	event := map[string]interface{}{"event": "state_changed", "action": action}
+	plain, _ := json.Marshal(event)
+
+	var withPipeline []byte
+	for _, includePipeline := range subscribers {
+		if includePipeline {
+			event["pipeline"] = ss.core.GetPipeline()
+			withPipeline, _ = json.Marshal(event)
+			break
+		}
+	}
+
+	// Write to all subscribers at once, so a slow one only delays the mutating client
+	// by the write timeout rather than adding up with the others
+	var wg sync.WaitGroup
+	for writer, includePipeline := range subscribers {
+		data := plain
+		if includePipeline {
+			data = withPipeline
 		}
 
-		for _, callback := range callbacks {
-			callback()
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := writer.Write(data); err != nil {
+				ss.dropSubscriber(writer)
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+// sendKeepalives pushes a keepalive event whenever the connection has been idle for a full interval
+func (ss *SocketServer) sendKeepalives(writer *lengthPrefixedWriter, interval time.Duration, closed <-chan struct{}) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	event, _ := json.Marshal(map[string]interface{}{"event": "keepalive"})
+
+	for {
+		select {
+		case <-closed:
+			return
+		case <-ss.done:
+			return
+		case <-ticker.C:
+			if writer.IdleFor() < interval {
+				continue
+			}
+			if err := writer.Write(event); err != nil {
+				ss.dropSubscriber(writer)
+				return
+			}
 		}
 	}
 }
 
+// dropSubscriber disconnects a subscriber whose event couldn't be written in time
+// A timed-out write may have sent part of a message, so the stream can't be used any more;
+// closing the connection also ends its handler
+func (ss *SocketServer) dropSubscriber(writer *lengthPrefixedWriter) {
+	ss.removeSubscriber(writer)
+	writer.conn.Close()
+}
+
+// removeSubscriber stops pushing events to a connection
+func (ss *SocketServer) removeSubscriber(writer *lengthPrefixedWriter) {
+	ss.mu.Lock()
+	defer ss.mu.Unlock()
+	delete(ss.subscribers, writer)
+}
+
+// responseSucceeded reports whether a JSON command response has success set
+func responseSucceeded(response string) bool {
+	var resp CommandResponse
+	if err := json.Unmarshal([]byte(response), &resp); err != nil {
+		return false
+	}
+	return resp.Success
+}
+
+// parseAction extracts the action and params from a JSON command, ignoring malformed input
+func parseAction(data []byte) (string, map[string]interface{}) {
+	var cmd Command
+	if err := json.Unmarshal(data, &cmd); err != nil {
+		return "", nil
+	}
+	return cmd.Action, cmd.Params
+}
+
 // handleSignals sets up graceful shutdown on signals
 func (ss *SocketServer) handleSignals() {
 	sigChan := make(chan os.Signal, 1)
@@ -266,7 +654,9 @@ func (ss *SocketServer) Stop() error {
 	}
 
 	// Remove socket file
-	os.Remove(ss.socketPath)
+	if ss.network == "unix" {
+		os.Remove(ss.socketPath)
+	}
 
 	// Signal that the server has stopped
 	close(ss.stopped)
@@ -274,6 +664,15 @@ func (ss *SocketServer) Stop() error {
 	return nil
 }
 
+// Addr returns the address the server is listening on, or nil before Start
+// For TCP servers started on port 0 this reports the port that was assigned
+func (ss *SocketServer) Addr() net.Addr {
+	if ss.listener == nil {
+		return nil
+	}
+	return ss.listener.Addr()
+}
+
 // Wait blocks until the server is fully shut down
 func (ss *SocketServer) Wait() {
 	<-ss.stopped
@@ -285,19 +684,29 @@ func (ss *SocketServer) Wait() {
 
 // lengthPrefixedReader reads length-prefixed messages (4-byte big-endian length + data)
 type lengthPrefixedReader struct {
-	conn net.Conn
+	conn    net.Conn
+	maxSize uint32        // Maximum message length; 0 means unlimited
+	timeout time.Duration // Deadline for reading the body once the prefix arrived; 0 means none
 }
 
 // Read reads a single length-prefixed message
 func (r *lengthPrefixedReader) Read() ([]byte, error) {
-	// Read 4-byte length prefix
+	// Read 4-byte length prefix (no deadline, so idle clients stay connected)
 	lengthBuf := make([]byte, 4)
 	if _, err := io.ReadFull(r.conn, lengthBuf); err != nil {
 		return nil, err
 	}
 
-	// Decode length
+	// Decode length and reject oversized messages before allocating
 	length := binary.BigEndian.Uint32(lengthBuf)
+	if r.maxSize > 0 && length > r.maxSize {
+		return nil, fmt.Errorf("%w: %d bytes exceeds limit of %d", ErrMessageTooLarge, length, r.maxSize)
+	}
+
+	if r.timeout > 0 {
+		r.conn.SetReadDeadline(time.Now().Add(r.timeout))
+		defer r.conn.SetReadDeadline(time.Time{})
+	}
 
 	// Read message data
 	data := make([]byte, length)
@@ -310,11 +719,22 @@ func (r *lengthPrefixedReader) Read() ([]byte, error) {
 
 // lengthPrefixedWriter writes length-prefixed messages (4-byte big-endian length + data)
 type lengthPrefixedWriter struct {
-	conn net.Conn
+	conn      net.Conn
+	timeout   time.Duration // Deadline for writing one message; 0 means none
+	mu        sync.Mutex    // Keeps pushed events from interleaving with responses
+	lastWrite time.Time     // When the last message was written, used to detect idle connections
 }
 
 // Write writes a single length-prefixed message
 func (w *lengthPrefixedWriter) Write(data []byte) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.timeout > 0 {
+		w.conn.SetWriteDeadline(time.Now().Add(w.timeout))
+		defer w.conn.SetWriteDeadline(time.Time{})
+	}
+
 	// Create length prefix
 	lengthBuf := make([]byte, 4)
 	binary.BigEndian.PutUint32(lengthBuf, uint32(len(data)))
@@ -328,9 +748,17 @@ func (w *lengthPrefixedWriter) Write(data []byte) error {
 		return err
 	}
 
+	w.lastWrite = time.Now()
 	return nil
 }
 
+// IdleFor returns how long ago the last message was written
+func (w *lengthPrefixedWriter) IdleFor() time.Duration {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return time.Since(w.lastWrite)
+}
+
 // ============================================================================
 // Response Types (for convenience)
 // ============================================================================
@@ -340,6 +768,7 @@ type CommandResponse struct {
 	Success bool        `json:"success"`
 	Result  interface{} `json:"result,omitempty"`
 	Error   string      `json:"error,omitempty"`
+	Code    string      `json:"code,omitempty"`
 }
 
 // SuccessResponse creates a successful response
@@ -352,11 +781,12 @@ func SuccessResponse(result interface{}) string {
 	return string(data)
 }
 
-// ErrorResponse creates an error response
-func ErrorResponse(err string) string {
+// ErrorResponse creates an error response with a machine-readable code (see ErrCode constants)
+func ErrorResponse(code, err string) string {
 	resp := CommandResponse{
 		Success: false,
 		Error:   err,
+		Code:    code,
 	}
 	data, _ := json.Marshal(resp)
 	return string(data)
@@ -423,6 +853,28 @@ func (ss *SocketServer) formatCommand(action string, params map[string]interface
 		nodeID, _ := params["node_id"].(string)
 		return fmt.Sprintf("delete_node(%s)", truncate(nodeID, 20))
 
+	case "replace_node":
+		nodeID, _ := params["node_id"].(string)
+		return fmt.Sprintf("replace_node(%s, <node>)", truncate(nodeID, 20))
+
+	case "process_batch":
+		inputs, _ := params["inputs"].([]interface{})
+		return fmt.Sprintf("process_batch(%d inputs)", len(inputs))
+
+	case "duplicate_node", "enable_node", "disable_node":
+		nodeID, _ := params["node_id"].(string)
+		return fmt.Sprintf("%s(%s)", action, truncate(nodeID, 20))
+
+	case "clear_pipeline":
+		return "clear_pipeline()"
+
+	case "set_seed":
+		return fmt.Sprintf("set_seed(%v)", params["seed"])
+
+	case "set_line_based":
+		nodeID, _ := params["node_id"].(string)
+		return fmt.Sprintf("set_line_based(%s, %v)", truncate(nodeID, 20), params["line_based"])
+
 	case "add_child_node":
 		parentID, _ := params["parent_id"].(string)
 		nodeType, _ := params["type"].(string)
@@ -442,12 +894,16 @@ func (ss *SocketServer) formatCommand(action string, params map[string]interface
 	case "get_output_text":
 		return "get_output_text()"
 
+	case "get_output_preview":
+		maxBytes, _ := params["max_bytes"].(float64)
+		return fmt.Sprintf("get_output_preview(%d bytes)", int(maxBytes))
+
 	case "get_selected_node_id":
 		return "get_selected_node_id()"
 
-	case "get_node":
+	case "get_node", "get_node_path":
 		nodeID, _ := params["node_id"].(string)
-		return fmt.Sprintf("get_node(%s)", truncate(nodeID, 20))
+		return fmt.Sprintf("%s(%s)", action, truncate(nodeID, 20))
 
 	case "list_nodes":
 		return "list_nodes()"
@@ -455,12 +911,39 @@ func (ss *SocketServer) formatCommand(action string, params map[string]interface
 	case "get_pipeline":
 		return "get_pipeline()"
 
+	case "pipeline_stats":
+		return "pipeline_stats()"
+
+	case "find_nodes":
+		operation, _ := params["operation"].(string)
+		nameContains, _ := params["name_contains"].(string)
+		return fmt.Sprintf("find_nodes(operation=%s, name=%s)", truncate(operation, 30), truncate(nameContains, 30))
+
 	case "export_pipeline":
 		return "export_pipeline()"
 
 	case "import_pipeline":
 		return "import_pipeline(<data>)"
 
+	case "auth":
+		return "auth(<token>)"
+
+	case "subscribe":
+		return "subscribe()"
+	case "ping":
+		return "ping()"
+
+	case "get_capabilities":
+		return "get_capabilities()"
+
+	case "search_operations":
+		query, _ := params["query"].(string)
+		return fmt.Sprintf("search_operations(%s)", truncate(query, 30))
+
+	case "save_preset", "delete_preset":
+		name, _ := params["name"].(string)
+		return fmt.Sprintf("%s(%s)", action, truncate(name, 30))
+
 	default:
 		return fmt.Sprintf("%s(...)", action)
 	}
@@ -3,8 +3,11 @@ package main
 import (
 	"encoding/binary"
 	"encoding/json"
+	"fmt"
+	"io"
 	"net"
 	"os"
+	"strings"
 	"testing"
 	"time"
 )
@@ -365,6 +368,478 @@ func TestSetInputAndProcessing(t *testing.T) {
 	}
 }
 
+// TestOversizedMessageRejected tests that a huge length prefix is rejected without allocating it
+func TestOversizedMessageRejected(t *testing.T) {
+	socketPath := "/tmp/test_textcleaner_7.sock"
+	defer os.Remove(socketPath)
+
+	core := NewTextCleanerCore()
+	server := NewSocketServer(socketPath, core)
+	server.SetMaxMessageSize(1024)
+
+	if err := server.Start(); err != nil {
+		t.Fatalf("Failed to start socket server: %v", err)
+	}
+	defer server.Stop()
+
+	time.Sleep(100 * time.Millisecond)
+
+	conn, err := net.Dial("unix", socketPath)
+	if err != nil {
+		t.Fatalf("Failed to connect to socket: %v", err)
+	}
+	defer conn.Close()
+
+	// Claim a 4GB message but never send the body
+	lengthBuf := make([]byte, 4)
+	binary.BigEndian.PutUint32(lengthBuf, 0xFFFFFFFF)
+	if _, err := conn.Write(lengthBuf); err != nil {
+		t.Fatalf("Failed to send length prefix: %v", err)
+	}
+
+	conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+	response, err := receiveMessage(conn)
+	if err != nil {
+		t.Fatalf("Expected an error response, got: %v", err)
+	}
+
+	var resp CommandResponse
+	if err := json.Unmarshal(response, &resp); err != nil {
+		t.Fatalf("Response is not valid JSON: %v", err)
+	}
+	if resp.Success || !strings.Contains(resp.Error, "message too large") {
+		t.Errorf("Expected 'message too large' error, got: %+v", resp)
+	}
+
+	// The server should still serve new clients
+	conn2, err := net.Dial("unix", socketPath)
+	if err != nil {
+		t.Fatalf("Failed to reconnect: %v", err)
+	}
+	defer conn2.Close()
+
+	if err := sendMessage(conn2, []byte(`{"action":"list_nodes","params":{}}`)); err != nil {
+		t.Fatalf("Failed to send message: %v", err)
+	}
+	if _, err := receiveMessage(conn2); err != nil {
+		t.Fatalf("Expected server to keep working, got: %v", err)
+	}
+}
+
+// TestMessageBodyReadTimeout tests that a client stalling mid-message is disconnected
+func TestMessageBodyReadTimeout(t *testing.T) {
+	socketPath := "/tmp/test_textcleaner_8.sock"
+	defer os.Remove(socketPath)
+
+	core := NewTextCleanerCore()
+	server := NewSocketServer(socketPath, core)
+	server.SetReadTimeout(100 * time.Millisecond)
+
+	if err := server.Start(); err != nil {
+		t.Fatalf("Failed to start socket server: %v", err)
+	}
+	defer server.Stop()
+
+	time.Sleep(100 * time.Millisecond)
+
+	conn, err := net.Dial("unix", socketPath)
+	if err != nil {
+		t.Fatalf("Failed to connect to socket: %v", err)
+	}
+	defer conn.Close()
+
+	// Announce 10 bytes but send only 2
+	lengthBuf := make([]byte, 4)
+	binary.BigEndian.PutUint32(lengthBuf, 10)
+	conn.Write(lengthBuf)
+	conn.Write([]byte("{}"))
+
+	conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+	buf := make([]byte, 1)
+	if _, err := conn.Read(buf); err != io.EOF {
+		t.Errorf("Expected server to close the connection, got: %v", err)
+	}
+}
+
+// TestTCPServer tests that a TCP client can execute commands against a TCP server
+func TestTCPServer(t *testing.T) {
+	core := NewTextCleanerCore()
+	core.CreateNode("operation", "Uppercase", "Uppercase", "", "", "")
+	server := NewTCPSocketServer("127.0.0.1:0", core)
+
+	if err := server.Start(); err != nil {
+		t.Fatalf("Failed to start TCP server: %v", err)
+	}
+	defer server.Stop()
+
+	client, err := NewTCPSocketClient(server.Addr().String())
+	if err != nil {
+		t.Fatalf("Failed to connect to TCP server: %v", err)
+	}
+	defer client.Close()
+
+	resp, err := client.Execute(`{"action":"get_pipeline","params":{}}`)
+	if err != nil {
+		t.Fatalf("Failed to execute command: %v", err)
+	}
+	if success, ok := resp["success"].(bool); !ok || !success {
+		t.Fatalf("Expected successful response, got: %v", resp)
+	}
+
+	result, _ := resp["result"].(map[string]interface{})
+	pipeline, _ := result["pipeline"].([]interface{})
+	if len(pipeline) != 1 {
+		t.Errorf("Expected 1 node in pipeline, got: %v", result)
+	}
+}
+
+// TestAuthTokenHandshake tests that commands are rejected until a valid token is sent
+func TestAuthTokenHandshake(t *testing.T) {
+	socketPath := "/tmp/test_textcleaner_9.sock"
+	defer os.Remove(socketPath)
+
+	core := NewTextCleanerCore()
+	server := NewSocketServer(socketPath, core)
+	server.SetAuthToken("s3cret")
+
+	if err := server.Start(); err != nil {
+		t.Fatalf("Failed to start socket server: %v", err)
+	}
+	defer server.Stop()
+
+	client, err := NewSocketClient(socketPath)
+	if err != nil {
+		t.Fatalf("Failed to connect: %v", err)
+	}
+	defer client.Close()
+
+	// Commands before authenticating are rejected
+	resp, err := client.Execute(`{"action":"list_nodes","params":{}}`)
+	if err != nil {
+		t.Fatalf("Failed to execute command: %v", err)
+	}
+	if success, _ := resp["success"].(bool); success {
+		t.Errorf("Expected unauthenticated command to fail, got: %v", resp)
+	}
+
+	// A wrong token is rejected and the connection closed
+	if err := client.Authenticate("wrong"); err == nil {
+		t.Errorf("Expected wrong token to be rejected")
+	}
+	if _, err := client.Execute(`{"action":"list_nodes","params":{}}`); err == nil {
+		t.Errorf("Expected the connection to be closed after a wrong token")
+	}
+
+	// The correct token unlocks a new connection
+	client, err = NewSocketClient(socketPath)
+	if err != nil {
+		t.Fatalf("Failed to reconnect: %v", err)
+	}
+	defer client.Close()
+
+	if err := client.Authenticate("s3cret"); err != nil {
+		t.Fatalf("Expected token to be accepted: %v", err)
+	}
+	resp, err = client.Execute(`{"action":"list_nodes","params":{}}`)
+	if err != nil {
+		t.Fatalf("Failed to execute command: %v", err)
+	}
+	if success, _ := resp["success"].(bool); !success {
+		t.Errorf("Expected authenticated command to succeed, got: %v", resp)
+	}
+
+	// Authenticating again is rejected, whatever the token, but the connection stays usable
+	if err := client.Authenticate("anything"); err == nil {
+		t.Errorf("Expected a repeated auth to be rejected")
+	}
+	resp, err = client.Execute(`{"action":"list_nodes","params":{}}`)
+	if err != nil {
+		t.Fatalf("Failed to execute command: %v", err)
+	}
+	if success, _ := resp["success"].(bool); !success {
+		t.Errorf("Expected the connection to stay authenticated, got: %v", resp)
+	}
+}
+
+// TestAuthWithoutToken tests backward compatibility when the server has no token configured
+func TestAuthWithoutToken(t *testing.T) {
+	socketPath := "/tmp/test_textcleaner_10.sock"
+	defer os.Remove(socketPath)
+
+	core := NewTextCleanerCore()
+	server := NewSocketServer(socketPath, core)
+
+	if err := server.Start(); err != nil {
+		t.Fatalf("Failed to start socket server: %v", err)
+	}
+	defer server.Stop()
+
+	client, err := NewSocketClient(socketPath)
+	if err != nil {
+		t.Fatalf("Failed to connect: %v", err)
+	}
+	defer client.Close()
+
+	resp, err := client.Execute(`{"action":"list_nodes","params":{}}`)
+	if err != nil {
+		t.Fatalf("Failed to execute command: %v", err)
+	}
+	if success, _ := resp["success"].(bool); !success {
+		t.Errorf("Expected command to succeed without auth, got: %v", resp)
+	}
+
+	// Clients that always authenticate still work against a server without a token
+	if err := client.Authenticate("anything"); err != nil {
+		t.Errorf("Expected auth to be accepted when no token is configured: %v", err)
+	}
+}
+
+// TestSubscribeReceivesStateChanges tests that a subscribed client is notified of another client's changes
+func TestSubscribeReceivesStateChanges(t *testing.T) {
+	socketPath := "/tmp/test_textcleaner_11.sock"
+	defer os.Remove(socketPath)
+
+	core := NewTextCleanerCore()
+	server := NewSocketServer(socketPath, core)
+
+	if err := server.Start(); err != nil {
+		t.Fatalf("Failed to start socket server: %v", err)
+	}
+	defer server.Stop()
+
+	subscriber, err := NewSocketClient(socketPath)
+	if err != nil {
+		t.Fatalf("Failed to connect subscriber: %v", err)
+	}
+	defer subscriber.Close()
+
+	if err := subscriber.Subscribe(true); err != nil {
+		t.Fatalf("Failed to subscribe: %v", err)
+	}
+
+	mutator, err := NewSocketClient(socketPath)
+	if err != nil {
+		t.Fatalf("Failed to connect mutator: %v", err)
+	}
+	defer mutator.Close()
+
+	// Read-only commands don't trigger events; the mutator still gets normal responses
+	resp, err := mutator.Execute(`{"action":"list_nodes","params":{}}`)
+	if err != nil || resp["success"] != true {
+		t.Fatalf("Expected list_nodes to succeed, got: %v, %v", resp, err)
+	}
+
+	resp, err = mutator.Execute(`{"action":"create_node","params":{"type":"operation","name":"Upper","operation":"Uppercase"}}`)
+	if err != nil || resp["success"] != true {
+		t.Fatalf("Expected create_node to succeed, got: %v, %v", resp, err)
+	}
+
+	subscriber.conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+	event, err := subscriber.ReceiveEvent()
+	if err != nil {
+		t.Fatalf("Expected a pushed event: %v", err)
+	}
+
+	if event["event"] != "state_changed" || event["action"] != "create_node" {
+		t.Errorf("Unexpected event: %v", event)
+	}
+	pipeline, ok := event["pipeline"].([]interface{})
+	if !ok || len(pipeline) != 1 {
+		t.Errorf("Expected event to include the new pipeline, got: %v", event["pipeline"])
+	}
+}
+
+// TestPingReportsUptime tests that ping responds and that the reported uptime increases
+func TestPingReportsUptime(t *testing.T) {
+	socketPath := "/tmp/test_textcleaner_12.sock"
+	defer os.Remove(socketPath)
+
+	core := NewTextCleanerCore()
+	server := NewSocketServer(socketPath, core)
+
+	if err := server.Start(); err != nil {
+		t.Fatalf("Failed to start socket server: %v", err)
+	}
+	defer server.Stop()
+
+	client, err := NewSocketClient(socketPath)
+	if err != nil {
+		t.Fatalf("Failed to connect: %v", err)
+	}
+	defer client.Close()
+
+	resp, err := client.Execute(`{"action":"ping"}`)
+	if err != nil {
+		t.Fatalf("Failed to ping: %v", err)
+	}
+	result, _ := resp["result"].(map[string]interface{})
+	if resp["success"] != true || result["pong"] != true {
+		t.Fatalf("Expected pong, got: %v", resp)
+	}
+	first, ok := result["uptime_seconds"].(float64)
+	if !ok || first < 0 {
+		t.Fatalf("Expected non-negative uptime_seconds, got: %v", result["uptime_seconds"])
+	}
+
+	time.Sleep(20 * time.Millisecond)
+
+	second, err := client.Ping()
+	if err != nil {
+		t.Fatalf("Failed to ping: %v", err)
+	}
+	if second <= first {
+		t.Errorf("Expected uptime to increase, got %v then %v", first, second)
+	}
+}
+
+// TestCapabilitiesOverSocket tests that the socket server adds its auth and subscribe support to the capabilities
+func TestCapabilitiesOverSocket(t *testing.T) {
+	socketPath := "/tmp/test_textcleaner_17.sock"
+	defer os.Remove(socketPath)
+
+	core := NewTextCleanerCore()
+	server := NewSocketServer(socketPath, core)
+	server.SetAuthToken("s3cret")
+
+	if err := server.Start(); err != nil {
+		t.Fatalf("Failed to start socket server: %v", err)
+	}
+	defer server.Stop()
+
+	client, err := NewSocketClient(socketPath)
+	if err != nil {
+		t.Fatalf("Failed to connect: %v", err)
+	}
+	defer client.Close()
+
+	if err := client.Authenticate("s3cret"); err != nil {
+		t.Fatalf("Expected token to be accepted: %v", err)
+	}
+
+	resp, err := client.Execute(`{"action":"get_capabilities"}`)
+	if err != nil {
+		t.Fatalf("Failed to execute command: %v", err)
+	}
+	result, _ := resp["result"].(map[string]interface{})
+	if resp["success"] != true || result["version"] != ProtocolVersion {
+		t.Fatalf("Expected capabilities, got: %v", resp)
+	}
+
+	actions := map[string]bool{}
+	for _, action := range result["actions"].([]interface{}) {
+		actions[action.(string)] = true
+	}
+	for _, action := range []string{"create_node", "get_capabilities", "auth", "subscribe"} {
+		if !actions[action] {
+			t.Errorf("Expected %q in the actions, got %v", action, result["actions"])
+		}
+	}
+
+	features := result["features"].(map[string]interface{})
+	if features["auth"] != true || features["subscribe"] != true || features["batch"] != true {
+		t.Errorf("Unexpected features: %v", features)
+	}
+}
+
+// TestKeepaliveOnIdleSubscription tests that idle subscribed connections receive keepalive events
+func TestKeepaliveOnIdleSubscription(t *testing.T) {
+	socketPath := "/tmp/test_textcleaner_13.sock"
+	defer os.Remove(socketPath)
+
+	core := NewTextCleanerCore()
+	server := NewSocketServer(socketPath, core)
+	server.SetKeepaliveInterval(50 * time.Millisecond)
+
+	if err := server.Start(); err != nil {
+		t.Fatalf("Failed to start socket server: %v", err)
+	}
+	defer server.Stop()
+
+	subscriber, err := NewSocketClient(socketPath)
+	if err != nil {
+		t.Fatalf("Failed to connect subscriber: %v", err)
+	}
+	defer subscriber.Close()
+
+	if err := subscriber.Subscribe(false); err != nil {
+		t.Fatalf("Failed to subscribe: %v", err)
+	}
+
+	subscriber.conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+	event, err := subscriber.ReceiveEvent()
+	if err != nil {
+		t.Fatalf("Expected a keepalive event: %v", err)
+	}
+	if event["event"] != "keepalive" {
+		t.Errorf("Expected keepalive event, got: %v", event)
+	}
+}
+
+// TestStalledSubscriberIsDropped tests that a subscriber that never reads can't block other clients
+func TestStalledSubscriberIsDropped(t *testing.T) {
+	socketPath := "/tmp/test_textcleaner_18.sock"
+	defer os.Remove(socketPath)
+
+	core := NewTextCleanerCore()
+	server := NewSocketServer(socketPath, core)
+	server.SetWriteTimeout(100 * time.Millisecond)
+
+	if err := server.Start(); err != nil {
+		t.Fatalf("Failed to start socket server: %v", err)
+	}
+	defer server.Stop()
+
+	subscriber, err := NewSocketClient(socketPath)
+	if err != nil {
+		t.Fatalf("Failed to connect subscriber: %v", err)
+	}
+	defer subscriber.Close()
+
+	if err := subscriber.Subscribe(true); err != nil {
+		t.Fatalf("Failed to subscribe: %v", err)
+	}
+
+	mutator, err := NewSocketClient(socketPath)
+	if err != nil {
+		t.Fatalf("Failed to connect mutator: %v", err)
+	}
+	defer mutator.Close()
+
+	// Every event carries the whole pipeline, so these soon fill the subscriber's socket buffers
+	command := fmt.Sprintf(`{"action":"create_node","params":{"type":"operation","name":%q,"operation":"Uppercase"}}`,
+		strings.Repeat("x", 256*1024))
+	done := make(chan error, 1)
+	go func() {
+		for i := 0; i < 10; i++ {
+			resp, err := mutator.Execute(command)
+			if err != nil {
+				done <- err
+				return
+			}
+			if resp["success"] != true {
+				done <- fmt.Errorf("create_node failed: %v", resp)
+				return
+			}
+		}
+		done <- nil
+	}()
+
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatalf("Mutator failed: %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Mutator was blocked by the stalled subscriber")
+	}
+
+	// The subscriber was disconnected: after the buffered events the connection ends
+	subscriber.conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+	if _, err := io.Copy(io.Discard, subscriber.conn); err != nil {
+		t.Errorf("Expected the subscriber to be disconnected, got: %v", err)
+	}
+}
+
 // Helper functions
 
 // sendMessage sends a length-prefixed message
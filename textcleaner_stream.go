@@ -0,0 +1,171 @@
+package main
+
+import (
+	"bufio"
+	"io"
+	"strings"
+)
+
+// lineSafeOperations are the operations that change each line on its own, so running them
+// on a whole text gives the same result as running them on its lines one by one
+var lineSafeOperations = map[string]bool{
+	"Identity":         true,
+	"Uppercase":        true,
+	"Lowercase":        true,
+	"Toggle Case":      true,
+	"Trim Lines":       true,
+	"Replace Text":     true,
+	"Strip Diacritics": true,
+	"Straight Quotes":  true,
+	"ROT13":            true,
+	"HTML Encode":      true,
+	"HTML Decode":      true,
+	"Comment Lines":    true,
+	"Uncomment Lines":  true,
+	"Indent Text":      true,
+	"Dedupe Words":     true,
+}
+
+// IsLineSafe reports whether the pipeline handles every line independently, so its
+// input can be streamed through it a line at a time
+func (tc *TextCleanerCore) IsLineSafe() bool {
+	tc.mu.RLock()
+	defer tc.mu.RUnlock()
+
+	return isLineSafePipeline(tc.pipeline)
+}
+
+// isLineSafePipeline checks nodes that receive the text as a whole
+// Operations must be line-based or in lineSafeOperations, and foreach nodes must split
+// on lines; if, capture and subroutine nodes see all lines at once, so they never are
+func isLineSafePipeline(nodes []PipelineNode) bool {
+	for _, node := range nodes {
+		if node.Disabled {
+			continue
+		}
+
+		switch node.Type {
+		case "operation":
+			if !node.LineBased {
+				// An argument with a line break, typed or as an escape sequence like \n, can match
+				// or build text across lines
+				args := processEscapeSequences(node.Arg1) + processEscapeSequences(node.Arg2)
+				if !lineSafeOperations[node.Operation] || strings.Contains(args, "\n") {
+					return false
+				}
+			}
+			if !isLineSafePipeline(node.Children) {
+				return false
+			}
+		case "foreach":
+			if node.Arg1 == "paragraph" || forEachSeparator(node.Arg1) != "\n" || !isRecordSafePipeline(node.Children) {
+				return false
+			}
+		case "group":
+			if !isLineSafePipeline(node.Children) {
+				return false
+			}
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+// isRecordSafePipeline checks nodes inside a foreach over lines, which only ever see one line
+// Anything goes except captures, whose values would leak to the lines after them
+func isRecordSafePipeline(nodes []PipelineNode) bool {
+	for _, node := range nodes {
+		if node.Disabled {
+			continue
+		}
+		if node.Type == "capture" || node.Type == "subroutine" {
+			return false
+		}
+		if !isRecordSafePipeline(node.Children) || !isRecordSafePipeline(node.ElseChildren) {
+			return false
+		}
+	}
+	return true
+}
+
+// ProcessStream runs the text read from r through the pipeline and writes the output to w,
+// leaving the stored input text alone
+// A line-safe pipeline is run on each line as soon as it is read, so large inputs never have
+// to fit in memory; other pipelines, e.g. ones that sort or deduplicate, read all input first
+func (tc *TextCleanerCore) ProcessStream(r io.Reader, w io.Writer) error {
+	tc.mu.RLock()
+	pipeline := clonePipeline(tc.pipeline)
+	run := tc.newRun()
+	tc.mu.RUnlock()
+
+	if !isLineSafePipeline(pipeline) {
+		data, err := io.ReadAll(r)
+		if err != nil {
+			return err
+		}
+		output, err := tc.processChunk(run, pipeline, string(data))
+		if err != nil {
+			return err
+		}
+		_, err = io.WriteString(w, output)
+		return err
+	}
+
+	// Blank lines are kept with the next line that has text, and blank lines at the end with
+	// the last one, so no chunk is empty unless the whole input is: a foreach passes empty
+	// input through, but runs its children on the blank lines of a longer text
+	var chunk []string
+	chunkHasText, first := false, true
+	flush := func() error {
+		output, err := tc.processChunk(run, pipeline, strings.Join(chunk, "\n"))
+		if err != nil {
+			return err
+		}
+		if !first {
+			output = "\n" + output
+		}
+		first = false
+		chunk, chunkHasText = chunk[:0], false
+		_, err = io.WriteString(w, output)
+		return err
+	}
+
+	reader := bufio.NewReader(r)
+	for {
+		line, err := reader.ReadString('\n')
+		if err != nil && err != io.EOF {
+			return err
+		}
+		atEOF := err == io.EOF
+		line = strings.TrimSuffix(line, "\n")
+
+		if line != "" && chunkHasText {
+			if err := flush(); err != nil {
+				return err
+			}
+		}
+		chunk = append(chunk, line)
+		if line != "" {
+			chunkHasText = true
+		}
+
+		if atEOF {
+			return flush()
+		}
+	}
+}
+
+// processChunk runs one piece of the stream through the pipeline within the execution timeout
+func (tc *TextCleanerCore) processChunk(run *pipelineRun, pipeline []PipelineNode, text string) (string, error) {
+	tc.mu.RLock()
+	ctx, cancel := tc.executionContext()
+	tc.mu.RUnlock()
+	defer cancel()
+
+	output, err := executePipelineRun(ctx, run, pipeline, text)
+	if err != nil {
+		return "", tc.executionError(err)
+	}
+	return output, nil
+}
@@ -0,0 +1,139 @@
+package main
+
+import (
+	"io"
+	"strings"
+	"testing"
+	"time"
+)
+
+// streamInputs cover blank lines in every position, since they are where streaming is easiest to get wrong
+var streamInputs = []string{
+	"",
+	"\n",
+	"\n\n",
+	"one",
+	"one\n",
+	"one\ntwo\nthree",
+	"\none\n\n\ntwo  \n",
+	"  Mixed Case  \n\tcafé \"quoted\" &amp; <b>\n# done\n\n",
+}
+
+// expectStreamMatchesBuffered checks that streaming each input gives the output of set_input_text and get_output_text
+func expectStreamMatchesBuffered(t *testing.T, core *TextCleanerCore) {
+	t.Helper()
+	for _, input := range streamInputs {
+		var streamed strings.Builder
+		if err := core.ProcessStream(strings.NewReader(input), &streamed); err != nil {
+			t.Fatalf("ProcessStream(%q) failed: %v", input, err)
+		}
+		core.SetInputText(input)
+		if expected := core.GetOutputText(); streamed.String() != expected {
+			t.Errorf("Input %q: expected: %q, Got: %q", input, expected, streamed.String())
+		}
+	}
+}
+
+// TestProcessStreamMatchesBuffered tests that a line-safe pipeline gives the same output streamed as buffered
+func TestProcessStreamMatchesBuffered(t *testing.T) {
+	core := NewTextCleanerCore()
+	err := core.ImportPipeline(`[
+		{"id": "node_0", "type": "operation", "name": "Trim", "operation": "Trim Lines", "arg1": "right"},
+		{"id": "node_1", "type": "group", "name": "Cleanup", "children": [
+			{"id": "node_2", "type": "operation", "name": "Upper", "operation": "Uppercase"}
+		]},
+		{"id": "node_3", "type": "foreach", "name": "Each", "children": [
+			{"id": "node_4", "type": "operation", "name": "Quote", "operation": "Quote Text"},
+			{"id": "node_5", "type": "if", "name": "Numbers", "condition": "\\d",
+				"children": [{"id": "node_6", "type": "operation", "name": "Mark", "operation": "Add Prefix", "arg1": "#"}]}
+		]},
+		{"id": "node_7", "type": "operation", "name": "Suffix", "operation": "Add Suffix", "arg1": ";", "line_based": true}
+	]`)
+	if err != nil {
+		t.Fatalf("ImportPipeline failed: %v", err)
+	}
+	if !core.IsLineSafe() {
+		t.Fatal("Expected the pipeline to be line-safe")
+	}
+	expectStreamMatchesBuffered(t, core)
+}
+
+// TestLineSafeOperations tests every operation marked line-safe on its own
+func TestLineSafeOperations(t *testing.T) {
+	for operation := range lineSafeOperations {
+		t.Run(operation, func(t *testing.T) {
+			core := NewTextCleanerCore()
+			core.CreateNode("operation", "", operation, "", "", "")
+			expectStreamMatchesBuffered(t, core)
+		})
+	}
+}
+
+// TestProcessStreamFallsBack tests that pipelines that need the whole text are detected and still give the right output
+func TestProcessStreamFallsBack(t *testing.T) {
+	tests := []struct {
+		pipeline string
+		desc     string
+	}{
+		{`[{"type": "operation", "operation": "Sort Lines"}]`, "Sort"},
+		{`[{"type": "operation", "operation": "Deduplicate Lines"}]`, "Dedup"},
+		{`[{"type": "operation", "operation": "Replace Text", "arg1": "one\ntwo", "arg2": "x"}]`, "Argument across lines"},
+		{`[{"type": "operation", "operation": "Replace Text", "arg1": "\\n", "arg2": ", "}]`, "Escaped line break in argument"},
+		{`[{"type": "if", "condition": "two", "children": [{"type": "operation", "operation": "Uppercase"}]}]`, "If node"},
+		{`[{"type": "foreach", "arg1": "paragraph", "children": [{"type": "operation", "operation": "Uppercase"}]}]`, "Foreach over paragraphs"},
+		{`[{"type": "operation", "operation": "Uppercase", "children": [{"type": "operation", "operation": "Line Count"}]}]`, "Child needs the whole text"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.desc, func(t *testing.T) {
+			core := NewTextCleanerCore()
+			if err := core.ImportPipeline(tt.pipeline); err != nil {
+				t.Fatalf("ImportPipeline failed: %v", err)
+			}
+			if core.IsLineSafe() {
+				t.Error("Expected the pipeline not to be line-safe")
+			}
+			expectStreamMatchesBuffered(t, core)
+		})
+	}
+}
+
+// TestProcessStreamWritesIncrementally tests that output is written before the input ends
+func TestProcessStreamWritesIncrementally(t *testing.T) {
+	core := NewTextCleanerCore()
+	core.CreateNode("operation", "Upper", "Uppercase", "", "", "")
+
+	inputReader, inputWriter := io.Pipe()
+	outputReader, outputWriter := io.Pipe()
+	done := make(chan error, 1)
+	go func() {
+		done <- core.ProcessStream(inputReader, outputWriter)
+		outputWriter.Close()
+	}()
+
+	// The first line is written once the next line with text shows it is complete
+	go io.WriteString(inputWriter, "first\nsecond\n")
+	buf := make([]byte, 64)
+	read := make(chan string, 1)
+	go func() {
+		n, _ := outputReader.Read(buf)
+		read <- string(buf[:n])
+	}()
+	select {
+	case got := <-read:
+		if got != "FIRST" {
+			t.Errorf("Expected: %q, Got: %q", "FIRST", got)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Timed out waiting for the first line's output")
+	}
+
+	inputWriter.Close()
+	rest, _ := io.ReadAll(outputReader)
+	if string(rest) != "\nSECOND\n" {
+		t.Errorf("Expected: %q, Got: %q", "\nSECOND\n", string(rest))
+	}
+	if err := <-done; err != nil {
+		t.Errorf("ProcessStream failed: %v", err)
+	}
+}
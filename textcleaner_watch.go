@@ -0,0 +1,115 @@
+package main
+
+import (
+	"context"
+	"os"
+	"time"
+)
+
+// Default timings for FileWatcher
+const (
+	DefaultWatchPollInterval = 250 * time.Millisecond
+	DefaultWatchDebounce     = 200 * time.Millisecond
+)
+
+// FileWatcher reruns a core's pipeline on a file each time the file changes
+type FileWatcher struct {
+	core         *TextCleanerCore
+	path         string
+	pollInterval time.Duration // How often the file's modification time and size are checked
+	debounce     time.Duration // How long the file must stay unchanged before it is processed
+}
+
+// NewFileWatcher creates a watcher that feeds path through the core's pipeline
+func NewFileWatcher(core *TextCleanerCore, path string) *FileWatcher {
+	return &FileWatcher{
+		core:         core,
+		path:         path,
+		pollInterval: DefaultWatchPollInterval,
+		debounce:     DefaultWatchDebounce,
+	}
+}
+
+// SetPollInterval sets how often the file is checked for changes
+func (w *FileWatcher) SetPollInterval(interval time.Duration) {
+	w.pollInterval = interval
+}
+
+// SetDebounce sets how long the file must stay unchanged before a change is reported
+// Editors often save in several writes, so this avoids processing half-written files
+func (w *FileWatcher) SetDebounce(debounce time.Duration) {
+	w.debounce = debounce
+}
+
+// Changes polls the file until ctx is done and signals each time it has changed
+// and then stayed unchanged for the debounce time
+func (w *FileWatcher) Changes(ctx context.Context) <-chan struct{} {
+	changes := make(chan struct{}, 1)
+
+	go func() {
+		ticker := time.NewTicker(w.pollInterval)
+		defer ticker.Stop()
+
+		last, _ := os.Stat(w.path)
+		var changedAt time.Time // When the latest unreported change was seen, zero if none
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case now := <-ticker.C:
+				info, err := os.Stat(w.path)
+				if err != nil {
+					// The file may be replaced mid-save; wait for it to come back
+					continue
+				}
+
+				if last == nil || info.ModTime() != last.ModTime() || info.Size() != last.Size() {
+					last = info
+					changedAt = now
+					continue
+				}
+
+				if !changedAt.IsZero() && now.Sub(changedAt) >= w.debounce {
+					changedAt = time.Time{}
+					select {
+					case changes <- struct{}{}:
+					default:
+						// A change is already waiting to be processed
+					}
+				}
+			}
+		}
+	}()
+
+	return changes
+}
+
+// Process runs the file's current contents through the pipeline
+func (w *FileWatcher) Process() (string, error) {
+	data, err := os.ReadFile(w.path)
+	if err != nil {
+		return "", err
+	}
+
+	w.core.SetInputText(string(data))
+	return w.core.GetOutputTextWithError()
+}
+
+// Run processes the file once and then again on every signal from changes, until ctx is done
+// Each result is passed to emit
+func (w *FileWatcher) Run(ctx context.Context, changes <-chan struct{}, emit func(output string, err error)) {
+	emit(w.Process())
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case _, ok := <-changes:
+			if !ok {
+				return
+			}
+			emit(w.Process())
+		}
+	}
+}
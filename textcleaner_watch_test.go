@@ -0,0 +1,100 @@
+package main
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// TestFileWatcherReprocessesOnChange tests that each change signal reruns the pipeline on the new contents
+func TestFileWatcherReprocessesOnChange(t *testing.T) {
+	core := NewTextCleanerCore()
+	core.CreateNode("operation", "Upper", "Uppercase", "", "", "")
+
+	path := filepath.Join(t.TempDir(), "notes.txt")
+	if err := os.WriteFile(path, []byte("first"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	// Stand in for the polling watcher, so the test decides when the file "changed"
+	changes := make(chan struct{})
+	outputs := make(chan string)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		NewFileWatcher(core, path).Run(ctx, changes, func(output string, err error) {
+			if err != nil {
+				t.Errorf("Unexpected error: %v", err)
+			}
+			outputs <- output
+		})
+	}()
+
+	expectOutput := func(expected string) {
+		t.Helper()
+		select {
+		case got := <-outputs:
+			if got != expected {
+				t.Errorf("Expected: %q, Got: %q", expected, got)
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("Timed out waiting for %q", expected)
+		}
+	}
+
+	expectOutput("FIRST")
+	for _, text := range []string{"second", "third"} {
+		if err := os.WriteFile(path, []byte(text), 0600); err != nil {
+			t.Fatal(err)
+		}
+		changes <- struct{}{}
+		expectOutput(strings.ToUpper(text))
+	}
+
+	cancel()
+	<-done
+	if got := core.GetInputText(); got != "third" {
+		t.Errorf("Expected the last write to be the input text, got %q", got)
+	}
+}
+
+// TestFileWatcherDebounce tests that several quick writes are reported as one change
+func TestFileWatcherDebounce(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "notes.txt")
+	if err := os.WriteFile(path, []byte("a"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	watcher := NewFileWatcher(NewTextCleanerCore(), path)
+	watcher.SetPollInterval(5 * time.Millisecond)
+	watcher.SetDebounce(50 * time.Millisecond)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	changes := watcher.Changes(ctx)
+
+	for _, text := range []string{"ab", "abc", "abcd"} {
+		if err := os.WriteFile(path, []byte(text), 0600); err != nil {
+			t.Fatal(err)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	select {
+	case <-changes:
+	case <-time.After(time.Second):
+		t.Fatal("Expected a change to be reported")
+	}
+
+	select {
+	case <-changes:
+		t.Error("Expected the quick writes to be reported once")
+	case <-time.After(150 * time.Millisecond):
+	}
+}